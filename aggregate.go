@@ -0,0 +1,65 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	"fmt"
+
+	"github.com/leibnewton/oto/internal/backend"
+)
+
+// CreateAggregateDevice creates an aggregate device of the devices on macOS, e.g. to play the sound on
+// multiple interfaces at once. The devices are listed by GetDevices. The first device is the clock source,
+// and the others are drift-compensated.
+//
+// When stacked is true, the aggregate device is a multi-output device, which plays the same sound on all
+// the devices. Otherwise, the channels of the devices are concatenated, and the sound is played on the
+// first channels, i.e. on the first device.
+//
+// Pass the returned Device to Options.Device to play on it. The aggregate device is private to the
+// process, and is destroyed by DestroyAggregateDevice or when the process exits. An existing aggregate
+// device, e.g. created in Audio MIDI Setup, is listed by GetDevices and is opened as any other device.
+//
+// CreateAggregateDevice returns an error on the other platforms.
+func CreateAggregateDevice(name string, devices []*Device, stacked bool) (*Device, error) {
+	if len(devices) == 0 {
+		return nil, fmt.Errorf("oto: an aggregate device needs at least one device")
+	}
+	b, ok := backend.Lookup(driverName)
+	if !ok || b.CreateAggregateDevice == nil {
+		return nil, errNoAggregateDevices
+	}
+	ds := make([]*backend.Device, len(devices))
+	for i, d := range devices {
+		ds[i] = d.backendDevice()
+	}
+	d, err := b.CreateAggregateDevice(name, ds, stacked)
+	if err != nil {
+		return nil, err
+	}
+	return deviceFromBackend(d), nil
+}
+
+// DestroyAggregateDevice destroys the aggregate device created by CreateAggregateDevice. The device must
+// not be used by a Context.
+func DestroyAggregateDevice(device *Device) error {
+	b, ok := backend.Lookup(driverName)
+	if !ok || b.DestroyAggregateDevice == nil {
+		return errNoAggregateDevices
+	}
+	return b.DestroyAggregateDevice(device.backendDevice())
+}
+
+var errNoAggregateDevices = fmt.Errorf("oto: aggregate devices are supported only on macOS")
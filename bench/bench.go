@@ -0,0 +1,94 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+// Package bench offers a synthetic driver and signals to measure the performance of Oto's playing path
+// without an audio device.
+//
+// Sink is a driver that consumes the mixed samples as fast as the Context writes them. The benchmarks in
+// this package play fixed signals through a real Context and its Players into a Sink, so that they
+// measure the code that applications run, and the results are comparable between revisions:
+//
+//	go test -bench . -benchmem github.com/leibnewton/oto/bench
+package bench
+
+import (
+	"math"
+	"sync/atomic"
+
+	"github.com/leibnewton/oto/driver"
+)
+
+// Sine is a deterministic signal of a sine wave in signed 16bit little endian. Sine never ends.
+type Sine struct {
+	channelNum int
+	step       float64
+	pos        int64
+}
+
+// NewSine creates a new Sine with the frequency at the sample rate.
+func NewSine(channelNum, sampleRate int, freq float64) *Sine {
+	return &Sine{
+		channelNum: channelNum,
+		step:       2 * math.Pi * freq / float64(sampleRate),
+	}
+}
+
+// Read fills buf with the frame-aligned samples.
+func (s *Sine) Read(buf []byte) (int, error) {
+	bytesPerFrame := 2 * s.channelNum
+	n := len(buf) / bytesPerFrame * bytesPerFrame
+	for i := 0; i < n; i += bytesPerFrame {
+		v := int16(math.Sin(s.step*float64(s.pos)) * 0.3 * math.MaxInt16)
+		for ch := 0; ch < s.channelNum; ch++ {
+			buf[i+2*ch] = byte(v)
+			buf[i+2*ch+1] = byte(v >> 8)
+		}
+		s.pos++
+	}
+	return n, nil
+}
+
+// Sink is a synthetic driver that consumes the mixed samples as fast as possible. Open is a
+// driver.OpenFunc, and is passed to oto.SetDriverForTesting or driver.Register:
+//
+//	s := &bench.Sink{}
+//	defer oto.SetDriverForTesting(s.Open)()
+type Sink struct {
+	bytes int64
+}
+
+// Open opens the Sink. The Sink counts the bytes written through all the opened drivers.
+func (s *Sink) Open(params driver.Params) (driver.Driver, error) {
+	return &sinkDriver{s: s}, nil
+}
+
+// Bytes returns the number of bytes written to the Sink.
+func (s *Sink) Bytes() int64 {
+	return atomic.LoadInt64(&s.bytes)
+}
+
+// sinkDriver is an opened Sink.
+type sinkDriver struct {
+	s *Sink
+}
+
+func (d *sinkDriver) TryWrite(data []byte) (int, error) {
+	atomic.AddInt64(&d.s.bytes, int64(len(data)))
+	return len(data), nil
+}
+
+func (d *sinkDriver) Close() error {
+	return nil
+}
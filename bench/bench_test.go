@@ -0,0 +1,158 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package bench_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/leibnewton/oto"
+	"github.com/leibnewton/oto/bench"
+	"github.com/leibnewton/oto/internal/dsp"
+)
+
+const (
+	channelNum = 2
+	sampleRate = 48000
+
+	// periodSize is 10ms of stereo signed 16bit samples at 48000Hz.
+	periodSize = sampleRate / 100 * channelNum * 2
+	bufferSize = 4 * periodSize
+)
+
+// newContext creates a Context that plays into s.
+func newContext(tb testing.TB, s *bench.Sink) (*oto.Context, func()) {
+	restore := oto.SetDriverForTesting(s.Open)
+	c, err := oto.NewContextFromOptions(&oto.Options{
+		SampleRate:        sampleRate,
+		ChannelNum:        channelNum,
+		Format:            oto.FormatSignedInt16LE,
+		BufferSizeInBytes: bufferSize,
+		PeriodFrames:      periodSize / (channelNum * 2),
+		CloseMode:         oto.ImmediateClose,
+	})
+	if err != nil {
+		restore()
+		tb.Fatal(err)
+	}
+	return c, func() {
+		c.Close()
+		restore()
+	}
+}
+
+func TestSink(t *testing.T) {
+	s := &bench.Sink{}
+	c, done := newContext(t, s)
+	defer done()
+
+	p := c.NewPlayer()
+	defer p.Close()
+	buf := make([]byte, 10*periodSize)
+	bench.NewSine(channelNum, sampleRate, 440).Read(buf)
+	if _, err := p.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	// The Context keeps writing periods, filled with silence when the Player lacks data.
+	deadline := time.Now().Add(5 * time.Second)
+	for s.Bytes() < int64(len(buf)) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Bytes(): got: %d, want: >= %d", s.Bytes(), len(buf))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// BenchmarkWrite measures the throughput of a Player's Write with the small chunks of 20ms frames,
+// including the mixing by the Context.
+func BenchmarkWrite(b *testing.B) {
+	const chunkSize = 2 * periodSize
+
+	c, done := newContext(b, &bench.Sink{})
+	defer done()
+	p := c.NewPlayer()
+	defer p.Close()
+
+	chunk := make([]byte, chunkSize)
+	bench.NewSine(channelNum, sampleRate, 440).Read(chunk)
+	b.ReportAllocs()
+	b.SetBytes(chunkSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := p.Write(chunk); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkMix measures how the mixing scales with the number of Players. Each iteration writes one
+// period to every Player, and the Writes block until the Context has mixed the earlier periods.
+func BenchmarkMix(b *testing.B) {
+	for _, n := range []int{1, 2, 4, 8, 16, 32} {
+		b.Run(fmt.Sprintf("players=%d", n), func(b *testing.B) {
+			c, done := newContext(b, &bench.Sink{})
+			defer done()
+
+			ps := make([]*oto.Player, n)
+			for i := range ps {
+				ps[i] = c.NewPlayer()
+				defer ps[i].Close()
+			}
+			buf := make([]byte, periodSize)
+			bench.NewSine(channelNum, sampleRate, 440).Read(buf)
+			b.ReportAllocs()
+			b.SetBytes(periodSize)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for _, p := range ps {
+					if _, err := p.Write(buf); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkConvert measures the conversion kernels for one period.
+func BenchmarkConvert(b *testing.B) {
+	const samples = periodSize / 2
+
+	in := make([]byte, periodSize)
+	bench.NewSine(channelNum, sampleRate, 440).Read(in)
+	f := make([]float32, samples)
+	out := make([]byte, periodSize)
+
+	b.Run("Int16sToFloat32s", func(b *testing.B) {
+		b.SetBytes(periodSize)
+		for i := 0; i < b.N; i++ {
+			dsp.Int16sToFloat32s(f, in)
+		}
+	})
+	b.Run("Float32sToInt16s", func(b *testing.B) {
+		b.SetBytes(periodSize)
+		for i := 0; i < b.N; i++ {
+			dsp.Float32sToInt16s(out, f)
+		}
+	})
+	b.Run("Scale", func(b *testing.B) {
+		b.SetBytes(4 * samples)
+		for i := 0; i < b.N; i++ {
+			dsp.Scale(f, 0.5)
+		}
+	})
+}
@@ -0,0 +1,90 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	"time"
+
+	"github.com/leibnewton/oto/internal/backend"
+)
+
+// Capabilities represents what the driver of a Context supports.
+type Capabilities struct {
+	// Pause is whether Players can be paused. Oto pauses Players by itself, so this is always true.
+	Pause bool
+
+	// Float is whether the driver accepts float samples.
+	Float bool
+
+	// MinLatency is the shortest buffer that the driver works with stably. This is a rough value
+	// and might differ by the device.
+	MinLatency time.Duration
+
+	// DeviceSwitch is whether the output device can be chosen by Options.Device.
+	DeviceSwitch bool
+
+	// DeviceVolume is whether the volume of the device can be set by Context.SetDeviceVolume, and
+	// DeviceStereoVolume is whether the left and the right channels can be set separately.
+	DeviceVolume       bool
+	DeviceStereoVolume bool
+
+	// DeviceRate and DevicePitch are whether Context.SetDeviceRate and Context.SetDevicePitch are
+	// applied by the device instead of the software.
+	DeviceRate  bool
+	DevicePitch bool
+}
+
+// Driver returns the name of the driver that the Context uses, e.g. "winmm". This is "dummy" when the
+// dummy driver is used, including when no device is available.
+func (c *Context) Driver() string {
+	if c.driverWriter.isDummy() {
+		return dummyDriverName
+	}
+	return c.options.resolvedDriverName()
+}
+
+// Capabilities returns the capabilities of the driver that the Context uses. The capabilities of a
+// driver registered to the package driver are unknown, and only Pause is reported.
+func (c *Context) Capabilities() Capabilities {
+	var caps Capabilities
+	if b, ok := backend.Lookup(c.options.resolvedDriverName()); ok && !c.driverWriter.isDummy() {
+		caps.Float = b.Capabilities.Float
+		caps.MinLatency = b.Capabilities.MinLatency
+		caps.DeviceSwitch = b.Capabilities.DeviceSwitch
+	}
+	caps.Pause = true
+	d := c.driverWriter
+	d.m.Lock()
+	if v := d.deviceVolumer(); v != nil {
+		caps.DeviceVolume, caps.DeviceStereoVolume = v.DeviceVolumeSupport()
+	}
+	if r := d.deviceRater(); r != nil {
+		caps.DeviceRate, caps.DevicePitch = r.DeviceRateSupport()
+	}
+	d.m.Unlock()
+	return caps
+}
+
+func (d *driverWriter) isDummy() bool {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	driver := d.driver
+	if c, ok := driver.(*convertingDriver); ok {
+		driver = c.driver
+	}
+	_, ok := driver.(*backend.Dummy)
+	return ok
+}
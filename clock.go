@@ -0,0 +1,76 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// maxRateTrim is the maximum deviation of the playback rate by Player.SetRateTrim in parts per million.
+const maxRateTrim = 5000
+
+// ClockSample is a reading of the audio clock of a Context. See Context.Clock.
+type ClockSample struct {
+	// Frames is the number of the mixed frames that have been heard at Time.
+	Frames int64
+
+	// Time is the wall clock time when the frame Frames is heard.
+	Time time.Time
+}
+
+// Clock returns the audio clock of the Context: the mixed frame being heard now by the device's counter.
+// The frames mixed after it are heard one after another at the sample rate, so a frame f is heard at
+// Time plus the duration of f - Frames frames. Time includes the latency of the output device where the
+// platform reports it. See Latency.
+//
+// The clock is the base of the synchronized playback across machines with StartAt and
+// Player.SetRateTrim. See the multiroom package for an example.
+func (c *Context) Clock() ClockSample {
+	now := time.Now()
+	frames := c.driverWriter.playedFrames()
+	return ClockSample{
+		Frames: frames,
+		Time:   now.Add(c.outputLatency()),
+	}
+}
+
+// SetRateTrim adjusts the playback rate of the Player by ppm parts per million on top of SetRate, e.g.
+// to follow the clock of another machine. A positive ppm plays faster. The trim is clamped to ±5000 ppm
+// (0.5%), and 0 is the default.
+//
+// The trim resamples the data like SetRate without the pitch preservation, and changes the pitch slightly,
+// which is not audible.
+func (p *Player) SetRateTrim(ppm float64) {
+	if math.IsNaN(ppm) {
+		ppm = 0
+	}
+	ppm = math.Max(-maxRateTrim, math.Min(maxRateTrim, ppm))
+	var v uint32
+	if ppm != 0 {
+		v = math.Float32bits(float32(1 + ppm/1e6))
+	}
+	atomic.StoreUint32(&p.source.rateTrim, v)
+}
+
+// RateTrim returns the trim of the playback rate of the Player in parts per million.
+func (p *Player) RateTrim() float64 {
+	v := atomic.LoadUint32(&p.source.rateTrim)
+	if v == 0 {
+		return 0
+	}
+	return (float64(math.Float32frombits(v)) - 1) * 1e6
+}
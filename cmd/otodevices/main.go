@@ -0,0 +1,104 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// otodevices lists the output devices that Oto can use, and the capabilities of the driver.
+//
+// Usage:
+//
+//	otodevices [flags]
+//
+// The devices are listed only on Windows for now. On the other platforms, Oto always uses the default
+// device. Capture devices are not listed since Oto doesn't record sound.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/leibnewton/oto"
+)
+
+var (
+	flagMapper = flag.Bool("mapper", true, "include the default device (-1)")
+	flagCaps   = flag.Bool("caps", true, "open the default device and print the capabilities of the driver")
+)
+
+func printDevices() error {
+	devs, err := oto.GetDevices(*flagMapper)
+	if err != nil {
+		return err
+	}
+	if len(devs) == 0 {
+		fmt.Println("No devices are listed. Oto uses the default device of the platform.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tCHANNELS\tMID:PID")
+	for _, d := range devs {
+		name := d.Name
+		if d.Number < 0 {
+			name += " (default)"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%d\t%d:%d\n", d.Number, name, d.Channels, d.Mid, d.Pid)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	for _, d := range devs {
+		fmt.Printf("\n%d: %s\n", d.Number, d.Name)
+		fmt.Printf("  formats:  %v\n", d.Formats)
+		fmt.Printf("  supports: %v\n", d.Support)
+	}
+	return nil
+}
+
+func printCapabilities() error {
+	c, err := oto.NewContextFromOptions(&oto.Options{
+		CloseMode: oto.ImmediateClose,
+	})
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	caps := c.Capabilities()
+	f := c.DeviceFormat()
+	fmt.Printf("\ndriver: %s\n", c.Driver())
+	fmt.Printf("  device format:  %d Hz, %d channels, %v\n", f.SampleRate, f.ChannelNum, f.Format)
+	fmt.Printf("  min latency:    %v\n", caps.MinLatency)
+	fmt.Printf("  float samples:  %t\n", caps.Float)
+	fmt.Printf("  pause:          %t\n", caps.Pause)
+	fmt.Printf("  device switch:  %t\n", caps.DeviceSwitch)
+	return c.Close()
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("otodevices: ")
+	flag.Parse()
+
+	if err := printDevices(); err != nil {
+		log.Fatal(err)
+	}
+	if *flagCaps {
+		if err := printCapabilities(); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
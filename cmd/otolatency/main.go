@@ -0,0 +1,103 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// otolatency measures the latency that Oto adds with the buffer settings, by playing a chirp and finding
+// it in the recording of the output.
+//
+// Usage:
+//
+//	otolatency [flags]
+//
+// Oto doesn't record sound, so otolatency plays to the in-memory driver of the ototest package and
+// records the output by its loopback Recorder. The driver plays in real time like a device, so the result
+// is the latency of the Context's buffers, without the latency of the OS and the device. Compare the
+// results with different flags to choose the buffer settings.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/leibnewton/oto"
+	"github.com/leibnewton/oto/latency"
+	"github.com/leibnewton/oto/ototest"
+)
+
+var (
+	flagSampleRate = flag.Int("samplerate", 48000, "sample rate")
+	flagChannelNum = flag.Int("channelnum", 2, "number of channels")
+	flagBuffer     = flag.Duration("buffer", 0, "buffer duration (0 for the default)")
+	flagPeriod     = flag.Duration("period", 0, "period duration (0 for the default)")
+	flagLowLatency = flag.Bool("lowlatency", false, "use the low latency settings for the unspecified buffer and period")
+	flagCount      = flag.Int("n", 3, "number of measurements")
+)
+
+func run() error {
+	flag.Parse()
+
+	d := ototest.NewDriver()
+	defer oto.SetDriverForTesting(d.Open)()
+
+	opts := []oto.Option{
+		oto.WithFormat(*flagSampleRate, *flagChannelNum, oto.FormatSignedInt16LE),
+		oto.WithBufferDuration(*flagBuffer),
+		func(o *oto.Options) {
+			o.PeriodDuration = *flagPeriod
+			o.CloseMode = oto.ImmediateClose
+		},
+	}
+	if *flagLowLatency {
+		opts = append(opts, oto.WithLowLatency())
+	}
+	c, err := oto.NewContextWithOptions(opts...)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	p := c.NewPlayer()
+	defer p.Close()
+
+	params := d.Params()
+	fmt.Printf("buffer: %d frames, period: %d frames\n", params.BufferFrames, params.PeriodFrames)
+
+	format := latency.Format{
+		SampleRate:     *flagSampleRate,
+		ChannelNum:     *flagChannelNum,
+		BytesPerSample: 2,
+	}
+	var total time.Duration
+	for i := 0; i < *flagCount; i++ {
+		l, err := latency.Measure(p, format, d.NewRecorder())
+		if err != nil {
+			return err
+		}
+		fmt.Printf("latency: %v\n", l)
+		total += l
+	}
+	if *flagCount > 1 {
+		fmt.Printf("average: %v\n", total/time.Duration(*flagCount))
+	}
+	return nil
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("otolatency: ")
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// otoplay plays a WAV file or a raw PCM file through Oto.
+//
+// Usage:
+//
+//	otoplay [flags] file
+//
+// A file whose name ends with .wav is played as a WAV file, and the format is taken from its header.
+// Other files are played as raw PCM with the format specified by the flags.
+//
+// otoplay helps to find whether a problem is in Oto or in the application: if a file plays correctly
+// with otoplay, the driver and the device work with the same settings.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/leibnewton/oto"
+	"github.com/leibnewton/oto/downmix"
+	"github.com/leibnewton/oto/wav"
+)
+
+var (
+	flagDevice     = flag.Int("device", -1, "device number (-1 for the default device)")
+	flagDriver     = flag.String("driver", "", `driver name (empty for the default driver, or "dummy")`)
+	flagBuffer     = flag.Duration("buffer", 0, "buffer duration (0 for the default)")
+	flagSampleRate = flag.Int("samplerate", 44100, "sample rate of raw PCM")
+	flagChannelNum = flag.Int("channelnum", 2, "number of channels of raw PCM")
+	flagFormat     = flag.String("format", "s16le", `sample format of raw PCM: "s16le" or "u8"`)
+	flagVerbose    = flag.Bool("v", false, "print the diagnostic events")
+)
+
+type format struct {
+	sampleRate int
+	channelNum int
+	format     oto.Format
+}
+
+func parseFormat(s string) (oto.Format, error) {
+	switch s {
+	case "s16le":
+		return oto.FormatSignedInt16LE, nil
+	case "u8":
+		return oto.FormatUnsignedInt8, nil
+	}
+	return 0, fmt.Errorf("unknown format: %q", s)
+}
+
+func run() error {
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	file, err := os.Open(flag.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var src io.Reader = file
+	var f format
+	if strings.EqualFold(filepath.Ext(file.Name()), ".wav") {
+		r, err := wav.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("%s: %v", file.Name(), err)
+		}
+		f.sampleRate = r.Format.SampleRate
+		f.channelNum = r.Format.ChannelNum
+		if r.Format.BytesPerSample == 1 {
+			f.format = oto.FormatUnsignedInt8
+		} else {
+			f.format = oto.FormatSignedInt16LE
+		}
+		src = r
+		if f.channelNum > 2 {
+			// Oto plays mono or stereo. Mix the surround channels into stereo.
+			m, err := downmix.Standard(f.channelNum, 2, 0)
+			if err != nil {
+				return fmt.Errorf("%s: %v", file.Name(), err)
+			}
+			d, err := downmix.NewReader(r, m, r.Format.BytesPerSample)
+			if err != nil {
+				return err
+			}
+			src = d
+			f.channelNum = 2
+		}
+	} else {
+		f.sampleRate = *flagSampleRate
+		f.channelNum = *flagChannelNum
+		f.format, err = parseFormat(*flagFormat)
+		if err != nil {
+			return err
+		}
+	}
+
+	if *flagVerbose {
+		oto.SetLogger(oto.LoggerFunc(func(e oto.Event) {
+			if e.Err != nil {
+				log.Printf("%s: %s: %s: %v", e.Driver, e.Kind, e.Message, e.Err)
+				return
+			}
+			log.Printf("%s: %s: %s", e.Driver, e.Kind, e.Message)
+		}))
+	}
+
+	var device *oto.Device
+	if *flagDevice >= 0 {
+		device = &oto.Device{Number: *flagDevice}
+	}
+	c, err := oto.NewContextFromOptions(&oto.Options{
+		Driver:         *flagDriver,
+		Device:         device,
+		SampleRate:     f.sampleRate,
+		ChannelNum:     f.channelNum,
+		Format:         f.format,
+		BufferDuration: *flagBuffer,
+	})
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if *flagVerbose {
+		d := c.DeviceFormat()
+		log.Printf("driver: %s, device format: %d Hz, %d channels, %v", c.Driver(), d.SampleRate, d.ChannelNum, d.Format)
+	}
+
+	start := time.Now()
+	p := c.NewPlayer()
+	n, err := io.Copy(p, src)
+	if err != nil {
+		return err
+	}
+	// Closing the Context plays the rest of the data in the Player, and then closes the Player.
+	if err := c.Close(); err != nil {
+		return err
+	}
+
+	if *flagVerbose {
+		s := c.Stats()
+		log.Printf("played %d bytes in %v: %d underruns, %d player underruns", n, time.Since(start).Round(time.Millisecond), s.Underruns, s.PlayerUnderruns)
+	}
+	return nil
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("otoplay: ")
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -15,11 +15,15 @@
 package oto
 
 import (
-	"errors"
 	"io"
+	"math"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	otodriver "github.com/leibnewton/oto/driver"
+	"github.com/leibnewton/oto/internal/backend"
 	"github.com/leibnewton/oto/internal/mux"
 )
 
@@ -30,34 +34,136 @@ import (
 //
 // There can only be one context at any time. Closing a context and opening a new one is allowed.
 type Context struct {
+	*contextState
+}
+
+// contextState is the state of a Context. The loop and the global variables refer to the contextState
+// instead of the Context, so that the Context is garbage-collected when it is not closed and the leak is
+// reported.
+type contextState struct {
+	// playerIDs is the number of the Players created, which is accessed atomically. playerIDs comes first
+	// so that it is aligned on 32-bit platforms.
+	playerIDs int64
+
 	driverWriter *driverWriter
 	mux          *mux.Mux
 	errCh        chan error
+	options      *Options
+
+	// done is closed when the loop feeding the device finishes.
+	done chan struct{}
+
+	closeM sync.Mutex
+	closed bool
+
+	// meter holds the levels of the mixed sound.
+	meter *meter
+
+	// interrupted is the set of the reasons why all the Players are paused, e.g. the loss of the audio
+	// focus. It is shared with the Players' sources.
+	interrupted int32
+
+	// focusM guards ducked and moving. moving is whether the sound is faded out to switch the device.
+	focusM sync.Mutex
+	ducked bool
+	moving bool
+
+	// moveM serializes SetDevice.
+	moveM sync.Mutex
+
+	// stopMetrics is closed when the Context is closed to stop reporting the metrics.
+	stopMetrics chan struct{}
+
+	// stack is where the Context was created, which is recorded only when Options.OnLeak is set.
+	stack string
+
+	// driverAttempts is the drivers in Options.Drivers that failed to open.
+	driverAttempts []DriverAttempt
+
+	// pauseM serializes pausing and restarting the device, and pauseStopped is whether the device is not
+	// paused any more since the Context is closing. See updateDevicePause.
+	pauseM       sync.Mutex
+	pauseStopped bool
+
+	// closedSnapshot is the Snapshot taken at Close.
+	closedSnapshot *Snapshot
+
+	// loops is the Loops played by PlayLoop that are not closed yet.
+	loopsM sync.Mutex
+	loops  map[*Loop]struct{}
 }
 
+// Device is an output device listed by GetDevices.
 type Device struct {
 	Name     string
 	Number   int
 	Channels int
 	Mid      uint16
 	Pid      uint16
-	Formats  uint32
-	Support  uint32
+	Formats  WaveFormats
+	Support  WaveSupport
 }
 
 func GetDevices(mapperInclude bool) ([]*Device, error) {
-	return getDevices(mapperInclude)
+	b, ok := backend.Lookup(driverName)
+	if !ok || b.Devices == nil {
+		return nil, nil
+	}
+	ds, err := b.Devices(mapperInclude)
+	if err != nil {
+		return nil, err
+	}
+	devices := make([]*Device, len(ds))
+	for i, d := range ds {
+		devices[i] = deviceFromBackend(d)
+	}
+	return devices, nil
+}
+
+// deviceFromBackend returns the Device of a device listed by a built-in driver.
+func deviceFromBackend(d *backend.Device) *Device {
+	return &Device{
+		Name:     d.Name,
+		Number:   d.Number,
+		Channels: d.Channels,
+		Mid:      d.Mid,
+		Pid:      d.Pid,
+		Formats:  WaveFormats(d.Formats),
+		Support:  WaveSupport(d.Support),
+	}
+}
+
+func (d *Device) backendDevice() *backend.Device {
+	return &backend.Device{
+		Name:     d.Name,
+		Number:   d.Number,
+		Channels: d.Channels,
+		Mid:      d.Mid,
+		Pid:      d.Pid,
+		Formats:  uint32(d.Formats),
+		Support:  uint32(d.Support),
+	}
 }
 
 var (
-	theContext *Context
+	theContext *contextState
 	contextM   sync.Mutex
 )
 
-var errClosed = errors.New("closed")
+// currentContext returns the Context that is not closed yet, or nil.
+func currentContext() *Context {
+	contextM.Lock()
+	defer contextM.Unlock()
+	if theContext == nil {
+		return nil
+	}
+	return &Context{theContext}
+}
 
 // NewContext creates a new context, that creates and holds ready-to-use Player objects.
 //
+// The deviceNum argument specifies the device number. -1 means the default device.
+//
 // The sampleRate argument specifies the number of samples that should be played during one second.
 // Usual numbers are 44100 or 48000.
 //
@@ -72,63 +178,311 @@ var errClosed = errors.New("closed")
 // of Player's Write calls, thus reducing CPU time. Smaller buffer enables more precise timing. The
 // longest delay between when samples were written and when they started playing is equal to the size
 // of the buffer.
+//
+// NewContext is a shorthand of NewContextFromOptions.
 func NewContext(deviceNum, sampleRate, channelNum, bitDepthInBytes, bufferSizeInBytes int) (*Context, error) {
+	format, err := formatFromBitDepthInBytes(bitDepthInBytes)
+	if err != nil {
+		return nil, err
+	}
+	var device *Device
+	if deviceNum >= 0 {
+		device = &Device{Number: deviceNum}
+	}
+	return NewContextFromOptions(&Options{
+		Device:            device,
+		SampleRate:        sampleRate,
+		ChannelNum:        channelNum,
+		Format:            format,
+		BufferSizeInBytes: bufferSizeInBytes,
+	})
+}
+
+// NewContextFromOptions creates a new context with the given options. nil options mean the default values
+// of all the options.
+//
+// See the documentation of Options for the details.
+func NewContextFromOptions(options *Options) (*Context, error) {
 	contextM.Lock()
 	defer contextM.Unlock()
 
 	if theContext != nil {
+		if theContext.stack != "" {
+			panic("oto: NewContext can be called only once; the current context was created at:\n" + theContext.stack)
+		}
 		panic("oto: NewContext can be called only once")
 	}
+	return newContextFromOptions(options)
+}
 
-	d, err := newDriver(deviceNum, sampleRate, channelNum, bitDepthInBytes, bufferSizeInBytes)
+// newContextFromOptions creates a new context with the given options. contextM must be locked, and there
+// must be no other context.
+func newContextFromOptions(options *Options) (*Context, error) {
+	o, err := options.resolve()
 	if err != nil {
 		return nil, err
 	}
+
+	d, attempts, err := openFirstDriver(o)
+	if err != nil {
+		return nil, err
+	}
+	var dump *debugDump
+	if o.DebugDumpPath != "" {
+		dump, err = newDebugDump(o.DebugDumpPath, o)
+		if err != nil {
+			d.Close()
+			return nil, err
+		}
+	}
+
+	flushSize := o.FlushFrames * o.bytesPerFrame()
 	dw := &driverWriter{
+		dump:           dump,
 		driver:         d,
-		bufferSize:     bufferSizeInBytes,
-		bytesPerSecond: sampleRate * channelNum * bitDepthInBytes,
+		options:        o,
+		bufferSize:     o.BufferSizeInBytes,
+		flushSize:      flushSize,
+		pending:        make([]byte, 0, flushSize),
+		bytesPerSecond: o.SampleRate * o.bytesPerFrame(),
+		outputShift:    outputShift{rate: math.Float32bits(1)},
+		closing:        make(chan struct{}),
 	}
-	c := &Context{
+	// Close can cancel the first write.
+	dw.storeDriver()
+	state := &contextState{
 		driverWriter: dw,
-		mux:          mux.New(channelNum, bitDepthInBytes),
+		mux:          mux.New(o.ChannelNum, o.Format.BytesPerSample()),
 		errCh:        make(chan error, 1),
+		options:      o,
+		done:         make(chan struct{}),
+		stopMetrics:  make(chan struct{}),
+		meter:        newMeter(o.ChannelNum, o.OnLevels),
+		stack:        creationStack(o),
+
+		driverAttempts: attempts,
+	}
+	// The goroutines below use their own Context for the same state, so that they don't keep c alive.
+	c := &Context{state}
+	runtime.SetFinalizer(c, (*Context).finalize)
+	c.mux.SetRampFrames(gainRampFrames(o.SampleRate))
+	c.mux.SetMaster(o.master())
+	c.mux.SetLimiter(o.limiter())
+	c.mux.SetMonitor(c.meter)
+	if o.MetricsSink != nil {
+		go (&Context{state}).reportMetrics(c.stopMetrics)
 	}
-	theContext = c
+	theContext = state
+	// The single loop mixes all the Players and writes the result to the device period by period.
 	go func() {
+		c := &Context{state}
+
+		// This goroutine feeds the device in real time. Lock the OS thread so that the thread's
+		// priority can be raised. Failing to raise the priority is not fatal.
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		if revert, err := raiseThreadPriority(c.options); err == nil {
+			defer revert()
+		}
+
 		if _, err := io.Copy(c.driverWriter, c.mux); err != nil {
 			c.errCh <- err
 		}
 		close(c.errCh)
-		c.Close()
+		close(c.done)
+		// Nothing can be drained any more.
+		c.close(ImmediateClose)
 	}()
 	return c, nil
 }
 
+const (
+	initialBusyRetryInterval = 50 * time.Millisecond
+	maxBusyRetryInterval     = time.Second
+)
+
+// openDriver opens the driver specified by the resolved options.
+//
+// When the device is busy, openDriver retries with exponential backoff until
+// Options.BusyRetryTimeout passes. When the device doesn't support the format, openDriver tries the
+// closest format that the device supports unless Options.ExactFormat is set.
+func openDriver(options *Options) (tryWriteCloser, error) {
+	if options.Driver == dummyDriverName {
+		return backend.NewDummy(options.SampleRate, options.ChannelNum, options.Format.BytesPerSample()), nil
+	}
+
+	d, err := openDriverWithRetry(options)
+	if err != nil && !options.ExactFormat && isError(err, ErrUnsupportedFormat) {
+		d, err = negotiateFormat(options, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	logEvent(options, EventDriverOpened, nil, "opened the device: %d Hz, %d channels, %v, %d frames buffer",
+		options.SampleRate, options.ChannelNum, options.Format, options.BufferFrames)
+	return d, nil
+}
+
+func openDriverWithRetry(options *Options) (tryWriteCloser, error) {
+	deadline := time.Now().Add(options.BusyRetryTimeout)
+	interval := initialBusyRetryInterval
+	for attempt := 1; ; attempt++ {
+		d, err := newDriverByName(options)
+		if err == nil {
+			return d, nil
+		}
+		if !isError(err, ErrDeviceBusy) || !time.Now().Add(interval).Before(deadline) {
+			return nil, err
+		}
+		if options.OnDeviceBusy != nil {
+			options.OnDeviceBusy(attempt, err)
+		}
+		time.Sleep(interval)
+		interval *= 2
+		if interval > maxBusyRetryInterval {
+			interval = maxBusyRetryInterval
+		}
+	}
+}
+
 // NewPlayer creates a new, ready-to-use Player belonging to the Context.
 func (c *Context) NewPlayer() *Player {
-	return newPlayer(c)
+	p := newPlayer(c)
+	c.updateDevicePause(nil)
+	return p
+}
+
+// playerBufferSize returns the size of each Player's buffer in bytes.
+func (c *Context) playerBufferSize() int {
+	return c.options.BufferSizeInBytes
 }
 
 // Close closes the Context and its Players and frees any resources associated with it. The Context is no longer
 // usable after calling Close.
+//
+// Whether the buffered data is played before closing depends on Options.CloseMode. Close returns within
+// Options.CloseTimeout even when the driver blocks.
 func (c *Context) Close() error {
+	runtime.SetFinalizer(c, nil)
+	return c.close(c.options.CloseMode)
+}
+
+// finalize closes the Context garbage-collected without Close so that the device is released, and
+// reports the leak.
+func (c *Context) finalize() {
+	if c.isClosed() {
+		return
+	}
+	c.close(ImmediateClose)
+	reportLeak(c.options, "Context", c.stack)
+}
+
+// isClosed reports whether the Context is closed. isClosed waits for Close in progress.
+func (c *Context) isClosed() bool {
+	c.closeM.Lock()
+	defer c.closeM.Unlock()
+	return c.closed
+}
+
+func (c *Context) close(mode CloseMode) error {
+	// Close can be called from any goroutine, and the loop closes the Context on errors too. The second
+	// call waits for the first one and does nothing.
+	c.closeM.Lock()
+	defer c.closeM.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	close(c.stopMetrics)
+
 	contextM.Lock()
-	theContext = nil
+	if theContext == c.contextState {
+		theContext = nil
+	}
 	contextM.Unlock()
 
-	if err := c.driverWriter.Close(); err != nil {
-		return err
+	// The data kept in the paused device is played or dropped as usual.
+	c.endDevicePause()
+	loopErr := c.closeLoops()
+
+	deadline := time.Now().Add(c.options.CloseTimeout)
+	drain := mode == DrainThenClose
+	if drain {
+		c.drainPlayers(deadline)
+	}
+
+	// Nothing needs to be played any more. Let a driver blocking in TryWrite return.
+	if !drain {
+		c.driverWriter.cancelWrite()
+	}
+
+	// A driver call can block forever, e.g. with a misbehaving Bluetooth stack. Close the driver in
+	// another goroutine, and abandon it at the deadline.
+	var err error
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.driverWriter.Close(drain)
+	}()
+	t := time.NewTimer(time.Until(deadline))
+	select {
+	case err = <-errCh:
+		t.Stop()
+	case <-t.C:
+		c.driverWriter.cancelWrite()
+		err = &closeTimeoutError{
+			timeout: c.options.CloseTimeout,
+			stage:   c.driverWriter.closeStage(),
+		}
 	}
+
+	if loopErr != nil && err == nil {
+		err = loopErr
+	}
+
+	// Nothing is mixed any more. Keep the state so that the Players can be restored after, e.g., the
+	// device is lost.
+	c.closedSnapshot = c.snapshot()
+
+	// Close the Players even when the driver fails so that their Write never blocks.
 	for _, r := range c.mux.Sources() {
-		if err := r.(io.Closer).Close(); err != nil {
-			return err
+		if cerr := r.(io.Closer).Close(); cerr != nil && err == nil {
+			err = cerr
 		}
 	}
-	if err := c.mux.Close(); err != nil {
-		return err
+	if cerr := c.mux.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// drainPlayers waits until the data in the Players' buffers is passed to the driver. drainPlayers gives up
+// after twice the duration of the buffers, e.g. when the device is stuck, or at the deadline.
+func (c *Context) drainPlayers(deadline time.Time) {
+	bufferDuration := FramesToDuration(c.playerBufferSize()/c.options.bytesPerFrame(), c.options.SampleRate)
+	interval := bufferDuration / 16
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+	if d := time.Now().Add(2 * bufferDuration); d.Before(deadline) {
+		deadline = d
+	}
+	for time.Now().Before(deadline) {
+		empty := true
+		for _, r := range c.mux.Sources() {
+			if p, ok := r.(*playerSource); ok && p.buf.Len() > 0 {
+				empty = false
+				break
+			}
+		}
+		if empty {
+			return
+		}
+		select {
+		case <-c.done:
+			return
+		case <-time.After(interval):
+		}
 	}
-	return nil
 }
 
 type tryWriteCloser interface {
@@ -138,27 +492,178 @@ type tryWriteCloser interface {
 }
 
 type driverWriter struct {
+	// stats must be the first field for the alignment of its 64bit fields.
+	stats driverStats
+
 	driver         tryWriteCloser
+	options        *Options
 	bufferSize     int
+	flushSize      int
 	bytesPerSecond int
 
+	// lastWrite is the time of the last write with its monotonic clock reading, and lastWall is the same
+	// time without it. They are used to detect the system's sleep.
+	lastWrite time.Time
+	lastWall  time.Time
+
+	// lastProgress is the time when the driver accepted data last, which is used to detect a stall.
+	lastProgress time.Time
+
+	// checkedDriver is the driver checked by adaptBuffer last, and checkedUnderruns is its number of the
+	// underruns at that time.
+	checkedDriver    tryWriteCloser
+	checkedUnderruns int64
+
+	// pending holds the written data that is not passed to the driver yet since it is smaller than
+	// flushSize.
+	pending []byte
+
+	// dump is the debug dump of the data passed to the driver, or nil.
+	dump *debugDump
+
+	// silentBytes is the number of the silent bytes passed to the driver in a row.
+	silentBytes int64
+
+	// keepAlive is whether the driver is kept playing in the background. See Context.SetKeepAlive.
+	keepAlive bool
+
+	// closed is whether Close is called, and closing is closed at that time so that reopen stops
+	// retrying.
+	closed  bool
+	closing chan struct{}
+
+	// stage is the step of Close in progress, which is reported when Close times out.
+	stage int32
+
+	// deviceVolumeSet is whether the device volume is set by Context.SetDeviceVolume, and
+	// deviceVolumeLeft and deviceVolumeRight are the volume.
+	deviceVolumeSet   bool
+	deviceVolumeLeft  float64
+	deviceVolumeRight float64
+
+	// deviceRate and devicePitch are set by Context.SetDeviceRate and Context.SetDevicePitch, and
+	// outputShift is the part of them applied in software. deviceRate 0 means the default.
+	deviceRate  float64
+	devicePitch float64
+	outputShift outputShift
+
+	// canceler holds the driver.Canceler of the driver being written, which is accessed without d.m.
+	canceler atomic.Value
+
+	// queuer holds the queuerValue of the driver being written, and pauser holds the pauserValue. They
+	// are accessed without d.m.
+	queuer atomic.Value
+	pauser atomic.Value
+
+	// devicePaused is 1 while the device is paused by driver.Pauser.
+	devicePaused int32
+
+	// crossfade is the crossfade from the old device in progress, or nil.
+	crossfade *deviceCrossfade
+
+	// move is the request of Context.SetDevice to be handled by the loop, or nil. moveM guards move, since
+	// the loop holds d.m while the driver is writing.
+	moveM sync.Mutex
+	move  *deviceMove
+
 	m sync.Mutex
 }
 
+// The steps of driverWriter.Close.
+const (
+	closeStageNone int32 = iota
+	closeStageWaiting
+	closeStageFlushing
+	closeStageDraining
+	closeStageClosing
+)
+
+// closeStage returns the description of the step of Close in progress.
+func (d *driverWriter) closeStage() string {
+	switch atomic.LoadInt32(&d.stage) {
+	case closeStageWaiting:
+		return "waiting for the write to the device in progress"
+	case closeStageFlushing:
+		return "flushing the buffered data to the device"
+	case closeStageDraining:
+		return "waiting for the device to play the buffered data"
+	case closeStageClosing:
+		return "closing the device"
+	}
+	return "starting to close"
+}
+
+// Write writes buf to the driver. Small writes are coalesced, and the data is passed to the driver
+// only when flushSize bytes are accumulated.
 func (d *driverWriter) Write(buf []byte) (int, error) {
 	d.m.Lock()
 	defer d.m.Unlock()
 
+	if d.driver == nil {
+		return 0, ErrContextClosed
+	}
+
+	written := 0
+	if len(d.pending) > 0 {
+		n := copy(d.pending[len(d.pending):d.flushSize], buf)
+		d.pending = d.pending[:len(d.pending)+n]
+		buf = buf[n:]
+		written += n
+		if len(d.pending) < d.flushSize {
+			return written, nil
+		}
+		if _, err := d.write(d.pending); err != nil {
+			return written, err
+		}
+		d.pending = d.pending[:0]
+	}
+
+	// Pass the large enough part directly, and keep the rest.
+	l := len(buf) / d.flushSize * d.flushSize
+	n, err := d.write(buf[:l])
+	written += n
+	if err != nil {
+		return written, err
+	}
+	d.pending = append(d.pending, buf[l:]...)
+	written += len(buf) - l
+	return written, nil
+}
+
+// flush passes the pending data to the driver.
+func (d *driverWriter) flush() error {
+	if len(d.pending) == 0 {
+		return nil
+	}
+	_, err := d.write(d.pending)
+	d.pending = d.pending[:0]
+	return err
+}
+
+func (d *driverWriter) write(buf []byte) (int, error) {
+	if d.options.SuspendOnSilence > 0 && !isSilence(buf, d.options.Format) {
+		if err := d.resumeIfSuspended(); err != nil {
+			return 0, err
+		}
+	}
+	d.mixCrossfade(buf)
 	written := 0
 	for len(buf) > 0 {
 		if d.driver == nil {
-			return written, errClosed
+			return written, ErrContextClosed
 		}
+		d.storeDriver()
 		n, err := d.driver.TryWrite(buf)
+		atomic.AddInt64(&d.stats.framesPassed, int64(n/d.options.bytesPerFrame()))
+		d.dump.write(buf[:n])
+		d.trackSilence(buf[:n])
 		written += n
 		if err != nil {
 			return written, err
 		}
+		if err := d.checkStall(n); err != nil {
+			return written, err
+		}
 		buf = buf[n:]
 		// When not all buf is written, the underlying buffer is full.
 		// Mitigate the busy loop by sleeping (#10).
@@ -170,13 +675,396 @@ func (d *driverWriter) Write(buf []byte) (int, error) {
 	return written, nil
 }
 
-func (d *driverWriter) Close() error {
+// ReadFrom reads the samples from r into the driver. ReadFrom is used by io.Copy.
+func (d *driverWriter) ReadFrom(r io.Reader) (int64, error) {
+	var written int64
+	// buf is used only when the driver doesn't implement backend.BufferAcquirer.
+	var buf []byte
+	for {
+		var n int
+		var err error
+		if d.hasBufferAcquirer() {
+			n, err = d.readFrom(r)
+		} else {
+			// Fall back to the copy via the Write method. Read flushSize bytes at a time, so that the
+			// mixed samples are written to the device as soon as possible without being held in pending.
+			if len(buf) != d.flushSize {
+				buf = make([]byte, d.flushSize)
+			}
+			n, err = r.Read(buf)
+			if n > 0 {
+				var werr error
+				n, werr = d.Write(buf[:n])
+				if werr != nil {
+					err = werr
+				}
+			}
+		}
+		written += int64(n)
+		if n > 0 {
+			d.recordWrite(n)
+		}
+		if err == io.EOF {
+			return written, nil
+		}
+		if err != nil && isError(err, ErrDeviceLost) {
+			// The device might come back, e.g. after the system sleeps. Reopen it and continue with
+			// the data in the Players' buffers.
+			logEvent(d.options, EventDeviceLost, err, "the device is lost")
+			err = d.reopen(err)
+		}
+		if err == ErrDeviceStalled {
+			logEvent(d.options, EventDeviceLost, err, "the device is stalled")
+			if d.options.ReopenOnStall {
+				err = d.reopen(err)
+			}
+		}
+		if err != nil {
+			return written, err
+		}
+		if err := d.reopenAfterSleep(); err != nil {
+			return written, err
+		}
+		if err := d.reopenIfDeviceChanged(); err != nil {
+			return written, err
+		}
+		if err := d.adaptBuffer(); err != nil {
+			return written, err
+		}
+		if err := d.suspendIfSilent(); err != nil {
+			return written, err
+		}
+		if err := d.moveIfRequested(); err != nil {
+			return written, err
+		}
+	}
+}
+
+func (d *driverWriter) hasBufferAcquirer() bool {
+	d.m.Lock()
+	defer d.m.Unlock()
+	_, ok := d.driver.(backend.BufferAcquirer)
+	return ok
+}
+
+// recordWrite updates the statistics after n bytes are written.
+func (d *driverWriter) recordWrite(n int) {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	d.stats.recordWrite(n, d.options.bytesPerFrame(), d.bytesPerSecond, d.bufferSize)
+	if u, ok := d.driver.(otodriver.UnderrunCounter); ok {
+		if d.stats.recordUnderruns(u.Underruns()) {
+			logEvent(d.options, EventUnderrun, nil, "the device underran (%d in total)", d.stats.snapshot().Underruns)
+		}
+	}
+}
+
+const (
+	// systemSleepThreshold is the gap between the writes to the driver that is regarded as a sleep of
+	// the system. The writes are never paused this long otherwise.
+	systemSleepThreshold = 3 * time.Second
+
+	// reopenTimeout is how long the driver is retried to be reopened after the device is lost.
+	reopenTimeout = 10 * time.Second
+)
+
+// reopenAfterSleep reopens the driver when the system seems to have slept since the last write.
+//
+// The gap is measured in the monotonic clock, which doesn't jump when the wall clock is adjusted. The
+// monotonic clock stops while the system sleeps on some platforms, so a wall clock gap that exceeds the
+// monotonic one by the threshold is also regarded as a sleep. A backward adjustment of the wall clock
+// is never regarded as a sleep, and neither is a usual NTP adjustment, which is far smaller than the
+// threshold.
+func (d *driverWriter) reopenAfterSleep() error {
+	now := time.Now()
+	wall := now.Round(0)
+	lastWrite, lastWall := d.lastWrite, d.lastWall
+	d.lastWrite, d.lastWall = now, wall
+	if lastWrite.IsZero() {
+		return nil
+	}
+	gap := now.Sub(lastWrite)
+	if gap < systemSleepThreshold && wall.Sub(lastWall)-gap < systemSleepThreshold {
+		return nil
+	}
+	if gap < wall.Sub(lastWall) {
+		gap = wall.Sub(lastWall)
+	}
+
+	d.m.Lock()
+	_, ok := d.driver.(backend.SleepRecoverer)
+	d.m.Unlock()
+	if !ok {
+		return nil
+	}
+	logEvent(d.options, EventDeviceLost, nil, "the system seems to have slept for %v", gap)
+	return d.reopen(nil)
+}
+
+// reopenIfDeviceChanged reopens the driver as soon as the device is removed or the default device changes,
+// so that the sound moves to another device without waiting for a write to the old device to fail.
+func (d *driverWriter) reopenIfDeviceChanged() error {
+	d.m.Lock()
+	w, ok := d.driver.(otodriver.RemovalWatcher)
+	removed := ok && w.DeviceRemoved()
+	f, ok := d.driver.(backend.DefaultDeviceFollower)
+	changed := ok && f.DefaultDeviceChanged()
+	device := d.options.Device
+	d.m.Unlock()
+	if removed {
+		logEvent(d.options, EventDeviceLost, nil, "the device was removed")
+		return d.reopen(nil)
+	}
+	if changed {
+		if d.crossfadeTo(device) {
+			return nil
+		}
+		return d.reopen(nil)
+	}
+	return nil
+}
+
+// reopen closes the driver and opens it again with the same options. reopen retries until
+// reopenTimeout passes, and returns cause when the driver can't be opened.
+//
+// d.m is not held while retrying, so that Close and Stats are not blocked. Close stops the retries.
+func (d *driverWriter) reopen(cause error) error {
+	d.m.Lock()
+	if d.driver == nil {
+		d.m.Unlock()
+		return ErrContextClosed
+	}
+	var underruns int64
+	if u, ok := d.driver.(otodriver.UnderrunCounter); ok {
+		underruns = u.Underruns()
+	}
+	d.stats.recordRestart(underruns)
+	// The old driver might be broken, so the error at closing is ignored.
+	d.driver.Close()
+	d.driver = nil
+	d.pending = d.pending[:0]
+	d.lastProgress = time.Time{}
+	options := d.options
+	d.m.Unlock()
+
+	deadline := time.Now().Add(reopenTimeout)
+	interval := initialBusyRetryInterval
+	for {
+		driver, err := openDriver(options)
+		if err == nil {
+			d.m.Lock()
+			defer d.m.Unlock()
+			if d.closed {
+				driver.Close()
+				return ErrContextClosed
+			}
+			d.driver = driver
+			logEvent(d.options, EventDeviceReopened, cause, "reopened the device")
+			return d.applySettings()
+		}
+		if !time.Now().Add(interval).Before(deadline) {
+			if cause != nil {
+				return cause
+			}
+			return err
+		}
+		select {
+		case <-d.closing:
+			return ErrContextClosed
+		case <-time.After(interval):
+		}
+		interval *= 2
+		if interval > maxBusyRetryInterval {
+			interval = maxBusyRetryInterval
+		}
+	}
+}
+
+// cancelerValue wraps a driver.Canceler so that atomic.Value can hold the different types.
+type cancelerValue struct {
+	otodriver.Canceler
+}
+
+// storeDriver records the optional interfaces of the driver about to be written, which are used without
+// d.m. storeDriver must be called with d.m locked.
+func (d *driverWriter) storeDriver() {
+	c, _ := d.driver.(otodriver.Canceler)
+	d.canceler.Store(cancelerValue{c})
+	q, _ := d.driver.(backend.FrameQueuer)
+	d.queuer.Store(queuerValue{queuer: q, bufferFrames: int64(d.bufferSize / d.options.bytesPerFrame())})
+	d.pauser.Store(pauserValue{pauserOf(d.driver)})
+}
+
+// cancelWrite makes the blocking TryWrite of the driver return. cancelWrite doesn't lock d.m, since the
+// loop holds it while the driver is writing.
+func (d *driverWriter) cancelWrite() {
+	if c, ok := d.canceler.Load().(cancelerValue); ok && c.Canceler != nil {
+		c.Cancel()
+	}
+}
+
+// adaptBuffer reopens the driver with a bigger buffer when Options.AdaptiveBuffer is enabled and
+// the driver has detected an underrun since the last check.
+func (d *driverWriter) adaptBuffer() error {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	if !d.options.AdaptiveBuffer || d.driver == nil {
+		return nil
+	}
+	u, ok := d.driver.(otodriver.UnderrunCounter)
+	if !ok {
+		return nil
+	}
+	underruns := u.Underruns()
+	if d.checkedDriver != d.driver {
+		// Count from the first check of a newly opened driver, so that a driver that doesn't reset the
+		// number at opening doesn't grow the buffer again and again.
+		d.checkedDriver = d.driver
+		d.checkedUnderruns = underruns
+		return nil
+	}
+	if underruns <= d.checkedUnderruns {
+		return nil
+	}
+	d.checkedUnderruns = underruns
+
+	o, err := d.options.grown()
+	if err != nil {
+		return err
+	}
+	if o == nil {
+		// The buffer has already reached the limit.
+		return nil
+	}
+
+	// The device might not be opened twice, so close the current driver first. The samples queued in
+	// the device are dropped, but the device has just underrun anyway.
+	d.stats.recordRestart(underruns)
+	if err := d.driver.Close(); err != nil {
+		return err
+	}
+	d.driver = nil
+	driver, err := openDriver(o)
+	if err != nil {
+		// Keep playing with the current buffer when the device can't be opened with the bigger one.
+		driver, rerr := openDriver(d.options)
+		if rerr != nil {
+			return err
+		}
+		d.driver = driver
+		logEvent(d.options, EventDeviceReopened, err, "failed to resize the buffer to %d frames", o.BufferFrames)
+		return d.applySettings()
+	}
+	d.driver = driver
+	d.options = o
+	d.bufferSize = o.BufferSizeInBytes
+	d.flushSize = o.FlushFrames * o.bytesPerFrame()
+	if cap(d.pending) < d.flushSize {
+		pending := make([]byte, len(d.pending), d.flushSize)
+		copy(pending, d.pending)
+		d.pending = pending
+	}
+	logEvent(o, EventBufferResized, nil, "resized the buffer to %d frames after underruns", o.BufferFrames)
+	if o.OnBufferResize != nil {
+		o.OnBufferResize(o.BufferFrames)
+	}
+	return d.applySettings()
+}
+
+func (d *driverWriter) readFrom(r io.Reader) (int, error) {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	if d.driver == nil {
+		return 0, ErrContextClosed
+	}
+	a := d.driver.(backend.BufferAcquirer)
+	d.storeDriver()
+	buf, err := a.AcquireBuffer()
+	if err != nil {
+		return 0, err
+	}
+	if len(buf) == 0 {
+		// The device buffer is full. Mitigate the busy loop by sleeping (#10).
+		time.Sleep(time.Second * time.Duration(d.bufferSize) / time.Duration(d.bytesPerSecond) / 8)
+		return 0, d.checkStall(0)
+	}
+	n, err := r.Read(buf)
+	d.mixCrossfade(buf[:n])
+	if err := a.CommitBuffer(n); err != nil {
+		return n, err
+	}
+	atomic.AddInt64(&d.stats.framesPassed, int64(n/d.options.bytesPerFrame()))
+	d.dump.write(buf[:n])
+	d.trackSilence(buf[:n])
+	if cerr := d.checkStall(n); cerr != nil && err == nil {
+		err = cerr
+	}
+	return n, err
+}
+
+// checkStall returns ErrDeviceStalled when the driver hasn't accepted any data for Options.StallPeriods
+// periods. n is the number of bytes that the driver has just accepted.
+func (d *driverWriter) checkStall(n int) error {
+	if d.options.StallPeriods == 0 {
+		return nil
+	}
+	now := time.Now()
+	if atomic.LoadInt32(&d.devicePaused) != 0 {
+		// The paused device doesn't consume the data on purpose.
+		d.lastProgress = now
+		return nil
+	}
+	if n > 0 || d.lastProgress.IsZero() {
+		d.lastProgress = now
+		return nil
+	}
+	size, _ := d.options.periods()
+	period := time.Second * time.Duration(size) / time.Duration(d.bytesPerSecond)
+	if now.Sub(d.lastProgress) < time.Duration(d.options.StallPeriods)*period {
+		return nil
+	}
+	return ErrDeviceStalled
+}
+
+// Close closes the driver. When drain is true, Close waits until the data passed to the driver is
+// played. Otherwise, the queued data is dropped.
+func (d *driverWriter) Close(drain bool) error {
+	// The loop holds the lock while the driver is writing.
+	atomic.StoreInt32(&d.stage, closeStageWaiting)
 	d.m.Lock()
 	defer d.m.Unlock()
 
-	// Close should be wait until the buffer data is consumed (#36).
-	// This is the simplest (but ugly) fix.
-	// TODO: Implement player's Close to wait the buffer played.
-	time.Sleep(time.Second * time.Duration(d.bufferSize) / time.Duration(d.bytesPerSecond))
-	return d.driver.Close()
+	if d.closed {
+		return nil
+	}
+	d.closed = true
+	close(d.closing)
+	// The driver is nil while it is being reopened.
+	if d.driver == nil {
+		return d.dump.close()
+	}
+
+	if drain {
+		atomic.StoreInt32(&d.stage, closeStageFlushing)
+		if err := d.flush(); err != nil {
+			return err
+		}
+		// Some drivers drop the queued data at closing, so wait until the device buffer is consumed
+		// (#36). This works in the same way regardless of the driver.
+		atomic.StoreInt32(&d.stage, closeStageDraining)
+		time.Sleep(time.Second * time.Duration(d.bufferSize) / time.Duration(d.bytesPerSecond))
+	}
+	atomic.StoreInt32(&d.stage, closeStageClosing)
+	d.stopCrossfade()
+	if err := d.dump.close(); err != nil {
+		d.driver.Close()
+		d.driver = nil
+		return err
+	}
+	err := d.driver.Close()
+	d.driver = nil
+	return err
 }
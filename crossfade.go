@@ -0,0 +1,173 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	"time"
+
+	otodriver "github.com/leibnewton/oto/driver"
+	"github.com/leibnewton/oto/internal/backend"
+	"github.com/leibnewton/oto/internal/dsp"
+)
+
+// deviceCrossfade is the overlap of the old and the new devices while the device is switched. See
+// Options.DeviceCrossfade.
+type deviceCrossfade struct {
+	old        tryWriteCloser
+	options    *Options
+	bufferSize int
+
+	// frames is the length of the crossfade, and done is the number of the frames already crossfaded.
+	frames int
+	done   int
+
+	// out and f are reused for the samples to the old device.
+	out []byte
+	f   []float32
+}
+
+// crossfadeTo opens the driver on device while the current driver keeps playing, and starts the crossfade
+// between them. crossfadeTo reports whether the crossfade started. Otherwise, the device should be switched
+// sequentially, e.g. when the device can't be opened twice.
+func (d *driverWriter) crossfadeTo(device *Device) bool {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	if d.options.DeviceCrossfade == 0 || d.driver == nil {
+		return false
+	}
+	if _, ok := d.driver.(*suspendedDriver); ok {
+		return false
+	}
+	o := *d.options
+	o.Device = device
+	driver, err := openDriver(&o)
+	if err != nil {
+		logEvent(d.options, EventDeviceLost, err, "failed to open the device to crossfade")
+		return false
+	}
+
+	// The data queued in the old device is played before the crossfaded data. Queue the same length of
+	// silence in the new device so that both devices play the crossfade at the same time.
+	queued := int64(d.bufferSize / d.options.bytesPerFrame())
+	if q, ok := d.driver.(backend.FrameQueuer); ok {
+		if n, ok := q.QueuedFrames(); ok {
+			queued = n
+		}
+	}
+	silence := make([]byte, int(queued)*o.bytesPerFrame())
+	if o.Format == FormatUnsignedInt8 {
+		for i := range silence {
+			silence[i] = 128
+		}
+	}
+	for len(silence) > 0 {
+		n, err := driver.TryWrite(silence)
+		if err != nil || n == 0 {
+			break
+		}
+		silence = silence[n:]
+	}
+
+	d.stopCrossfade()
+	var underruns int64
+	if u, ok := d.driver.(otodriver.UnderrunCounter); ok {
+		underruns = u.Underruns()
+	}
+	d.stats.recordRestart(underruns)
+	frames := int(int64(o.DeviceCrossfade) * int64(o.SampleRate) / int64(time.Second))
+	if frames == 0 {
+		frames = 1
+	}
+	d.crossfade = &deviceCrossfade{
+		old:        d.driver,
+		options:    d.options,
+		bufferSize: d.bufferSize,
+		frames:     frames,
+	}
+	d.driver = driver
+	d.options = &o
+	d.lastProgress = time.Time{}
+	logEvent(d.options, EventDeviceReopened, nil, "crossfading to the device for %v", o.DeviceCrossfade)
+	if err := d.applySettings(); err != nil {
+		logEvent(d.options, EventDeviceReopened, err, "failed to apply the settings to the device")
+	}
+	return true
+}
+
+// mixCrossfade passes buf faded out to the old device, and fades buf in for the new device in place.
+// mixCrossfade must be called with d.m locked.
+func (d *driverWriter) mixCrossfade(buf []byte) {
+	x := d.crossfade
+	if x == nil {
+		return
+	}
+	bytesPerFrame := x.options.bytesPerFrame()
+	n := len(buf) / bytesPerFrame
+	if rest := x.frames - x.done; n > rest {
+		n = rest
+	}
+	from := float32(x.done) / float32(x.frames)
+	to := float32(x.done+n) / float32(x.frames)
+	x.done += n
+
+	b := buf[:n*bytesPerFrame]
+	x.out = append(x.out[:0], b...)
+	x.ramp(x.out, 1-from, 1-to)
+	// The old device consumes the data at the same rate, and might be unavailable already. The data it
+	// doesn't accept is dropped.
+	x.old.TryWrite(x.out)
+	x.ramp(b, from, to)
+
+	if x.done >= x.frames {
+		// Let the old device play the faded data before closing it.
+		old := x.old
+		wait := time.Second * time.Duration(x.bufferSize) / time.Duration(x.options.SampleRate*bytesPerFrame)
+		go func() {
+			time.Sleep(wait)
+			old.Close()
+		}()
+		d.crossfade = nil
+	}
+}
+
+// stopCrossfade closes the old device immediately if the crossfade is in progress. stopCrossfade must be
+// called with d.m locked.
+func (d *driverWriter) stopCrossfade() {
+	if d.crossfade == nil {
+		return
+	}
+	d.crossfade.old.Close()
+	d.crossfade = nil
+}
+
+// ramp multiplies the samples in buf by the gain ramping linearly from from to to.
+func (x *deviceCrossfade) ramp(buf []byte, from, to float32) {
+	n := len(buf) / x.options.Format.BytesPerSample()
+	if cap(x.f) < n {
+		x.f = make([]float32, n)
+	}
+	f := x.f[:n]
+	switch x.options.Format {
+	case FormatUnsignedInt8:
+		dsp.Uint8sToFloat32s(f, buf)
+		dsp.Ramp(f, x.options.ChannelNum, from, to)
+		dsp.Float32sToUint8s(buf, f)
+	default:
+		dsp.Int16sToFloat32s(f, buf)
+		dsp.Ramp(f, x.options.ChannelNum, from, to)
+		dsp.Float32sToInt16s(buf, f)
+	}
+}
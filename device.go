@@ -0,0 +1,170 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	"fmt"
+	"strings"
+)
+
+// WaveFormats is the set of the standard formats that a device supports, which is WAVEOUTCAPS.dwFormats
+// on Windows.
+type WaveFormats uint32
+
+// The standard formats. The name is the sample rate, mono (M) or stereo (S), and the bits per sample:
+// 1 is 11.025kHz, 2 is 22.05kHz, 4 is 44.1kHz, 48 is 48kHz and 96 is 96kHz.
+const (
+	WaveFormat1M08 WaveFormats = 1 << iota
+	WaveFormat1S08
+	WaveFormat1M16
+	WaveFormat1S16
+	WaveFormat2M08
+	WaveFormat2S08
+	WaveFormat2M16
+	WaveFormat2S16
+	WaveFormat4M08
+	WaveFormat4S08
+	WaveFormat4M16
+	WaveFormat4S16
+	WaveFormat48M08
+	WaveFormat48S08
+	WaveFormat48M16
+	WaveFormat48S16
+	WaveFormat96M08
+	WaveFormat96S08
+	WaveFormat96M16
+	WaveFormat96S16
+)
+
+// waveFormatRates is the sample rates of the standard formats in the order of the bits. Each rate has
+// four bits: mono 8bit, stereo 8bit, mono 16bit and stereo 16bit.
+var waveFormatRates = []int{11025, 22050, 44100, 48000, 96000}
+
+// waveFormat returns the bit of the standard format, or 0 if the format is not a standard one.
+func waveFormat(sampleRate, channelNum, bitsPerSample int) WaveFormats {
+	for i, r := range waveFormatRates {
+		if r != sampleRate {
+			continue
+		}
+		bit := uint(4 * i)
+		switch channelNum {
+		case 1:
+		case 2:
+			bit++
+		default:
+			return 0
+		}
+		switch bitsPerSample {
+		case 8:
+		case 16:
+			bit += 2
+		default:
+			return 0
+		}
+		return 1 << bit
+	}
+	return 0
+}
+
+// Has reports whether the set has the standard format.
+func (f WaveFormats) Has(sampleRate, channelNum, bitsPerSample int) bool {
+	b := waveFormat(sampleRate, channelNum, bitsPerSample)
+	return b != 0 && f&b != 0
+}
+
+// String returns the formats in the set, e.g. "44.1kHz stereo 16bit, 48kHz stereo 16bit", or "none".
+func (f WaveFormats) String() string {
+	var ns []string
+	for i, r := range waveFormatRates {
+		for j := uint(0); j < 4; j++ {
+			if f&(1<<(uint(4*i)+j)) == 0 {
+				continue
+			}
+			ch := "mono"
+			if j&1 != 0 {
+				ch = "stereo"
+			}
+			bits := 8
+			if j&2 != 0 {
+				bits = 16
+			}
+			ns = append(ns, fmt.Sprintf("%skHz %s %dbit", formatKHz(r), ch, bits))
+		}
+	}
+	if len(ns) == 0 {
+		return "none"
+	}
+	return strings.Join(ns, ", ")
+}
+
+// formatKHz formats the sample rate in kHz without trailing zeros, e.g. "44.1" and "48".
+func formatKHz(sampleRate int) string {
+	s := fmt.Sprintf("%.3f", float64(sampleRate)/1000)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// WaveSupport is the set of the optional functions of a device, which is WAVEOUTCAPS.dwSupport on
+// Windows.
+type WaveSupport uint32
+
+const (
+	// WaveCapsPitch is the pitch control. See Context.SetDevicePitch.
+	WaveCapsPitch WaveSupport = 1 << iota
+
+	// WaveCapsPlaybackRate is the playback rate control. See Context.SetDeviceRate.
+	WaveCapsPlaybackRate
+
+	// WaveCapsVolume is the volume control. See Context.SetDeviceVolume.
+	WaveCapsVolume
+
+	// WaveCapsLRVolume is the separate volume control of the left and the right channels.
+	WaveCapsLRVolume
+
+	// WaveCapsSync is that the driver is synchronous and blocks while playing a buffer.
+	WaveCapsSync
+
+	// WaveCapsSampleAccurate is that the position is reported accurately in samples.
+	WaveCapsSampleAccurate
+)
+
+var waveSupportNames = []string{
+	"pitch",
+	"playback rate",
+	"volume",
+	"left/right volume",
+	"sync",
+	"sample accurate",
+}
+
+// String returns the functions in the set, e.g. "volume, left/right volume", or "none".
+func (s WaveSupport) String() string {
+	var ns []string
+	for i, n := range waveSupportNames {
+		if s&(1<<uint(i)) != 0 {
+			ns = append(ns, n)
+		}
+	}
+	if len(ns) == 0 {
+		return "none"
+	}
+	return strings.Join(ns, ", ")
+}
+
+// SupportsFormat reports whether the device supports the format as a standard format. A device might play
+// other formats too, e.g. through the wave mapper that converts the format.
+func (d *Device) SupportsFormat(sampleRate, channelNum, bitsPerSample int) bool {
+	return d.Formats.Has(sampleRate, channelNum, bitsPerSample)
+}
@@ -0,0 +1,181 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	"time"
+
+	otodriver "github.com/leibnewton/oto/driver"
+)
+
+// deviceMove is a request of SetDevice, which the loop feeding the device handles between the writes.
+type deviceMove struct {
+	device *Device
+
+	// faded is whether the master gain has been faded out. The device is switched after the fade has been
+	// written.
+	faded bool
+
+	// fadeOut fades the master gain out from the next period, and fadeIn restores it just after the switch
+	// so that no silent period is mixed in between. fading reports whether the fade is still ramping.
+	fadeOut func()
+	fadeIn  func()
+	fading  func() bool
+
+	// done receives the result of the switch.
+	done chan error
+}
+
+// SetDevice moves the playback to another output device without recreating the Context and the Players.
+// nil means the default device. The Players keep their positions and their buffered data: the sound
+// fades out on the current device, the data queued in the device is played, and the sound fades in on
+// the new device.
+//
+// When Options.DeviceCrossfade is set, the new device is opened while the current device is playing, and
+// the sound is crossfaded between them instead.
+//
+// SetDevice blocks until the sound plays on the new device. When the new device can't be opened, the
+// current device is opened again and SetDevice returns the error.
+func (c *Context) SetDevice(device *Device) error {
+	if c.isClosed() {
+		return ErrContextClosed
+	}
+	c.moveM.Lock()
+	defer c.moveM.Unlock()
+
+	m := &deviceMove{
+		device:  device,
+		fadeOut: func() { c.setMoving(true) },
+		fadeIn:  func() { c.setMoving(false) },
+		fading:  c.mux.MasterRamping,
+		done:    make(chan error, 1),
+	}
+	d := c.driverWriter
+	d.moveM.Lock()
+	d.move = m
+	d.moveM.Unlock()
+
+	select {
+	case err := <-m.done:
+		return err
+	case <-c.done:
+		c.setMoving(false)
+		return ErrContextClosed
+	}
+}
+
+// SetDevice moves the playback to another output device. All the Players of the Context share one
+// stream of the device, so SetDevice moves all of them. See Context.SetDevice.
+func (p *Player) SetDevice(device *Device) error {
+	return p.context.SetDevice(device)
+}
+
+// setMoving fades the master gain out while the device is being switched, and fades it in again.
+func (c *Context) setMoving(moving bool) {
+	c.focusM.Lock()
+	defer c.focusM.Unlock()
+	c.moving = moving
+	c.mux.SetMaster(c.masterGain())
+}
+
+// moveIfRequested switches the device when SetDevice requests it. Unless the sound is crossfaded, the
+// device is switched after the fade has been written.
+func (d *driverWriter) moveIfRequested() error {
+	d.moveM.Lock()
+	m := d.move
+	d.moveM.Unlock()
+	if m == nil {
+		return nil
+	}
+	if !m.faded {
+		if d.crossfadeTo(m.device) {
+			d.endMove()
+			m.done <- nil
+			return nil
+		}
+		// The next period is mixed after the fade.
+		m.fadeOut()
+		m.faded = true
+		return nil
+	}
+	if m.fading() {
+		// The fade can take more than one period when the periods are short.
+		return nil
+	}
+	d.endMove()
+
+	moveErr, err := d.moveTo(m.device)
+	m.fadeIn()
+	m.done <- moveErr
+	return err
+}
+
+// endMove removes the request of SetDevice being handled.
+func (d *driverWriter) endMove() {
+	d.moveM.Lock()
+	defer d.moveM.Unlock()
+	d.move = nil
+}
+
+// moveTo closes the driver after the queued data is played, and opens the driver on device. When device
+// can't be opened, moveTo opens the current device again. moveErr is the error for SetDevice, and err is
+// the error that stops the loop.
+func (d *driverWriter) moveTo(device *Device) (moveErr, err error) {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	if d.driver == nil {
+		return ErrContextClosed, nil
+	}
+	o := *d.options
+	o.Device = device
+	if _, ok := d.driver.(*suspendedDriver); ok {
+		// The device is opened on the new device when the sound resumes.
+		d.options = &o
+		logEvent(d.options, EventDeviceReopened, nil, "switched the device while suspended")
+		return nil, nil
+	}
+
+	if err := d.flush(); err != nil {
+		return err, err
+	}
+	// Some drivers drop the queued data at closing, so wait until the device buffer is consumed in the
+	// same way as Close.
+	time.Sleep(time.Second * time.Duration(d.bufferSize) / time.Duration(d.bytesPerSecond))
+
+	var underruns int64
+	if u, ok := d.driver.(otodriver.UnderrunCounter); ok {
+		underruns = u.Underruns()
+	}
+	d.stats.recordRestart(underruns)
+	// The device might not be opened twice, so close the current driver first.
+	d.driver.Close()
+	d.driver = nil
+	d.lastProgress = time.Time{}
+
+	driver, moveErr := openDriver(&o)
+	if moveErr != nil {
+		logEvent(d.options, EventDeviceLost, moveErr, "failed to switch the device")
+		driver, err = openDriver(d.options)
+		if err != nil {
+			return moveErr, err
+		}
+	} else {
+		d.options = &o
+	}
+	d.driver = driver
+	logEvent(d.options, EventDeviceReopened, moveErr, "reopened the device")
+	return moveErr, d.applySettings()
+}
@@ -0,0 +1,111 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	"math"
+	"sync/atomic"
+
+	"github.com/leibnewton/oto/internal/backend"
+)
+
+// deviceRater returns the backend.DeviceRater of the driver, or nil. deviceRater must be called with d.m
+// locked.
+func (d *driverWriter) deviceRater() backend.DeviceRater {
+	driver := d.driver
+	if c, ok := driver.(*convertingDriver); ok {
+		driver = c.driver
+	}
+	r, _ := driver.(backend.DeviceRater)
+	return r
+}
+
+// outputShift is the playback rate and the pitch of the whole output that are applied in software, since
+// the device doesn't support them. The fields are the bits of float32 values, and are accessed
+// atomically.
+type outputShift struct {
+	rate  uint32
+	pitch uint32
+}
+
+// load returns the playback rate and the pitch shift in semitones.
+func (o *outputShift) load() (rate, semitones float32) {
+	return math.Float32frombits(atomic.LoadUint32(&o.rate)), math.Float32frombits(atomic.LoadUint32(&o.pitch))
+}
+
+// SetDeviceRate sets the playback rate of the whole output keeping the pitch. 1 is the original speed,
+// which is the default. The rate is clamped to [0.25, 4].
+//
+// When the device supports it, the rate is changed by the device, e.g. waveOutSetPlaybackRate on Windows.
+// Otherwise, every Player is time-stretched in software like Player.SetPreservePitch, on top of the
+// Player's own rate. See Capabilities.DeviceRate.
+func (c *Context) SetDeviceRate(rate float64) error {
+	if math.IsNaN(rate) {
+		rate = 1
+	}
+	d := c.driverWriter
+	d.m.Lock()
+	defer d.m.Unlock()
+	d.deviceRate = math.Max(minRate, math.Min(maxRate, rate))
+	return d.applyDeviceRate()
+}
+
+// SetDevicePitch shifts the pitch of the whole output by semitones keeping the speed. 0 is the default.
+// The shift is clamped to [-24, 24].
+//
+// When the device supports it, the pitch is shifted by the device, e.g. waveOutSetPitch on Windows.
+// Otherwise, every Player is pitch-shifted in software like Player.SetPitch, on top of the Player's own
+// shift. See Capabilities.DevicePitch.
+func (c *Context) SetDevicePitch(semitones float64) error {
+	if math.IsNaN(semitones) {
+		semitones = 0
+	}
+	d := c.driverWriter
+	d.m.Lock()
+	defer d.m.Unlock()
+	d.devicePitch = math.Max(-24, math.Min(24, semitones))
+	return d.applyDeviceRate()
+}
+
+// applyDeviceRate applies the playback rate and the pitch of the whole output to the driver, or to the
+// software when the device doesn't support them, e.g. after the driver is reopened. applyDeviceRate must be
+// called with d.m locked.
+func (d *driverWriter) applyDeviceRate() error {
+	rate, semitones := d.deviceRate, d.devicePitch
+	if rate == 0 {
+		// SetDeviceRate has never been called.
+		rate = 1
+	}
+	var hwRate, hwPitch bool
+	r := d.deviceRater()
+	if r != nil {
+		hwRate, hwPitch = r.DeviceRateSupport()
+	}
+	if hwRate {
+		if err := r.SetDeviceRate(rate); err != nil {
+			return err
+		}
+		rate = 1
+	}
+	if hwPitch {
+		if err := r.SetDevicePitch(math.Pow(2, semitones/12)); err != nil {
+			return err
+		}
+		semitones = 0
+	}
+	atomic.StoreUint32(&d.outputShift.rate, math.Float32bits(float32(rate)))
+	atomic.StoreUint32(&d.outputShift.pitch, math.Float32bits(float32(semitones)))
+	return nil
+}
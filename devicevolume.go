@@ -0,0 +1,92 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	"fmt"
+
+	"github.com/leibnewton/oto/internal/backend"
+)
+
+// deviceVolumer returns the backend.DeviceVolumer of the driver, or nil. deviceVolumer must be called with d.m
+// locked.
+func (d *driverWriter) deviceVolumer() backend.DeviceVolumer {
+	driver := d.driver
+	if c, ok := driver.(*convertingDriver); ok {
+		driver = c.driver
+	}
+	v, ok := driver.(backend.DeviceVolumer)
+	if !ok {
+		return nil
+	}
+	if volume, _ := v.DeviceVolumeSupport(); !volume {
+		return nil
+	}
+	return v
+}
+
+// SetDeviceVolume sets the volume of the output device in the driver, instead of scaling the samples in
+// software. left and right are in [0, 1]. When the device can't control the channels separately, the
+// average of them is used for both. The volume is kept when the device is reopened.
+//
+// SetDeviceVolume returns an error when the driver or the device doesn't support the volume. See
+// Capabilities.DeviceVolume. Only the winmm driver supports the device volume by waveOutSetVolume. On
+// Windows Vista and later, this is the volume of the application in the mixer rather than the volume of
+// the device.
+func (c *Context) SetDeviceVolume(left, right float64) error {
+	if left < 0 || left > 1 || right < 0 || right > 1 {
+		return fmt.Errorf("oto: the device volume must be in [0, 1] but (%v, %v)", left, right)
+	}
+	d := c.driverWriter
+	d.m.Lock()
+	defer d.m.Unlock()
+	if d.deviceVolumer() == nil {
+		return fmt.Errorf("oto: the driver doesn't support the device volume")
+	}
+	d.deviceVolumeSet = true
+	d.deviceVolumeLeft = left
+	d.deviceVolumeRight = right
+	return d.applyDeviceVolume()
+}
+
+// DeviceVolume returns the volume of the output device set by SetDeviceVolume or by the system.
+func (c *Context) DeviceVolume() (left, right float64, err error) {
+	d := c.driverWriter
+	d.m.Lock()
+	defer d.m.Unlock()
+	v := d.deviceVolumer()
+	if v == nil {
+		return 0, 0, fmt.Errorf("oto: the driver doesn't support the device volume")
+	}
+	return v.DeviceVolume()
+}
+
+// applyDeviceVolume applies the volume set by SetDeviceVolume to the driver, e.g. after the driver is
+// reopened. applyDeviceVolume must be called with d.m locked.
+func (d *driverWriter) applyDeviceVolume() error {
+	if !d.deviceVolumeSet {
+		return nil
+	}
+	v := d.deviceVolumer()
+	if v == nil {
+		return nil
+	}
+	left, right := d.deviceVolumeLeft, d.deviceVolumeRight
+	if _, stereo := v.DeviceVolumeSupport(); !stereo {
+		left = (left + right) / 2
+		right = left
+	}
+	return v.SetDeviceVolume(left, right)
+}
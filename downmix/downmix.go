@@ -0,0 +1,199 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package downmix converts PCM streams with many channels, e.g. 5.1 surround, into fewer channels for
+// Oto, which plays mono or stereo.
+package downmix
+
+import (
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/leibnewton/oto/internal/dsp"
+)
+
+// Matrix is a downmix matrix. Matrix[out][in] is the gain of the input channel in to the output channel
+// out.
+type Matrix [][]float64
+
+// The channel orders of the standard layouts follow WAVE_FORMAT_EXTENSIBLE.
+const (
+	// Surround51 is 6 channels: front left, front right, center, LFE, side left and side right.
+	Surround51 = 6
+
+	// Surround71 is 8 channels: front left, front right, center, LFE, back left, back right, side left
+	// and side right.
+	Surround71 = 8
+)
+
+// Standard returns the downmix matrix from the layout of from channels to to channels with the
+// coefficients of ITU-R BS.775: the center and the surround channels are mixed into the front channels at
+// -3dB. lfe is the gain of the LFE channel, which is dropped when lfe is 0 as ITU-R BS.775 does.
+//
+// from is 1, 2, 3 (L, R, C), 4 (L, R, Ls, Rs), Surround51 or Surround71, and to is 1 or 2. Each output
+// channel is normalized so that the sum of its gains is 1, which keeps the downmix from clipping.
+func Standard(from, to int, lfe float64) (Matrix, error) {
+	if to != 1 && to != 2 {
+		return nil, fmt.Errorf("downmix: the number of output channels must be 1 or 2 but %d", to)
+	}
+	const c = math.Sqrt2 / 2
+
+	// row is the gains to the left channel, and the gains to the right channel are mirrored by mirror.
+	var left []float64
+	var mirror []int
+	switch from {
+	case 1:
+		left, mirror = []float64{1}, []int{0}
+	case 2:
+		left, mirror = []float64{1, 0}, []int{1, 0}
+	case 3:
+		left, mirror = []float64{1, 0, c}, []int{1, 0, 2}
+	case 4:
+		left, mirror = []float64{1, 0, c, 0}, []int{1, 0, 3, 2}
+	case Surround51:
+		left, mirror = []float64{1, 0, c, lfe, c, 0}, []int{1, 0, 2, 3, 5, 4}
+	case Surround71:
+		left, mirror = []float64{1, 0, c, lfe, c, 0, c, 0}, []int{1, 0, 2, 3, 5, 4, 7, 6}
+	default:
+		return nil, fmt.Errorf("downmix: no standard layout for %d channels", from)
+	}
+
+	right := make([]float64, from)
+	for i, j := range mirror {
+		right[j] = left[i]
+	}
+	var m Matrix
+	if to == 1 {
+		mono := make([]float64, from)
+		for i := range mono {
+			mono[i] = (left[i] + right[i]) / 2
+		}
+		m = Matrix{mono}
+	} else {
+		m = Matrix{left, right}
+	}
+	for _, row := range m {
+		var sum float64
+		for _, g := range row {
+			sum += g
+		}
+		for i := range row {
+			row[i] /= sum
+		}
+	}
+	return m, nil
+}
+
+// Reader reads the downmixed stream from a stream with more channels.
+type Reader struct {
+	r              io.Reader
+	m              Matrix
+	bytesPerSample int
+
+	in   []byte
+	rest int
+	f    []float32
+	out  []float32
+}
+
+// NewReader returns a Reader downmixing the interleaved samples from r by the matrix. bytesPerSample is
+// 1 for unsigned 8bit samples, and 2 for little-endian signed 16bit samples.
+func NewReader(r io.Reader, m Matrix, bytesPerSample int) (*Reader, error) {
+	if len(m) == 0 || len(m[0]) == 0 {
+		return nil, fmt.Errorf("downmix: the matrix must not be empty")
+	}
+	for _, row := range m {
+		if len(row) != len(m[0]) {
+			return nil, fmt.Errorf("downmix: all the rows of the matrix must have the same length")
+		}
+	}
+	if bytesPerSample != 1 && bytesPerSample != 2 {
+		return nil, fmt.Errorf("downmix: bytesPerSample must be 1 or 2 but %d", bytesPerSample)
+	}
+	return &Reader{
+		r:              r,
+		m:              m,
+		bytesPerSample: bytesPerSample,
+	}, nil
+}
+
+// Read implements io.Reader. Read reads whole output frames, so buf must have room for one frame at
+// least.
+func (r *Reader) Read(buf []byte) (int, error) {
+	from, to := len(r.m[0]), len(r.m)
+	inFrame, outFrame := from*r.bytesPerSample, to*r.bytesPerSample
+	frames := len(buf) / outFrame
+	if frames == 0 {
+		if len(buf) == 0 {
+			return 0, nil
+		}
+		return 0, io.ErrShortBuffer
+	}
+
+	if cap(r.in) < frames*inFrame {
+		in := make([]byte, frames*inFrame)
+		copy(in, r.in[:r.rest])
+		r.in = in
+	}
+	r.in = r.in[:frames*inFrame]
+
+	// Read until a whole input frame is available, and keep the remainder to the next Read.
+	var err error
+	for r.rest < inFrame && err == nil {
+		var n int
+		n, err = r.r.Read(r.in[r.rest:])
+		r.rest += n
+	}
+	n := r.rest / inFrame
+	if n == 0 {
+		if err == io.EOF && r.rest > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, err
+	}
+
+	samples := r.in[:n*inFrame]
+	if cap(r.f) < n*from {
+		r.f = make([]float32, n*from)
+		r.out = make([]float32, n*to)
+	}
+	f, out := r.f[:n*from], r.out[:n*to]
+	if r.bytesPerSample == 1 {
+		dsp.Uint8sToFloat32s(f, samples)
+	} else {
+		dsp.Int16sToFloat32s(f, samples)
+	}
+	for i := 0; i < n; i++ {
+		for o, row := range r.m {
+			var v float64
+			for c, g := range row {
+				v += g * float64(f[i*from+c])
+			}
+			out[i*to+o] = float32(v)
+		}
+	}
+	if r.bytesPerSample == 1 {
+		dsp.Float32sToUint8s(buf[:n*outFrame], out)
+	} else {
+		dsp.Float32sToInt16s(buf[:n*outFrame], out)
+	}
+
+	r.rest = copy(r.in, r.in[n*inFrame:r.rest])
+	if err == io.EOF && r.rest > 0 {
+		// Report EOF at the next Read with the partial frame.
+		err = nil
+	}
+	return n * outFrame, err
+}
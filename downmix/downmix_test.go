@@ -0,0 +1,98 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package downmix_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"testing"
+	"testing/iotest"
+
+	"github.com/leibnewton/oto/downmix"
+)
+
+func int16sToBytes(s []int16) []byte {
+	b := make([]byte, 2*len(s))
+	for i, v := range s {
+		b[2*i] = byte(v)
+		b[2*i+1] = byte(v >> 8)
+	}
+	return b
+}
+
+func bytesToInt16s(b []byte) []int16 {
+	s := make([]int16, len(b)/2)
+	for i := range s {
+		s[i] = int16(b[2*i]) | int16(b[2*i+1])<<8
+	}
+	return s
+}
+
+func TestStandard(t *testing.T) {
+	m, err := downmix.Standard(downmix.Surround51, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The center goes to both channels, and the LFE is dropped.
+	if m[0][2] != m[1][2] || m[0][2] == 0 || m[0][3] != 0 || m[1][3] != 0 {
+		t.Errorf("unexpected matrix: %v", m)
+	}
+	// Side left goes only to the left.
+	if m[0][4] == 0 || m[1][4] != 0 {
+		t.Errorf("unexpected matrix: %v", m)
+	}
+	for _, row := range m {
+		var sum float64
+		for _, g := range row {
+			sum += g
+		}
+		if math.Abs(sum-1) > 1e-9 {
+			t.Errorf("the sum of a row: got: %v, want: 1", sum)
+		}
+	}
+
+	if _, err := downmix.Standard(5, 2, 0); err == nil {
+		t.Errorf("Standard must return an error for an unknown layout")
+	}
+}
+
+func TestReader(t *testing.T) {
+	m := downmix.Matrix{
+		{1, 0, 0.5},
+		{0, 1, 0.5},
+	}
+	in := int16sToBytes([]int16{100, 200, 1000, -100, -200, -1000})
+	// Read one byte at a time to test the partial frames.
+	r, err := downmix.NewReader(iotest.OneByteReader(bytes.NewReader(in)), m, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := bytesToInt16s(out)
+	want := []int16{600, 700, -600, -700}
+	if len(got) != len(want) {
+		t.Fatalf("got: %v, want: %v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("got: %v, want: %v", got, want)
+			break
+		}
+	}
+}
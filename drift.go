@@ -0,0 +1,95 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// maxDriftCorrection is the maximum deviation of the playback rate to compensate the clock drift.
+	maxDriftCorrection = 0.005
+
+	// driftGain is the deviation of the playback rate per the relative error of the buffer level. The
+	// rate reaches maxDriftCorrection when the level is off by half of the target.
+	driftGain = 2 * maxDriftCorrection
+
+	// driftTimeConstant is the time constant of the smoothing of the buffer level. The level jitters
+	// with the network, and only its trend is followed.
+	driftTimeConstant = 2 * time.Second
+)
+
+// driftState is the state of the clock-drift compensation of a Player. The fields other than correction
+// are used only by the Context's loop.
+type driftState struct {
+	// correction is the bits of the float64 ratio of the playback rate, which is accessed atomically.
+	correction uint64
+
+	// level is the smoothed number of the bytes in the buffer. level is negative before the first update.
+	level float64
+}
+
+// SetDriftCompensation enables the adaptive playback rate for a live source, e.g. VoIP or an internet
+// radio, whose clock drifts from the device's. The Player measures the trend of its buffer level, and
+// resamples the data by up to ±0.5% so that the level stays at target instead of drifting into underruns
+// or an ever-growing delay. The resampling changes the pitch slightly, which is not audible.
+//
+// target is the duration of the data to keep buffered, which is limited to 3/4 of the Player's buffer.
+// 0 disables the compensation, which is the default.
+func (p *Player) SetDriftCompensation(target time.Duration) {
+	o := p.context.options
+	bytes := int64(DurationToFrames(target, o.SampleRate) * o.bytesPerFrame())
+	if max := int64(p.buf.Size()/o.bytesPerFrame()*3/4) * int64(o.bytesPerFrame()); bytes > max {
+		bytes = max
+	}
+	if bytes < 0 {
+		bytes = 0
+	}
+	atomic.StoreInt64(&p.source.driftTarget, bytes)
+}
+
+// DriftCorrection returns the ratio of the playback rate applied by the drift compensation, e.g. 1.002
+// when the Player plays 0.2% faster to reduce the buffered data. DriftCorrection is 1 while the
+// compensation is disabled.
+func (p *Player) DriftCorrection() float64 {
+	if atomic.LoadInt64(&p.source.driftTarget) == 0 {
+		return 1
+	}
+	if c := atomic.LoadUint64(&p.source.drift.correction); c != 0 {
+		return math.Float64frombits(c)
+	}
+	return 1
+}
+
+// update updates the buffer level with the current level of the buffer, and returns the ratio of the
+// playback rate for the next frames. target is the level to keep, and frames is the number of the frames
+// to read.
+func (d *driftState) update(level, target int64, frames, sampleRate int) float64 {
+	if d.level < 0 {
+		d.level = float64(level)
+	} else {
+		alpha := float64(frames) / (driftTimeConstant.Seconds() * float64(sampleRate))
+		if alpha > 1 {
+			alpha = 1
+		}
+		d.level += alpha * (float64(level) - d.level)
+	}
+	r := 1 + driftGain*(d.level-float64(target))/float64(target)
+	r = math.Max(1-maxDriftCorrection, math.Min(1+maxDriftCorrection, r))
+	atomic.StoreUint64(&d.correction, math.Float64bits(r))
+	return r
+}
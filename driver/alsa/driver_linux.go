@@ -0,0 +1,375 @@
+// Copyright 2017 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !js,!android
+
+package alsa
+
+/*
+#cgo pkg-config: alsa
+
+#include <alsa/asoundlib.h>
+
+static void check(int *err, int newErr) {
+  if (*err) {
+    return;
+  }
+  *err = newErr;
+}
+
+static int ALSA_hw_params(
+    snd_pcm_t          *pcm,
+    unsigned           sampleRate,
+    unsigned           numChans,
+    snd_pcm_format_t   format,
+    snd_pcm_uframes_t* buffer_size,
+    snd_pcm_uframes_t* period_size,
+    int                resample) {
+  snd_pcm_hw_params_t* params = NULL;
+  int err = 0;
+  snd_pcm_hw_params_alloca(&params);
+  check(&err, snd_pcm_hw_params_any(pcm, params));
+
+  check(&err, snd_pcm_hw_params_set_access(pcm, params, SND_PCM_ACCESS_RW_INTERLEAVED));
+  check(&err, snd_pcm_hw_params_set_format(pcm, params, format));
+  check(&err, snd_pcm_hw_params_set_channels(pcm, params, numChans));
+  // Without resampling, the rate must be exact so that the sound is not played at a wrong pitch.
+  check(&err, snd_pcm_hw_params_set_rate_resample(pcm, params, resample));
+  if (resample) {
+    check(&err, snd_pcm_hw_params_set_rate_near(pcm, params, &sampleRate, NULL));
+  } else {
+    check(&err, snd_pcm_hw_params_set_rate(pcm, params, sampleRate, 0));
+  }
+  check(&err, snd_pcm_hw_params_set_buffer_size_near(pcm, params, buffer_size));
+  check(&err, snd_pcm_hw_params_set_period_size_near(pcm, params, period_size, NULL));
+
+  check(&err, snd_pcm_hw_params(pcm, params));
+
+  return err;
+}
+
+// ALSA_card returns the number of the sound card of the PCM, or -1 when the PCM is not on a card, e.g. with
+// the PulseAudio plugin.
+static int ALSA_card(snd_pcm_t *pcm) {
+  snd_pcm_info_t* info = NULL;
+  snd_pcm_info_alloca(&info);
+  if (snd_pcm_info(pcm, info) < 0) {
+    return -1;
+  }
+  return snd_pcm_info_get_card(info);
+}
+
+static int ALSA_sw_params(snd_pcm_t *pcm, snd_pcm_uframes_t start_threshold) {
+  snd_pcm_sw_params_t* params = NULL;
+  int err = 0;
+  snd_pcm_sw_params_alloca(&params);
+  check(&err, snd_pcm_sw_params_current(pcm, params));
+
+  check(&err, snd_pcm_sw_params_set_start_threshold(pcm, params, start_threshold));
+
+  check(&err, snd_pcm_sw_params(pcm, params));
+
+  return err;
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	otodriver "github.com/leibnewton/oto/driver"
+	"github.com/leibnewton/oto/internal/backend"
+	"github.com/leibnewton/oto/internal/hotplug"
+)
+
+const driverName = "alsa"
+
+func init() {
+	backend.Register(&backend.Driver{
+		Name: driverName,
+		Open: newDriver,
+		Capabilities: backend.Capabilities{
+			MinLatency:   5 * time.Millisecond,
+			DeviceSwitch: false,
+		},
+	})
+}
+
+type driver struct {
+	handle          *C.snd_pcm_t
+	buf             []byte
+	bufLen          int
+	bufSamples      int
+	numChans        int
+	bitDepthInBytes int
+
+	// underrunCount is the number of the underruns reported by ALSA.
+	underrunCount int64
+
+	xrunPolicy backend.XrunPolicy
+	onXrun     func(count int64)
+
+	// card is the number of the sound card, or -1. removals is the number of the removals of the card when
+	// they were checked last.
+	card     int
+	removals int64
+}
+
+// alsaError is an error code of ALSA, which is a negative errno.
+type alsaError struct {
+	code C.int
+}
+
+func newALSAError(code C.int) error {
+	return &alsaError{code: code}
+}
+
+func (e *alsaError) Error() string {
+	return fmt.Sprintf("oto: ALSA error: %s", C.GoString(C.snd_strerror(e.code)))
+}
+
+// Driver implements oto.DriverError.
+func (e *alsaError) Driver() string {
+	return driverName
+}
+
+// Code implements oto.DriverError.
+func (e *alsaError) Code() int {
+	return int(e.code)
+}
+
+// Unwrap returns the underlying syscall.Errno.
+func (e *alsaError) Unwrap() error {
+	return syscall.Errno(-e.code)
+}
+
+// Is reports whether e corresponds to target, one of the errors like driver.ErrDeviceBusy.
+func (e *alsaError) Is(target error) bool {
+	switch target {
+	case otodriver.ErrDeviceBusy:
+		return e.code == -C.EBUSY || e.code == -C.EAGAIN
+	case otodriver.ErrNoDevice:
+		return e.code == -C.ENOENT
+	case otodriver.ErrDeviceLost:
+		return e.code == -C.ENODEV
+	case otodriver.ErrUnsupportedFormat:
+		// The hardware parameters are rejected by EINVAL, which can happen only without the plug layer.
+		return e.code == -C.EINVAL
+	}
+	return false
+}
+
+// deviceName returns the name of the PCM device that the driver opens.
+func deviceName(params *backend.Params) string {
+	name := params.ALSADevice
+	if name == "" {
+		name = "default"
+	}
+	switch params.ALSAAccess {
+	case backend.ALSAAccessHardware:
+		if name == "default" {
+			return "hw:0,0"
+		}
+		if strings.HasPrefix(name, "plughw:") {
+			return "hw:" + name[len("plughw:"):]
+		}
+	case backend.ALSAAccessDmix:
+		if name == "default" {
+			return "dmix"
+		}
+		for _, prefix := range []string{"hw:", "plughw:"} {
+			if strings.HasPrefix(name, prefix) {
+				return "dmix:" + name[len(prefix):]
+			}
+		}
+	}
+	return name
+}
+
+func newDriver(params *backend.Params) (otodriver.Driver, error) {
+	sampleRate := params.SampleRate
+	numChans := params.ChannelNum
+	bitDepthInBytes := params.BytesPerSample
+
+	p := &driver{
+		numChans:        numChans,
+		bitDepthInBytes: bitDepthInBytes,
+		xrunPolicy:      params.XrunPolicy,
+		onXrun:          params.OnXrun,
+	}
+
+	// open the ALSA audio device for blocking stream playback
+	cs := C.CString(deviceName(params))
+	defer C.free(unsafe.Pointer(cs))
+	if errCode := C.snd_pcm_open(&p.handle, cs, C.SND_PCM_STREAM_PLAYBACK, 0); errCode < 0 {
+		return nil, newALSAError(errCode)
+	}
+
+	// bufferSize is the total size of the main circular buffer fullness of this buffer
+	// oscilates somewhere between bufferSize and bufferSize-periodSize
+	bufferSize := C.snd_pcm_uframes_t(params.BufferFrames)
+	// periodSize is the number of samples that will be taken from the main circular
+	// buffer at once, we leave this value to bufferSize unless the period is specified,
+	// because ALSA will change that to the maximum viable number, obviously lower than bufferSize
+	periodSize := bufferSize
+	if params.PeriodFrames > 0 {
+		periodSize = C.snd_pcm_uframes_t(params.PeriodFrames)
+	}
+	// When the number of periods is specified, the buffer consists of exactly that number of periods.
+	if params.PeriodCount > 0 {
+		bufferSize = periodSize * C.snd_pcm_uframes_t(params.PeriodCount)
+	}
+
+	// choose the correct sample format according to bitDepthInBytes
+	var format C.snd_pcm_format_t
+	switch bitDepthInBytes {
+	case 1:
+		format = C.SND_PCM_FORMAT_U8
+	case 2:
+		format = C.SND_PCM_FORMAT_S16_LE
+	default:
+		panic(fmt.Errorf("oto: bitDepthInBytes must be 1 or 2, got %d", bitDepthInBytes))
+	}
+
+	// set the device hardware parameters according to sampleRate, numChans, format, bufferSize
+	// and periodSize
+	//
+	// bufferSize and periodSize are passed as pointers, because they may be changed according
+	// to the wisdom of ALSA
+	//
+	// ALSA will try too keep them as close to what was requested as possible
+	// ALSA resamples only with the default access. Otherwise oto converts the format.
+	var resample C.int
+	if params.ALSAAccess == backend.ALSAAccessDefault {
+		resample = 1
+	}
+	if errCode := C.ALSA_hw_params(p.handle, C.uint(sampleRate), C.uint(numChans), format, &bufferSize, &periodSize, resample); errCode < 0 {
+		p.Close()
+		return nil, newALSAError(errCode)
+	}
+
+	// the playback starts when the main circular buffer has this number of frames
+	if params.StartThresholdFrames > 0 {
+		threshold := C.snd_pcm_uframes_t(params.StartThresholdFrames)
+		if threshold > bufferSize {
+			threshold = bufferSize
+		}
+		if errCode := C.ALSA_sw_params(p.handle, threshold); errCode < 0 {
+			p.Close()
+			return nil, newALSAError(errCode)
+		}
+	}
+
+	// allocate the buffer of the size of the period, use the periodSize that we've got back
+	// from ALSA after it's wise decision
+	p.bufSamples = int(periodSize)
+	p.buf = make([]byte, p.bufSamples*numChans*bitDepthInBytes)
+
+	// Watch the sound cards so that the driver is reopened as soon as a USB interface is unplugged.
+	hotplug.StartCardWatcher()
+	p.card = int(C.ALSA_card(p.handle))
+	if p.card >= 0 {
+		p.removals = hotplug.CardRemovalCount(p.card)
+	}
+
+	return p, nil
+}
+
+func (p *driver) TryWrite(data []byte) (n int, err error) {
+	for len(data) > 0 {
+		toWrite := copy(p.buf[p.bufLen:], data)
+		p.bufLen += toWrite
+		data = data[toWrite:]
+		n += toWrite
+
+		// our buffer is not full and we've used up all the data, we'll keep them and finish
+		if p.bufLen < len(p.buf) {
+			break
+		}
+
+		// write samples to the main circular buffer
+		wrote := C.snd_pcm_writei(p.handle, unsafe.Pointer(&p.buf[0]), C.snd_pcm_uframes_t(p.bufSamples))
+		if wrote == -C.EPIPE || wrote == -C.ESTRPIPE || wrote == -C.EINTR {
+			// An underrun (xrun) happened, or the system was suspended.
+			if err := p.recoverXrun(C.int(wrote)); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		if wrote < 0 {
+			// an error occurred while writing samples
+			return 0, newALSAError(C.int(wrote))
+		}
+		// Move the remaining samples to the head of the buffer so that no allocation is needed.
+		p.bufLen = copy(p.buf, p.buf[int(wrote)*p.numChans*p.bitDepthInBytes:p.bufLen])
+	}
+	return n, nil
+}
+
+// recoverXrun recovers the stream from the error code of snd_pcm_writei according to the xrun policy.
+func (p *driver) recoverXrun(code C.int) error {
+	if code == -C.EPIPE {
+		p.underrunCount++
+		switch p.xrunPolicy {
+		case backend.XrunFail:
+			return newALSAError(code)
+		case backend.XrunReport:
+			if p.onXrun != nil {
+				p.onXrun(p.underrunCount)
+			}
+		}
+	}
+	// snd_pcm_recover prepares the stream again after an underrun, and waits for the device to
+	// resume after a suspension.
+	if errCode := C.snd_pcm_recover(p.handle, code, 1); errCode < 0 {
+		return newALSAError(errCode)
+	}
+	return nil
+}
+
+// DeviceRemoved implements driver.RemovalWatcher.
+func (p *driver) DeviceRemoved() bool {
+	if p.card < 0 {
+		return false
+	}
+	n := hotplug.CardRemovalCount(p.card)
+	if n == p.removals {
+		return false
+	}
+	p.removals = n
+	return true
+}
+
+// ReopensAfterSleep implements backend.SleepRecoverer. The device can be gone after the system sleeps.
+func (p *driver) ReopensAfterSleep() {}
+
+// Underruns implements driver.UnderrunCounter.
+func (p *driver) Underruns() int64 {
+	return p.underrunCount
+}
+
+func (p *driver) Close() error {
+	// drop the remaining unprocessed samples in the main circular buffer
+	if errCode := C.snd_pcm_drop(p.handle); errCode < 0 {
+		return newALSAError(errCode)
+	}
+	if errCode := C.snd_pcm_close(p.handle); errCode < 0 {
+		return newALSAError(errCode)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build darwin,!ios,!js
+
+package audioqueue
+
+// #include <CoreAudio/CoreAudio.h>
+//
+// OSStatus oto_addDefaultOutputDeviceListener(void);
+// OSStatus oto_addDevicesListener(void);
+import "C"
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/leibnewton/oto/internal/backend"
+)
+
+var (
+	// defaultDevice is the AudioDeviceID of the default output device, and defaultDeviceChanges is the
+	// number of the changes of the default output device. They are accessed atomically.
+	defaultDevice        uint32
+	defaultDeviceChanges int64
+
+	defaultDeviceWatcherOnce sync.Once
+)
+
+// watchDefaultOutputDevice starts listening to the changes of the default output device and the devices if
+// not yet, and returns the number of the changes of the default output device so far. The listeners live
+// as long as the process.
+func watchDefaultOutputDevice() int64 {
+	defaultDeviceWatcherOnce.Do(func() {
+		if id, ok := defaultOutputDevice(); ok {
+			atomic.StoreUint32(&defaultDevice, id)
+		}
+		// When the listeners can't be added, the sound stays on the old device as before.
+		C.oto_addDefaultOutputDeviceListener()
+		C.oto_addDevicesListener()
+	})
+	return atomic.LoadInt64(&defaultDeviceChanges)
+}
+
+//export oto_defaultOutputDeviceChanged
+func oto_defaultOutputDeviceChanged() {
+	id, ok := defaultOutputDevice()
+	if !ok {
+		return
+	}
+	old := atomic.SwapUint32(&defaultDevice, id)
+	if old == id {
+		return
+	}
+	atomic.AddInt64(&defaultDeviceChanges, 1)
+
+	// The default device changes to another one when the old one is unplugged, and to a new one when it
+	// is plugged in, as the route changes on iOS.
+	change := backend.RouteChangeNewDevice
+	if !deviceIsAlive(old) {
+		change = backend.RouteChangeOldDeviceUnavailable
+	}
+	backend.RouteChanged(change)
+}
+
+// DefaultDeviceChanged implements backend.DefaultDeviceFollower.
+func (d *driver) DefaultDeviceChanged() bool {
+	if !d.followsDefault {
+		return false
+	}
+	n := atomic.LoadInt64(&defaultDeviceChanges)
+	if n == d.defaultChanges {
+		return false
+	}
+	d.defaultChanges = n
+	return true
+}
+
+//export oto_devicesChanged
+func oto_devicesChanged() {
+	backend.DevicesChanged()
+}
@@ -0,0 +1,433 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !js
+
+package audioqueue
+
+// #cgo LDFLAGS: -framework AudioToolbox
+//
+// #import <AudioToolbox/AudioToolbox.h>
+//
+// void oto_render(void* inUserData, AudioQueueRef inAQ, AudioQueueBufferRef inBuffer);
+//
+// void oto_setNotificationHandler(AudioQueueRef audioQueue);
+import "C"
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+	"unsafe"
+
+	otodriver "github.com/leibnewton/oto/driver"
+	"github.com/leibnewton/oto/internal/backend"
+)
+
+const baseQueueBufferSize = 1024
+
+const driverName = "audioqueue"
+
+func init() {
+	backend.Register(&backend.Driver{
+		Name: driverName,
+		Open: newDriver,
+		Capabilities: backend.Capabilities{
+			MinLatency:   10 * time.Millisecond,
+			DeviceSwitch: false,
+		},
+		Devices: func(mapperInclude bool) ([]*backend.Device, error) {
+			return outputDevices()
+		},
+		CreateAggregateDevice:  createAggregateDevice,
+		DestroyAggregateDevice: destroyAggregateDevice,
+	})
+}
+
+type audioInfo struct {
+	channelNum        int
+	bitDepthInBytes   int
+	queueBufferFrames int
+}
+
+func (a *audioInfo) queueBufferSize() int {
+	return a.queueBufferFrames * a.channelNum * a.bitDepthInBytes
+}
+
+type driver struct {
+	audioQueue    C.AudioQueueRef
+	buf           []byte
+	bufSize       int
+	storage       []byte
+	renderBuf     []byte
+	sampleRate    int
+	audioInfo     *audioInfo
+	buffers       []C.AudioQueueBufferRef
+	paused        bool
+	lastPauseTime time.Time
+
+	// followsDefault is whether the driver plays on the default device, and defaultChanges is the number of
+	// the changes of the default device when they were checked last.
+	followsDefault bool
+	defaultChanges int64
+
+	err error
+
+	chWrite   chan []byte
+	chWritten chan int
+
+	m sync.Mutex
+}
+
+var (
+	theDriver *driver
+	driverM   sync.Mutex
+)
+
+func setDriver(d *driver) {
+	driverM.Lock()
+	defer driverM.Unlock()
+
+	if theDriver != nil && d != nil {
+		panic("oto: at most one driver object can exist")
+	}
+	theDriver = d
+
+	if d != nil {
+		setNotificationHandler(d)
+	}
+}
+
+func getDriver() *driver {
+	driverM.Lock()
+	defer driverM.Unlock()
+
+	return theDriver
+}
+
+// TOOD: Convert the error code correctly.
+// See https://stackoverflow.com/questions/2196869/how-do-you-convert-an-iphone-osstatus-code-to-something-useful
+
+// osStatusError is a status code of Core Audio.
+type osStatusError struct {
+	fname  string
+	status C.OSStatus
+}
+
+func newOSStatusError(fname string, status C.OSStatus) error {
+	return &osStatusError{
+		fname:  fname,
+		status: status,
+	}
+}
+
+func (e *osStatusError) Error() string {
+	return fmt.Sprintf("oto: %s failed: %d", e.fname, e.status)
+}
+
+// Driver implements oto.DriverError.
+func (e *osStatusError) Driver() string {
+	return driverName
+}
+
+// Code implements oto.DriverError.
+func (e *osStatusError) Code() int {
+	return int(e.status)
+}
+
+// Is reports whether e corresponds to target, one of the errors like driver.ErrDeviceBusy.
+func (e *osStatusError) Is(target error) bool {
+	// The four-character codes are not exposed as constants via cgo.
+	const (
+		audioFormatUnsupportedDataFormatError = 0x666d743f // 'fmt?'
+		audioHardwareBadDeviceError           = 0x21646576 // '!dev'
+		audioHardwareNotRunningError          = 0x73746f70 // 'stop'
+		audioDevicePermissionsError           = 0x21686f67 // '!hog'
+		audioQueueErrInvalidDevice            = -66680
+		audioQueueErrCannotStart              = -66681
+	)
+	switch target {
+	case otodriver.ErrDeviceBusy:
+		return e.status == audioDevicePermissionsError || e.status == audioQueueErrCannotStart
+	case otodriver.ErrNoDevice:
+		return e.status == audioHardwareBadDeviceError || e.status == audioQueueErrInvalidDevice
+	case otodriver.ErrDeviceLost:
+		return e.status == audioHardwareNotRunningError
+	case otodriver.ErrUnsupportedFormat:
+		return e.status == audioFormatUnsupportedDataFormatError
+	}
+	return false
+}
+
+func newDriver(params *backend.Params) (otodriver.Driver, error) {
+	sampleRate := params.SampleRate
+	channelNum := params.ChannelNum
+	bitDepthInBytes := params.BytesPerSample
+
+	flags := C.kAudioFormatFlagIsPacked
+	if bitDepthInBytes != 1 {
+		flags |= C.kAudioFormatFlagIsSignedInteger
+	}
+	desc := C.AudioStreamBasicDescription{
+		mSampleRate:       C.double(sampleRate),
+		mFormatID:         C.kAudioFormatLinearPCM,
+		mFormatFlags:      C.UInt32(flags),
+		mBytesPerPacket:   C.UInt32(channelNum * bitDepthInBytes),
+		mFramesPerPacket:  1,
+		mBytesPerFrame:    C.UInt32(channelNum * bitDepthInBytes),
+		mChannelsPerFrame: C.UInt32(channelNum),
+		mBitsPerChannel:   C.UInt32(8 * bitDepthInBytes),
+	}
+
+	// The I/O buffer of the device is set before the audio queue is created, so that the queue
+	// runs with the requested I/O cycle.
+	if params.IOBufferFrames > 0 {
+		if err := setIOBufferFrames(params.IOBufferFrames, sampleRate); err != nil {
+			return nil, err
+		}
+	}
+
+	queueBufferFrames := baseQueueBufferSize
+	if params.PeriodFrames > 0 {
+		queueBufferFrames = params.PeriodFrames
+	}
+
+	audioInfo := &audioInfo{
+		channelNum:        channelNum,
+		bitDepthInBytes:   bitDepthInBytes,
+		queueBufferFrames: queueBufferFrames,
+	}
+
+	var audioQueue C.AudioQueueRef
+	if osstatus := C.AudioQueueNewOutput(
+		&desc,
+		(C.AudioQueueOutputCallback)(C.oto_render),
+		unsafe.Pointer(audioInfo),
+		(C.CFRunLoopRef)(0),
+		(C.CFStringRef)(0),
+		0,
+		&audioQueue); osstatus != C.noErr {
+		return nil, newOSStatusError("AudioQueueNewFormat with StreamFormat", osstatus)
+	}
+	if err := setQueueDevice(audioQueue, params.Device); err != nil {
+		C.AudioQueueDispose(audioQueue, C.true)
+		return nil, err
+	}
+
+	queueBufferSize := audioInfo.queueBufferSize()
+	nbuf := params.BufferSizeInBytes() / queueBufferSize
+	if nbuf <= 1 {
+		nbuf = 2
+	}
+	if params.PeriodCount > 0 {
+		nbuf = params.PeriodCount
+	}
+
+	d := &driver{
+		audioQueue: audioQueue,
+		sampleRate: sampleRate,
+		audioInfo:  audioInfo,
+		bufSize:    nbuf * queueBufferSize,
+		storage:    make([]byte, nbuf*queueBufferSize),
+		renderBuf:  make([]byte, 0, queueBufferSize),
+		buffers:    make([]C.AudioQueueBufferRef, nbuf),
+		chWrite:    make(chan []byte),
+		chWritten:  make(chan int),
+
+		followsDefault: params.Device < 0,
+		defaultChanges: watchDefaultOutputDevice(),
+	}
+	runtime.SetFinalizer(d, (*driver).Close)
+	// Set the driver before setting the rendering callback.
+	setDriver(d)
+
+	for i := 0; i < len(d.buffers); i++ {
+		if osstatus := C.AudioQueueAllocateBuffer(audioQueue, C.UInt32(queueBufferSize), &d.buffers[i]); osstatus != C.noErr {
+			return nil, newOSStatusError("AudioQueueAllocateBuffer", osstatus)
+		}
+		d.buffers[i].mAudioDataByteSize = C.UInt32(queueBufferSize)
+		for j := 0; j < queueBufferSize; j++ {
+			*(*byte)(unsafe.Pointer(uintptr(unsafe.Pointer(d.buffers[i].mAudioData)) + uintptr(j))) = 0
+		}
+		if osstatus := C.AudioQueueEnqueueBuffer(audioQueue, d.buffers[i], 0, nil); osstatus != C.noErr {
+			return nil, newOSStatusError("AudioQueueEnqueueBuffer", osstatus)
+		}
+	}
+
+	if osstatus := C.AudioQueueStart(audioQueue, nil); osstatus != C.noErr {
+		return nil, newOSStatusError("AudioQueueStart", osstatus)
+	}
+
+	return d, nil
+}
+
+//export oto_render
+func oto_render(inUserData unsafe.Pointer, inAQ C.AudioQueueRef, inBuffer C.AudioQueueBufferRef) {
+	audioInfo := (*audioInfo)(inUserData)
+	queueBufferSize := audioInfo.queueBufferSize()
+
+	d := getDriver()
+
+	// Reuse the buffer so that the callback doesn't allocate in the steady state.
+	buf := d.renderBuf[:0]
+
+	// Set the timer. When the input does not come, the audio must be paused.
+	s := time.Second * time.Duration(queueBufferSize) / time.Duration(d.sampleRate*d.audioInfo.channelNum*d.audioInfo.bitDepthInBytes)
+	t := time.NewTicker(s)
+	defer t.Stop()
+	ch := t.C
+
+	for len(buf) < queueBufferSize {
+		select {
+		case dbuf := <-d.chWrite:
+			d.resume(false)
+			n := queueBufferSize - len(buf)
+			if n > len(dbuf) {
+				n = len(dbuf)
+			}
+			buf = append(buf, dbuf[:n]...)
+			d.chWritten <- n
+		case <-ch:
+			d.pause()
+			ch = nil
+		}
+	}
+
+	for i := 0; i < queueBufferSize; i++ {
+		*(*byte)(unsafe.Pointer(uintptr(inBuffer.mAudioData) + uintptr(i))) = buf[i]
+	}
+	// Do not update mAudioDataByteSize, or the buffer is not used correctly any more.
+
+	d.enqueueBuffer(inBuffer)
+}
+
+func (d *driver) TryWrite(data []byte) (int, error) {
+	d.m.Lock()
+	err := d.err
+	d.m.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	n := d.bufSize - len(d.buf)
+	if n > len(data) {
+		n = len(data)
+	}
+	d.buf = append(d.buf, data[:n]...)
+	// Use the buffer only when the buffer length is enough to avoid choppy sound.
+	queueBufferSize := d.audioInfo.queueBufferSize()
+	for len(d.buf) >= queueBufferSize {
+		d.chWrite <- d.buf
+		n := <-d.chWritten
+		d.buf = d.buf[n:]
+	}
+	// Move the remaining data to the head of the storage so that append doesn't allocate.
+	d.buf = d.storage[:copy(d.storage, d.buf)]
+	return n, nil
+}
+
+func (d *driver) Close() error {
+	runtime.SetFinalizer(d, nil)
+
+	if osstatus := C.AudioQueueStop(d.audioQueue, C.false); osstatus != C.noErr {
+		return newOSStatusError("AudioQueueStop", osstatus)
+	}
+	if osstatus := C.AudioQueueDispose(d.audioQueue, C.false); osstatus != C.noErr {
+		return newOSStatusError("AudioQueueDispose", osstatus)
+	}
+	d.audioQueue = nil
+	setDriver(nil)
+	return nil
+}
+
+func (d *driver) enqueueBuffer(buffer C.AudioQueueBufferRef) {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	if osstatus := C.AudioQueueEnqueueBuffer(d.audioQueue, buffer, 0, nil); osstatus != C.noErr && d.err == nil {
+		d.err = newOSStatusError("AudioQueueEnqueueBuffer", osstatus)
+		return
+	}
+}
+
+func (d *driver) resume(afterSleep bool) {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	// Audio doesn't work soon after recovering from sleeping. Wait for a while
+	// (hajimehoshi/ebiten#1259).
+	if afterSleep {
+		// After short-time sleeping, 500ms more sleeping is enough. However, after long-time sleeping, it
+		// looks like 1 second more sleeping are required (hajimehoshi/ebiten#1280).
+		// This is tested on MacBook Pro 2020 macOS 10.15.6.
+		if time.Now().Sub(d.lastPauseTime) < 30*time.Second {
+			time.Sleep(500 * time.Millisecond)
+		} else {
+			time.Sleep(time.Second)
+		}
+	}
+
+	if !d.paused {
+		return
+	}
+	if osstatus := C.AudioQueueStart(d.audioQueue, nil); osstatus != C.noErr && d.err == nil {
+		d.err = newOSStatusError("AudioQueueStart", osstatus)
+		return
+	}
+	d.paused = false
+}
+
+func (d *driver) pause() {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	if d.paused {
+		return
+	}
+	if osstatus := C.AudioQueuePause(d.audioQueue); osstatus != C.noErr && d.err == nil {
+		d.err = newOSStatusError("AudioQueuePause", osstatus)
+		return
+	}
+	d.paused = true
+	d.lastPauseTime = time.Now()
+}
+
+// OutputLatency implements backend.OutputLatencier.
+func (d *driver) OutputLatency() (time.Duration, bool) {
+	return deviceOutputLatency()
+}
+
+func setNotificationHandler(driver *driver) {
+	C.oto_setNotificationHandler(driver.audioQueue)
+}
+
+//export oto_setGlobalPause
+func oto_setGlobalPause(paused C.int) {
+	if paused != 0 {
+		theDriver.pause()
+	} else {
+		theDriver.resume(true)
+	}
+}
+
+//export oto_setErrorByNotification
+func oto_setErrorByNotification(s C.OSStatus, from *C.char) {
+	if theDriver.err != nil {
+		return
+	}
+
+	gofrom := C.GoString(from)
+	theDriver.err = newOSStatusError(gofrom+" at notification", s)
+}
@@ -0,0 +1,104 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build darwin,ios,!js
+
+package audioqueue
+
+// #cgo LDFLAGS: -framework Foundation -framework AVFoundation
+//
+// #import <AudioToolbox/AudioToolbox.h>
+//
+// int oto_activateAudioSession(void);
+// int oto_setPreferredIOBufferDuration(double duration);
+// double oto_outputLatency(int* bluetooth);
+import "C"
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/leibnewton/oto/internal/backend"
+)
+
+func componentSubType() C.OSType {
+	return C.kAudioUnitSubType_RemoteIO
+}
+
+// setIOBufferFrames sets the preferred I/O buffer duration of the audio session.
+func setIOBufferFrames(frames, sampleRate int) error {
+	d := float64(frames) / float64(sampleRate)
+	if code := C.oto_setPreferredIOBufferDuration(C.double(d)); code != 0 {
+		return fmt.Errorf("oto: setPreferredIOBufferDuration failed: %d", code)
+	}
+	return nil
+}
+
+// deviceOutputLatency returns the output latency of the audio session's route, and whether the route is a
+// Bluetooth device.
+func deviceOutputLatency() (time.Duration, bool) {
+	var bluetooth C.int
+	s := float64(C.oto_outputLatency(&bluetooth))
+	return time.Duration(s * float64(time.Second)), bluetooth != 0
+}
+
+//export oto_setInterrupted
+func oto_setInterrupted(interrupted C.int) {
+	d := getDriver()
+	if interrupted != 0 {
+		// The Players are paused first so that nothing is lost while the queue is paused.
+		backend.Interrupted(true, nil)
+		if d != nil {
+			d.pause()
+		}
+		return
+	}
+
+	// Without activating the session again, the audio queue would start but play nothing.
+	var err error
+	if code := C.oto_activateAudioSession(); code != 0 {
+		err = fmt.Errorf("oto: setActive failed: %d", code)
+	}
+	if d != nil {
+		d.resume(false)
+	}
+	backend.Interrupted(false, err)
+}
+
+//export oto_routeChanged
+func oto_routeChanged(change C.int) {
+	backend.RouteChanged(backend.RouteChange(change))
+}
+
+// outputDevices returns no devices, since the audio session chooses the route on iOS.
+func outputDevices() ([]*backend.Device, error) {
+	return nil, nil
+}
+
+// watchDefaultOutputDevice does nothing, since the route changes are notified by the audio session on iOS.
+func watchDefaultOutputDevice() int64 {
+	return 0
+}
+
+func setQueueDevice(queue C.AudioQueueRef, deviceNum int) error {
+	return nil
+}
+
+func createAggregateDevice(name string, devices []*backend.Device, stacked bool) (*backend.Device, error) {
+	return nil, fmt.Errorf("oto: aggregate devices are not supported on iOS")
+}
+
+func destroyAggregateDevice(device *backend.Device) error {
+	return fmt.Errorf("oto: aggregate devices are not supported on iOS")
+}
@@ -0,0 +1,129 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build darwin,ios
+
+#import <AVFoundation/AVFoundation.h>
+#import <AudioToolbox/AudioToolbox.h>
+
+#include "_cgo_export.h"
+
+@interface OtoInterruptObserver : NSObject {
+}
+
+- (void) onAudioSessionEvent: (NSNotification*)notification;
+
+@end
+
+@implementation OtoInterruptObserver {
+}
+
+- (void) onAudioSessionEvent: (NSNotification *)notification
+{
+  if ([notification.name isEqualToString:AVAudioSessionRouteChangeNotification]) {
+    NSObject* value = [notification.userInfo valueForKey:AVAudioSessionRouteChangeReasonKey];
+    AVAudioSessionRouteChangeReason reason = [(NSNumber*)value unsignedIntegerValue];
+    // The values must match oto.RouteChange.
+    switch (reason) {
+    case AVAudioSessionRouteChangeReasonNewDeviceAvailable:
+      oto_routeChanged(0);
+      break;
+    case AVAudioSessionRouteChangeReasonOldDeviceUnavailable:
+      oto_routeChanged(1);
+      break;
+    default:
+      oto_routeChanged(2);
+      break;
+    }
+    return;
+  }
+
+  if (![notification.name isEqualToString:AVAudioSessionInterruptionNotification]) {
+    return;
+  }
+
+  NSObject* value = [notification.userInfo valueForKey:AVAudioSessionInterruptionTypeKey];
+  AVAudioSessionInterruptionType interruptionType = [(NSNumber*)value intValue];
+  switch (interruptionType) {
+  case AVAudioSessionInterruptionTypeBegan: {
+    oto_setInterrupted(YES);
+    break;
+  }
+  case AVAudioSessionInterruptionTypeEnded: {
+    oto_setInterrupted(NO);
+    break;
+  }
+  default:
+    NSAssert(NO, @"unexpected AVAudioSessionInterruptionType: %lu",
+             (unsigned long)(interruptionType));
+    break;
+  }
+}
+
+@end
+
+// oto_setNotificationHandler sets a handler for interruption and route change events.
+// Without the handler, Siri would stop the audio (#80).
+// The handler is set only once, since the driver is created again when the device is reopened, and each
+// event must be handled only once.
+void oto_setNotificationHandler(AudioQueueRef audioQueue) {
+  static OtoInterruptObserver* observer = nil;
+  if (observer) {
+    return;
+  }
+  AVAudioSession* session = [AVAudioSession sharedInstance];
+  observer = [[OtoInterruptObserver alloc] init];
+  [[NSNotificationCenter defaultCenter] addObserver: observer
+                                           selector: @selector(onAudioSessionEvent:)
+                                               name: AVAudioSessionInterruptionNotification
+                                             object: session];
+  [[NSNotificationCenter defaultCenter] addObserver: observer
+                                           selector: @selector(onAudioSessionEvent:)
+                                               name: AVAudioSessionRouteChangeNotification
+                                             object: session];
+}
+
+// oto_activateAudioSession activates the audio session again after an interruption. The session is
+// deactivated by the system during the interruption.
+int oto_activateAudioSession(void) {
+  NSError* error = nil;
+  if (![[AVAudioSession sharedInstance] setActive:YES error:&error]) {
+    return (int)error.code;
+  }
+  return 0;
+}
+
+int oto_setPreferredIOBufferDuration(double duration) {
+  NSError* error = nil;
+  if (![[AVAudioSession sharedInstance] setPreferredIOBufferDuration:duration
+                                                               error:&error]) {
+    return (int)error.code;
+  }
+  return 0;
+}
+
+// oto_outputLatency returns the latency of the output route in seconds, and sets whether the route is a
+// Bluetooth device. The latency includes the codec and the transport of a Bluetooth device.
+double oto_outputLatency(int* bluetooth) {
+  AVAudioSession* session = [AVAudioSession sharedInstance];
+  *bluetooth = 0;
+  for (AVAudioSessionPortDescription* port in session.currentRoute.outputs) {
+    if ([port.portType isEqualToString:AVAudioSessionPortBluetoothA2DP] ||
+        [port.portType isEqualToString:AVAudioSessionPortBluetoothLE] ||
+        [port.portType isEqualToString:AVAudioSessionPortBluetoothHFP]) {
+      *bluetooth = 1;
+    }
+  }
+  return session.outputLatency;
+}
@@ -0,0 +1,380 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build darwin,!ios,!js
+
+package audioqueue
+
+// #cgo LDFLAGS: -framework AppKit -framework CoreAudio -framework CoreFoundation
+//
+// #import <AudioToolbox/AudioToolbox.h>
+// #import <CoreAudio/CoreAudio.h>
+// #import <CoreFoundation/CoreFoundation.h>
+// #include <stdlib.h>
+//
+// static OSStatus oto_setIOBufferFrameSize(UInt32 frames) {
+//   AudioObjectPropertyAddress addr = {
+//     kAudioHardwarePropertyDefaultOutputDevice,
+//     kAudioObjectPropertyScopeGlobal,
+//     kAudioObjectPropertyElementMaster,
+//   };
+//   AudioDeviceID device = kAudioObjectUnknown;
+//   UInt32 size = sizeof(device);
+//   OSStatus status = AudioObjectGetPropertyData(kAudioObjectSystemObject, &addr, 0, NULL, &size, &device);
+//   if (status != noErr) {
+//     return status;
+//   }
+//
+//   // The buffer frame size applies only to this process's I/O with the device.
+//   addr.mSelector = kAudioDevicePropertyBufferFrameSize;
+//   addr.mScope = kAudioDevicePropertyScopeOutput;
+//   return AudioObjectSetPropertyData(device, &addr, 0, NULL, sizeof(frames), &frames);
+// }
+//
+// // oto_outputLatency gets the latency and the safety offset of the default output device in frames, its
+// // sample rate, and whether it is a Bluetooth device.
+// static OSStatus oto_outputLatency(UInt32* frames, Float64* sampleRate, int* bluetooth) {
+//   AudioObjectPropertyAddress addr = {
+//     kAudioHardwarePropertyDefaultOutputDevice,
+//     kAudioObjectPropertyScopeGlobal,
+//     kAudioObjectPropertyElementMaster,
+//   };
+//   AudioDeviceID device = kAudioObjectUnknown;
+//   UInt32 size = sizeof(device);
+//   OSStatus status = AudioObjectGetPropertyData(kAudioObjectSystemObject, &addr, 0, NULL, &size, &device);
+//   if (status != noErr) {
+//     return status;
+//   }
+//
+//   UInt32 transportType = 0;
+//   addr.mSelector = kAudioDevicePropertyTransportType;
+//   size = sizeof(transportType);
+//   if (AudioObjectGetPropertyData(device, &addr, 0, NULL, &size, &transportType) == noErr) {
+//     *bluetooth = transportType == kAudioDeviceTransportTypeBluetooth ||
+//         transportType == kAudioDeviceTransportTypeBluetoothLE;
+//   }
+//
+//   addr.mSelector = kAudioDevicePropertyNominalSampleRate;
+//   size = sizeof(*sampleRate);
+//   status = AudioObjectGetPropertyData(device, &addr, 0, NULL, &size, sampleRate);
+//   if (status != noErr) {
+//     return status;
+//   }
+//
+//   addr.mScope = kAudioDevicePropertyScopeOutput;
+//   UInt32 latency = 0;
+//   addr.mSelector = kAudioDevicePropertyLatency;
+//   size = sizeof(latency);
+//   status = AudioObjectGetPropertyData(device, &addr, 0, NULL, &size, &latency);
+//   if (status != noErr) {
+//     return status;
+//   }
+//   UInt32 safetyOffset = 0;
+//   addr.mSelector = kAudioDevicePropertySafetyOffset;
+//   size = sizeof(safetyOffset);
+//   status = AudioObjectGetPropertyData(device, &addr, 0, NULL, &size, &safetyOffset);
+//   if (status != noErr) {
+//     return status;
+//   }
+//   *frames = latency + safetyOffset;
+//   return noErr;
+// }
+//
+// // oto_deviceIDs gets the IDs of the audio devices. count is the capacity of ids, and is set to the
+// // number of the devices.
+// static OSStatus oto_deviceIDs(AudioDeviceID* ids, UInt32* count) {
+//   AudioObjectPropertyAddress addr = {
+//     kAudioHardwarePropertyDevices,
+//     kAudioObjectPropertyScopeGlobal,
+//     kAudioObjectPropertyElementMaster,
+//   };
+//   UInt32 size = *count * sizeof(AudioDeviceID);
+//   OSStatus status = AudioObjectGetPropertyData(kAudioObjectSystemObject, &addr, 0, NULL, &size, ids);
+//   *count = size / sizeof(AudioDeviceID);
+//   return status;
+// }
+//
+// // oto_outputChannels returns the number of the output channels of the device, which is 0 for an input
+// // device.
+// static UInt32 oto_outputChannels(AudioDeviceID device) {
+//   AudioObjectPropertyAddress addr = {
+//     kAudioDevicePropertyStreamConfiguration,
+//     kAudioDevicePropertyScopeOutput,
+//     kAudioObjectPropertyElementMaster,
+//   };
+//   UInt32 size = 0;
+//   if (AudioObjectGetPropertyDataSize(device, &addr, 0, NULL, &size) != noErr || size == 0) {
+//     return 0;
+//   }
+//   AudioBufferList* list = malloc(size);
+//   UInt32 channels = 0;
+//   if (AudioObjectGetPropertyData(device, &addr, 0, NULL, &size, list) == noErr) {
+//     for (UInt32 i = 0; i < list->mNumberBuffers; i++) {
+//       channels += list->mBuffers[i].mNumberChannels;
+//     }
+//   }
+//   free(list);
+//   return channels;
+// }
+//
+// static void oto_deviceName(AudioDeviceID device, char* name, int len) {
+//   AudioObjectPropertyAddress addr = {
+//     kAudioObjectPropertyName,
+//     kAudioObjectPropertyScopeGlobal,
+//     kAudioObjectPropertyElementMaster,
+//   };
+//   CFStringRef str = NULL;
+//   UInt32 size = sizeof(str);
+//   name[0] = '\0';
+//   if (AudioObjectGetPropertyData(device, &addr, 0, NULL, &size, &str) != noErr || str == NULL) {
+//     return;
+//   }
+//   CFStringGetCString(str, name, len, kCFStringEncodingUTF8);
+//   CFRelease(str);
+// }
+//
+// // oto_copyDeviceUID returns the UID of the device, or NULL. The caller must release the UID.
+// static CFStringRef oto_copyDeviceUID(AudioDeviceID device) {
+//   AudioObjectPropertyAddress addr = {
+//     kAudioDevicePropertyDeviceUID,
+//     kAudioObjectPropertyScopeGlobal,
+//     kAudioObjectPropertyElementMaster,
+//   };
+//   CFStringRef uid = NULL;
+//   UInt32 size = sizeof(uid);
+//   if (AudioObjectGetPropertyData(device, &addr, 0, NULL, &size, &uid) != noErr) {
+//     return NULL;
+//   }
+//   return uid;
+// }
+//
+// // oto_setQueueDevice makes the audio queue play on the device instead of the default device.
+// static OSStatus oto_setQueueDevice(AudioQueueRef queue, AudioDeviceID device) {
+//   CFStringRef uid = oto_copyDeviceUID(device);
+//   if (uid == NULL) {
+//     return kAudioHardwareBadDeviceError;
+//   }
+//   OSStatus status = AudioQueueSetProperty(queue, kAudioQueueProperty_CurrentDevice, &uid, sizeof(uid));
+//   CFRelease(uid);
+//   return status;
+// }
+//
+// static OSStatus oto_defaultOutputDevice(AudioDeviceID* device) {
+//   AudioObjectPropertyAddress addr = {
+//     kAudioHardwarePropertyDefaultOutputDevice,
+//     kAudioObjectPropertyScopeGlobal,
+//     kAudioObjectPropertyElementMaster,
+//   };
+//   UInt32 size = sizeof(*device);
+//   return AudioObjectGetPropertyData(kAudioObjectSystemObject, &addr, 0, NULL, &size, device);
+// }
+//
+// static int oto_deviceIsAlive(AudioDeviceID device) {
+//   AudioObjectPropertyAddress addr = {
+//     kAudioDevicePropertyDeviceIsAlive,
+//     kAudioObjectPropertyScopeGlobal,
+//     kAudioObjectPropertyElementMaster,
+//   };
+//   UInt32 alive = 0;
+//   UInt32 size = sizeof(alive);
+//   if (AudioObjectGetPropertyData(device, &addr, 0, NULL, &size, &alive) != noErr) {
+//     return 0;
+//   }
+//   return alive != 0;
+// }
+//
+// static CFNumberRef oto_number(int value) {
+//   return CFNumberCreate(NULL, kCFNumberIntType, &value);
+// }
+//
+// // oto_createAggregateDevice creates a private aggregate device of the devices. The first device is the
+// // clock source, and the others are drift-compensated.
+// static OSStatus oto_createAggregateDevice(const char* name, const char* uid, const AudioDeviceID* devices, int n, int stacked, AudioDeviceID* out) {
+//   CFMutableArrayRef subs = CFArrayCreateMutable(NULL, n, &kCFTypeArrayCallBacks);
+//   CFNumberRef one = oto_number(1);
+//   CFStringRef master = NULL;
+//   for (int i = 0; i < n; i++) {
+//     CFStringRef sub = oto_copyDeviceUID(devices[i]);
+//     if (sub == NULL) {
+//       if (master != NULL) {
+//         CFRelease(master);
+//       }
+//       CFRelease(one);
+//       CFRelease(subs);
+//       return kAudioHardwareBadDeviceError;
+//     }
+//     CFMutableDictionaryRef d = CFDictionaryCreateMutable(NULL, 0, &kCFTypeDictionaryKeyCallBacks, &kCFTypeDictionaryValueCallBacks);
+//     CFDictionarySetValue(d, CFSTR(kAudioSubDeviceUIDKey), sub);
+//     if (i > 0) {
+//       CFDictionarySetValue(d, CFSTR(kAudioSubDeviceDriftCompensationKey), one);
+//     }
+//     CFArrayAppendValue(subs, d);
+//     CFRelease(d);
+//     if (i == 0) {
+//       master = sub;
+//     } else {
+//       CFRelease(sub);
+//     }
+//   }
+//
+//   CFStringRef cfName = CFStringCreateWithCString(NULL, name, kCFStringEncodingUTF8);
+//   CFStringRef cfUID = CFStringCreateWithCString(NULL, uid, kCFStringEncodingUTF8);
+//   CFNumberRef cfStacked = oto_number(stacked);
+//   CFMutableDictionaryRef desc = CFDictionaryCreateMutable(NULL, 0, &kCFTypeDictionaryKeyCallBacks, &kCFTypeDictionaryValueCallBacks);
+//   CFDictionarySetValue(desc, CFSTR(kAudioAggregateDeviceNameKey), cfName);
+//   CFDictionarySetValue(desc, CFSTR(kAudioAggregateDeviceUIDKey), cfUID);
+//   CFDictionarySetValue(desc, CFSTR(kAudioAggregateDeviceSubDeviceListKey), subs);
+//   CFDictionarySetValue(desc, CFSTR(kAudioAggregateDeviceMasterSubDeviceKey), master);
+//   CFDictionarySetValue(desc, CFSTR(kAudioAggregateDeviceIsPrivateKey), one);
+//   CFDictionarySetValue(desc, CFSTR(kAudioAggregateDeviceIsStackedKey), cfStacked);
+//   OSStatus status = AudioHardwareCreateAggregateDevice(desc, out);
+//
+//   CFRelease(desc);
+//   CFRelease(cfStacked);
+//   CFRelease(cfUID);
+//   CFRelease(cfName);
+//   CFRelease(master);
+//   CFRelease(one);
+//   CFRelease(subs);
+//   return status;
+// }
+import "C"
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/leibnewton/oto/internal/backend"
+)
+
+func componentSubType() C.OSType {
+	return C.kAudioUnitSubType_DefaultOutput
+}
+
+// setIOBufferFrames sets the I/O buffer size of the default output device.
+func setIOBufferFrames(frames, sampleRate int) error {
+	if osstatus := C.oto_setIOBufferFrameSize(C.UInt32(frames)); osstatus != C.noErr {
+		return newOSStatusError("setting kAudioDevicePropertyBufferFrameSize", osstatus)
+	}
+	return nil
+}
+
+// deviceOutputLatency returns the latency of the default output device, and whether it is a Bluetooth
+// device. Core Audio's latency of a Bluetooth device doesn't include the codec and the transport, so
+// backend.BluetoothLatency is added for it.
+func deviceOutputLatency() (time.Duration, bool) {
+	var frames C.UInt32
+	var sampleRate C.Float64
+	var bluetooth C.int
+	if osstatus := C.oto_outputLatency(&frames, &sampleRate, &bluetooth); osstatus != C.noErr || sampleRate <= 0 {
+		return 0, bluetooth != 0
+	}
+	l := time.Duration(float64(frames) / float64(sampleRate) * float64(time.Second))
+	if bluetooth != 0 {
+		l += backend.BluetoothLatency
+	}
+	return l, bluetooth != 0
+}
+
+// maxDevices is the maximum number of the devices listed by outputDevices.
+const maxDevices = 64
+
+// outputDevices returns the output devices. Number of a Device is its AudioDeviceID.
+func outputDevices() ([]*backend.Device, error) {
+	var ids [maxDevices]C.AudioDeviceID
+	n := C.UInt32(len(ids))
+	if osstatus := C.oto_deviceIDs(&ids[0], &n); osstatus != C.noErr {
+		return nil, newOSStatusError("getting kAudioHardwarePropertyDevices", osstatus)
+	}
+	var devices []*backend.Device
+	var name [256]C.char
+	for _, id := range ids[:n] {
+		channels := int(C.oto_outputChannels(id))
+		if channels == 0 {
+			continue
+		}
+		C.oto_deviceName(id, &name[0], C.int(len(name)))
+		devices = append(devices, &backend.Device{
+			Name:     C.GoString(&name[0]),
+			Number:   int(id),
+			Channels: channels,
+		})
+	}
+	return devices, nil
+}
+
+// setQueueDevice makes the audio queue play on the device instead of the default device. -1 means the
+// default device.
+func setQueueDevice(queue C.AudioQueueRef, deviceNum int) error {
+	if deviceNum < 0 {
+		return nil
+	}
+	if osstatus := C.oto_setQueueDevice(queue, C.AudioDeviceID(deviceNum)); osstatus != C.noErr {
+		return newOSStatusError("setting kAudioQueueProperty_CurrentDevice", osstatus)
+	}
+	return nil
+}
+
+// aggregateDevices is the number of the aggregate devices created, which makes their UIDs unique.
+var aggregateDevices int32
+
+func createAggregateDevice(name string, devices []*backend.Device, stacked bool) (*backend.Device, error) {
+	ids := make([]C.AudioDeviceID, len(devices))
+	for i, d := range devices {
+		ids[i] = C.AudioDeviceID(d.Number)
+	}
+	uid := fmt.Sprintf("oto.aggregate.%d.%d", os.Getpid(), atomic.AddInt32(&aggregateDevices, 1))
+
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	cuid := C.CString(uid)
+	defer C.free(unsafe.Pointer(cuid))
+	var cstacked C.int
+	if stacked {
+		cstacked = 1
+	}
+	var id C.AudioDeviceID
+	if osstatus := C.oto_createAggregateDevice(cname, cuid, &ids[0], C.int(len(ids)), cstacked, &id); osstatus != C.noErr {
+		return nil, newOSStatusError("AudioHardwareCreateAggregateDevice", osstatus)
+	}
+	return &backend.Device{
+		Name:     name,
+		Number:   int(id),
+		Channels: int(C.oto_outputChannels(id)),
+	}, nil
+}
+
+func destroyAggregateDevice(device *backend.Device) error {
+	if osstatus := C.AudioHardwareDestroyAggregateDevice(C.AudioObjectID(device.Number)); osstatus != C.noErr {
+		return newOSStatusError("AudioHardwareDestroyAggregateDevice", osstatus)
+	}
+	return nil
+}
+
+// defaultOutputDevice returns the AudioDeviceID of the default output device.
+func defaultOutputDevice() (uint32, bool) {
+	var id C.AudioDeviceID
+	if osstatus := C.oto_defaultOutputDevice(&id); osstatus != C.noErr {
+		return 0, false
+	}
+	return uint32(id), true
+}
+
+// deviceIsAlive reports whether the device is still connected.
+func deviceIsAlive(id uint32) bool {
+	return C.oto_deviceIsAlive(C.AudioDeviceID(id)) != 0
+}
@@ -15,6 +15,7 @@
 // +build darwin,!ios,!js
 
 #import <AppKit/AppKit.h>
+#import <CoreAudio/CoreAudio.h>
 
 #include "_cgo_export.h"
 
@@ -51,3 +52,37 @@ void oto_setNotificationHandler(AudioQueueRef audioQueue) {
              name:NSWorkspaceDidWakeNotification
            object:NULL];
 }
+
+static OSStatus oto_defaultOutputDeviceListener(AudioObjectID object, UInt32 numAddresses,
+                                                const AudioObjectPropertyAddress *addresses,
+                                                void *clientData) {
+  oto_defaultOutputDeviceChanged();
+  return noErr;
+}
+
+// oto_addDefaultOutputDeviceListener registers a listener of the changes of the default output device.
+OSStatus oto_addDefaultOutputDeviceListener(void) {
+  AudioObjectPropertyAddress addr = {
+      kAudioHardwarePropertyDefaultOutputDevice,
+      kAudioObjectPropertyScopeGlobal,
+      kAudioObjectPropertyElementMaster,
+  };
+  return AudioObjectAddPropertyListener(kAudioObjectSystemObject, &addr,
+                                        oto_defaultOutputDeviceListener, NULL);
+}
+
+static OSStatus oto_devicesListener(AudioObjectID object, UInt32 numAddresses,
+                                    const AudioObjectPropertyAddress *addresses, void *clientData) {
+  oto_devicesChanged();
+  return noErr;
+}
+
+// oto_addDevicesListener registers a listener of the addition and the removal of the devices.
+OSStatus oto_addDevicesListener(void) {
+  AudioObjectPropertyAddress addr = {
+      kAudioHardwarePropertyDevices,
+      kAudioObjectPropertyScopeGlobal,
+      kAudioObjectPropertyElementMaster,
+  };
+  return AudioObjectAddPropertyListener(kAudioObjectSystemObject, &addr, oto_devicesListener, NULL);
+}
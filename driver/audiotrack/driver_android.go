@@ -0,0 +1,741 @@
+// Copyright 2016 Hajime Hoshi
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audiotrack
+
+/*
+
+#include <jni.h>
+#include <stdlib.h>
+#include <string.h>
+
+static jclass android_media_AudioFormat;
+static jclass android_media_AudioManager;
+static jclass android_media_AudioTrack;
+
+static char* initAudioTrack(uintptr_t java_vm, uintptr_t jni_env,
+    int sampleRate, int channelNum, int bitDepthInBytes, jobject* audioTrack, int bufferSize) {
+  JavaVM* vm = (JavaVM*)java_vm;
+  JNIEnv* env = (JNIEnv*)jni_env;
+
+  jclass local = (*env)->FindClass(env, "android/media/AudioFormat");
+  android_media_AudioFormat = (*env)->NewGlobalRef(env, local);
+  (*env)->DeleteLocalRef(env, local);
+
+  local = (*env)->FindClass(env, "android/media/AudioManager");
+  android_media_AudioManager = (*env)->NewGlobalRef(env, local);
+  (*env)->DeleteLocalRef(env, local);
+
+  local = (*env)->FindClass(env, "android/media/AudioTrack");
+  android_media_AudioTrack = (*env)->NewGlobalRef(env, local);
+  (*env)->DeleteLocalRef(env, local);
+
+  const jint android_media_AudioManager_STREAM_MUSIC =
+      (*env)->GetStaticIntField(
+          env, android_media_AudioManager,
+          (*env)->GetStaticFieldID(env, android_media_AudioManager, "STREAM_MUSIC", "I"));
+  const jint android_media_AudioTrack_MODE_STREAM =
+      (*env)->GetStaticIntField(
+          env, android_media_AudioTrack,
+          (*env)->GetStaticFieldID(env, android_media_AudioTrack, "MODE_STREAM", "I"));
+  const jint android_media_AudioFormat_CHANNEL_OUT_MONO =
+      (*env)->GetStaticIntField(
+          env, android_media_AudioFormat,
+          (*env)->GetStaticFieldID(env, android_media_AudioFormat, "CHANNEL_OUT_MONO", "I"));
+  const jint android_media_AudioFormat_CHANNEL_OUT_STEREO =
+      (*env)->GetStaticIntField(
+          env, android_media_AudioFormat,
+          (*env)->GetStaticFieldID(env, android_media_AudioFormat, "CHANNEL_OUT_STEREO", "I"));
+  const jint android_media_AudioFormat_ENCODING_PCM_8BIT =
+      (*env)->GetStaticIntField(
+          env, android_media_AudioFormat,
+          (*env)->GetStaticFieldID(env, android_media_AudioFormat, "ENCODING_PCM_8BIT", "I"));
+  const jint android_media_AudioFormat_ENCODING_PCM_16BIT =
+      (*env)->GetStaticIntField(
+          env, android_media_AudioFormat,
+          (*env)->GetStaticFieldID(env, android_media_AudioFormat, "ENCODING_PCM_16BIT", "I"));
+
+  jint channel = android_media_AudioFormat_CHANNEL_OUT_MONO;
+  switch (channelNum) {
+  case 1:
+    channel = android_media_AudioFormat_CHANNEL_OUT_MONO;
+    break;
+  case 2:
+    channel = android_media_AudioFormat_CHANNEL_OUT_STEREO;
+    break;
+  default:
+    return "invalid channel";
+  }
+
+  jint encoding = android_media_AudioFormat_ENCODING_PCM_8BIT;
+  switch (bitDepthInBytes) {
+  case 1:
+    encoding = android_media_AudioFormat_ENCODING_PCM_8BIT;
+    break;
+  case 2:
+    encoding = android_media_AudioFormat_ENCODING_PCM_16BIT;
+    break;
+  default:
+    return "invalid bitDepthInBytes";
+  }
+
+  const jobject tmpAudioTrack =
+      (*env)->NewObject(
+          env, android_media_AudioTrack,
+          (*env)->GetMethodID(env, android_media_AudioTrack, "<init>", "(IIIIII)V"),
+          android_media_AudioManager_STREAM_MUSIC,
+          sampleRate, channel, encoding, bufferSize,
+          android_media_AudioTrack_MODE_STREAM);
+  *audioTrack = (*env)->NewGlobalRef(env, tmpAudioTrack);
+  (*env)->DeleteLocalRef(env, tmpAudioTrack);
+
+  (*env)->CallVoidMethod(
+      env, *audioTrack,
+      (*env)->GetMethodID(env, android_media_AudioTrack, "play", "()V"));
+
+  return NULL;
+}
+
+// writeToAudioTrack writes the data, and returns the result of AudioTrack.write, which is negative on
+// errors.
+static jint writeToAudioTrack(uintptr_t java_vm, uintptr_t jni_env,
+    jobject audioTrack, int bitDepthInBytes, void* data, int length) {
+  JavaVM* vm = (JavaVM*)java_vm;
+  JNIEnv* env = (JNIEnv*)jni_env;
+
+  jbyteArray arrInBytes;
+  jshortArray arrInShorts;
+  switch (bitDepthInBytes) {
+  case 1:
+    arrInBytes = (*env)->NewByteArray(env, length);
+    (*env)->SetByteArrayRegion(env, arrInBytes, 0, length, data);
+    break;
+  case 2:
+    arrInShorts = (*env)->NewShortArray(env, length);
+    (*env)->SetShortArrayRegion(env, arrInShorts, 0, length, data);
+    break;
+  }
+
+  jint result;
+  static jmethodID write1 = NULL;
+  static jmethodID write2 = NULL;
+  if (!write1) {
+    write1 = (*env)->GetMethodID(env, android_media_AudioTrack, "write", "([BII)I");
+  }
+  if (!write2) {
+    write2 = (*env)->GetMethodID(env, android_media_AudioTrack, "write", "([SII)I");
+  }
+  switch (bitDepthInBytes) {
+  case 1:
+    result = (*env)->CallIntMethod(env, audioTrack, write1, arrInBytes, 0, length);
+    (*env)->DeleteLocalRef(env, arrInBytes);
+    break;
+  case 2:
+    result = (*env)->CallIntMethod(env, audioTrack, write2, arrInShorts, 0, length);
+    (*env)->DeleteLocalRef(env, arrInShorts);
+    break;
+  }
+  return result;
+}
+
+static char* releaseAudioTrack(uintptr_t java_vm, uintptr_t jni_env,
+    jobject audioTrack) {
+  JavaVM* vm = (JavaVM*)java_vm;
+  JNIEnv* env = (JNIEnv*)jni_env;
+
+  (*env)->CallVoidMethod(
+      env, audioTrack,
+      (*env)->GetMethodID(env, android_media_AudioTrack, "release", "()V"));
+  return NULL;
+}
+
+// getOutputDevices returns the AudioDeviceInfo array of the output devices, or NULL when the API level is
+// lower than 23.
+static jobjectArray getOutputDevices(JNIEnv* env, jobject context) {
+  jclass android_content_Context = (*env)->FindClass(env, "android/content/Context");
+  jstring service = (*env)->NewStringUTF(env, "audio");
+  jobject audioManager =
+      (*env)->CallObjectMethod(
+          env, context,
+          (*env)->GetMethodID(env, android_content_Context, "getSystemService", "(Ljava/lang/String;)Ljava/lang/Object;"),
+          service);
+  (*env)->DeleteLocalRef(env, service);
+  (*env)->DeleteLocalRef(env, android_content_Context);
+  if ((*env)->ExceptionCheck(env) || !audioManager) {
+    (*env)->ExceptionClear(env);
+    return NULL;
+  }
+
+  jclass android_media_AudioManager = (*env)->GetObjectClass(env, audioManager);
+  jmethodID getDevices =
+      (*env)->GetMethodID(env, android_media_AudioManager, "getDevices", "(I)[Landroid/media/AudioDeviceInfo;");
+  if ((*env)->ExceptionCheck(env) || !getDevices) {
+    // AudioManager.getDevices is available from API level 23.
+    (*env)->ExceptionClear(env);
+    (*env)->DeleteLocalRef(env, android_media_AudioManager);
+    (*env)->DeleteLocalRef(env, audioManager);
+    return NULL;
+  }
+  const jint android_media_AudioManager_GET_DEVICES_OUTPUTS =
+      (*env)->GetStaticIntField(
+          env, android_media_AudioManager,
+          (*env)->GetStaticFieldID(env, android_media_AudioManager, "GET_DEVICES_OUTPUTS", "I"));
+  jobjectArray devices =
+      (jobjectArray)(*env)->CallObjectMethod(env, audioManager, getDevices, android_media_AudioManager_GET_DEVICES_OUTPUTS);
+  (*env)->DeleteLocalRef(env, android_media_AudioManager);
+  (*env)->DeleteLocalRef(env, audioManager);
+  if ((*env)->ExceptionCheck(env)) {
+    (*env)->ExceptionClear(env);
+    return NULL;
+  }
+  return devices;
+}
+
+static int outputDeviceCount(uintptr_t java_vm, uintptr_t jni_env, jobject context) {
+  JNIEnv* env = (JNIEnv*)jni_env;
+  jobjectArray devices = getOutputDevices(env, context);
+  if (!devices) {
+    return 0;
+  }
+  int n = (*env)->GetArrayLength(env, devices);
+  (*env)->DeleteLocalRef(env, devices);
+  return n;
+}
+
+// outputDevice gets the ID, the type and the product name of the index-th output device.
+static void outputDevice(uintptr_t java_vm, uintptr_t jni_env, jobject context, int index,
+    int* id, int* type, char* name, int nameSize) {
+  JNIEnv* env = (JNIEnv*)jni_env;
+  *id = 0;
+  *type = 0;
+  name[0] = '\0';
+
+  jobjectArray devices = getOutputDevices(env, context);
+  if (!devices) {
+    return;
+  }
+  if (index >= (*env)->GetArrayLength(env, devices)) {
+    (*env)->DeleteLocalRef(env, devices);
+    return;
+  }
+  jobject device = (*env)->GetObjectArrayElement(env, devices, index);
+  jclass android_media_AudioDeviceInfo = (*env)->GetObjectClass(env, device);
+  *id = (*env)->CallIntMethod(
+      env, device, (*env)->GetMethodID(env, android_media_AudioDeviceInfo, "getId", "()I"));
+  *type = (*env)->CallIntMethod(
+      env, device, (*env)->GetMethodID(env, android_media_AudioDeviceInfo, "getType", "()I"));
+  jobject productName = (*env)->CallObjectMethod(
+      env, device,
+      (*env)->GetMethodID(env, android_media_AudioDeviceInfo, "getProductName", "()Ljava/lang/CharSequence;"));
+  if (productName) {
+    jclass java_lang_Object = (*env)->FindClass(env, "java/lang/Object");
+    jstring str = (jstring)(*env)->CallObjectMethod(
+        env, productName,
+        (*env)->GetMethodID(env, java_lang_Object, "toString", "()Ljava/lang/String;"));
+    const char* chars = (*env)->GetStringUTFChars(env, str, NULL);
+    strncpy(name, chars, nameSize - 1);
+    name[nameSize - 1] = '\0';
+    (*env)->ReleaseStringUTFChars(env, str, chars);
+    (*env)->DeleteLocalRef(env, str);
+    (*env)->DeleteLocalRef(env, java_lang_Object);
+    (*env)->DeleteLocalRef(env, productName);
+  }
+  (*env)->DeleteLocalRef(env, android_media_AudioDeviceInfo);
+  (*env)->DeleteLocalRef(env, device);
+  (*env)->DeleteLocalRef(env, devices);
+  if ((*env)->ExceptionCheck(env)) {
+    (*env)->ExceptionClear(env);
+  }
+}
+
+// setPreferredDevice routes the AudioTrack to the output device with the ID. setPreferredDevice returns
+// 0 on success, 1 when the device is not found, and 2 when the routing is not supported.
+static int setPreferredDevice(uintptr_t java_vm, uintptr_t jni_env, jobject context,
+    jobject audioTrack, int id) {
+  JNIEnv* env = (JNIEnv*)jni_env;
+
+  jobjectArray devices = getOutputDevices(env, context);
+  if (!devices) {
+    return 2;
+  }
+  jobject found = NULL;
+  jclass android_media_AudioDeviceInfo = (*env)->FindClass(env, "android/media/AudioDeviceInfo");
+  jmethodID getId = (*env)->GetMethodID(env, android_media_AudioDeviceInfo, "getId", "()I");
+  int n = (*env)->GetArrayLength(env, devices);
+  for (int i = 0; i < n && !found; i++) {
+    jobject device = (*env)->GetObjectArrayElement(env, devices, i);
+    if ((*env)->CallIntMethod(env, device, getId) == id) {
+      found = device;
+    } else {
+      (*env)->DeleteLocalRef(env, device);
+    }
+  }
+  (*env)->DeleteLocalRef(env, android_media_AudioDeviceInfo);
+  (*env)->DeleteLocalRef(env, devices);
+  if (!found) {
+    return 1;
+  }
+
+  jboolean ok = (*env)->CallBooleanMethod(
+      env, audioTrack,
+      (*env)->GetMethodID(env, android_media_AudioTrack, "setPreferredDevice", "(Landroid/media/AudioDeviceInfo;)Z"),
+      found);
+  (*env)->DeleteLocalRef(env, found);
+  if ((*env)->ExceptionCheck(env)) {
+    (*env)->ExceptionClear(env);
+    return 2;
+  }
+  return ok ? 0 : 1;
+}
+
+// routedDeviceType returns the type of the output device that the AudioTrack plays to, or 0 when it is
+// unknown. getRoutedDevice is available from API level 24.
+static int routedDeviceType(uintptr_t java_vm, uintptr_t jni_env, jobject audioTrack) {
+  JNIEnv* env = (JNIEnv*)jni_env;
+
+  jmethodID getRoutedDevice =
+      (*env)->GetMethodID(env, android_media_AudioTrack, "getRoutedDevice", "()Landroid/media/AudioDeviceInfo;");
+  if ((*env)->ExceptionCheck(env) || !getRoutedDevice) {
+    (*env)->ExceptionClear(env);
+    return 0;
+  }
+  jobject device = (*env)->CallObjectMethod(env, audioTrack, getRoutedDevice);
+  if ((*env)->ExceptionCheck(env) || !device) {
+    (*env)->ExceptionClear(env);
+    return 0;
+  }
+  jclass android_media_AudioDeviceInfo = (*env)->GetObjectClass(env, device);
+  int type = (*env)->CallIntMethod(
+      env, device, (*env)->GetMethodID(env, android_media_AudioDeviceInfo, "getType", "()I"));
+  (*env)->DeleteLocalRef(env, android_media_AudioDeviceInfo);
+  (*env)->DeleteLocalRef(env, device);
+  if ((*env)->ExceptionCheck(env)) {
+    (*env)->ExceptionClear(env);
+    return 0;
+  }
+  return type;
+}
+
+// wakeLock is the partial wake lock held while the playback is kept alive, or NULL.
+static jobject wakeLock;
+
+static char* acquireWakeLock(uintptr_t java_vm, uintptr_t jni_env, jobject context) {
+  JNIEnv* env = (JNIEnv*)jni_env;
+
+  if (wakeLock) {
+    return NULL;
+  }
+
+  jclass android_content_Context = (*env)->FindClass(env, "android/content/Context");
+  jstring service = (*env)->NewStringUTF(env, "power");
+  jobject powerManager =
+      (*env)->CallObjectMethod(
+          env, context,
+          (*env)->GetMethodID(env, android_content_Context, "getSystemService", "(Ljava/lang/String;)Ljava/lang/Object;"),
+          service);
+  (*env)->DeleteLocalRef(env, service);
+  (*env)->DeleteLocalRef(env, android_content_Context);
+  if ((*env)->ExceptionCheck(env) || !powerManager) {
+    (*env)->ExceptionClear(env);
+    return "getSystemService failed";
+  }
+
+  jclass android_os_PowerManager = (*env)->FindClass(env, "android/os/PowerManager");
+  const jint android_os_PowerManager_PARTIAL_WAKE_LOCK =
+      (*env)->GetStaticIntField(
+          env, android_os_PowerManager,
+          (*env)->GetStaticFieldID(env, android_os_PowerManager, "PARTIAL_WAKE_LOCK", "I"));
+  jstring tag = (*env)->NewStringUTF(env, "oto:playback");
+  jobject lock =
+      (*env)->CallObjectMethod(
+          env, powerManager,
+          (*env)->GetMethodID(env, android_os_PowerManager, "newWakeLock", "(ILjava/lang/String;)Landroid/os/PowerManager$WakeLock;"),
+          android_os_PowerManager_PARTIAL_WAKE_LOCK, tag);
+  (*env)->DeleteLocalRef(env, tag);
+  (*env)->DeleteLocalRef(env, android_os_PowerManager);
+  (*env)->DeleteLocalRef(env, powerManager);
+  if ((*env)->ExceptionCheck(env) || !lock) {
+    (*env)->ExceptionClear(env);
+    return "newWakeLock failed";
+  }
+
+  jclass android_os_PowerManager_WakeLock = (*env)->GetObjectClass(env, lock);
+  (*env)->CallVoidMethod(
+      env, lock,
+      (*env)->GetMethodID(env, android_os_PowerManager_WakeLock, "acquire", "()V"));
+  (*env)->DeleteLocalRef(env, android_os_PowerManager_WakeLock);
+  if ((*env)->ExceptionCheck(env)) {
+    (*env)->ExceptionClear(env);
+    (*env)->DeleteLocalRef(env, lock);
+    return "acquire failed: the WAKE_LOCK permission might be missing";
+  }
+
+  wakeLock = (*env)->NewGlobalRef(env, lock);
+  (*env)->DeleteLocalRef(env, lock);
+  return NULL;
+}
+
+static char* releaseWakeLock(uintptr_t java_vm, uintptr_t jni_env) {
+  JNIEnv* env = (JNIEnv*)jni_env;
+
+  if (!wakeLock) {
+    return NULL;
+  }
+  jclass android_os_PowerManager_WakeLock = (*env)->GetObjectClass(env, wakeLock);
+  (*env)->CallVoidMethod(
+      env, wakeLock,
+      (*env)->GetMethodID(env, android_os_PowerManager_WakeLock, "release", "()V"));
+  (*env)->DeleteLocalRef(env, android_os_PowerManager_WakeLock);
+  (*env)->DeleteGlobalRef(env, wakeLock);
+  wakeLock = NULL;
+  if ((*env)->ExceptionCheck(env)) {
+    (*env)->ExceptionClear(env);
+    return "release of the wake lock failed";
+  }
+  return NULL;
+}
+
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"time"
+	"unsafe"
+
+	"golang.org/x/mobile/app"
+
+	otodriver "github.com/leibnewton/oto/driver"
+	"github.com/leibnewton/oto/internal/backend"
+)
+
+const driverName = "audiotrack"
+
+func init() {
+	backend.Register(&backend.Driver{
+		Name: driverName,
+		Open: newDriver,
+		Capabilities: backend.Capabilities{
+			MinLatency:   40 * time.Millisecond,
+			DeviceSwitch: true,
+		},
+		Devices: getDevices,
+	})
+}
+
+// deviceTypeNames are the names of the types of AudioDeviceInfo.
+var deviceTypeNames = map[int]string{
+	1:  "Earpiece",
+	2:  "Speaker",
+	3:  "Wired headset",
+	4:  "Wired headphones",
+	7:  "Bluetooth SCO",
+	8:  "Bluetooth A2DP",
+	9:  "HDMI",
+	11: "USB device",
+	12: "USB accessory",
+	13: "Dock",
+	22: "USB headset",
+	23: "Hearing aid",
+	26: "BLE headset",
+	27: "BLE speaker",
+}
+
+// getDevices lists the output devices of AudioManager. The Number of a Device is the ID of its
+// AudioDeviceInfo. The list is empty before API level 23.
+func getDevices(mapperInclude bool) ([]*backend.Device, error) {
+	var devices []*backend.Device
+	if err := app.RunOnJVM(func(vm, env, ctx uintptr) error {
+		n := int(C.outputDeviceCount(C.uintptr_t(vm), C.uintptr_t(env), C.jobject(ctx)))
+		var name [256]C.char
+		for i := 0; i < n; i++ {
+			var id, typ C.int
+			C.outputDevice(C.uintptr_t(vm), C.uintptr_t(env), C.jobject(ctx), C.int(i), &id, &typ, &name[0], C.int(len(name)))
+			t, ok := deviceTypeNames[int(typ)]
+			if !ok {
+				t = fmt.Sprintf("Type %d", int(typ))
+			}
+			dname := t
+			if product := C.GoString(&name[0]); product != "" {
+				dname = t + ": " + product
+			}
+			devices = append(devices, &backend.Device{
+				Name:   dname,
+				Number: int(id),
+			})
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+// audioTrackError is an error code returned by AudioTrack.write.
+type audioTrackError struct {
+	code int
+}
+
+func (e *audioTrackError) Error() string {
+	switch e.code {
+	case -6:
+		return "oto: AudioTrack error: dead object"
+	case -3:
+		return "oto: AudioTrack error: invalid operation"
+	case -2:
+		return "oto: AudioTrack error: bad value"
+	}
+	return fmt.Sprintf("oto: AudioTrack error: %d", e.code)
+}
+
+// Driver implements oto.DriverError.
+func (e *audioTrackError) Driver() string {
+	return driverName
+}
+
+// Code implements oto.DriverError.
+func (e *audioTrackError) Code() int {
+	return e.code
+}
+
+// Is reports whether e corresponds to target, one of the errors like driver.ErrDeviceLost.
+func (e *audioTrackError) Is(target error) bool {
+	// ERROR_DEAD_OBJECT means the AudioTrack must be created again, e.g. after the media server was
+	// restarted while the device dozed.
+	return target == otodriver.ErrDeviceLost && e.code == -6
+}
+
+type driver struct {
+	sampleRate      int
+	channelNum      int
+	bitDepthInBytes int
+	audioTrack      C.jobject
+	chErr           chan error
+	chBuffer        chan []byte
+	chFree          chan []byte
+	tmp             []byte
+	bufferSize      int
+
+	// keepAlive is whether the driver holds the wake lock.
+	keepAlive bool
+}
+
+func newDriver(params *backend.Params) (otodriver.Driver, error) {
+	sampleRate := params.SampleRate
+	channelNum := params.ChannelNum
+	bitDepthInBytes := params.BytesPerSample
+	bufferSizeInBytes := params.BufferSizeInBytes()
+
+	p := &driver{
+		sampleRate:      sampleRate,
+		channelNum:      channelNum,
+		bitDepthInBytes: bitDepthInBytes,
+		chErr:           make(chan error),
+		chBuffer:        make(chan []byte),
+	}
+	runtime.SetFinalizer(p, (*driver).Close)
+
+	if err := app.RunOnJVM(func(vm, env, ctx uintptr) error {
+		audioTrack := C.jobject(0)
+		bufferSize := C.int(bufferSizeInBytes)
+		if msg := C.initAudioTrack(C.uintptr_t(vm), C.uintptr_t(env),
+			C.int(sampleRate), C.int(channelNum), C.int(bitDepthInBytes),
+			&audioTrack, bufferSize); msg != nil {
+			return errors.New("oto: initAutioTrack failed: " + C.GoString(msg))
+		}
+		p.audioTrack = audioTrack
+		p.bufferSize = int(bufferSize)
+
+		if params.Device < 0 {
+			return nil
+		}
+		switch C.setPreferredDevice(C.uintptr_t(vm), C.uintptr_t(env), C.jobject(ctx), audioTrack, C.int(params.Device)) {
+		case 1:
+			return otodriver.ErrNoDevice
+		case 2:
+			return errors.New("oto: routing to a device requires API level 23")
+		}
+		return nil
+	}); err != nil {
+		if p.audioTrack != 0 {
+			p.Close()
+		}
+		return nil, err
+	}
+
+	// Two buffers are used alternately: one is filled by TryWrite while the other is written to the
+	// AudioTrack. This avoids allocations in the steady state.
+	p.chFree = make(chan []byte, 2)
+	for i := 0; i < cap(p.chFree); i++ {
+		p.chFree <- make([]byte, 0, p.bufferSize)
+	}
+
+	go p.loop()
+	return p, nil
+}
+
+func (p *driver) loop() {
+	var shorts []int16
+	for bufInBytes := range p.chBuffer {
+		var bufInShorts []int16
+		if p.bitDepthInBytes == 2 {
+			if cap(shorts) < len(bufInBytes)/2 {
+				shorts = make([]int16, len(bufInBytes)/2)
+			}
+			bufInShorts = shorts[:len(bufInBytes)/2]
+			for i := 0; i < len(bufInShorts); i++ {
+				bufInShorts[i] = int16(bufInBytes[2*i]) | (int16(bufInBytes[2*i+1]) << 8)
+			}
+		}
+		if err := app.RunOnJVM(func(vm, env, ctx uintptr) error {
+			var result C.jint
+			switch p.bitDepthInBytes {
+			case 1:
+				result = C.writeToAudioTrack(C.uintptr_t(vm), C.uintptr_t(env),
+					p.audioTrack, C.int(p.bitDepthInBytes),
+					unsafe.Pointer(&bufInBytes[0]), C.int(len(bufInBytes)))
+			case 2:
+				result = C.writeToAudioTrack(C.uintptr_t(vm), C.uintptr_t(env),
+					p.audioTrack, C.int(p.bitDepthInBytes),
+					unsafe.Pointer(&bufInShorts[0]), C.int(len(bufInShorts)))
+			default:
+				panic("not reach")
+			}
+			if result < 0 {
+				return &audioTrackError{code: int(result)}
+			}
+			return nil
+		}); err != nil {
+			p.chErr <- err
+			return
+		}
+		p.chFree <- bufInBytes[:0]
+	}
+}
+
+func (p *driver) TryWrite(data []byte) (int, error) {
+	if p.tmp == nil {
+		select {
+		case p.tmp = <-p.chFree:
+		case err := <-p.chErr:
+			return 0, err
+		}
+	}
+
+	n := min(len(data), p.bufferSize-len(p.tmp))
+	p.tmp = append(p.tmp, data[:n]...)
+
+	if len(p.tmp) < p.bufferSize {
+		return n, nil
+	}
+
+	select {
+	case p.chBuffer <- p.tmp:
+	case err := <-p.chErr:
+		return 0, err
+	}
+
+	p.tmp = nil
+	return n, nil
+}
+
+func (p *driver) Close() error {
+	if p.audioTrack == 0 {
+		return nil
+	}
+
+	runtime.SetFinalizer(p, nil)
+	if p.keepAlive {
+		// The error is ignored, since the AudioTrack must be released anyway.
+		p.SetKeepAlive(false)
+	}
+	err := app.RunOnJVM(func(vm, env, ctx uintptr) error {
+		if msg := C.releaseAudioTrack(C.uintptr_t(vm), C.uintptr_t(env),
+			p.audioTrack); msg != nil {
+			return errors.New("oto: release failed: " + C.GoString(msg))
+		}
+		return nil
+	})
+
+	p.audioTrack = 0
+	return err
+}
+
+// SetKeepAlive implements backend.KeepAliver with a partial wake lock, so that the CPU keeps feeding the
+// AudioTrack while the screen is off.
+func (p *driver) SetKeepAlive(keepAlive bool) error {
+	if p.keepAlive == keepAlive {
+		return nil
+	}
+	if err := app.RunOnJVM(func(vm, env, ctx uintptr) error {
+		var msg *C.char
+		if keepAlive {
+			msg = C.acquireWakeLock(C.uintptr_t(vm), C.uintptr_t(env), C.jobject(ctx))
+		} else {
+			msg = C.releaseWakeLock(C.uintptr_t(vm), C.uintptr_t(env))
+		}
+		if msg != nil {
+			return errors.New("oto: " + C.GoString(msg))
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	p.keepAlive = keepAlive
+	return nil
+}
+
+// bluetoothDeviceTypes are the types of AudioDeviceInfo that play media through a Bluetooth codec.
+var bluetoothDeviceTypes = map[int]bool{
+	8:  true,
+	26: true,
+	27: true,
+}
+
+// OutputLatency implements backend.OutputLatencier. Android doesn't tell the latency of the output device, so
+// only whether the AudioTrack plays to a Bluetooth device is reported. When the routed device is unknown
+// before API level 24, a connected A2DP device is assumed to be used, since Android routes media to it.
+func (p *driver) OutputLatency() (time.Duration, bool) {
+	if p.audioTrack == 0 {
+		return 0, false
+	}
+	var bluetooth bool
+	_ = app.RunOnJVM(func(vm, env, ctx uintptr) error {
+		if typ := int(C.routedDeviceType(C.uintptr_t(vm), C.uintptr_t(env), p.audioTrack)); typ != 0 {
+			bluetooth = bluetoothDeviceTypes[typ]
+			return nil
+		}
+		n := int(C.outputDeviceCount(C.uintptr_t(vm), C.uintptr_t(env), C.jobject(ctx)))
+		var name [1]C.char
+		for i := 0; i < n; i++ {
+			var id, typ C.int
+			C.outputDevice(C.uintptr_t(vm), C.uintptr_t(env), C.jobject(ctx), C.int(i), &id, &typ, &name[0], C.int(len(name)))
+			if typ == 8 {
+				bluetooth = true
+				break
+			}
+		}
+		return nil
+	})
+	return 0, bluetooth
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
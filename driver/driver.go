@@ -0,0 +1,177 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package driver is the registry of the audio drivers that oto can open by name.
+//
+// A driver package registers itself in its init function, and a program enables the driver by
+// importing the package, usually with the blank identifier:
+//
+//	import _ "example.com/otojack"
+//
+// Then the driver is chosen by the Driver field of oto.Options:
+//
+//	c, err := oto.NewContextFromOptions(&oto.Options{Driver: "jack"})
+//
+// The drivers built into oto are the subpackages of this package, e.g. "winmm", and register themselves in
+// the same way. oto imports the default driver of the platform, so it is always available. The dummy
+// driver is built into oto itself, and is not listed here.
+package driver
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// Params represents the parameters to open a driver. They are resolved by oto, and are always valid.
+type Params struct {
+	// SampleRate is the number of frames played in one second.
+	SampleRate int
+
+	// ChannelNum is the number of channels.
+	ChannelNum int
+
+	// BytesPerSample is the number of bytes of one sample. 1 means unsigned 8bit, 2 means signed
+	// 16bit little endian, and 4 means 32bit float little endian.
+	BytesPerSample int
+
+	// BufferFrames is the size of the device buffer in frames.
+	BufferFrames int
+
+	// PeriodFrames is the size of one period in frames. 0 means that the driver decides it.
+	PeriodFrames int
+
+	// Device is the number of the output device. -1 means the default device.
+	Device int
+}
+
+// The errors that the drivers report in common. A driver's error matches them by errors.Is when the error
+// is one of them, or when the error implements Is for them. They are the errors of the same names in oto.
+var (
+	// ErrDeviceLost means that the device was removed or stopped working while playing.
+	ErrDeviceLost = errors.New("oto: the device is lost")
+
+	// ErrDeviceBusy means that the device is used exclusively by another application. oto retries to
+	// open the driver while the driver returns ErrDeviceBusy.
+	ErrDeviceBusy = errors.New("oto: the device is busy")
+
+	// ErrNoDevice means that the device is not found.
+	ErrNoDevice = errors.New("oto: no device is found")
+
+	// ErrUnsupportedFormat means that the device doesn't support the sample rate, the number of channels
+	// or the format. oto tries another format on it unless oto.Options.ExactFormat is set.
+	ErrUnsupportedFormat = errors.New("oto: the format is not supported")
+)
+
+// Driver is an opened audio device.
+//
+// TryWrite is called from a single goroutine. TryWrite passes the samples to the device, and may block
+// until the device has room for them. TryWrite returns the number of bytes accepted, which can be less
+// than len(data), and can be 0 when the device is still busy.
+type Driver interface {
+	io.Closer
+
+	TryWrite(data []byte) (int, error)
+}
+
+// UnderrunCounter is implemented by drivers that can detect the underruns of the device. oto reports the
+// underruns in Context.Stats.
+type UnderrunCounter interface {
+	// Underruns returns the number of the underruns since the driver is opened.
+	Underruns() int64
+}
+
+// FrameQueuer is implemented by drivers that know how much of the written data the device has played,
+// e.g. by a sample counter of the device. oto reports the progress of the Players by it in
+// Player.Position.
+type FrameQueuer interface {
+	// QueuedFrames returns the number of the frames written to the driver but not played yet.
+	QueuedFrames() int64
+}
+
+// Pauser is implemented by drivers that can pause the device keeping the data queued in it. oto pauses
+// the device when all the Players are paused. Pause and Restart are called from another goroutine than
+// TryWrite, and TryWrite may accept no data while the device is paused.
+type Pauser interface {
+	Pause() error
+	Restart() error
+}
+
+// RemovalWatcher is implemented by drivers that the OS notifies of the removal of the device, e.g. by
+// WM_DEVICECHANGE. oto reopens the driver as soon as DeviceRemoved reports true, instead of waiting for
+// TryWrite to fail. DeviceRemoved is called between the calls of TryWrite.
+type RemovalWatcher interface {
+	// DeviceRemoved reports whether the device has been removed since the last call.
+	DeviceRemoved() bool
+}
+
+// Canceler is implemented by drivers whose TryWrite can block for long, e.g. until a test advances a
+// virtual clock. Cancel is called from another goroutine when the Context is closed without draining, or
+// when closing times out. Cancel makes the blocking TryWrite return, and TryWrite after Cancel should
+// discard the data without blocking.
+type Canceler interface {
+	Cancel()
+}
+
+// OpenFunc opens a driver with the parameters.
+type OpenFunc func(params Params) (Driver, error)
+
+var (
+	driversM sync.Mutex
+	drivers  = map[string]OpenFunc{}
+)
+
+// Register makes a driver available by the name.
+//
+// Register panics if open is nil, or a driver is already registered with the same name. Register is
+// usually called from the init function of the driver package.
+func Register(name string, open OpenFunc) {
+	driversM.Lock()
+	defer driversM.Unlock()
+
+	if name == "" {
+		panic("oto: driver name must not be empty")
+	}
+	if open == nil {
+		panic(fmt.Sprintf("oto: Register of driver %q is called with nil", name))
+	}
+	if _, ok := drivers[name]; ok {
+		panic(fmt.Sprintf("oto: Register is called twice for driver %q", name))
+	}
+	drivers[name] = open
+}
+
+// Lookup returns the function to open the driver registered by the name.
+func Lookup(name string) (OpenFunc, bool) {
+	driversM.Lock()
+	defer driversM.Unlock()
+
+	open, ok := drivers[name]
+	return open, ok
+}
+
+// Names returns the sorted names of the registered drivers.
+func Names() []string {
+	driversM.Lock()
+	defer driversM.Unlock()
+
+	names := make([]string, 0, len(drivers))
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,61 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package driver_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/leibnewton/oto/driver"
+)
+
+type nopDriver struct{}
+
+func (nopDriver) TryWrite(data []byte) (int, error) {
+	return len(data), nil
+}
+
+func (nopDriver) Close() error {
+	return nil
+}
+
+func openNop(params driver.Params) (driver.Driver, error) {
+	return nopDriver{}, nil
+}
+
+func TestRegister(t *testing.T) {
+	driver.Register("test-b", openNop)
+	driver.Register("test-a", openNop)
+
+	if got, want := driver.Names(), []string{"test-a", "test-b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Names(): got: %v, want: %v", got, want)
+	}
+	if _, ok := driver.Lookup("test-a"); !ok {
+		t.Errorf("Lookup(%q): got false, want true", "test-a")
+	}
+	if _, ok := driver.Lookup("test-c"); ok {
+		t.Errorf("Lookup(%q): got true, want false", "test-c")
+	}
+}
+
+func TestRegisterTwice(t *testing.T) {
+	driver.Register("test-twice", openNop)
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Register must panic for a registered name")
+		}
+	}()
+	driver.Register("test-twice", openNop)
+}
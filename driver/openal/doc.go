@@ -0,0 +1,19 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package openal is the driver of oto for OpenAL, which is the default driver on FreeBSD and OpenBSD.
+//
+// The package registers the driver by the name "openal" when it is imported. oto imports it on FreeBSD and
+// OpenBSD, so it doesn't have to be imported explicitly.
+package openal
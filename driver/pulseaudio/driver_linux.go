@@ -0,0 +1,394 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !js,!android
+
+package pulseaudio
+
+/*
+#cgo pkg-config: libpulse
+
+#include <pulse/pulseaudio.h>
+#include <stdint.h>
+#include <stdlib.h>
+#include <string.h>
+
+typedef struct {
+  pa_threaded_mainloop* mainloop;
+  pa_context*           context;
+  pa_stream*            stream;
+  int                   started;
+  int64_t               underruns;
+} oto_pulse;
+
+static void oto_pulse_context_state_cb(pa_context* c, void* userdata) {
+  oto_pulse* p = userdata;
+  pa_threaded_mainloop_signal(p->mainloop, 0);
+}
+
+static void oto_pulse_stream_state_cb(pa_stream* s, void* userdata) {
+  oto_pulse* p = userdata;
+  pa_threaded_mainloop_signal(p->mainloop, 0);
+}
+
+static void oto_pulse_stream_write_cb(pa_stream* s, size_t nbytes, void* userdata) {
+  oto_pulse* p = userdata;
+  pa_threaded_mainloop_signal(p->mainloop, 0);
+}
+
+static void oto_pulse_stream_underflow_cb(pa_stream* s, void* userdata) {
+  oto_pulse* p = userdata;
+  p->underruns++;
+}
+
+static oto_pulse* oto_pulse_new() {
+  return calloc(1, sizeof(oto_pulse));
+}
+
+// oto_pulse_proplist creates the properties of the context and the stream, which the desktop uses for
+// the per-application volume, the routing and the ducking. Empty values are not set.
+static pa_proplist* oto_pulse_proplist(const char* appName, const char* iconName, const char* role) {
+  pa_proplist* props = pa_proplist_new();
+  if (appName[0]) {
+    pa_proplist_sets(props, PA_PROP_APPLICATION_NAME, appName);
+  }
+  if (iconName[0]) {
+    pa_proplist_sets(props, PA_PROP_APPLICATION_ICON_NAME, iconName);
+  }
+  if (role[0]) {
+    pa_proplist_sets(props, PA_PROP_MEDIA_ROLE, role);
+  }
+  return props;
+}
+
+// oto_pulse_open connects to the server and creates a playback stream with the properties. oto_pulse_open
+// returns 0 or an error code of PulseAudio.
+static int oto_pulse_open(oto_pulse* p, const char* name, pa_proplist* props, const pa_sample_spec* spec,
+                          const pa_buffer_attr* attr, pa_stream_flags_t flags) {
+  int err = 0;
+  p->mainloop = pa_threaded_mainloop_new();
+  if (!p->mainloop) {
+    return PA_ERR_INTERNAL;
+  }
+  p->context = pa_context_new_with_proplist(pa_threaded_mainloop_get_api(p->mainloop), name, props);
+  if (!p->context) {
+    return PA_ERR_INTERNAL;
+  }
+  pa_context_set_state_callback(p->context, oto_pulse_context_state_cb, p);
+  if (pa_context_connect(p->context, NULL, PA_CONTEXT_NOFLAGS, NULL) < 0) {
+    return pa_context_errno(p->context);
+  }
+
+  pa_threaded_mainloop_lock(p->mainloop);
+  if (pa_threaded_mainloop_start(p->mainloop) < 0) {
+    pa_threaded_mainloop_unlock(p->mainloop);
+    return PA_ERR_INTERNAL;
+  }
+  p->started = 1;
+
+  for (;;) {
+    pa_context_state_t state = pa_context_get_state(p->context);
+    if (state == PA_CONTEXT_READY) {
+      break;
+    }
+    if (!PA_CONTEXT_IS_GOOD(state)) {
+      err = pa_context_errno(p->context);
+      goto unlock;
+    }
+    pa_threaded_mainloop_wait(p->mainloop);
+  }
+
+  p->stream = pa_stream_new_with_proplist(p->context, name, spec, NULL, props);
+  if (!p->stream) {
+    err = pa_context_errno(p->context);
+    goto unlock;
+  }
+  pa_stream_set_state_callback(p->stream, oto_pulse_stream_state_cb, p);
+  pa_stream_set_write_callback(p->stream, oto_pulse_stream_write_cb, p);
+  pa_stream_set_underflow_callback(p->stream, oto_pulse_stream_underflow_cb, p);
+  if (pa_stream_connect_playback(p->stream, NULL, attr, flags, NULL, NULL) < 0) {
+    err = pa_context_errno(p->context);
+    goto unlock;
+  }
+
+  for (;;) {
+    pa_stream_state_t state = pa_stream_get_state(p->stream);
+    if (state == PA_STREAM_READY) {
+      break;
+    }
+    if (!PA_STREAM_IS_GOOD(state)) {
+      err = pa_context_errno(p->context);
+      goto unlock;
+    }
+    pa_threaded_mainloop_wait(p->mainloop);
+  }
+
+unlock:
+  pa_threaded_mainloop_unlock(p->mainloop);
+  return err;
+}
+
+// oto_pulse_write writes the data to the stream. oto_pulse_write blocks until all the data is
+// written.
+static int oto_pulse_write(oto_pulse* p, const void* data, size_t length) {
+  int err = 0;
+  pa_threaded_mainloop_lock(p->mainloop);
+  while (length > 0) {
+    size_t n = 0;
+    for (;;) {
+      if (!PA_STREAM_IS_GOOD(pa_stream_get_state(p->stream))) {
+        err = pa_context_errno(p->context);
+        goto unlock;
+      }
+      n = pa_stream_writable_size(p->stream);
+      if (n == (size_t)-1) {
+        err = pa_context_errno(p->context);
+        goto unlock;
+      }
+      if (n > 0) {
+        break;
+      }
+      // Wait until the server requests more data.
+      pa_threaded_mainloop_wait(p->mainloop);
+    }
+    if (n > length) {
+      n = length;
+    }
+    if (pa_stream_write(p->stream, data, n, NULL, 0, PA_SEEK_RELATIVE) < 0) {
+      err = pa_context_errno(p->context);
+      goto unlock;
+    }
+    data = (const uint8_t*)data + n;
+    length -= n;
+  }
+
+unlock:
+  pa_threaded_mainloop_unlock(p->mainloop);
+  return err;
+}
+
+static int64_t oto_pulse_underruns(oto_pulse* p) {
+  pa_threaded_mainloop_lock(p->mainloop);
+  int64_t n = p->underruns;
+  pa_threaded_mainloop_unlock(p->mainloop);
+  return n;
+}
+
+// oto_pulse_is_bluetooth returns whether the stream plays to a Bluetooth sink, whose name starts with
+// "bluez_" both on PulseAudio and on PipeWire.
+static int oto_pulse_is_bluetooth(oto_pulse* p) {
+  pa_threaded_mainloop_lock(p->mainloop);
+  const char* name = pa_stream_get_device_name(p->stream);
+  int bluetooth = name && strncmp(name, "bluez_", 6) == 0;
+  pa_threaded_mainloop_unlock(p->mainloop);
+  return bluetooth;
+}
+
+static void oto_pulse_free(oto_pulse* p) {
+  if (p->started) {
+    pa_threaded_mainloop_stop(p->mainloop);
+  }
+  if (p->stream) {
+    pa_stream_disconnect(p->stream);
+    pa_stream_unref(p->stream);
+  }
+  if (p->context) {
+    pa_context_disconnect(p->context);
+    pa_context_unref(p->context);
+  }
+  if (p->mainloop) {
+    pa_threaded_mainloop_free(p->mainloop);
+  }
+  free(p);
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"time"
+	"unsafe"
+
+	otodriver "github.com/leibnewton/oto/driver"
+	"github.com/leibnewton/oto/internal/backend"
+	"github.com/leibnewton/oto/internal/hotplug"
+)
+
+const driverName = "pulseaudio"
+
+func init() {
+	backend.Register(&backend.Driver{
+		Name: driverName,
+		Open: newDriver,
+		Capabilities: backend.Capabilities{
+			MinLatency:   10 * time.Millisecond,
+			DeviceSwitch: false,
+		},
+	})
+}
+
+type driver struct {
+	pulse *C.oto_pulse
+}
+
+// pulseError is an error code of PulseAudio.
+type pulseError struct {
+	code C.int
+}
+
+func newPulseError(code C.int) error {
+	return &pulseError{code: code}
+}
+
+func (e *pulseError) Error() string {
+	return fmt.Sprintf("oto: PulseAudio error: %s", C.GoString(C.pa_strerror(e.code)))
+}
+
+// Driver implements oto.DriverError.
+func (e *pulseError) Driver() string {
+	return driverName
+}
+
+// Code implements oto.DriverError.
+func (e *pulseError) Code() int {
+	return int(e.code)
+}
+
+// Is reports whether e corresponds to target, one of the errors like driver.ErrDeviceBusy.
+func (e *pulseError) Is(target error) bool {
+	switch target {
+	case otodriver.ErrDeviceBusy:
+		return e.code == C.PA_ERR_BUSY
+	case otodriver.ErrNoDevice:
+		return e.code == C.PA_ERR_NOENTITY || e.code == C.PA_ERR_CONNECTIONREFUSED
+	case otodriver.ErrDeviceLost:
+		return e.code == C.PA_ERR_CONNECTIONTERMINATED || e.code == C.PA_ERR_KILLED
+	case otodriver.ErrUnsupportedFormat:
+		return e.code == C.PA_ERR_NOTSUPPORTED
+	}
+	return false
+}
+
+// pulseBufferAttr returns the metric of the stream's buffer. The values not specified are left to the
+// server.
+func pulseBufferAttr(params *backend.Params) C.pa_buffer_attr {
+	const serverDefault = ^C.uint32_t(0)
+	attr := C.pa_buffer_attr{
+		maxlength: serverDefault,
+		tlength:   C.uint32_t(params.BufferSizeInBytes()),
+		prebuf:    serverDefault,
+		minreq:    serverDefault,
+		fragsize:  serverDefault,
+	}
+	if s := params.PeriodSizeInBytes(); s > 0 {
+		attr.minreq = C.uint32_t(s)
+	}
+	if a := params.PulseBufferAttr; a != nil {
+		if a.MaxLength > 0 {
+			attr.maxlength = C.uint32_t(a.MaxLength)
+		}
+		if a.TargetLength > 0 {
+			attr.tlength = C.uint32_t(a.TargetLength)
+		}
+		if a.Prebuffer > 0 {
+			attr.prebuf = C.uint32_t(a.Prebuffer)
+		}
+		if a.MinRequest > 0 {
+			attr.minreq = C.uint32_t(a.MinRequest)
+		}
+	}
+	return attr
+}
+
+func newDriver(params *backend.Params) (otodriver.Driver, error) {
+	// The server moves the stream when the device is removed. The cards are watched only to report the
+	// changes of the devices.
+	hotplug.StartCardWatcher()
+
+	spec := C.pa_sample_spec{
+		rate:     C.uint32_t(params.SampleRate),
+		channels: C.uint8_t(params.ChannelNum),
+	}
+	switch params.BytesPerSample {
+	case 1:
+		spec.format = C.PA_SAMPLE_U8
+	case 2:
+		spec.format = C.PA_SAMPLE_S16LE
+	default:
+		panic(fmt.Sprintf("oto: unexpected bytes per sample: %d", params.BytesPerSample))
+	}
+	attr := pulseBufferAttr(params)
+
+	flags := C.pa_stream_flags_t(C.PA_STREAM_INTERPOLATE_TIMING | C.PA_STREAM_AUTO_TIMING_UPDATE)
+	if params.PulseAdjustLatency {
+		flags |= C.PA_STREAM_ADJUST_LATENCY
+	}
+
+	appName := params.SessionName
+	if appName == "" {
+		appName = "oto"
+	}
+	name := C.CString(appName)
+	defer C.free(unsafe.Pointer(name))
+	icon := C.CString(params.SessionIconPath)
+	defer C.free(unsafe.Pointer(icon))
+	role := C.CString(params.MediaRole)
+	defer C.free(unsafe.Pointer(role))
+	// The server copies the properties.
+	props := C.oto_pulse_proplist(name, icon, role)
+	defer C.pa_proplist_free(props)
+
+	p := &driver{
+		pulse: C.oto_pulse_new(),
+	}
+	if code := C.oto_pulse_open(p.pulse, name, props, &spec, &attr, flags); code != 0 {
+		C.oto_pulse_free(p.pulse)
+		return nil, newPulseError(code)
+	}
+	return p, nil
+}
+
+func (p *driver) TryWrite(data []byte) (int, error) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+	if code := C.oto_pulse_write(p.pulse, unsafe.Pointer(&data[0]), C.size_t(len(data))); code != 0 {
+		return 0, newPulseError(code)
+	}
+	return len(data), nil
+}
+
+// ReopensAfterSleep implements backend.SleepRecoverer. The connection to the server can be dead after the
+// system sleeps.
+func (p *driver) ReopensAfterSleep() {}
+
+// Underruns implements driver.UnderrunCounter.
+func (p *driver) Underruns() int64 {
+	return int64(C.oto_pulse_underruns(p.pulse))
+}
+
+// OutputLatency implements backend.OutputLatencier. The latency of a Bluetooth sink reported by the server
+// doesn't include the codec, so only whether the sink is a Bluetooth device is reported.
+func (p *driver) OutputLatency() (time.Duration, bool) {
+	if p.pulse == nil {
+		return 0, false
+	}
+	return 0, C.oto_pulse_is_bluetooth(p.pulse) != 0
+}
+
+func (p *driver) Close() error {
+	C.oto_pulse_free(p.pulse)
+	p.pulse = nil
+	return nil
+}
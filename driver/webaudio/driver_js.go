@@ -0,0 +1,561 @@
+// Copyright 2015 Hajime Hoshi
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build js
+
+package webaudio
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"syscall/js"
+	"time"
+
+	otodriver "github.com/leibnewton/oto/driver"
+	"github.com/leibnewton/oto/internal/backend"
+)
+
+type driver struct {
+	sampleRate      int
+	channelNum      int
+	bitDepthInBytes int
+	nextPos         float64
+	tmp             []byte
+	bufferSize      int
+	context         js.Value
+	ready           bool
+	callbacks       map[string]js.Func
+
+	// onStateChange is the listener of the state changes of the AudioContext.
+	onStateChange js.Func
+
+	// l and r are the scratch buffers of the deinterleaved samples.
+	l []float32
+	r []float32
+
+	// For AudioBufferSourceNode. The typed arrays are reused for all the chunks.
+	tl *float32Array
+	tr *float32Array
+
+	// shared is the ring buffer read by the Audio Worklet when SharedArrayBuffer is available, or nil.
+	shared *sharedRing
+
+	// For Audio Worklet
+	workletNode js.Value
+	bufs        [][]js.Value
+	cond        *sync.Cond
+
+	// spare holds the slices of bufs that were sent, so that the returned buffers are stored without
+	// allocating. message and transfers are the arrays reused for postMessage.
+	spare     [][]js.Value
+	message   js.Value
+	transfers js.Value
+}
+
+type warn struct {
+	msg string
+}
+
+func (w *warn) Error() string {
+	return w.msg
+}
+
+const audioBufferSamples = 3200
+
+func tryAudioWorklet(context js.Value, channelNum int) (js.Value, error) {
+	if valueEqual(js.Global().Get("AudioWorkletNode"), js.Undefined()) {
+		return js.Undefined(), nil
+	}
+
+	if !isAudioWorkletAvailable() {
+		return js.Undefined(), nil
+	}
+
+	worklet := context.Get("audioWorklet")
+	if valueEqual(worklet, js.Undefined()) {
+		return js.Undefined(), &warn{
+			msg: "AudioWorklet is not available due to the insecure context. See https://developer.mozilla.org/en-US/docs/Web/API/AudioWorklet",
+		}
+	}
+
+	script := `
+class EbitenAudioWorkletProcessor extends AudioWorkletProcessor {
+  constructor() {
+    super();
+
+    this.buffers_ = [[], []];
+    this.offsets_ = [0, 0];
+    this.offsetsInArray_ = [0, 0];
+    this.consumed_ = [];
+
+    this.port.onmessage = (e) => {
+      const bufs = e.data;
+      for (let ch = 0; ch < bufs.length; ch++) {
+        this.buffers_[ch].push(bufs[ch]);
+      }
+    };
+  }
+
+  bufferTotalLength(ch) {
+    const sum = this.buffers_[ch].reduce((total, buf) => total + buf.length, 0);
+    return sum - this.offsetsInArray_[ch];
+  }
+
+  consume(ch, i) {
+    while (this.buffers_[ch][0].length <= i - this.offsets_[ch]) {
+      this.offsets_[ch] += this.buffers_[ch][0].length;
+      this.offsetsInArray_[ch] = 0;
+      const buf = this.buffers_[ch].shift();
+      this.appendConsumedBuffer(ch, buf);
+    }
+    this.offsetsInArray_[ch]++;
+    return this.buffers_[ch][0][i - this.offsets_[ch]];
+  }
+
+  appendConsumedBuffer(ch, buf) {
+    let idx = this.consumed_.length - 1;
+    if (idx < 0 || this.consumed_[idx][ch]) {
+      this.consumed_.push([]);
+      idx++;
+    }
+    this.consumed_[idx][ch] = buf;
+  }
+
+  process(inputs, outputs, parameters) {
+    const out = outputs[0];
+
+    if (this.bufferTotalLength(0) < out[0].length) {
+      for (let ch = 0; ch < out.length; ch++) {
+        for (let i = 0; i < out[ch].length; i++) {
+          out[ch][i] = 0;
+        }
+      }
+      return true;
+    }
+
+    for (let ch = 0; ch < out.length; ch++) {
+      const offset = this.offsets_[ch] + this.offsetsInArray_[ch];
+      for (let i = 0; i < out[ch].length; i++) {
+        out[ch][i] = this.consume(ch, i + offset);
+      }
+    }
+
+    for (let bufs of this.consumed_) {
+      this.port.postMessage(bufs, bufs.map(buf => buf.buffer));
+    }
+    this.consumed_ = [];
+
+    return true;
+  }
+}
+
+registerProcessor('ebiten-audio-worklet-processor', EbitenAudioWorkletProcessor);`
+	scriptURL := "data:application/javascript;base64," + base64.StdEncoding.EncodeToString([]byte(script))
+
+	ch := make(chan error)
+	worklet.Call("addModule", scriptURL).Call("then", js.FuncOf(func(js.Value, []js.Value) interface{} {
+		close(ch)
+		return nil
+	})).Call("catch", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		err := args[0]
+		ch <- fmt.Errorf("oto: error at addModule: %s: %s", err.Get("name").String(), err.Get("message").String())
+		close(ch)
+		return nil
+	}))
+	if err := <-ch; err != nil {
+		return js.Undefined(), err
+	}
+
+	options := js.Global().Get("Object").New()
+	arr := js.Global().Get("Array").New()
+	arr.Call("push", channelNum)
+	options.Set("outputChannelCount", arr)
+
+	node := js.Global().Get("AudioWorkletNode").New(context, "ebiten-audio-worklet-processor", options)
+	node.Call("connect", context.Get("destination"))
+
+	return node, nil
+}
+
+const driverName = "webaudio"
+
+func init() {
+	backend.Register(&backend.Driver{
+		Name: driverName,
+		Open: newDriver,
+		Capabilities: backend.Capabilities{
+			MinLatency:   20 * time.Millisecond,
+			DeviceSwitch: false,
+		},
+	})
+}
+
+func newDriver(params *backend.Params) (otodriver.Driver, error) {
+	sampleRate := params.SampleRate
+	channelNum := params.ChannelNum
+	bitDepthInBytes := params.BytesPerSample
+	bufferSize := params.BufferSizeInBytes()
+
+	class := js.Global().Get("AudioContext")
+	if valueEqual(class, js.Undefined()) {
+		class = js.Global().Get("webkitAudioContext")
+	}
+	if valueEqual(class, js.Undefined()) {
+		return nil, errors.New("oto: audio couldn't be initialized")
+	}
+
+	contextOptions := js.Global().Get("Object").New()
+	contextOptions.Set("sampleRate", sampleRate)
+	context := class.New(contextOptions)
+
+	embedded := embeddedBrowser()
+	if embedded != "" {
+		// The windows of embedded browsers are throttled more when they are hidden.
+		bufferSize *= 2
+	}
+
+	// Prefer the worklet reading the shared memory, which doesn't depend on the main thread. Embedded
+	// browsers are rarely cross-origin isolated, and the shared memory is not tried there.
+	node := js.Undefined()
+	var ring *sharedRing
+	if embedded == "" {
+		var err error
+		node, ring, err = trySharedWorklet(context, channelNum, max(bufferSize, 4096)/(channelNum*bitDepthInBytes))
+		if err != nil {
+			js.Global().Get("console").Call("warn", err.Error())
+		}
+	}
+	if ring == nil {
+		var err error
+		node, err = tryAudioWorklet(context, channelNum)
+		if err != nil {
+			if _, ok := err.(*warn); !ok {
+				if embedded == "" {
+					return nil, err
+				}
+				// The content security policies of embedded browsers might block the worklet script.
+				// Fall back to AudioBufferSourceNode there.
+				node = js.Undefined()
+			}
+			js.Global().Get("console").Call("warn", err.Error())
+		}
+	}
+
+	bs := bufferSize
+	if valueEqual(node, js.Undefined()) {
+		bs = max(bufferSize, audioBufferSamples*channelNum*bitDepthInBytes)
+	} else {
+		bs = max(bufferSize, 4096)
+	}
+
+	p := &driver{
+		sampleRate:      sampleRate,
+		channelNum:      channelNum,
+		bitDepthInBytes: bitDepthInBytes,
+		context:         context,
+		workletNode:     node,
+		shared:          ring,
+		bufferSize:      bs,
+		tmp:             make([]byte, 0, bs),
+		cond:            sync.NewCond(&sync.Mutex{}),
+	}
+
+	switch {
+	case ring != nil:
+		// The worklet reads the ring directly. No buffers are exchanged.
+	case !valueEqual(node, js.Undefined()):
+		s := p.bufferSize / p.channelNum / p.bitDepthInBytes / 2
+		p.l = make([]float32, s)
+		p.r = make([]float32, s)
+		p.message = js.Global().Get("Array").New(2)
+		p.transfers = js.Global().Get("Array").New(2)
+		p.bufs = [][]js.Value{
+			{
+				js.Global().Get("Float32Array").New(s),
+				js.Global().Get("Float32Array").New(s),
+			},
+			{
+				js.Global().Get("Float32Array").New(s),
+				js.Global().Get("Float32Array").New(s),
+			},
+		}
+
+		node.Get("port").Set("onmessage", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			p.cond.L.Lock()
+			defer p.cond.L.Unlock()
+
+			bufs := args[0].Get("data")
+			var arr []js.Value
+			if l := len(p.spare); l > 0 {
+				arr = p.spare[l-1][:0]
+				p.spare = p.spare[:l-1]
+			}
+			for i := 0; i < bufs.Length(); i++ {
+				arr = append(arr, bufs.Index(i))
+			}
+
+			notify := len(p.bufs) == 0
+			p.bufs = append(p.bufs, arr)
+			if notify {
+				p.cond.Signal()
+			}
+
+			return nil
+		}))
+	default:
+		p.l = make([]float32, audioBufferSamples)
+		p.r = make([]float32, audioBufferSamples)
+		p.tl = newFloat32Array(audioBufferSamples)
+		p.tr = newFloat32Array(audioBufferSamples)
+	}
+
+	setCallback := func(event string) js.Func {
+		var f js.Func
+		f = js.FuncOf(func(this js.Value, arguments []js.Value) interface{} {
+			if !p.ready {
+				p.context.Call("resume")
+				p.ready = true
+			}
+			js.Global().Get("document").Call("removeEventListener", event, f)
+			return nil
+		})
+		js.Global().Get("document").Call("addEventListener", event, f)
+		p.callbacks[event] = f
+		return f
+	}
+
+	p.onStateChange = js.FuncOf(func(this js.Value, arguments []js.Value) interface{} {
+		state := p.context.Get("state").String()
+		params.LogEvent(backend.EventAudioStateChanged, nil, "the state of the AudioContext is %s", state)
+		if _, f := backend.GestureSettings(); f != nil {
+			f(state)
+		}
+		return nil
+	})
+	p.context.Set("onstatechange", p.onStateChange)
+
+	if embedded != "" {
+		// Embedded browsers often allow autoplay. Try to start without waiting for a user gesture.
+		p.tryResume()
+	}
+
+	// Browsers require user interaction to start the audio.
+	// https://developers.google.com/web/updates/2017/09/autoplay-policy-changes#webaudio
+	p.callbacks = map[string]js.Func{}
+	if resume, _ := backend.GestureSettings(); resume {
+		p.ResumeOnUserGesture()
+	} else {
+		setCallback("touchend")
+		setCallback("keyup")
+		setCallback("mouseup")
+	}
+	return p, nil
+}
+
+// toLR deinterleaves the stereo samples in data into l and r.
+func toLR(l, r []float32, data []byte) ([]float32, []float32) {
+	const max = 1 << 15
+
+	l = l[:len(data)/4]
+	r = r[:len(data)/4]
+	for i := 0; i < len(data)/4; i++ {
+		l[i] = float32(int16(data[4*i])|int16(data[4*i+1])<<8) / max
+		r[i] = float32(int16(data[4*i+2])|int16(data[4*i+3])<<8) / max
+	}
+	return l, r
+}
+
+// consume removes the first n bytes of tmp. The rest is moved to the head so that appending to tmp
+// doesn't allocate.
+func (p *driver) consume(n int) {
+	p.tmp = p.tmp[:copy(p.tmp, p.tmp[n:])]
+}
+
+func (p *driver) TryWrite(data []byte) (int, error) {
+	if !p.ready {
+		return 0, nil
+	}
+
+	if p.shared != nil {
+		return p.shared.write(data, p.bitDepthInBytes), nil
+	}
+
+	if !valueEqual(p.workletNode, js.Undefined()) {
+		p.cond.L.Lock()
+		defer p.cond.L.Unlock()
+
+		n := min(len(data), max(0, p.bufferSize-len(p.tmp)))
+		p.tmp = append(p.tmp, data[:n]...)
+
+		if len(p.tmp) < p.bufferSize/2 {
+			return n, nil
+		}
+
+		for len(p.bufs) == 0 {
+			p.cond.Wait()
+		}
+
+		l, r := toLR(p.l, p.r, p.tmp[:p.bufferSize/2])
+		tl := p.bufs[0][0]
+		tr := p.bufs[0][1]
+		copyFloat32sToJS(tl, l)
+		copyFloat32sToJS(tr, r)
+		p.consume(p.bufferSize / 2)
+
+		// postMessage copies the message array, so the same arrays can be reused.
+		p.message.SetIndex(0, tl)
+		p.message.SetIndex(1, tr)
+		p.transfers.SetIndex(0, tl.Get("buffer"))
+		p.transfers.SetIndex(1, tr.Get("buffer"))
+		p.workletNode.Get("port").Call("postMessage", p.message, p.transfers)
+
+		p.spare = append(p.spare, p.bufs[0])
+		p.bufs = p.bufs[:copy(p.bufs, p.bufs[1:])]
+
+		return n, nil
+	}
+
+	n := min(len(data), max(0, p.bufferSize-len(p.tmp)))
+	p.tmp = append(p.tmp, data[:n]...)
+
+	c := p.context.Get("currentTime").Float()
+
+	if p.nextPos < c {
+		p.nextPos = c
+	}
+
+	// It's too early to enqueue a buffer.
+	// Highly likely, there are two playing buffers now.
+	if c+float64(p.bufferSize/p.bitDepthInBytes/p.channelNum)/float64(p.sampleRate) < p.nextPos {
+		return n, nil
+	}
+
+	le := audioBufferSamples * p.bitDepthInBytes * p.channelNum
+	if len(p.tmp) < le {
+		return n, nil
+	}
+
+	buf := p.context.Call("createBuffer", p.channelNum, audioBufferSamples, p.sampleRate)
+	l, r := toLR(p.l, p.r, p.tmp[:le])
+	p.tl.set(l)
+	p.tr.set(r)
+	if !valueEqual(buf.Get("copyToChannel"), js.Undefined()) {
+		buf.Call("copyToChannel", p.tl.v, 0, 0)
+		buf.Call("copyToChannel", p.tr.v, 1, 0)
+	} else {
+		// copyToChannel is not defined on Safari 11
+		buf.Call("getChannelData", 0).Call("set", p.tl.v)
+		buf.Call("getChannelData", 1).Call("set", p.tr.v)
+	}
+
+	s := p.context.Call("createBufferSource")
+	s.Set("buffer", buf)
+	s.Call("connect", p.context.Get("destination"))
+	s.Call("start", p.nextPos)
+	p.nextPos += buf.Get("duration").Float()
+
+	p.consume(le)
+	return n, nil
+}
+
+// embeddedBrowser returns the name of the embedded browser that the page runs in, "electron" or
+// "webview2", or the empty string for a usual browser.
+func embeddedBrowser() string {
+	g := js.Global()
+	if p := g.Get("process"); !valueEqual(p, js.Undefined()) {
+		if v := p.Get("versions"); !valueEqual(v, js.Undefined()) && !valueEqual(v.Get("electron"), js.Undefined()) {
+			return "electron"
+		}
+	}
+	if n := g.Get("navigator"); !valueEqual(n, js.Undefined()) && strings.Contains(n.Get("userAgent").String(), "Electron/") {
+		return "electron"
+	}
+	if c := g.Get("chrome"); !valueEqual(c, js.Undefined()) && !valueEqual(c.Get("webview"), js.Undefined()) {
+		return "webview2"
+	}
+	return ""
+}
+
+// tryResume resumes the AudioContext without a user gesture. The driver becomes ready when the
+// AudioContext runs, i.e. when the browser allows autoplay.
+func (p *driver) tryResume() {
+	var then js.Func
+	then = js.FuncOf(func(this js.Value, arguments []js.Value) interface{} {
+		if p.context.Get("state").String() == "running" {
+			p.ready = true
+		}
+		then.Release()
+		return nil
+	})
+	p.context.Call("resume").Call("then", then)
+}
+
+// gestureEvents are the events that browsers regard as user activations.
+var gestureEvents = []string{"touchend", "keydown", "mousedown", "pointerup"}
+
+// ResumeOnUserGesture implements backend.GestureResumer. The listeners resume the AudioContext at every
+// user gesture while it is not running, instead of only at the first one.
+func (p *driver) ResumeOnUserGesture() {
+	p.removeCallbacks()
+	for _, event := range gestureEvents {
+		f := js.FuncOf(func(this js.Value, arguments []js.Value) interface{} {
+			if p.context.Get("state").String() != "running" {
+				p.context.Call("resume")
+			}
+			p.ready = true
+			return nil
+		})
+		js.Global().Get("document").Call("addEventListener", event, f)
+		p.callbacks[event] = f
+	}
+	if _, f := backend.GestureSettings(); f != nil {
+		f(p.context.Get("state").String())
+	}
+}
+
+// removeCallbacks removes the listeners of the user gestures.
+func (p *driver) removeCallbacks() {
+	for event, f := range p.callbacks {
+		// https://developer.mozilla.org/en-US/docs/Web/API/EventTarget/removeEventListener
+		// "Calling removeEventListener() with arguments that do not identify any currently registered EventListener on the EventTarget has no effect."
+		js.Global().Get("document").Call("removeEventListener", event, f)
+		f.Release()
+		delete(p.callbacks, event)
+	}
+}
+
+func (p *driver) Close() error {
+	p.context.Set("onstatechange", js.Null())
+	p.onStateChange.Release()
+	p.removeCallbacks()
+	p.callbacks = nil
+	return nil
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -14,7 +14,7 @@
 
 // +build !go1.14
 
-package oto
+package webaudio
 
 import (
 	"syscall/js"
@@ -14,18 +14,29 @@
 
 // +build !go1.13 !wasm
 
-package oto
+package webaudio
 
 import (
 	"syscall/js"
 )
 
-func float32SliceToTypedArray(s []float32) (js.Value, func()) {
+// float32Array is a reused Float32Array.
+type float32Array struct {
+	v js.Value
+}
+
+func newFloat32Array(n int) *float32Array {
+	return &float32Array{
+		v: js.Global().Get("Float32Array").New(n),
+	}
+}
+
+func (a *float32Array) set(s []float32) {
 	// Note that TypedArrayOf cannot work correcly on Wasm.
 	// See https://github.com/golang/go/issues/31980
-
-	a := js.TypedArrayOf(s)
-	return a.Value, func() { a.Release() }
+	t := js.TypedArrayOf(s)
+	a.v.Call("set", t.Value)
+	t.Release()
 }
 
 func copyFloat32sToJS(v js.Value, s []float32) {
@@ -14,7 +14,7 @@
 
 // +build go1.13
 
-package oto
+package webaudio
 
 import (
 	"reflect"
@@ -23,27 +23,37 @@ import (
 	"unsafe"
 )
 
-func float32SliceToTypedArray(s []float32) (js.Value, func()) {
-	h := (*reflect.SliceHeader)(unsafe.Pointer(&s))
-	h.Len *= 4
-	h.Cap *= 4
-	bs := *(*[]byte)(unsafe.Pointer(h))
+// float32Array is a Float32Array with the view of its bytes. Go slices are copied into it without
+// allocating JavaScript objects.
+type float32Array struct {
+	v     js.Value
+	bytes js.Value
+}
 
-	a := js.Global().Get("Uint8Array").New(len(bs))
-	js.CopyBytesToJS(a, bs)
+func newFloat32Array(n int) *float32Array {
+	v := js.Global().Get("Float32Array").New(n)
+	return &float32Array{
+		v:     v,
+		bytes: js.Global().Get("Uint8Array").New(v.Get("buffer")),
+	}
+}
+
+func (a *float32Array) set(s []float32) {
+	js.CopyBytesToJS(a.bytes, float32sToBytes(s))
 	runtime.KeepAlive(s)
-	buf := a.Get("buffer")
-	return js.Global().Get("Float32Array").New(buf, a.Get("byteOffset"), a.Get("byteLength").Int()/4), func() {}
 }
 
-func copyFloat32sToJS(v js.Value, s []float32) {
+func float32sToBytes(s []float32) []byte {
 	h := (*reflect.SliceHeader)(unsafe.Pointer(&s))
 	h.Len *= 4
 	h.Cap *= 4
-	bs := *(*[]byte)(unsafe.Pointer(h))
+	return *(*[]byte)(unsafe.Pointer(h))
+}
 
-	a := js.Global().Get("Uint8Array").New(v.Get("buffer"))
-	js.CopyBytesToJS(a, bs)
+// copyFloat32sToJS copies s to the Float32Array v, which can be a view of a part of its buffer.
+func copyFloat32sToJS(v js.Value, s []float32) {
+	a := js.Global().Get("Uint8Array").New(v.Get("buffer"), v.Get("byteOffset"), v.Get("byteLength"))
+	js.CopyBytesToJS(a, float32sToBytes(s))
 	runtime.KeepAlive(s)
 }
 
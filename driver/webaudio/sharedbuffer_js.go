@@ -0,0 +1,183 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build js
+
+package webaudio
+
+import (
+	"encoding/base64"
+	"fmt"
+	"syscall/js"
+
+	"github.com/leibnewton/oto/internal/dsp"
+)
+
+// sharedRing is a ring buffer of float samples in a SharedArrayBuffer, which the Audio Worklet reads on
+// the audio thread.
+//
+// Go on Wasm runs only on the main thread, so the Go loop feeding the device cannot move to a worker.
+// Instead, the worklet takes the samples from the shared memory without waiting for messages from the
+// main thread. While the main thread is busy, e.g. rendering a heavy frame, the sound keeps playing as
+// long as the ring has samples.
+type sharedRing struct {
+	// indices holds the write and the read positions in frames. The ring is full when the write
+	// position is just before the read position.
+	indices js.Value
+	data    js.Value
+	atomics js.Value
+
+	frames     int
+	channelNum int
+
+	// floats is the scratch buffer of the converted samples.
+	floats []float32
+}
+
+// isSharedArrayBufferAvailable reports whether SharedArrayBuffer can be used. Browsers enable it only
+// on cross-origin isolated pages.
+func isSharedArrayBufferAvailable() bool {
+	g := js.Global()
+	if valueEqual(g.Get("SharedArrayBuffer"), js.Undefined()) || valueEqual(g.Get("Atomics"), js.Undefined()) {
+		return false
+	}
+	return g.Get("crossOriginIsolated").Truthy()
+}
+
+// trySharedWorklet creates an Audio Worklet reading from a sharedRing of the specified number of frames.
+// trySharedWorklet returns nil when SharedArrayBuffer or Audio Worklet is not available.
+func trySharedWorklet(context js.Value, channelNum, frames int) (js.Value, *sharedRing, error) {
+	if !isSharedArrayBufferAvailable() || !isAudioWorkletAvailable() {
+		return js.Undefined(), nil, nil
+	}
+	worklet := context.Get("audioWorklet")
+	if valueEqual(worklet, js.Undefined()) {
+		return js.Undefined(), nil, nil
+	}
+
+	script := `
+class OtoSharedAudioWorkletProcessor extends AudioWorkletProcessor {
+  constructor(options) {
+    super();
+    const o = options.processorOptions;
+    this.indices_ = new Int32Array(o.indices);
+    this.data_ = new Float32Array(o.data);
+    this.channels_ = o.channels;
+    this.frames_ = this.data_.length / this.channels_;
+  }
+
+  process(inputs, outputs, parameters) {
+    const out = outputs[0];
+    const n = out[0].length;
+    const w = Atomics.load(this.indices_, 0);
+    let r = Atomics.load(this.indices_, 1);
+    const available = (w - r + this.frames_) % this.frames_;
+    const m = Math.min(n, available);
+    for (let i = 0; i < m; i++) {
+      const j = r * this.channels_;
+      for (let ch = 0; ch < out.length; ch++) {
+        out[ch][i] = this.data_[j + Math.min(ch, this.channels_ - 1)];
+      }
+      r = (r + 1) % this.frames_;
+    }
+    for (let ch = 0; ch < out.length; ch++) {
+      out[ch].fill(0, m);
+    }
+    Atomics.store(this.indices_, 1, r);
+    return true;
+  }
+}
+
+registerProcessor('oto-shared-audio-worklet-processor', OtoSharedAudioWorkletProcessor);`
+	scriptURL := "data:application/javascript;base64," + base64.StdEncoding.EncodeToString([]byte(script))
+
+	ch := make(chan error)
+	then := js.FuncOf(func(js.Value, []js.Value) interface{} {
+		close(ch)
+		return nil
+	})
+	defer then.Release()
+	catch := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		err := args[0]
+		ch <- fmt.Errorf("oto: error at addModule: %s: %s", err.Get("name").String(), err.Get("message").String())
+		close(ch)
+		return nil
+	})
+	defer catch.Release()
+	worklet.Call("addModule", scriptURL).Call("then", then).Call("catch", catch)
+	if err := <-ch; err != nil {
+		return js.Undefined(), nil, err
+	}
+
+	sab := js.Global().Get("SharedArrayBuffer")
+	r := &sharedRing{
+		indices:    js.Global().Get("Int32Array").New(sab.New(2 * 4)),
+		data:       js.Global().Get("Float32Array").New(sab.New(frames * channelNum * 4)),
+		atomics:    js.Global().Get("Atomics"),
+		frames:     frames,
+		channelNum: channelNum,
+	}
+
+	processorOptions := js.Global().Get("Object").New()
+	processorOptions.Set("indices", r.indices.Get("buffer"))
+	processorOptions.Set("data", r.data.Get("buffer"))
+	processorOptions.Set("channels", channelNum)
+	options := js.Global().Get("Object").New()
+	arr := js.Global().Get("Array").New()
+	arr.Call("push", channelNum)
+	options.Set("outputChannelCount", arr)
+	options.Set("processorOptions", processorOptions)
+
+	node := js.Global().Get("AudioWorkletNode").New(context, "oto-shared-audio-worklet-processor", options)
+	node.Call("connect", context.Get("destination"))
+	return node, r, nil
+}
+
+// write writes as many frames of data as the ring can hold, and returns the number of bytes written.
+func (r *sharedRing) write(data []byte, bitDepthInBytes int) int {
+	w := r.atomics.Call("load", r.indices, 0).Int()
+	rd := r.atomics.Call("load", r.indices, 1).Int()
+	free := r.frames - 1 - (w-rd+r.frames)%r.frames
+	n := len(data) / (bitDepthInBytes * r.channelNum)
+	if n > free {
+		n = free
+	}
+	if n == 0 {
+		return 0
+	}
+
+	samples := n * r.channelNum
+	if cap(r.floats) < samples {
+		r.floats = make([]float32, samples)
+	}
+	f := r.floats[:samples]
+	switch bitDepthInBytes {
+	case 1:
+		dsp.Uint8sToFloat32s(f, data[:samples])
+	case 2:
+		dsp.Int16sToFloat32s(f, data[:2*samples])
+	}
+
+	// The frames might wrap around the end of the ring.
+	first := r.frames - w
+	if first > n {
+		first = n
+	}
+	copyFloat32sToJS(r.data.Call("subarray", w*r.channelNum, (w+first)*r.channelNum), f[:first*r.channelNum])
+	if first < n {
+		copyFloat32sToJS(r.data.Call("subarray", 0, (n-first)*r.channelNum), f[first*r.channelNum:])
+	}
+	r.atomics.Call("store", r.indices, 0, (w+n)%r.frames)
+	return n * bitDepthInBytes * r.channelNum
+}
@@ -0,0 +1,166 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package winmm
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+
+	"github.com/leibnewton/oto/internal/backend"
+)
+
+var (
+	user32 = windows.NewLazySystemDLL("user32")
+
+	procRegisterClassExW            = user32.NewProc("RegisterClassExW")
+	procCreateWindowExW             = user32.NewProc("CreateWindowExW")
+	procDefWindowProcW              = user32.NewProc("DefWindowProcW")
+	procRegisterDeviceNotificationW = user32.NewProc("RegisterDeviceNotificationW")
+	procGetMessageW                 = user32.NewProc("GetMessageW")
+	procDispatchMessageW            = user32.NewProc("DispatchMessageW")
+)
+
+const (
+	wmDeviceChange           = 0x0219
+	dbtDeviceArrival         = 0x8000
+	dbtDeviceRemoveComplete  = 0x8004
+	dbtDevtypDeviceInterface = 5
+	deviceNotifyWindowHandle = 0
+	hwndMessage              = ^uintptr(2) // HWND_MESSAGE, which is (HWND)-3.
+	deviceWatcherWindowClass = "OtoDeviceWatcher"
+)
+
+// ksCategoryAudio is KSCATEGORY_AUDIO, the interface class of the audio devices.
+var ksCategoryAudio = windows.GUID{
+	Data1: 0x6994ad04,
+	Data2: 0x93ef,
+	Data3: 0x11d0,
+	Data4: [8]byte{0xa3, 0xcc, 0x00, 0xa0, 0xc9, 0x22, 0x31, 0x96},
+}
+
+type wndClassEx struct {
+	cbSize        uint32
+	style         uint32
+	lpfnWndProc   uintptr
+	cbClsExtra    int32
+	cbWndExtra    int32
+	hInstance     windows.Handle
+	hIcon         windows.Handle
+	hCursor       windows.Handle
+	hbrBackground windows.Handle
+	lpszMenuName  *uint16
+	lpszClassName *uint16
+	hIconSm       windows.Handle
+}
+
+type devBroadcastDeviceInterface struct {
+	dbccSize       uint32
+	dbccDeviceType uint32
+	dbccReserved   uint32
+	dbccClassGUID  windows.GUID
+	dbccName       [1]uint16
+}
+
+type msg struct {
+	hwnd     uintptr
+	message  uint32
+	wParam   uintptr
+	lParam   uintptr
+	time     uint32
+	pt       struct{ x, y int32 }
+	lPrivate uint32
+}
+
+var (
+	// deviceRemovals is the number of the audio devices removed since the watcher started, which is
+	// accessed atomically.
+	deviceRemovals int64
+
+	deviceWatcherOnce sync.Once
+)
+
+// startDeviceWatcher starts watching the arrival and the removal of the audio devices by WM_DEVICECHANGE. The watcher
+// lives as long as the process, since only one window and one thread are needed for all the drivers.
+func startDeviceWatcher() {
+	deviceWatcherOnce.Do(func() {
+		go watchDevices()
+	})
+}
+
+// watchDevices runs the message loop of a message-only window registered for the notifications of the
+// audio device interfaces. When the window can't be created, the removals are detected only by the
+// failures of the writes as before.
+func watchDevices() {
+	// The messages are delivered to the thread that created the window.
+	runtime.LockOSThread()
+
+	className, err := windows.UTF16PtrFromString(deviceWatcherWindowClass)
+	if err != nil {
+		return
+	}
+	wc := wndClassEx{
+		lpfnWndProc:   syscall.NewCallback(deviceWatcherProc),
+		lpszClassName: className,
+	}
+	wc.cbSize = uint32(unsafe.Sizeof(wc))
+	if r, _, _ := procRegisterClassExW.Call(uintptr(unsafe.Pointer(&wc))); r == 0 {
+		return
+	}
+	hwnd, _, _ := procCreateWindowExW.Call(0, uintptr(unsafe.Pointer(className)), 0, 0, 0, 0, 0, 0,
+		hwndMessage, 0, 0, 0)
+	runtime.KeepAlive(className)
+	if hwnd == 0 {
+		return
+	}
+
+	f := devBroadcastDeviceInterface{
+		dbccDeviceType: dbtDevtypDeviceInterface,
+		dbccClassGUID:  ksCategoryAudio,
+	}
+	f.dbccSize = uint32(unsafe.Sizeof(f))
+	if r, _, _ := procRegisterDeviceNotificationW.Call(hwnd, uintptr(unsafe.Pointer(&f)), deviceNotifyWindowHandle); r == 0 {
+		return
+	}
+
+	var m msg
+	for {
+		r, _, _ := procGetMessageW.Call(uintptr(unsafe.Pointer(&m)), 0, 0, 0)
+		// GetMessage returns -1 at an error.
+		if r == 0 || int32(r) == -1 {
+			return
+		}
+		procDispatchMessageW.Call(uintptr(unsafe.Pointer(&m)))
+	}
+}
+
+func deviceWatcherProc(hwnd, message, wParam, lParam uintptr) uintptr {
+	if message == wmDeviceChange {
+		switch wParam {
+		case dbtDeviceArrival:
+			backend.DevicesChanged()
+		case dbtDeviceRemoveComplete:
+			atomic.AddInt64(&deviceRemovals, 1)
+			backend.DevicesChanged()
+		}
+		return 1
+	}
+	r, _, _ := procDefWindowProcW.Call(hwnd, message, wParam, lParam)
+	return r
+}
@@ -0,0 +1,512 @@
+// Copyright 2015 Hajime Hoshi
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !js
+
+package winmm
+
+import (
+	"runtime"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	otodriver "github.com/leibnewton/oto/driver"
+	"github.com/leibnewton/oto/internal/backend"
+)
+
+// header is a wave header and its buffer, which are in native memory since winmm accesses them
+// asynchronously.
+type header struct {
+	mem     *nativeMemory
+	buffer  []byte
+	waveHdr *wavehdr
+}
+
+func newHeader(waveOut uintptr, bufferSize int) (*header, error) {
+	// The wavehdr is placed at the head, and the buffer follows.
+	hdrSize := int(unsafe.Sizeof(wavehdr{}))
+	mem, err := allocNativeMemory(hdrSize + bufferSize)
+	if err != nil {
+		return nil, err
+	}
+	h := &header{
+		mem:     mem,
+		buffer:  mem.bytes(hdrSize),
+		waveHdr: (*wavehdr)(mem.pointer(0)),
+	}
+	h.waveHdr.lpData = uintptr(mem.pointer(hdrSize))
+	h.waveHdr.dwBufferLength = uint32(bufferSize)
+	if err := waveOutPrepareHeader(waveOut, h.waveHdr); err != nil {
+		mem.free()
+		return nil, err
+	}
+	// The memory is used by the device until the header is unprepared.
+	mem.setUsed(true)
+	return h, nil
+}
+
+// Write submits the header's buffer to the device. The header is prepared only once at newHeader,
+// and is reused after the device is done with it.
+func (h *header) Write(waveOut uintptr) error {
+	if err := waveOutWrite(waveOut, h.waveHdr); err != nil {
+		return err
+	}
+	return nil
+}
+
+// inQueue reports whether the device still has the header. winmm updates the flags from its own thread.
+func (h *header) inQueue() bool {
+	return atomic.LoadUint32(&h.waveHdr.dwFlags)&whdrInqueue != 0
+}
+
+func (h *header) Close(waveOut uintptr) error {
+	if err := waveOutUnprepareHeader(waveOut, h.waveHdr); err != nil {
+		return err
+	}
+	h.mem.setUsed(false)
+	h.buffer = nil
+	h.waveHdr = nil
+	return h.mem.free()
+}
+
+const driverName = "winmm"
+
+func init() {
+	backend.Register(&backend.Driver{
+		Name: driverName,
+		Open: newDriver,
+		Capabilities: backend.Capabilities{
+			MinLatency:   40 * time.Millisecond,
+			DeviceSwitch: true,
+		},
+		Devices: getDevices,
+	})
+}
+
+// The bits of WAVEOUTCAPS.dwSupport.
+const (
+	wavecapsPitch        = 0x1
+	wavecapsPlaybackRate = 0x2
+	wavecapsVolume       = 0x4
+	wavecapsLRVolume     = 0x8
+)
+
+func getDevices(mapperInclude bool) ([]*backend.Device, error) {
+	n, err := waveOutGetNumDevs()
+	if err != nil {
+		return nil, err
+	}
+	devs := make([]*backend.Device, 0, n+1)
+	c := -1
+	if !mapperInclude {
+		c = 0
+	}
+	for ; c < n; c++ {
+		dev, err := waveOutGetDevCaps(uint32(c))
+		if err != nil {
+			return nil, err
+		}
+		dev.Number = c
+		devs = append(devs, dev)
+	}
+	return devs, nil
+}
+
+type driver struct {
+	// committedFrames is the number of the frames filled into the headers, which is accessed atomically
+	// and is placed first for the alignment on 32bit platforms.
+	committedFrames int64
+
+	out        uintptr
+	notifier   notifier
+	headers    []*header
+	bufferSize int
+	waitMillis uint32
+
+	// current is the header being filled, and filled is the number of bytes filled in current.
+	current *header
+	filled  int
+
+	// started is whether any header has been submitted. underrunCount is the number of times all the
+	// submitted headers were done before the next header was submitted.
+	started       bool
+	underrunCount int64
+
+	// frameSize is the size of a frame in bytes.
+	frameSize int
+
+	// support is WAVEOUTCAPS.dwSupport of the device, and name is the name of the device.
+	support uint32
+	name    string
+
+	// removals is deviceRemovals when the removals were checked last.
+	removals int64
+
+	// format and deviceNum are what the device is opened with, which are used to open the loops.
+	format    waveformatex
+	deviceNum int
+}
+
+func newDriver(params *backend.Params) (otodriver.Driver, error) {
+	sampleRate := params.SampleRate
+	channelNum := params.ChannelNum
+	bitDepthInBytes := params.BytesPerSample
+
+	numBlockAlign := channelNum * bitDepthInBytes
+	f := &waveformatex{
+		wFormatTag:      waveFormatPCM,
+		nChannels:       uint16(channelNum),
+		nSamplesPerSec:  uint32(sampleRate),
+		nAvgBytesPerSec: uint32(sampleRate * numBlockAlign),
+		wBitsPerSample:  uint16(bitDepthInBytes * 8),
+		nBlockAlign:     uint16(numBlockAlign),
+	}
+
+	startDeviceWatcher()
+
+	// The notifier is notified by winmm whenever a header is done, so that TryWrite can wait for a free
+	// header without polling.
+	n, err := newNotifier(params.WinMMCallbackFunction)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := n.open(f, params.Device)
+	const elementNotFound = 1168
+	if e, ok := err.(*winmmError); ok && e.errno == elementNotFound {
+		// No device was found. Return the dummy device.
+		// TODO: Retry to open the device when possible.
+		n.Close()
+		return backend.NewDummy(sampleRate, channelNum, bitDepthInBytes), nil
+	}
+	if err != nil {
+		n.Close()
+		return nil, err
+	}
+
+	headerSize, numBufs := params.Periods()
+	// Align the header size to frames so that the mixed frames are not split into two headers.
+	headerSize = max(numBlockAlign, headerSize/numBlockAlign*numBlockAlign)
+
+	p := &driver{
+		out:        w,
+		notifier:   n,
+		headers:    make([]*header, numBufs),
+		bufferSize: headerSize,
+		frameSize:  numBlockAlign,
+		format:     *f,
+		deviceNum:  params.Device,
+		// Wait for at most twice the duration of one header so that a stuck device doesn't
+		// block TryWrite forever.
+		waitMillis: uint32(max(1, 2*1000*headerSize/(sampleRate*numBlockAlign))),
+	}
+	// The wave mapper has its capabilities too, as WAVE_MAPPER is -1.
+	if dev, err := waveOutGetDevCaps(uint32(params.Device)); err == nil {
+		p.support = dev.Support
+		p.name = dev.Name
+	}
+	p.removals = atomic.LoadInt64(&deviceRemovals)
+	runtime.SetFinalizer(p, (*driver).Close)
+	for i := range p.headers {
+		var err error
+		p.headers[i], err = newHeader(w, p.bufferSize)
+		if err != nil {
+			// Free the headers allocated so far and the device now instead of leaving them to the
+			// finalizer. The error of newHeader is more informative than the one of Close.
+			p.Close()
+			return nil, err
+		}
+	}
+	// The winmm streams are played in the audio session of the process, which is shown in the volume
+	// mixer. The sound plays without the name, so the error is only logged.
+	if err := setAudioSession(params.SessionName, params.SessionIconPath); err != nil {
+		params.LogEvent(backend.EventDriverOpened, err, "failed to set the audio session")
+	}
+	if params.WatchSessionVolume {
+		startSessionWatcher(params.Log)
+	}
+	return p, nil
+}
+
+func (p *driver) TryWrite(data []byte) (int, error) {
+	buf, err := p.AcquireBuffer()
+	if err != nil {
+		return 0, err
+	}
+	n := copy(buf, data)
+	if err := p.CommitBuffer(n); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+// AcquireBuffer implements backend.BufferAcquirer.
+func (p *driver) AcquireBuffer() ([]byte, error) {
+	// Fill the data into a free header directly so that no buffers are allocated in the steady state.
+	if p.current == nil {
+		p.current = p.freeHeader()
+		if p.current == nil {
+			// Wait until any header is done. The notification might have been sent before the headers
+			// are checked, so check the headers again after waiting.
+			if err := p.notifier.wait(p.waitMillis); err != nil {
+				return nil, err
+			}
+			p.current = p.freeHeader()
+		}
+		if p.current == nil {
+			return nil, nil
+		}
+	}
+	return p.current.buffer[p.filled:], nil
+}
+
+// CommitBuffer implements backend.BufferAcquirer.
+func (p *driver) CommitBuffer(n int) error {
+	if p.current == nil {
+		return nil
+	}
+	p.filled += n
+	atomic.AddInt64(&p.committedFrames, int64(n/p.frameSize))
+	if p.filled < len(p.current.buffer) {
+		return nil
+	}
+
+	if p.started && p.queuedHeaders() == 0 {
+		p.underrunCount++
+	}
+	if err := p.current.Write(p.out); err != nil {
+		// This error can happen when e.g. a new HDMI connection is detected (#51).
+		// Keep the filled header and retry writing it at the next CommitBuffer.
+		const errorNotFound = 1168
+		werr := err.(*winmmError)
+		if werr.fname == "waveOutWrite" && werr.errno == errorNotFound {
+			return nil
+		}
+		return err
+	}
+
+	p.started = true
+	p.current = nil
+	p.filled = 0
+	return nil
+}
+
+func (p *driver) queuedHeaders() int {
+	n := 0
+	for _, h := range p.headers {
+		if h.inQueue() {
+			n++
+		}
+	}
+	return n
+}
+
+// DeviceRemoved implements driver.RemovalWatcher.
+func (p *driver) DeviceRemoved() bool {
+	n := atomic.LoadInt64(&deviceRemovals)
+	if n == p.removals {
+		return false
+	}
+	p.removals = n
+	// The wave mapper might have played the removed device. Reopen it so that it picks the new default.
+	if p.deviceNum < 0 {
+		return true
+	}
+	// Another device might have been removed. The device numbers are shifted by the removal, so the
+	// device is regarded as removed when its number refers to another device.
+	dev, err := waveOutGetDevCaps(uint32(p.deviceNum))
+	return err != nil || dev.Name != p.name
+}
+
+// ReopensAfterSleep implements backend.SleepRecoverer. The device handle can be dead after the system sleeps.
+func (p *driver) ReopensAfterSleep() {}
+
+// QueuedFrames implements backend.FrameQueuer with the sample counter of the device. QueuedFrames is called
+// from another goroutine than TryWrite.
+func (p *driver) QueuedFrames() (int64, bool) {
+	played, ok, err := waveOutGetPosition(p.out)
+	if err != nil || !ok {
+		return 0, false
+	}
+	// The counter wraps around at 32 bits, so compare the lower 32 bits. The frames filled in the
+	// current header are not submitted yet, but are queued too.
+	queued := int64(uint32(atomic.LoadInt64(&p.committedFrames)) - played)
+	if queued > int64(len(p.headers)*p.bufferSize/p.frameSize) {
+		// The counter is ahead of the committed frames, which must not happen.
+		return 0, false
+	}
+	return queued, true
+}
+
+// Pause implements driver.Pauser by waveOutPause. The headers stay in the queue while the device is
+// paused, so TryWrite just waits for a free header.
+func (p *driver) Pause() error {
+	return waveOutPause(p.out)
+}
+
+// Restart implements driver.Pauser by waveOutRestart.
+func (p *driver) Restart() error {
+	return waveOutRestart(p.out)
+}
+
+// DeviceRateSupport implements backend.DeviceRater.
+func (p *driver) DeviceRateSupport() (rate, pitch bool) {
+	return p.support&wavecapsPlaybackRate != 0, p.support&wavecapsPitch != 0
+}
+
+// SetDeviceRate implements backend.DeviceRater by waveOutSetPlaybackRate.
+func (p *driver) SetDeviceRate(rate float64) error {
+	return waveOutSetPlaybackRate(p.out, toFixed16(rate))
+}
+
+// SetDevicePitch implements backend.DeviceRater by waveOutSetPitch.
+func (p *driver) SetDevicePitch(pitch float64) error {
+	return waveOutSetPitch(p.out, toFixed16(pitch))
+}
+
+// DeviceVolumeSupport implements backend.DeviceVolumer.
+func (p *driver) DeviceVolumeSupport() (volume, stereo bool) {
+	return p.support&wavecapsVolume != 0, p.support&wavecapsLRVolume != 0
+}
+
+// SetDeviceVolume implements backend.DeviceVolumer by waveOutSetVolume.
+func (p *driver) SetDeviceVolume(left, right float64) error {
+	l := uint32(left*0xffff + 0.5)
+	r := uint32(right*0xffff + 0.5)
+	return waveOutSetVolume(p.out, l|r<<16)
+}
+
+// DeviceVolume implements backend.DeviceVolumer by waveOutGetVolume.
+func (p *driver) DeviceVolume() (left, right float64, err error) {
+	v, err := waveOutGetVolume(p.out)
+	if err != nil {
+		return 0, 0, err
+	}
+	left = float64(v&0xffff) / 0xffff
+	right = left
+	if p.support&wavecapsLRVolume != 0 {
+		right = float64(v>>16) / 0xffff
+	}
+	return left, right, nil
+}
+
+// Underruns implements driver.UnderrunCounter.
+func (p *driver) Underruns() int64 {
+	return p.underrunCount
+}
+
+func (p *driver) freeHeader() *header {
+	for _, h := range p.headers {
+		// TODO: Need to check WHDR_DONE?
+		if !h.inQueue() {
+			return h
+		}
+	}
+	return nil
+}
+
+func (p *driver) Close() error {
+	runtime.SetFinalizer(p, nil)
+	// Mark all the headers done so that they can be unprepared.
+	if err := waveOutReset(p.out); err != nil {
+		return err
+	}
+	for _, h := range p.headers {
+		if h == nil {
+			continue
+		}
+		if err := h.Close(p.out); err != nil {
+			return err
+		}
+	}
+	if err := waveOutClose(p.out); err != nil {
+		return err
+	}
+	if err := p.notifier.Close(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// winmmLoop is a header looped by the device. The loop has its own handle of the device, since the headers
+// are played in order and the loop would block the mixed data otherwise.
+type winmmLoop struct {
+	out      uintptr
+	notifier notifier
+	header   *header
+}
+
+// PlayLoop implements backend.Looper with WHDR_BEGINLOOP and WHDR_ENDLOOP.
+func (p *driver) PlayLoop(data []byte, loops int) (backend.Loop, error) {
+	e, err := newEventNotifier()
+	if err != nil {
+		return nil, err
+	}
+	f := p.format
+	out, err := e.open(&f, p.deviceNum)
+	if err != nil {
+		e.Close()
+		return nil, err
+	}
+	h, err := newHeader(out, len(data))
+	if err != nil {
+		waveOutClose(out)
+		e.Close()
+		return nil, err
+	}
+	copy(h.buffer, data)
+
+	// dwLoops is 32 bits. The maximum plays for days even with a short buffer.
+	n := uint32(0xffffffff)
+	if loops > 0 {
+		n = uint32(loops)
+	}
+	h.waveHdr.dwFlags |= whdrBeginLoop | whdrEndLoop
+	h.waveHdr.dwLoops = n
+	l := &winmmLoop{
+		out:      out,
+		notifier: e,
+		header:   h,
+	}
+	if err := h.Write(out); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *winmmLoop) IsPlaying() bool {
+	return atomic.LoadUint32(&l.header.waveHdr.dwFlags)&whdrDone == 0
+}
+
+func (l *winmmLoop) Close() error {
+	if err := waveOutReset(l.out); err != nil {
+		return err
+	}
+	if err := l.header.Close(l.out); err != nil {
+		return err
+	}
+	if err := waveOutClose(l.out); err != nil {
+		return err
+	}
+	return l.notifier.Close()
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,103 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !js
+
+package winmm
+
+import (
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// liveNativeMemory is the number of the native memory blocks not freed yet.
+var liveNativeMemory int64
+
+// nativeMemory is a memory block allocated outside of the Go heap.
+//
+// The audio APIs read and write the buffers passed to them asynchronously, after the call returns and
+// while no Go pointer keeps the buffers alive. Such buffers must be nativeMemory: the garbage collector
+// never frees or scans them, and no Go pointers are passed to the OS, which keeps checkptr happy.
+//
+// The memory must not be freed while the device uses it. The user marks the period by setUsed, and free
+// fails during the period.
+type nativeMemory struct {
+	addr  uintptr
+	size  int
+	used  bool
+	freed bool
+}
+
+func allocNativeMemory(size int) (*nativeMemory, error) {
+	if size <= 0 {
+		return nil, errors.New("oto: the size of native memory must be positive")
+	}
+	addr, err := windows.VirtualAlloc(0, uintptr(size), windows.MEM_COMMIT|windows.MEM_RESERVE, windows.PAGE_READWRITE)
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddInt64(&liveNativeMemory, 1)
+	return &nativeMemory{
+		addr: addr,
+		size: size,
+	}, nil
+}
+
+// pointer returns the pointer at the offset in the memory.
+func (m *nativeMemory) pointer(offset int) unsafe.Pointer {
+	if m.freed {
+		panic("oto: the native memory is already freed")
+	}
+	if offset < 0 || offset >= m.size {
+		panic("oto: the offset is out of the native memory")
+	}
+	addr := m.addr + uintptr(offset)
+	// addr points outside of the Go heap, so reinterpreting it as a pointer is safe.
+	return *(*unsafe.Pointer)(unsafe.Pointer(&addr))
+}
+
+// bytes returns the region of the memory from offset to the end as a byte slice.
+func (m *nativeMemory) bytes(offset int) []byte {
+	var b []byte
+	h := (*reflect.SliceHeader)(unsafe.Pointer(&b))
+	h.Data = uintptr(m.pointer(offset))
+	h.Len = m.size - offset
+	h.Cap = m.size - offset
+	return b
+}
+
+// setUsed marks whether the device uses the memory.
+func (m *nativeMemory) setUsed(used bool) {
+	m.used = used
+}
+
+// free releases the memory. free does nothing when the memory is already freed.
+func (m *nativeMemory) free() error {
+	if m.freed {
+		return nil
+	}
+	if m.used {
+		return errors.New("oto: the native memory is still used by the device")
+	}
+	if err := windows.VirtualFree(m.addr, 0, windows.MEM_RELEASE); err != nil {
+		return err
+	}
+	m.freed = true
+	atomic.AddInt64(&liveNativeMemory, -1)
+	return nil
+}
@@ -0,0 +1,148 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package winmm
+
+import (
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// notifier opens a device and waits until any header of the device is done.
+type notifier interface {
+	open(f *waveformatex, deviceNum int) (uintptr, error)
+
+	// wait waits until any header is done, or at most millis milliseconds.
+	wait(millis uint32) error
+
+	Close() error
+}
+
+func newNotifier(callback bool) (notifier, error) {
+	if callback {
+		return newCallbackNotifier(), nil
+	}
+	return newEventNotifier()
+}
+
+// eventNotifier is notified by an auto-reset event signaled by winmm (CALLBACK_EVENT).
+type eventNotifier struct {
+	event windows.Handle
+}
+
+func newEventNotifier() (*eventNotifier, error) {
+	event, err := windows.CreateEvent(nil, 0, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &eventNotifier{event: event}, nil
+}
+
+func (n *eventNotifier) open(f *waveformatex, deviceNum int) (uintptr, error) {
+	return waveOutOpen(f, deviceNum, uintptr(n.event), 0, callbackEvent)
+}
+
+func (n *eventNotifier) wait(millis uint32) error {
+	_, err := windows.WaitForSingleObject(n.event, millis)
+	return err
+}
+
+func (n *eventNotifier) Close() error {
+	return windows.CloseHandle(n.event)
+}
+
+var (
+	// waveOutProcPtr is the callback function shared by all the devices, since the number of callbacks
+	// created by syscall.NewCallback is limited and they are never released.
+	waveOutProcOnce sync.Once
+	waveOutProcPtr  uintptr
+
+	// callbackChs maps the instance data passed to waveOutOpen to the channel notified by waveOutProc.
+	callbackChs    = map[uintptr]chan struct{}{}
+	callbackNextID uintptr
+	callbackM      sync.Mutex
+)
+
+// waveOutProc is called by winmm on its own thread. waveOutProc must not call winmm functions, so it only
+// notifies the channel without blocking.
+func waveOutProc(hwo, msg, instance, param1, param2 uintptr) uintptr {
+	if msg != womDone {
+		return 0
+	}
+	callbackM.Lock()
+	ch := callbackChs[instance]
+	callbackM.Unlock()
+	if ch != nil {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+	return 0
+}
+
+// callbackNotifier is notified by a callback function called by winmm (CALLBACK_FUNCTION). A callback
+// function is called as soon as a header is done, while an event might be signaled late on some systems.
+type callbackNotifier struct {
+	id   uintptr
+	done chan struct{}
+
+	// timer is reused so that wait doesn't allocate in the steady state.
+	timer *time.Timer
+}
+
+func newCallbackNotifier() *callbackNotifier {
+	waveOutProcOnce.Do(func() {
+		waveOutProcPtr = syscall.NewCallback(waveOutProc)
+	})
+	n := &callbackNotifier{
+		done:  make(chan struct{}, 1),
+		timer: time.NewTimer(time.Hour),
+	}
+	n.timer.Stop()
+
+	callbackM.Lock()
+	defer callbackM.Unlock()
+	callbackNextID++
+	n.id = callbackNextID
+	callbackChs[n.id] = n.done
+	return n
+}
+
+func (n *callbackNotifier) open(f *waveformatex, deviceNum int) (uintptr, error) {
+	return waveOutOpen(f, deviceNum, waveOutProcPtr, n.id, callbackFunction)
+}
+
+func (n *callbackNotifier) wait(millis uint32) error {
+	n.timer.Reset(time.Duration(millis) * time.Millisecond)
+	select {
+	case <-n.done:
+		if !n.timer.Stop() {
+			<-n.timer.C
+		}
+	case <-n.timer.C:
+	}
+	return nil
+}
+
+// Close unregisters the channel. Close must be called after the device is closed.
+func (n *callbackNotifier) Close() error {
+	callbackM.Lock()
+	defer callbackM.Unlock()
+	delete(callbackChs, n.id)
+	return nil
+}
@@ -0,0 +1,370 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package winmm
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+
+	"github.com/leibnewton/oto/internal/backend"
+)
+
+var (
+	ole32 = windows.NewLazySystemDLL("ole32")
+
+	procCoInitializeEx   = ole32.NewProc("CoInitializeEx")
+	procCoUninitialize   = ole32.NewProc("CoUninitialize")
+	procCoCreateInstance = ole32.NewProc("CoCreateInstance")
+)
+
+const (
+	clsctxAll           = 0x17
+	coinitMultithreaded = 0
+	rpcEChangedMode     = 0x80010106
+	eNoInterface        = 0x80004002
+	hresultFailureBit   = 0x80000000
+	eRender             = 0
+	eConsole            = 0
+)
+
+// The indices of the methods in the vtables.
+const (
+	unknownVtblRelease  = 2 // IUnknown::Release
+	enumVtblDefault     = 4 // IMMDeviceEnumerator::GetDefaultAudioEndpoint
+	deviceVtblActivate  = 3 // IMMDevice::Activate
+	managerVtblControl  = 3 // IAudioSessionManager::GetAudioSessionControl
+	managerVtblVolume   = 4 // IAudioSessionManager::GetSimpleAudioVolume
+	controlVtblSetName  = 5 // IAudioSessionControl::SetDisplayName
+	controlVtblSetIcon  = 7 // IAudioSessionControl::SetIconPath
+	controlVtblRegister = 8 // IAudioSessionControl::RegisterAudioSessionNotification
+	volumeVtblSetVolume = 3 // ISimpleAudioVolume::SetMasterVolume
+	volumeVtblGetVolume = 4 // ISimpleAudioVolume::GetMasterVolume
+	volumeVtblSetMute   = 5 // ISimpleAudioVolume::SetMute
+	volumeVtblGetMute   = 6 // ISimpleAudioVolume::GetMute
+)
+
+var (
+	clsidMMDeviceEnumerator = windows.GUID{
+		Data1: 0xbcde0395,
+		Data2: 0xe52f,
+		Data3: 0x467c,
+		Data4: [8]byte{0x8e, 0x3d, 0xc4, 0x57, 0x92, 0x91, 0x69, 0x2e},
+	}
+	iidIMMDeviceEnumerator = windows.GUID{
+		Data1: 0xa95664d2,
+		Data2: 0x9614,
+		Data3: 0x4f35,
+		Data4: [8]byte{0xa7, 0x46, 0xde, 0x8d, 0xb6, 0x36, 0x17, 0xe6},
+	}
+	iidIAudioSessionManager = windows.GUID{
+		Data1: 0xbfa971f1,
+		Data2: 0x4d5e,
+		Data3: 0x40bb,
+		Data4: [8]byte{0x93, 0x5e, 0x96, 0x70, 0x39, 0xbf, 0xbe, 0xe4},
+	}
+	iidIUnknown = windows.GUID{
+		Data4: [8]byte{0xc0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x46},
+	}
+	iidIAudioSessionEvents = windows.GUID{
+		Data1: 0x24918acc,
+		Data2: 0x64b3,
+		Data3: 0x37c1,
+		Data4: [8]byte{0x8c, 0xa9, 0x74, 0xa6, 0x6e, 0x99, 0x57, 0xa8},
+	}
+)
+
+// comObject is a COM interface, whose first word points to the vtable. comObject is always allocated by
+// the COM.
+type comObject struct {
+	vtbl *[16]uintptr
+}
+
+// call calls the method at index i of the vtable with the arguments, and returns the HRESULT.
+func (o *comObject) call(name string, i int, args ...uintptr) error {
+	var a [5]uintptr
+	copy(a[:], args)
+	r, _, _ := syscall.Syscall6(o.vtbl[i], uintptr(len(args)+1), uintptr(unsafe.Pointer(o)), a[0], a[1], a[2], a[3], a[4])
+	if uint32(r)&hresultFailureBit != 0 {
+		return fmt.Errorf("oto: %s failed: HRESULT 0x%08x", name, uint32(r))
+	}
+	return nil
+}
+
+func (o *comObject) release() {
+	if o != nil {
+		o.call("Release", unknownVtblRelease)
+	}
+}
+
+// initCOM initializes the COM on the current thread, and returns the function to uninitialize it. The
+// COM might be initialized on the thread in another mode, which also works. The thread must be locked.
+func initCOM() (func(), error) {
+	r, _, _ := procCoInitializeEx.Call(0, coinitMultithreaded)
+	if uint32(r) == rpcEChangedMode {
+		return func() {}, nil
+	}
+	if uint32(r)&hresultFailureBit != 0 {
+		return nil, fmt.Errorf("oto: CoInitializeEx failed: HRESULT 0x%08x", uint32(r))
+	}
+	return func() { procCoUninitialize.Call() }, nil
+}
+
+// sessionManager returns the IAudioSessionManager of the default device. The winmm streams belong to the
+// default session of the process on the default device. The COM must be initialized.
+func sessionManager() (*comObject, error) {
+	var enumerator *comObject
+	r, _, _ := procCoCreateInstance.Call(uintptr(unsafe.Pointer(&clsidMMDeviceEnumerator)), 0, clsctxAll,
+		uintptr(unsafe.Pointer(&iidIMMDeviceEnumerator)), uintptr(unsafe.Pointer(&enumerator)))
+	if uint32(r)&hresultFailureBit != 0 {
+		return nil, fmt.Errorf("oto: CoCreateInstance failed: HRESULT 0x%08x", uint32(r))
+	}
+	defer enumerator.release()
+
+	var device *comObject
+	if err := enumerator.call("GetDefaultAudioEndpoint", enumVtblDefault, eRender, eConsole, uintptr(unsafe.Pointer(&device))); err != nil {
+		return nil, err
+	}
+	defer device.release()
+
+	var manager *comObject
+	if err := device.call("Activate", deviceVtblActivate, uintptr(unsafe.Pointer(&iidIAudioSessionManager)), clsctxAll, 0, uintptr(unsafe.Pointer(&manager))); err != nil {
+		return nil, err
+	}
+	return manager, nil
+}
+
+// withSession calls f with the IAudioSessionControl or the ISimpleAudioVolume of the default session of the
+// process. method is managerVtblControl or managerVtblVolume.
+func withSession(method int, f func(session *comObject) error) error {
+	// The COM is initialized per thread.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	uninit, err := initCOM()
+	if err != nil {
+		return err
+	}
+	defer uninit()
+
+	manager, err := sessionManager()
+	if err != nil {
+		return err
+	}
+	defer manager.release()
+
+	// The null GUID and no flags are the default session of the process.
+	name := "GetAudioSessionControl"
+	if method == managerVtblVolume {
+		name = "GetSimpleAudioVolume"
+	}
+	var session *comObject
+	if err := manager.call(name, method, 0, 0, uintptr(unsafe.Pointer(&session))); err != nil {
+		return err
+	}
+	defer session.release()
+	return f(session)
+}
+
+// setAudioSession sets the display name and the icon of the audio session of the process, which are shown
+// in the volume mixer. Empty name or iconPath is not set.
+func setAudioSession(name, iconPath string) error {
+	if name == "" && iconPath == "" {
+		return nil
+	}
+	return withSession(managerVtblControl, func(control *comObject) error {
+		if name != "" {
+			n, err := windows.UTF16PtrFromString(name)
+			if err != nil {
+				return err
+			}
+			if err := control.call("SetDisplayName", controlVtblSetName, uintptr(unsafe.Pointer(n)), 0); err != nil {
+				return err
+			}
+		}
+		if iconPath != "" {
+			p, err := windows.UTF16PtrFromString(iconPath)
+			if err != nil {
+				return err
+			}
+			if err := control.call("SetIconPath", controlVtblSetIcon, uintptr(unsafe.Pointer(p)), 0); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SetSessionVolume implements backend.SessionVolumer.
+func (p *driver) SetSessionVolume(volume float64) error {
+	return withSession(managerVtblVolume, func(v *comObject) error {
+		// The float argument is passed by its bits, which the syscall puts in the floating point register
+		// too on amd64.
+		return v.call("SetMasterVolume", volumeVtblSetVolume, uintptr(math.Float32bits(float32(volume))), 0)
+	})
+}
+
+// SetSessionMute implements backend.SessionVolumer.
+func (p *driver) SetSessionMute(muted bool) error {
+	var b uintptr
+	if muted {
+		b = 1
+	}
+	return withSession(managerVtblVolume, func(v *comObject) error {
+		return v.call("SetMute", volumeVtblSetMute, b, 0)
+	})
+}
+
+// SessionVolume implements backend.SessionVolumer.
+func (p *driver) SessionVolume() (volume float64, muted bool, err error) {
+	err = withSession(managerVtblVolume, func(v *comObject) error {
+		var err error
+		volume, muted, err = simpleAudioVolume(v)
+		return err
+	})
+	return volume, muted, err
+}
+
+func simpleAudioVolume(v *comObject) (volume float64, muted bool, err error) {
+	var f float32
+	if err := v.call("GetMasterVolume", volumeVtblGetVolume, uintptr(unsafe.Pointer(&f))); err != nil {
+		return 0, false, err
+	}
+	var b int32
+	if err := v.call("GetMute", volumeVtblGetMute, uintptr(unsafe.Pointer(&b))); err != nil {
+		return 0, false, err
+	}
+	return float64(f), b != 0, nil
+}
+
+// sessionEvents is an IAudioSessionEvents implemented in Go. The COM keeps the pointer to it, so it is a
+// global variable, which is never moved or freed, and its reference count is not counted.
+type sessionEvents struct {
+	vtbl *[10]uintptr
+}
+
+var (
+	theSessionEvents sessionEvents
+
+	// sessionVolumeChanged is notified by OnSimpleVolumeChanged.
+	sessionVolumeChanged = make(chan struct{}, 1)
+
+	sessionWatcherOnce sync.Once
+)
+
+// The methods of sessionEvents are called by the COM on its threads. The arguments must match the methods
+// exactly, since the callee pops them on 386.
+
+func sessionEventsQueryInterface(this *sessionEvents, riid *windows.GUID, ppv **sessionEvents) uintptr {
+	if *riid != iidIUnknown && *riid != iidIAudioSessionEvents {
+		*ppv = nil
+		return eNoInterface
+	}
+	*ppv = this
+	return 0
+}
+
+func sessionEventsAddRef(this *sessionEvents) uintptr {
+	return 1
+}
+
+func sessionEventsIgnore2(this *sessionEvents, a uintptr) uintptr {
+	return 0
+}
+
+func sessionEventsIgnore3(this *sessionEvents, a, b uintptr) uintptr {
+	return 0
+}
+
+func sessionEventsIgnore5(this *sessionEvents, a, b, c, d uintptr) uintptr {
+	return 0
+}
+
+// sessionEventsOnSimpleVolumeChanged doesn't read the volume from the arguments, since the float argument
+// is passed in a floating point register on amd64, which the callback can't read. The watcher gets the
+// volume from ISimpleAudioVolume instead.
+func sessionEventsOnSimpleVolumeChanged(this *sessionEvents, volume, muted, context uintptr) uintptr {
+	select {
+	case sessionVolumeChanged <- struct{}{}:
+	default:
+	}
+	return 0
+}
+
+// startSessionWatcher starts watching the volume and the mute of the session, which are reported by
+// backend.SessionVolumeChanged. The watcher lives as long as the process, and its thread keeps the COM
+// initialized so that the registered notification keeps working. The failure to start watching is
+// reported by log of the driver starting the watcher.
+func startSessionWatcher(log func(kind backend.EventKind, err error, format string, args ...interface{})) {
+	sessionWatcherOnce.Do(func() {
+		go func() {
+			if err := watchSession(); err != nil && log != nil {
+				log(backend.EventSessionWatchFailed, err, "failed to watch the volume of the audio session")
+			}
+		}()
+	})
+}
+
+func watchSession() error {
+	runtime.LockOSThread()
+
+	if _, err := initCOM(); err != nil {
+		return err
+	}
+	manager, err := sessionManager()
+	if err != nil {
+		return err
+	}
+	var control, volume *comObject
+	if err := manager.call("GetAudioSessionControl", managerVtblControl, 0, 0, uintptr(unsafe.Pointer(&control))); err != nil {
+		return err
+	}
+	if err := manager.call("GetSimpleAudioVolume", managerVtblVolume, 0, 0, uintptr(unsafe.Pointer(&volume))); err != nil {
+		return err
+	}
+
+	addRef := syscall.NewCallback(sessionEventsAddRef)
+	ignore2 := syscall.NewCallback(sessionEventsIgnore2)
+	ignore3 := syscall.NewCallback(sessionEventsIgnore3)
+	theSessionEvents.vtbl = &[10]uintptr{
+		syscall.NewCallback(sessionEventsQueryInterface),
+		addRef,
+		addRef,  // Release
+		ignore3, // OnDisplayNameChanged
+		ignore3, // OnIconPathChanged
+		syscall.NewCallback(sessionEventsOnSimpleVolumeChanged),
+		syscall.NewCallback(sessionEventsIgnore5), // OnChannelVolumeChanged
+		ignore3, // OnGroupingParamChanged
+		ignore2, // OnStateChanged
+		ignore2, // OnSessionDisconnected
+	}
+	if err := control.call("RegisterAudioSessionNotification", controlVtblRegister, uintptr(unsafe.Pointer(&theSessionEvents))); err != nil {
+		return err
+	}
+
+	for range sessionVolumeChanged {
+		v, muted, err := simpleAudioVolume(volume)
+		if err != nil {
+			continue
+		}
+		backend.SessionVolumeChanged(v, muted)
+	}
+	return nil
+}
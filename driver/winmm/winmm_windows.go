@@ -0,0 +1,428 @@
+// Copyright 2017 Hajime Hoshi
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !js
+
+package winmm
+
+import (
+	"fmt"
+	"runtime"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+
+	otodriver "github.com/leibnewton/oto/driver"
+	"github.com/leibnewton/oto/internal/backend"
+)
+
+var (
+	winmm = windows.NewLazySystemDLL("winmm")
+)
+
+var (
+	procWaveOutOpen            = winmm.NewProc("waveOutOpen")
+	procWaveOutClose           = winmm.NewProc("waveOutClose")
+	procWaveOutPrepareHeader   = winmm.NewProc("waveOutPrepareHeader")
+	procWaveOutUnprepareHeader = winmm.NewProc("waveOutUnprepareHeader")
+	procWaveOutWrite           = winmm.NewProc("waveOutWrite")
+	procWaveOutReset           = winmm.NewProc("waveOutReset")
+	procWaveOutGetNumDevs      = winmm.NewProc("waveOutGetNumDevs")
+	procWaveOutGetDevCapsW     = winmm.NewProc("waveOutGetDevCapsW")
+	procWaveOutGetPosition     = winmm.NewProc("waveOutGetPosition")
+	procWaveOutPause           = winmm.NewProc("waveOutPause")
+	procWaveOutRestart         = winmm.NewProc("waveOutRestart")
+	procWaveOutSetPlaybackRate = winmm.NewProc("waveOutSetPlaybackRate")
+	procWaveOutSetPitch        = winmm.NewProc("waveOutSetPitch")
+	procWaveOutSetVolume       = winmm.NewProc("waveOutSetVolume")
+	procWaveOutGetVolume       = winmm.NewProc("waveOutGetVolume")
+)
+
+type wavehdr struct {
+	lpData          uintptr
+	dwBufferLength  uint32
+	dwBytesRecorded uint32
+	dwUser          uintptr
+	dwFlags         uint32
+	dwLoops         uint32
+	lpNext          uintptr
+	reserved        uintptr
+}
+
+type waveformatex struct {
+	wFormatTag      uint16
+	nChannels       uint16
+	nSamplesPerSec  uint32
+	nAvgBytesPerSec uint32
+	nBlockAlign     uint16
+	wBitsPerSample  uint16
+	cbSize          uint16
+}
+
+type wavecap struct {
+	Mid           uint16     // manufacturer ID
+	Pid           uint16     // product ID
+	DriverVersion uint32     // version of the driver
+	Pname         [32]uint16 // product name (NULL terminated string)
+	Formats       uint32     // formats supported
+	Channels      uint16     // number of sources supported
+	Reserved1     uint16     // packing
+	Support       uint32     // functionality supported by driver
+}
+
+// mmtime is MMTIME. u is the union of the time formats, whose largest member is the 8-byte SMPTE time.
+type mmtime struct {
+	wType uint32
+	u     [8]byte
+}
+
+const (
+	timeSamples = 2
+)
+
+const (
+	callbackFunction = 0x30000
+	callbackEvent    = 0x50000
+	womDone          = 0x3bd
+)
+
+const (
+	waveFormatPCM = 1
+	whdrDone      = 1
+	whdrBeginLoop = 4
+	whdrEndLoop   = 8
+	whdrInqueue   = 16
+)
+
+type mmresult uint
+
+const (
+	mmsyserrNoerror       mmresult = 0
+	mmsyserrError         mmresult = 1
+	mmsyserrBaddeviceid   mmresult = 2
+	mmsyserrAllocated     mmresult = 4
+	mmsyserrInvalidhandle mmresult = 5
+	mmsyserrNodriver      mmresult = 6
+	mmsyserrNomem         mmresult = 7
+	waveerrBadformat      mmresult = 32
+	waveerrStillplaying   mmresult = 33
+	waveerrUnprepared     mmresult = 34
+	waveerrSync           mmresult = 35
+)
+
+func (m mmresult) String() string {
+	switch m {
+	case mmsyserrNoerror:
+		return "MMSYSERR_NOERROR"
+	case mmsyserrError:
+		return "MMSYSERR_ERROR"
+	case mmsyserrBaddeviceid:
+		return "MMSYSERR_BADDEVICEID"
+	case mmsyserrAllocated:
+		return "MMSYSERR_ALLOCATED"
+	case mmsyserrInvalidhandle:
+		return "MMSYSERR_INVALIDHANDLE"
+	case mmsyserrNodriver:
+		return "MMSYSERR_NODRIVER"
+	case mmsyserrNomem:
+		return "MMSYSERR_NOMEM"
+	case waveerrBadformat:
+		return "WAVEERR_BADFORMAT"
+	case waveerrStillplaying:
+		return "WAVEERR_STILLPLAYING"
+	case waveerrUnprepared:
+		return "WAVEERR_UNPREPARED"
+	case waveerrSync:
+		return "WAVEERR_SYNC"
+	}
+	return fmt.Sprintf("MMRESULT (%d)", m)
+}
+
+type winmmError struct {
+	fname    string
+	errno    windows.Errno
+	mmresult mmresult
+}
+
+func (e *winmmError) Error() string {
+	if e.mmresult != mmsyserrNoerror {
+		return fmt.Sprintf("winmm error at %s: %s Errno: %d", e.fname, e.mmresult, e.errno)
+	}
+	return fmt.Sprintf("winmm error at %s: Errno: %d", e.fname, e.errno)
+}
+
+// Driver implements oto.DriverError.
+func (e *winmmError) Driver() string {
+	return driverName
+}
+
+// Code implements oto.DriverError. Code returns MMRESULT, or the Windows error code when MMRESULT is
+// MMSYSERR_NOERROR.
+func (e *winmmError) Code() int {
+	if e.mmresult != mmsyserrNoerror {
+		return int(e.mmresult)
+	}
+	return int(e.errno)
+}
+
+// Unwrap returns the underlying windows.Errno.
+func (e *winmmError) Unwrap() error {
+	if e.errno == 0 {
+		return nil
+	}
+	return e.errno
+}
+
+// Is reports whether e corresponds to target, one of the errors like driver.ErrDeviceBusy.
+func (e *winmmError) Is(target error) bool {
+	const errorNotFound = 1168
+	switch target {
+	case otodriver.ErrDeviceBusy:
+		return e.mmresult == mmsyserrAllocated
+	case otodriver.ErrNoDevice:
+		if e.fname == "waveOutOpen" && e.errno == errorNotFound {
+			return true
+		}
+		return e.mmresult == mmsyserrBaddeviceid || e.mmresult == mmsyserrNodriver
+	case otodriver.ErrDeviceLost:
+		return e.fname != "waveOutOpen" && (e.errno == errorNotFound || e.mmresult == mmsyserrNodriver)
+	case otodriver.ErrUnsupportedFormat:
+		return e.mmresult == waveerrBadformat
+	}
+	return false
+}
+
+// waveOutOpen opens the device. callback and instance are interpreted by fdwOpen, which is
+// callbackEvent or callbackFunction.
+func waveOutOpen(f *waveformatex, deviceNum int, callback, instance uintptr, fdwOpen uint32) (uintptr, error) {
+	const waveMapper = 0xffffffff
+	var w uintptr
+	var dev uintptr = waveMapper
+	if deviceNum >= 0 {
+		dev = uintptr(deviceNum)
+	}
+	r, _, e := procWaveOutOpen.Call(uintptr(unsafe.Pointer(&w)), dev, uintptr(unsafe.Pointer(f)),
+		callback, instance, uintptr(fdwOpen))
+	runtime.KeepAlive(f)
+	if mmresult(r) != mmsyserrNoerror {
+		return 0, &winmmError{
+			fname:    "waveOutOpen",
+			mmresult: mmresult(r),
+			errno:    e.(windows.Errno),
+		}
+	}
+	return w, nil
+}
+
+func waveOutClose(hwo uintptr) error {
+	r, _, e := procWaveOutClose.Call(hwo)
+	// WAVERR_STILLPLAYING is ignored.
+	if mmresult(r) != mmsyserrNoerror && mmresult(r) != waveerrStillplaying {
+		return &winmmError{
+			fname:    "waveOutClose",
+			mmresult: mmresult(r),
+			errno:    e.(windows.Errno),
+		}
+	}
+	return nil
+}
+
+func waveOutPrepareHeader(hwo uintptr, pwh *wavehdr) error {
+	r, _, e := procWaveOutPrepareHeader.Call(hwo, uintptr(unsafe.Pointer(pwh)), unsafe.Sizeof(wavehdr{}))
+	runtime.KeepAlive(pwh)
+	if mmresult(r) != mmsyserrNoerror {
+		return &winmmError{
+			fname:    "waveOutPrepareHeader",
+			mmresult: mmresult(r),
+			errno:    e.(windows.Errno),
+		}
+	}
+	return nil
+}
+
+func waveOutUnprepareHeader(hwo uintptr, pwh *wavehdr) error {
+	r, _, e := procWaveOutUnprepareHeader.Call(hwo, uintptr(unsafe.Pointer(pwh)), unsafe.Sizeof(wavehdr{}))
+	runtime.KeepAlive(pwh)
+	if mmresult(r) != mmsyserrNoerror {
+		return &winmmError{
+			fname:    "waveOutUnprepareHeader",
+			mmresult: mmresult(r),
+			errno:    e.(windows.Errno),
+		}
+	}
+	return nil
+}
+
+func waveOutReset(hwo uintptr) error {
+	r, _, e := procWaveOutReset.Call(hwo)
+	if mmresult(r) != mmsyserrNoerror {
+		return &winmmError{
+			fname:    "waveOutReset",
+			mmresult: mmresult(r),
+			errno:    e.(windows.Errno),
+		}
+	}
+	return nil
+}
+
+// waveOutPause pauses the device. The submitted headers are kept until waveOutRestart.
+func waveOutPause(hwo uintptr) error {
+	r, _, e := procWaveOutPause.Call(hwo)
+	if mmresult(r) != mmsyserrNoerror {
+		return &winmmError{
+			fname:    "waveOutPause",
+			mmresult: mmresult(r),
+			errno:    e.(windows.Errno),
+		}
+	}
+	return nil
+}
+
+// waveOutRestart restarts the device paused by waveOutPause.
+func waveOutRestart(hwo uintptr) error {
+	r, _, e := procWaveOutRestart.Call(hwo)
+	if mmresult(r) != mmsyserrNoerror {
+		return &winmmError{
+			fname:    "waveOutRestart",
+			mmresult: mmresult(r),
+			errno:    e.(windows.Errno),
+		}
+	}
+	return nil
+}
+
+func waveOutWrite(hwo uintptr, pwh *wavehdr) error {
+	r, _, e := procWaveOutWrite.Call(hwo, uintptr(unsafe.Pointer(pwh)), unsafe.Sizeof(wavehdr{}))
+	runtime.KeepAlive(pwh)
+	if mmresult(r) != mmsyserrNoerror {
+		return &winmmError{
+			fname:    "waveOutWrite",
+			mmresult: mmresult(r),
+			errno:    e.(windows.Errno),
+		}
+	}
+	return nil
+}
+
+func waveOutGetNumDevs() (int, error) {
+	r, _, e := procWaveOutGetNumDevs.Call()
+	if r == 0 && e.(windows.Errno) != 0 {
+		return 0, &winmmError{
+			fname: "waveOutGetNumDevs",
+			errno: e.(windows.Errno),
+		}
+	}
+	return int(r), nil
+}
+
+func waveOutGetDevCaps(uDeviceID uint32) (*backend.Device, error) {
+	pwoc := &wavecap{}
+	r, _, e := procWaveOutGetDevCapsW.Call(uintptr(uDeviceID), uintptr(unsafe.Pointer(pwoc)), unsafe.Sizeof(wavecap{}))
+	runtime.KeepAlive(pwoc)
+	if mmresult(r) != mmsyserrNoerror {
+		return nil, &winmmError{
+			fname:    "waveOutGetDevCaps",
+			mmresult: mmresult(r),
+			errno:    e.(windows.Errno),
+		}
+	}
+	return &backend.Device{
+		Mid:      pwoc.Mid,
+		Pid:      pwoc.Pid,
+		Name:     syscall.UTF16ToString(pwoc.Pname[:]),
+		Formats:  pwoc.Formats,
+		Channels: int(pwoc.Channels),
+		Support:  pwoc.Support,
+	}, nil
+}
+
+// waveOutGetPosition returns the number of the samples played since the device was opened or reset. The
+// counter is 32 bits and wraps around. ok is false when the device doesn't support TIME_SAMPLES.
+func waveOutGetPosition(hwo uintptr) (samples uint32, ok bool, err error) {
+	t := &mmtime{wType: timeSamples}
+	r, _, e := procWaveOutGetPosition.Call(hwo, uintptr(unsafe.Pointer(t)), unsafe.Sizeof(mmtime{}))
+	runtime.KeepAlive(t)
+	if mmresult(r) != mmsyserrNoerror {
+		return 0, false, &winmmError{
+			fname:    "waveOutGetPosition",
+			mmresult: mmresult(r),
+			errno:    e.(windows.Errno),
+		}
+	}
+	if t.wType != timeSamples {
+		return 0, false, nil
+	}
+	return *(*uint32)(unsafe.Pointer(&t.u[0])), true, nil
+}
+
+// waveOutSetVolume sets the volume. The low word of volume is the left channel and the high word is the
+// right channel, from 0 to 0xffff. The low word is used for both when the device doesn't support the
+// separate volumes.
+func waveOutSetVolume(hwo uintptr, volume uint32) error {
+	r, _, e := procWaveOutSetVolume.Call(hwo, uintptr(volume))
+	if mmresult(r) != mmsyserrNoerror {
+		return &winmmError{
+			fname:    "waveOutSetVolume",
+			mmresult: mmresult(r),
+			errno:    e.(windows.Errno),
+		}
+	}
+	return nil
+}
+
+// waveOutGetVolume returns the volume in the same form as waveOutSetVolume.
+func waveOutGetVolume(hwo uintptr) (uint32, error) {
+	var volume uint32
+	r, _, e := procWaveOutGetVolume.Call(hwo, uintptr(unsafe.Pointer(&volume)))
+	if mmresult(r) != mmsyserrNoerror {
+		return 0, &winmmError{
+			fname:    "waveOutGetVolume",
+			mmresult: mmresult(r),
+			errno:    e.(windows.Errno),
+		}
+	}
+	return volume, nil
+}
+
+// toFixed16 converts v to the 16.16 fixed-point number of waveOutSetPlaybackRate and waveOutSetPitch.
+func toFixed16(v float64) uint32 {
+	return uint32(v*0x10000 + 0.5)
+}
+
+// waveOutSetPlaybackRate sets the playback rate in 16.16 fixed point.
+func waveOutSetPlaybackRate(hwo uintptr, rate uint32) error {
+	r, _, e := procWaveOutSetPlaybackRate.Call(hwo, uintptr(rate))
+	if mmresult(r) != mmsyserrNoerror {
+		return &winmmError{
+			fname:    "waveOutSetPlaybackRate",
+			mmresult: mmresult(r),
+			errno:    e.(windows.Errno),
+		}
+	}
+	return nil
+}
+
+// waveOutSetPitch sets the pitch multiplier in 16.16 fixed point.
+func waveOutSetPitch(hwo uintptr, pitch uint32) error {
+	r, _, e := procWaveOutSetPitch.Call(hwo, uintptr(pitch))
+	if mmresult(r) != mmsyserrNoerror {
+		return &winmmError{
+			fname:    "waveOutSetPitch",
+			mmresult: mmresult(r),
+			errno:    e.(windows.Errno),
+		}
+	}
+	return nil
+}
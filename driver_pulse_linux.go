@@ -12,16 +12,13 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-// +build darwin,!ios
-// +build !js
+// +build pulseaudio,!js,!android
 
 package oto
 
-// #cgo LDFLAGS: -framework AppKit
-//
-// #import <AudioToolbox/AudioToolbox.h>
-import "C"
+import (
+	// The PulseAudio driver is the default driver on Linux with the pulseaudio build tag.
+	_ "github.com/leibnewton/oto/driver/pulseaudio"
+)
 
-func componentSubType() C.OSType {
-	return C.kAudioUnitSubType_DefaultOutput
-}
+const driverName = "pulseaudio"
@@ -0,0 +1,79 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	"os"
+
+	"github.com/leibnewton/oto/wav"
+)
+
+// dumpEnv is the environment variable to specify Options.DebugDumpPath without changing the code.
+const dumpEnv = "OTO_DUMP"
+
+// debugDump writes a copy of the data passed to the driver into a WAV file. The data is teed before
+// convertingDriver, so the file is always in the Context's format even if the device format changes when
+// the driver is reopened.
+type debugDump struct {
+	file *os.File
+	w    *wav.Writer
+}
+
+func newDebugDump(path string, options *Options) (*debugDump, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w, err := wav.NewWriter(f, wav.Format{
+		SampleRate:     options.SampleRate,
+		ChannelNum:     options.ChannelNum,
+		BytesPerSample: options.Format.BytesPerSample(),
+	})
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &debugDump{
+		file: f,
+		w:    w,
+	}, nil
+}
+
+// write writes buf to the file. An error stops dumping, but doesn't stop playing.
+func (d *debugDump) write(buf []byte) {
+	if d == nil || len(buf) == 0 {
+		return
+	}
+	d.w.Write(buf)
+}
+
+func (d *debugDump) close() error {
+	if d == nil {
+		return nil
+	}
+	if err := d.w.Close(); err != nil {
+		d.file.Close()
+		return err
+	}
+	return d.file.Close()
+}
+
+// WithDebugDump writes a copy of everything passed to the device into a WAV file at path, in the format
+// of the Context before any conversion to the device format. See Options.DebugDumpPath.
+func WithDebugDump(path string) Option {
+	return func(o *Options) {
+		o.DebugDumpPath = path
+	}
+}
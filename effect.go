@@ -0,0 +1,126 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Effect is a custom processing of a Player's sound, e.g. a reverb or a filter.
+//
+// The effects of a Player are applied in the order of AddEffect after the Player's EQ, and before the
+// volume and the stereo controls.
+type Effect interface {
+	// Prepare is called once by AddEffect with the format of the samples before the first Process.
+	Prepare(sampleRate, channelNum int)
+
+	// Process processes the samples of in and writes the result to out. in and out have a slice for each
+	// channel, and all the slices have the same length. The samples are in the range of [-1, 1]. in and
+	// out don't overlap.
+	//
+	// Process is called from the Context's loop in real time, and should not block or allocate.
+	Process(in, out [][]float32)
+}
+
+// effectChain holds the effects of a Player.
+type effectChain struct {
+	// effects is the []Effect, replaced as a whole when an effect is added or removed.
+	effects atomic.Value
+	m       sync.Mutex
+
+	// planes is the pair of the buffers of planar samples, used only by the Context's loop.
+	planes [2][][]float32
+}
+
+func (e *effectChain) load() []Effect {
+	es, _ := e.effects.Load().([]Effect)
+	return es
+}
+
+func (e *effectChain) add(effect Effect) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	old := e.load()
+	es := make([]Effect, len(old), len(old)+1)
+	copy(es, old)
+	e.effects.Store(append(es, effect))
+}
+
+func (e *effectChain) remove(effect Effect) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	old := e.load()
+	es := make([]Effect, 0, len(old))
+	for _, x := range old {
+		if x != effect {
+			es = append(es, x)
+		}
+	}
+	e.effects.Store(es)
+}
+
+// process applies the effects to the interleaved frames of channelNum channels in buf.
+func (e *effectChain) process(buf []float32, channelNum int) {
+	es := e.load()
+	if len(es) == 0 {
+		return
+	}
+	frames := len(buf) / channelNum
+	in := e.plane(0, channelNum, frames)
+	out := e.plane(1, channelNum, frames)
+	for i := 0; i < frames; i++ {
+		for ch := 0; ch < channelNum; ch++ {
+			in[ch][i] = buf[i*channelNum+ch]
+		}
+	}
+	for _, effect := range es {
+		effect.Process(in, out)
+		in, out = out, in
+	}
+	for i := 0; i < frames; i++ {
+		for ch := 0; ch < channelNum; ch++ {
+			buf[i*channelNum+ch] = in[ch][i]
+		}
+	}
+}
+
+func (e *effectChain) plane(index, channelNum, frames int) [][]float32 {
+	p := e.planes[index]
+	if len(p) != channelNum {
+		p = make([][]float32, channelNum)
+	}
+	for ch := range p {
+		if cap(p[ch]) < frames {
+			p[ch] = make([]float32, frames)
+		}
+		p[ch] = p[ch][:frames]
+	}
+	e.planes[index] = p
+	return p
+}
+
+// AddEffect adds the effect to the end of the Player's effects. AddEffect calls the effect's Prepare
+// with the Context's sample rate and number of channels.
+func (p *Player) AddEffect(effect Effect) {
+	effect.Prepare(p.context.options.SampleRate, p.context.options.ChannelNum)
+	p.source.effects.add(effect)
+}
+
+// RemoveEffect removes the effect from the Player's effects. RemoveEffect does nothing if the effect was
+// not added.
+func (p *Player) RemoveEffect(effect Effect) {
+	p.source.effects.remove(effect)
+}
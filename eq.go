@@ -0,0 +1,117 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/leibnewton/oto/internal/biquad"
+)
+
+// EQBandKind represents the kind of an EQBand.
+type EQBandKind int
+
+const (
+	// EQLowShelf changes the gain of the frequencies below the band's frequency.
+	EQLowShelf EQBandKind = iota
+
+	// EQPeak changes the gain of the frequencies around the band's frequency.
+	EQPeak
+
+	// EQHighShelf changes the gain of the frequencies above the band's frequency.
+	EQHighShelf
+)
+
+// EQBand represents a band of an equalizer.
+type EQBand struct {
+	Kind EQBandKind
+
+	// Frequency is the center frequency of a peak band, or the corner frequency of a shelf band, in Hz.
+	// This must be less than the half of the sample rate.
+	Frequency float64
+
+	// Gain is the gain of the band in decibels.
+	Gain float64
+
+	// Q is the sharpness of the band. 0 means 1/√2, which is the flattest for a shelf.
+	Q float64
+}
+
+// newEQ creates an equalizer of the bands for the options' format. newEQ returns nil for no bands.
+func newEQ(bands []EQBand, options *Options) (*biquad.EQ, error) {
+	if len(bands) == 0 {
+		return nil, nil
+	}
+	bs := make([]biquad.Band, 0, len(bands))
+	for _, b := range bands {
+		var kind biquad.Kind
+		switch b.Kind {
+		case EQLowShelf:
+			kind = biquad.LowShelf
+		case EQPeak:
+			kind = biquad.Peak
+		case EQHighShelf:
+			kind = biquad.HighShelf
+		default:
+			return nil, fmt.Errorf("oto: invalid EQBandKind: %d", b.Kind)
+		}
+		if !(b.Frequency > 0 && b.Frequency < float64(options.SampleRate)/2) {
+			return nil, fmt.Errorf("oto: EQ frequency must be between 0 and %d but %v", options.SampleRate/2, b.Frequency)
+		}
+		if b.Q < 0 || math.IsNaN(b.Q) || math.IsNaN(b.Gain) || math.IsInf(b.Gain, 0) {
+			return nil, fmt.Errorf("oto: invalid EQ band: %+v", b)
+		}
+		q := b.Q
+		if q == 0 {
+			q = math.Sqrt2 / 2
+		}
+		bs = append(bs, biquad.Band{
+			Kind:      kind,
+			Frequency: b.Frequency,
+			Gain:      b.Gain,
+			Q:         q,
+		})
+	}
+	return biquad.New(bs, options.SampleRate, options.ChannelNum), nil
+}
+
+// SetEQ sets the equalizer of the Player. The bands are applied in series before the volume. nil removes
+// the equalizer.
+//
+// SetEQ resets the state of the filters, so changing the bands during playback can click.
+func (p *Player) SetEQ(bands []EQBand) error {
+	e, err := newEQ(bands, p.context.options)
+	if err != nil {
+		return err
+	}
+	p.source.eq.Store(e)
+	return nil
+}
+
+// SetEQ sets the equalizer of the master bus, which is applied to the mixed sound of all the Players.
+// nil removes the equalizer.
+func (c *Context) SetEQ(bands []EQBand) error {
+	e, err := newEQ(bands, c.options)
+	if err != nil {
+		return err
+	}
+	if e == nil {
+		c.mux.SetProcessor(nil)
+		return nil
+	}
+	c.mux.SetProcessor(e)
+	return nil
+}
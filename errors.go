@@ -0,0 +1,112 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	otodriver "github.com/leibnewton/oto/driver"
+)
+
+// The errors that drivers report in common. The errors returned by Oto are compared with them by
+// errors.Is, which works regardless of the driver:
+//
+//	if errors.Is(err, oto.ErrDeviceBusy) {
+//		// Another application holds the device.
+//	}
+var (
+	// ErrContextClosed is returned when the Context is already closed.
+	ErrContextClosed = errors.New("oto: the context is closed")
+
+	// ErrPlayerClosed is returned when the Player is already closed.
+	ErrPlayerClosed = errors.New("oto: the player is closed")
+
+	// ErrDeviceLost is returned when the device was removed or stopped working while playing.
+	ErrDeviceLost = otodriver.ErrDeviceLost
+
+	// ErrDeviceBusy is returned when the device is used exclusively by another application.
+	ErrDeviceBusy = otodriver.ErrDeviceBusy
+
+	// ErrNoDevice is returned when the device is not found.
+	ErrNoDevice = otodriver.ErrNoDevice
+
+	// ErrUnsupportedFormat is returned when the device doesn't support the sample rate, the number of
+	// channels or the format.
+	ErrUnsupportedFormat = otodriver.ErrUnsupportedFormat
+
+	// ErrDeviceStalled is returned when the device stops consuming the data for Options.StallPeriods
+	// periods, e.g. a frozen Bluetooth device or a hung virtual driver.
+	ErrDeviceStalled = errors.New("oto: the device is stalled")
+
+	// ErrCloseTimeout is returned by Context.Close when the driver doesn't finish closing within
+	// Options.CloseTimeout.
+	ErrCloseTimeout = errors.New("oto: closing the context timed out")
+)
+
+// closeTimeoutError reports the step of closing the driver that was abandoned.
+type closeTimeoutError struct {
+	timeout time.Duration
+	stage   string
+}
+
+func (e *closeTimeoutError) Error() string {
+	return fmt.Sprintf("oto: closing the context timed out after %v; the driver was abandoned while %s", e.timeout, e.stage)
+}
+
+func (e *closeTimeoutError) Is(target error) bool {
+	return target == ErrCloseTimeout
+}
+
+// DriverError is implemented by the errors that come from the audio API of the platform.
+// Use errors.As to get the driver-specific details:
+//
+//	var derr oto.DriverError
+//	if errors.As(err, &derr) {
+//		log.Printf("%s error code: %d", derr.Driver(), derr.Code())
+//	}
+//
+// The errors also implement Unwrap when the code is a system error like windows.Errno or
+// syscall.Errno.
+type DriverError interface {
+	error
+
+	// Driver returns the name of the driver, e.g. "winmm".
+	Driver() string
+
+	// Code returns the error code of the platform, e.g. MMRESULT for winmm, a negative errno for ALSA,
+	// and OSStatus for Core Audio.
+	Code() int
+}
+
+// isError reports whether err or any error in its chain matches target, like errors.Is does.
+// isError exists since errors.Is is not available on Go 1.12.
+func isError(err, target error) bool {
+	for err != nil {
+		if err == target {
+			return true
+		}
+		if x, ok := err.(interface{ Is(error) bool }); ok && x.Is(target) {
+			return true
+		}
+		u, ok := err.(interface{ Unwrap() error })
+		if !ok {
+			return false
+		}
+		err = u.Unwrap()
+	}
+	return false
+}
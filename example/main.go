@@ -20,11 +20,11 @@ import (
 	"flag"
 	"fmt"
 	"io"
-	"math"
 	"sync"
 	"time"
 
 	"github.com/leibnewton/oto"
+	"github.com/leibnewton/oto/gen"
 )
 
 var (
@@ -34,89 +34,14 @@ var (
 	bitDepthInBytes = flag.Int("bitdepthinbytes", 2, "bit depth in bytes")
 )
 
-type SineWave struct {
-	freq   float64
-	length int64
-	pos    int64
-
-	remaining []byte
-}
-
-func NewSineWave(freq float64, duration time.Duration) *SineWave {
-	l := int64(*channelNum) * int64(*bitDepthInBytes) * int64(*sampleRate) * int64(duration) / int64(time.Second)
-	l = l / 4 * 4
-	return &SineWave{
-		freq:   freq,
-		length: l,
-	}
-}
-
-func (s *SineWave) Read(buf []byte) (int, error) {
-	if len(s.remaining) > 0 {
-		n := copy(buf, s.remaining)
-		s.remaining = s.remaining[n:]
-		return n, nil
-	}
-
-	if s.pos == s.length {
-		return 0, io.EOF
-	}
-
-	eof := false
-	if s.pos+int64(len(buf)) > s.length {
-		buf = buf[:s.length-s.pos]
-		eof = true
-	}
-
-	var origBuf []byte
-	if len(buf)%4 > 0 {
-		origBuf = buf
-		buf = make([]byte, len(origBuf)+4-len(origBuf)%4)
-	}
-
-	length := float64(*sampleRate) / float64(s.freq)
-
-	num := (*bitDepthInBytes) * (*channelNum)
-	p := s.pos / int64(num)
-	switch *bitDepthInBytes {
-	case 1:
-		for i := 0; i < len(buf)/num; i++ {
-			const max = 127
-			b := int(math.Sin(2*math.Pi*float64(p)/length) * 0.3 * max)
-			for ch := 0; ch < *channelNum; ch++ {
-				buf[num*i+ch] = byte(b + 128)
-			}
-			p++
-		}
-	case 2:
-		for i := 0; i < len(buf)/num; i++ {
-			const max = 32767
-			b := int16(math.Sin(2*math.Pi*float64(p)/length) * 0.3 * max)
-			for ch := 0; ch < *channelNum; ch++ {
-				buf[num*i+2*ch] = byte(b)
-				buf[num*i+1+2*ch] = byte(b >> 8)
-			}
-			p++
-		}
-	}
-
-	s.pos += int64(len(buf))
-
-	n := len(buf)
-	if origBuf != nil {
-		n = copy(origBuf, buf)
-		s.remaining = buf[n:]
-	}
-
-	if eof {
-		return n, io.EOF
-	}
-	return n, nil
-}
-
 func play(context *oto.Context, freq float64, duration time.Duration) error {
 	p := context.NewPlayer()
-	s := NewSineWave(freq, duration)
+	s := gen.Sine(gen.Format{
+		SampleRate:     *sampleRate,
+		ChannelNum:     *channelNum,
+		BytesPerSample: *bitDepthInBytes,
+	}, freq, duration)
+	s.SetAmplitude(0.3)
 	if _, err := io.Copy(p, s); err != nil {
 		return err
 	}
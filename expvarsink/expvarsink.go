@@ -0,0 +1,55 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package expvarsink offers a metrics sink of Oto that publishes the metrics by expvar.
+//
+//	c, err := oto.NewContextFromOptions(&oto.Options{
+//		MetricsSink: expvarsink.New("oto"),
+//	})
+//
+// The metrics are served at /debug/vars with the other expvar variables.
+package expvarsink
+
+import (
+	"expvar"
+)
+
+// Sink publishes the metrics as an expvar.Map. Sink implements oto.MetricsSink.
+type Sink struct {
+	m *expvar.Map
+}
+
+// New creates a Sink that publishes the metrics with the given name. When a variable with the name is
+// already published as an expvar.Map, the map is reused, so that a Sink can be created again for a new
+// Context.
+func New(name string) *Sink {
+	if m, ok := expvar.Get(name).(*expvar.Map); ok {
+		return &Sink{m: m}
+	}
+	return &Sink{m: expvar.NewMap(name)}
+}
+
+// Counter implements oto.MetricsSink.
+func (s *Sink) Counter(name string, value int64) {
+	v := new(expvar.Int)
+	v.Set(value)
+	s.m.Set(name, v)
+}
+
+// Gauge implements oto.MetricsSink.
+func (s *Sink) Gauge(name string, value float64) {
+	v := new(expvar.Float)
+	v.Set(value)
+	s.m.Set(name, v)
+}
@@ -0,0 +1,39 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expvarsink_test
+
+import (
+	"expvar"
+	"testing"
+
+	"github.com/leibnewton/oto/expvarsink"
+)
+
+func TestSink(t *testing.T) {
+	s := expvarsink.New("oto_test")
+	s.Counter("oto.underruns", 3)
+	s.Gauge("oto.buffer_fill", 0.5)
+
+	// Creating a Sink with the same name reuses the published map.
+	expvarsink.New("oto_test").Counter("oto.underruns", 4)
+
+	m := expvar.Get("oto_test").(*expvar.Map)
+	if got, want := m.Get("oto.underruns").String(), "4"; got != want {
+		t.Errorf("oto.underruns: got: %s, want: %s", got, want)
+	}
+	if got, want := m.Get("oto.buffer_fill").String(), "0.5"; got != want {
+		t.Errorf("oto.buffer_fill: got: %s, want: %s", got, want)
+	}
+}
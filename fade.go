@@ -0,0 +1,103 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	"math"
+	"time"
+)
+
+// fadeState is the fade of a Player. fadeState is accessed only while the mux is locked, i.e. by the
+// Context's loop or in mux.Sync.
+type fadeState struct {
+	gain float32
+
+	// from and to are the gains at the start and the end of the fade in progress, and pos and frames are
+	// the progress of the fade. frames is 0 when no fade is in progress.
+	from       float32
+	to         float32
+	pos        int
+	frames     int
+	equalPower bool
+}
+
+func (f *fadeState) start(to float32, frames int, equalPower bool) {
+	f.from = f.gain
+	f.to = to
+	f.pos = 0
+	f.frames = frames
+	f.equalPower = equalPower
+	if frames == 0 {
+		f.gain = to
+	}
+}
+
+// process applies the fade to the interleaved frames of channelNum channels in buf, and advances the
+// fade.
+func (f *fadeState) process(buf []float32, channelNum int) {
+	if f.frames == 0 {
+		if f.gain != 1 {
+			for i := range buf {
+				buf[i] *= f.gain
+			}
+		}
+		return
+	}
+
+	frames := len(buf) / channelNum
+	for i := 0; i < frames; i++ {
+		if f.pos < f.frames {
+			t := float64(f.pos+1) / float64(f.frames)
+			if f.equalPower {
+				// Keep the sum of the powers of the two Players constant during a crossfade.
+				f.gain = f.from*float32(math.Cos(t*math.Pi/2)) + f.to*float32(math.Sin(t*math.Pi/2))
+			} else {
+				f.gain = f.from + (f.to-f.from)*float32(t)
+			}
+			f.pos++
+		}
+		for ch := 0; ch < channelNum; ch++ {
+			buf[i*channelNum+ch] *= f.gain
+		}
+	}
+	if f.pos >= f.frames {
+		f.gain = f.to
+		f.frames = 0
+	}
+}
+
+// Fade changes the fade gain of the Player linearly to gain over d, starting at the next period. The fade
+// gain is multiplied with the volume, and is 1 by default. The fade is sample-accurate regardless of the
+// period size.
+func (p *Player) Fade(gain float64, d time.Duration) {
+	frames := DurationToFrames(d, p.context.options.SampleRate)
+	p.context.mux.Sync(func() {
+		p.source.fade.start(float32(gain), frames, false)
+	})
+}
+
+// Crossfade fades out the Player from and fades in the Player to at the same time over d with equal-power
+// curves, which is useful for the transitions of tracks. The fades start at the same sample, so the
+// Players must have data to play without underflowing.
+//
+// to starts from silence. from keeps playing silence after the crossfade; close or pause it then.
+func Crossfade(from, to *Player, d time.Duration) {
+	frames := DurationToFrames(d, from.context.options.SampleRate)
+	from.context.mux.Sync(func() {
+		to.source.fade.gain = 0
+		from.source.fade.start(0, frames, true)
+		to.source.fade.start(1, frames, true)
+	})
+}
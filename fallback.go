@@ -0,0 +1,119 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DriverAttempt is a driver that failed to open before the driver that the Context uses.
+// See Options.Drivers.
+type DriverAttempt struct {
+	// Driver is the name of the driver.
+	Driver string
+
+	// Err is the reason why the driver failed to open.
+	Err error
+}
+
+// isAvailableDriver reports whether the name is of a driver that can be opened on this platform.
+func isAvailableDriver(name string) bool {
+	return name == driverName || name == dummyDriverName || isBuiltinDriver(name) || isRegisteredDriver(name)
+}
+
+// availableDrivers returns the names of the available drivers in names in order, without duplicates.
+func availableDrivers(names []string) []string {
+	var r []string
+	for _, name := range names {
+		if !isAvailableDriver(name) {
+			continue
+		}
+		dup := false
+		for _, n := range r {
+			if n == name {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			r = append(r, name)
+		}
+	}
+	return r
+}
+
+// openFirstDriver opens the first driver in Options.Drivers that opens successfully, and sets
+// Options.Driver to it so that reopening the device uses the same driver. The drivers that failed are
+// returned with the reasons.
+func openFirstDriver(options *Options) (tryWriteCloser, []DriverAttempt, error) {
+	if options.Driver != "" || len(options.Drivers) == 0 {
+		d, err := openDriver(options)
+		return d, nil, err
+	}
+
+	var attempts []DriverAttempt
+	for _, name := range options.Drivers {
+		o := *options
+		o.Driver = name
+		d, err := openDriver(&o)
+		if err != nil {
+			logEvent(&o, EventDriverFallback, err, "failed to open the driver")
+			attempts = append(attempts, DriverAttempt{Driver: name, Err: err})
+			continue
+		}
+		*options = o
+		return d, attempts, nil
+	}
+	return nil, nil, &driverFallbackError{attempts: attempts}
+}
+
+// driverFallbackError is returned when none of Options.Drivers can be opened.
+type driverFallbackError struct {
+	attempts []DriverAttempt
+}
+
+func (e *driverFallbackError) Error() string {
+	var s []string
+	for _, a := range e.attempts {
+		s = append(s, fmt.Sprintf("%s: %v", a.Driver, a.Err))
+	}
+	return "oto: no driver could be opened: " + strings.Join(s, "; ")
+}
+
+// Is reports whether any of the drivers failed with target.
+func (e *driverFallbackError) Is(target error) bool {
+	for _, a := range e.attempts {
+		if isError(a.Err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Unwrap returns the error of the last driver, which is usually the most basic one, e.g. so that
+// errors.As finds its DriverError.
+func (e *driverFallbackError) Unwrap() error {
+	if len(e.attempts) == 0 {
+		return nil
+	}
+	return e.attempts[len(e.attempts)-1].Err
+}
+
+// DriverAttempts returns the drivers that failed to open before the driver that the Context uses, with
+// the reasons. See Options.Drivers.
+func (c *Context) DriverAttempts() []DriverAttempt {
+	return append([]DriverAttempt(nil), c.driverAttempts...)
+}
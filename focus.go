@@ -0,0 +1,105 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	"fmt"
+)
+
+// AudioFocus represents a change of the audio focus on Android. The values are the same as the focus
+// changes of android.media.AudioManager, so that an OnAudioFocusChangeListener can pass them as they are.
+type AudioFocus int
+
+const (
+	// AudioFocusGain means the application has got the focus.
+	AudioFocusGain AudioFocus = 1
+
+	// AudioFocusLoss means another application has got the focus for an unknown duration.
+	AudioFocusLoss AudioFocus = -1
+
+	// AudioFocusLossTransient means another application has got the focus for a short time, e.g. for
+	// a notification.
+	AudioFocusLossTransient AudioFocus = -2
+
+	// AudioFocusLossTransientCanDuck means another application has got the focus for a short time, and
+	// the application can keep playing quietly.
+	AudioFocusLossTransientCanDuck AudioFocus = -3
+)
+
+// String returns the name of the focus change.
+func (f AudioFocus) String() string {
+	switch f {
+	case AudioFocusGain:
+		return "gain"
+	case AudioFocusLoss:
+		return "loss"
+	case AudioFocusLossTransient:
+		return "loss-transient"
+	case AudioFocusLossTransientCanDuck:
+		return "loss-transient-can-duck"
+	}
+	return fmt.Sprintf("AudioFocus(%d)", int(f))
+}
+
+// SetAudioFocus reacts to a change of the audio focus. Oto doesn't request the audio focus by itself,
+// since the listener of the focus changes must be a Java object. Request the focus with
+// AudioManager.requestAudioFocus in the application, abandon it when the playback finishes, and pass
+// the changes from the listener to SetAudioFocus.
+//
+// AudioFocusLoss and AudioFocusLossTransient pause all the Players without changing their paused states,
+// and AudioFocusGain resumes them. AudioFocusLossTransientCanDuck lowers the volume of the mixed sound to
+// Options.DuckVolume until AudioFocusGain. After AudioFocusLoss, the focus doesn't come back by itself:
+// the application should resume when the user asks, by requesting the focus again.
+//
+// SetAudioFocus can also be used on the other platforms to pause or duck the whole sound.
+func (c *Context) SetAudioFocus(focus AudioFocus) error {
+	switch focus {
+	case AudioFocusGain:
+		c.setInterrupted(interruptedByFocus, false)
+		c.setDucked(false)
+	case AudioFocusLoss, AudioFocusLossTransient:
+		c.setInterrupted(interruptedByFocus, true)
+	case AudioFocusLossTransientCanDuck:
+		c.setDucked(true)
+	default:
+		return fmt.Errorf("oto: unknown audio focus change: %d", int(focus))
+	}
+	logEvent(c.options, EventAudioFocusChanged, nil, "audio focus: %s", focus)
+	return nil
+}
+
+// setDucked lowers the volume of the mixed sound to Options.DuckVolume, or restores it.
+func (c *Context) setDucked(ducked bool) {
+	c.focusM.Lock()
+	defer c.focusM.Unlock()
+	if c.ducked == ducked {
+		return
+	}
+	c.ducked = ducked
+	c.mux.SetMaster(c.masterGain())
+}
+
+// masterGain returns the master gain and the knee of the mixed sound considering the ducking and the
+// switch of the device. masterGain must be called with c.focusM locked.
+func (c *Context) masterGain() (gain, knee float32) {
+	gain, knee = c.options.master()
+	if c.moving {
+		return 0, knee
+	}
+	if c.ducked {
+		gain *= float32(c.options.DuckVolume)
+	}
+	return gain, knee
+}
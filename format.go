@@ -0,0 +1,271 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	otodriver "github.com/leibnewton/oto/driver"
+	"github.com/leibnewton/oto/internal/backend"
+	"github.com/leibnewton/oto/internal/convert"
+	"github.com/leibnewton/oto/internal/rate"
+)
+
+// DeviceFormat represents the format of the samples that the device actually plays.
+type DeviceFormat struct {
+	SampleRate int
+	ChannelNum int
+	Format     Format
+}
+
+// DeviceFormat returns the format that the device actually plays. This differs from the format of the
+// Context's options when the device doesn't support the format and Oto converts the samples.
+// See Options.ExactFormat.
+func (c *Context) DeviceFormat() DeviceFormat {
+	return c.driverWriter.deviceFormat()
+}
+
+func (d *driverWriter) deviceFormat() DeviceFormat {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	if c, ok := d.driver.(*convertingDriver); ok {
+		return c.format
+	}
+	return d.options.deviceFormat()
+}
+
+func (o *Options) deviceFormat() DeviceFormat {
+	return DeviceFormat{
+		SampleRate: o.SampleRate,
+		ChannelNum: o.ChannelNum,
+		Format:     o.Format,
+	}
+}
+
+func (f DeviceFormat) convertFormat() convert.Format {
+	return convert.Format{
+		SampleRate:     f.SampleRate,
+		ChannelNum:     f.ChannelNum,
+		BytesPerSample: f.Format.BytesPerSample(),
+	}
+}
+
+// ResampleQuality represents the quality of the sample rate conversion.
+type ResampleQuality int
+
+const (
+	// ResampleQualityLinear interpolates the samples linearly. This is the cheapest.
+	ResampleQualityLinear ResampleQuality = iota
+
+	// ResampleQualityMedium uses a short windowed-sinc filter.
+	ResampleQualityMedium
+
+	// ResampleQualityHigh uses a long windowed-sinc filter, which is transparent but costs the most.
+	ResampleQualityHigh
+)
+
+func (q ResampleQuality) rateQuality() rate.Quality {
+	switch q {
+	case ResampleQualityMedium:
+		return rate.QualityMedium
+	case ResampleQualityHigh:
+		return rate.QualityHigh
+	}
+	return rate.QualityLinear
+}
+
+// fallbackSampleRates are the sample rates tried when the device doesn't support the requested one.
+var fallbackSampleRates = []int{48000, 44100, 96000, 32000, 22050, 16000, 11025, 8000}
+
+// formatCandidates returns the formats to try when the device rejects the requested format, from the
+// closest one. The sample rate is kept as long as possible since resampling is the most lossy, and the
+// bit depth is changed first.
+func formatCandidates(options *Options) []DeviceFormat {
+	rates := []int{options.SampleRate}
+	for _, r := range fallbackSampleRates {
+		if r != options.SampleRate {
+			rates = append(rates, r)
+		}
+	}
+	// Sort the fallback rates by the distance from the requested rate. The list is short.
+	for i := 1; i < len(rates); i++ {
+		for j := i; j > 1 && abs(rates[j]-options.SampleRate) < abs(rates[j-1]-options.SampleRate); j-- {
+			rates[j], rates[j-1] = rates[j-1], rates[j]
+		}
+	}
+	chs := []int{options.ChannelNum, 3 - options.ChannelNum}
+	formats := []Format{options.Format, FormatSignedInt16LE}
+	if options.Format == FormatSignedInt16LE {
+		formats[1] = FormatUnsignedInt8
+	}
+
+	var fs []DeviceFormat
+	for _, r := range rates {
+		for _, ch := range chs {
+			for _, f := range formats {
+				if r == options.SampleRate && ch == options.ChannelNum && f == options.Format {
+					continue
+				}
+				fs = append(fs, DeviceFormat{SampleRate: r, ChannelNum: ch, Format: f})
+			}
+		}
+	}
+	return fs
+}
+
+// negotiateFormat opens the driver with the closest format that the device supports, after the device
+// rejected the requested format with cause.
+func negotiateFormat(options *Options, cause error) (tryWriteCloser, error) {
+	for _, f := range formatCandidates(options) {
+		o, err := options.withDeviceFormat(f)
+		if err != nil {
+			continue
+		}
+		d, err := openDriverWithRetry(o)
+		if err == nil {
+			logEvent(options, EventFormatNegotiated, cause, "the device doesn't support %d Hz, %d channels, %v; using %d Hz, %d channels, %v",
+				options.SampleRate, options.ChannelNum, options.Format, f.SampleRate, f.ChannelNum, f.Format)
+			return newConvertingDriver(d, options.deviceFormat(), f, options.ResampleQuality), nil
+		}
+		if !isError(err, ErrUnsupportedFormat) {
+			return nil, err
+		}
+	}
+	return nil, cause
+}
+
+// convertingDriver converts the samples in the Context's format to the format that the device accepts.
+//
+// convertingDriver forwards the optional interfaces of the driver, except for the ones that pass the
+// samples to the device without the conversion: backend.BufferAcquirer, so the samples are written by
+// TryWrite, and backend.Looper, so Context.PlayLoop fails. The interfaces that Oto takes from the driver
+// itself, e.g. driver.Pauser and backend.DeviceRater, are taken from the wrapped driver.
+type convertingDriver struct {
+	driver    tryWriteCloser
+	from      DeviceFormat
+	format    DeviceFormat
+	converter *convert.Converter
+
+	// buf holds the converted data that the driver hasn't accepted yet.
+	buf []byte
+}
+
+func newConvertingDriver(driver tryWriteCloser, from, to DeviceFormat, quality ResampleQuality) *convertingDriver {
+	return &convertingDriver{
+		driver:    driver,
+		from:      from,
+		format:    to,
+		converter: convert.NewWithQuality(from.convertFormat(), to.convertFormat(), quality.rateQuality()),
+	}
+}
+
+func (c *convertingDriver) TryWrite(data []byte) (int, error) {
+	// Pass the converted data left at the previous call first. data is not taken until then so that
+	// the converted data doesn't pile up.
+	if len(c.buf) > 0 {
+		if err := c.writeBuffered(); err != nil {
+			return 0, err
+		}
+		if len(c.buf) > 0 {
+			return 0, nil
+		}
+	}
+	c.buf = c.converter.Convert(c.buf, data)
+	if err := c.writeBuffered(); err != nil {
+		return len(data), err
+	}
+	return len(data), nil
+}
+
+func (c *convertingDriver) writeBuffered() error {
+	n, err := c.driver.TryWrite(c.buf)
+	c.buf = c.buf[:copy(c.buf, c.buf[n:])]
+	return err
+}
+
+func (c *convertingDriver) Close() error {
+	return c.driver.Close()
+}
+
+// Underruns implements driver.UnderrunCounter.
+func (c *convertingDriver) Underruns() int64 {
+	if u, ok := c.driver.(otodriver.UnderrunCounter); ok {
+		return u.Underruns()
+	}
+	return 0
+}
+
+// QueuedFrames implements backend.FrameQueuer. The frames of the device format are counted in the frames
+// before the conversion.
+func (c *convertingDriver) QueuedFrames() (int64, bool) {
+	q, ok := c.driver.(backend.FrameQueuer)
+	if !ok {
+		return 0, false
+	}
+	n, ok := q.QueuedFrames()
+	if !ok {
+		return 0, false
+	}
+	n += int64(len(c.buf) / (c.format.ChannelNum * c.format.Format.BytesPerSample()))
+	return n * int64(c.from.SampleRate) / int64(c.format.SampleRate), true
+}
+
+// Cancel implements driver.Canceler.
+func (c *convertingDriver) Cancel() {
+	if w, ok := c.driver.(otodriver.Canceler); ok {
+		w.Cancel()
+	}
+}
+
+// ResumeOnUserGesture implements backend.GestureResumer.
+func (c *convertingDriver) ResumeOnUserGesture() {
+	if g, ok := c.driver.(backend.GestureResumer); ok {
+		g.ResumeOnUserGesture()
+	}
+}
+
+// SetKeepAlive implements backend.KeepAliver.
+func (c *convertingDriver) SetKeepAlive(keepAlive bool) error {
+	if k, ok := c.driver.(backend.KeepAliver); ok {
+		return k.SetKeepAlive(keepAlive)
+	}
+	return nil
+}
+
+// ReopensAfterSleep implements backend.SleepRecoverer. The formats are negotiated only with the real
+// devices, which are reopened after the system sleeps.
+func (c *convertingDriver) ReopensAfterSleep() {}
+
+// DeviceRemoved implements driver.RemovalWatcher.
+func (c *convertingDriver) DeviceRemoved() bool {
+	if w, ok := c.driver.(otodriver.RemovalWatcher); ok {
+		return w.DeviceRemoved()
+	}
+	return false
+}
+
+// DefaultDeviceChanged implements backend.DefaultDeviceFollower.
+func (c *convertingDriver) DefaultDeviceChanged() bool {
+	if f, ok := c.driver.(backend.DefaultDeviceFollower); ok {
+		return f.DefaultDeviceChanged()
+	}
+	return false
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,108 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build gofuzz
+
+package oto
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/leibnewton/oto/internal/backend"
+)
+
+// Fuzz is the entry point of go-fuzz. Fuzz resolves the Options decoded from data, and checks that
+// resolved Options are consistent, and that the formats negotiated from them can be converted:
+//
+//	go-fuzz-build github.com/leibnewton/oto
+//	go-fuzz -bin oto-fuzz.zip
+func Fuzz(data []byte) int {
+	var v [14]int32
+	if len(data) < 4*len(v) {
+		return 0
+	}
+	for i := range v {
+		v[i] = int32(binary.LittleEndian.Uint32(data[4*i:]))
+	}
+	options := &Options{
+		SampleRate:           int(v[0]),
+		ChannelNum:           int(v[1]),
+		Format:               Format(v[2]),
+		BufferSizeInBytes:    int(v[3]),
+		BufferFrames:         int(v[4]),
+		BufferDuration:       time.Duration(v[5]) * time.Microsecond,
+		PeriodFrames:         int(v[6]),
+		PeriodDuration:       time.Duration(v[7]) * time.Microsecond,
+		PeriodCount:          int(v[8]),
+		StartThresholdFrames: int(v[9]),
+		IOBufferFrames:       int(v[10]),
+		FlushFrames:          int(v[11]),
+		Profile:              Profile(v[12]),
+		ResampleQuality:      ResampleQuality(v[13] % 3),
+		Driver:               dummyDriverName,
+	}
+	o, err := options.resolve()
+	if err != nil {
+		return 0
+	}
+	checkResolvedOptions(o)
+
+	src := data[4*len(v):]
+	for _, f := range formatCandidates(o) {
+		fo, err := o.withDeviceFormat(f)
+		if err != nil {
+			continue
+		}
+		checkResolvedOptions(fo)
+
+		c := newConvertingDriver(backend.NewDummy(f.SampleRate, f.ChannelNum, f.Format.BytesPerSample()), o.deviceFormat(), f, o.ResampleQuality)
+		out := c.converter.Convert(nil, src)
+		if len(out)%(f.ChannelNum*f.Format.BytesPerSample()) != 0 {
+			panic(fmt.Sprintf("oto: the converted data (%d bytes) is not whole frames of %+v", len(out), f))
+		}
+	}
+	return 1
+}
+
+// checkResolvedOptions panics if the resolved options are inconsistent.
+func checkResolvedOptions(o *Options) {
+	bpf := o.bytesPerFrame()
+	if o.SampleRate < minSampleRate || o.SampleRate > maxSampleRate {
+		panic(fmt.Sprintf("oto: SampleRate %d is out of range", o.SampleRate))
+	}
+	if o.ChannelNum != 1 && o.ChannelNum != 2 {
+		panic(fmt.Sprintf("oto: ChannelNum %d is invalid", o.ChannelNum))
+	}
+	if bpf == 0 {
+		panic(fmt.Sprintf("oto: Format %v is invalid", o.Format))
+	}
+	if o.BufferFrames <= 0 || o.BufferSizeInBytes != o.BufferFrames*bpf {
+		panic(fmt.Sprintf("oto: the buffer is inconsistent: %d frames, %d bytes", o.BufferFrames, o.BufferSizeInBytes))
+	}
+	if o.PeriodFrames < 0 || o.PeriodFrames > o.BufferFrames {
+		panic(fmt.Sprintf("oto: PeriodFrames %d is out of range", o.PeriodFrames))
+	}
+	if o.FlushFrames <= 0 || o.FlushFrames > o.BufferFrames {
+		panic(fmt.Sprintf("oto: FlushFrames %d is out of range", o.FlushFrames))
+	}
+	if o.StartThresholdFrames < 0 || o.StartThresholdFrames > o.BufferFrames {
+		panic(fmt.Sprintf("oto: StartThresholdFrames %d is out of range", o.StartThresholdFrames))
+	}
+	size, count := o.periods()
+	if size <= 0 || count < 2 {
+		panic(fmt.Sprintf("oto: the periods are invalid: %d bytes, %d periods", size, count))
+	}
+}
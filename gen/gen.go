@@ -0,0 +1,214 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package gen offers signal generators that produce PCM samples for Players.
+//
+// The generators are useful to verify the audio path, e.g. whether the sound reaches the speakers,
+// and to test applications:
+//
+//	c, _ := oto.NewContext(-1, 44100, 2, 2, 8192)
+//	p := c.NewPlayer()
+//	io.Copy(p, gen.Sine(gen.Format{SampleRate: 44100, ChannelNum: 2, BytesPerSample: 2}, 440, time.Second))
+//
+// The same value is written to all the channels.
+package gen
+
+import (
+	"io"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Format represents the format of the generated samples. BytesPerSample is 1 for unsigned 8bit
+// samples and 2 for signed 16bit little-endian samples, like oto.Format.
+type Format struct {
+	SampleRate     int
+	ChannelNum     int
+	BytesPerSample int
+}
+
+func (f Format) bytesPerFrame() int {
+	return f.ChannelNum * f.BytesPerSample
+}
+
+// Reader generates PCM samples. Reader implements io.Reader.
+type Reader struct {
+	format    Format
+	next      func() float64
+	amplitude float64
+
+	// frames is the number of the frames to generate, or -1 for infinite.
+	frames int64
+
+	// frame is the last generated frame that is not read entirely yet.
+	frame []byte
+	rest  []byte
+}
+
+func newReader(format Format, duration time.Duration, next func() float64) *Reader {
+	if format.SampleRate <= 0 {
+		panic("gen: SampleRate must be positive")
+	}
+	if format.ChannelNum <= 0 {
+		panic("gen: ChannelNum must be positive")
+	}
+	if format.BytesPerSample != 1 && format.BytesPerSample != 2 {
+		panic("gen: BytesPerSample must be 1 or 2")
+	}
+	frames := int64(-1)
+	if duration > 0 {
+		frames = int64(duration) * int64(format.SampleRate) / int64(time.Second)
+	}
+	return &Reader{
+		format:    format,
+		next:      next,
+		amplitude: 1,
+		frames:    frames,
+		frame:     make([]byte, format.bytesPerFrame()),
+	}
+}
+
+// SetAmplitude sets the amplitude of the signal from 0 to 1. The default amplitude is 1.
+func (r *Reader) SetAmplitude(amplitude float64) {
+	r.amplitude = math.Max(0, math.Min(1, amplitude))
+}
+
+// Read implements io.Reader. Read returns io.EOF after the duration is generated. When the duration is
+// 0, Read never returns io.EOF.
+func (r *Reader) Read(buf []byte) (int, error) {
+	n := copy(buf, r.rest)
+	r.rest = r.rest[n:]
+	for n < len(buf) {
+		if r.frames == 0 {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, io.EOF
+		}
+		if r.frames > 0 {
+			r.frames--
+		}
+		r.encode(r.next() * r.amplitude)
+		c := copy(buf[n:], r.frame)
+		r.rest = r.frame[c:]
+		n += c
+	}
+	return n, nil
+}
+
+// encode encodes the value from -1 to 1 into r.frame.
+func (r *Reader) encode(v float64) {
+	v = math.Max(-1, math.Min(1, v))
+	switch r.format.BytesPerSample {
+	case 1:
+		b := byte(math.Round(v*127) + 128)
+		for i := range r.frame {
+			r.frame[i] = b
+		}
+	case 2:
+		s := int16(math.Round(v * 32767))
+		for i := 0; i < len(r.frame); i += 2 {
+			r.frame[i] = byte(s)
+			r.frame[i+1] = byte(s >> 8)
+		}
+	}
+}
+
+// oscillator returns a function that returns the phase from 0 to 1 of the given frequency, advancing
+// it by one frame at each call.
+func oscillator(format Format, freq float64) func() float64 {
+	var phase float64
+	step := freq / float64(format.SampleRate)
+	return func() float64 {
+		p := phase
+		phase += step
+		phase -= math.Floor(phase)
+		return p
+	}
+}
+
+// Sine generates a sine wave of the frequency in Hz for the duration. 0 duration means infinite.
+func Sine(format Format, freq float64, duration time.Duration) *Reader {
+	osc := oscillator(format, freq)
+	return newReader(format, duration, func() float64 {
+		return math.Sin(2 * math.Pi * osc())
+	})
+}
+
+// Square generates a square wave of the frequency in Hz for the duration. 0 duration means infinite.
+func Square(format Format, freq float64, duration time.Duration) *Reader {
+	osc := oscillator(format, freq)
+	return newReader(format, duration, func() float64 {
+		if osc() < 0.5 {
+			return 1
+		}
+		return -1
+	})
+}
+
+// Sawtooth generates a sawtooth wave of the frequency in Hz for the duration. 0 duration means
+// infinite.
+func Sawtooth(format Format, freq float64, duration time.Duration) *Reader {
+	osc := oscillator(format, freq)
+	return newReader(format, duration, func() float64 {
+		return 2*osc() - 1
+	})
+}
+
+// WhiteNoise generates white noise for the duration. 0 duration means infinite. The noise is the same
+// every time.
+func WhiteNoise(format Format, duration time.Duration) *Reader {
+	rnd := rand.New(rand.NewSource(1))
+	return newReader(format, duration, func() float64 {
+		return 2*rnd.Float64() - 1
+	})
+}
+
+// PinkNoise generates pink noise, whose power decreases by 3dB per octave, for the duration.
+// 0 duration means infinite. The noise is the same every time.
+func PinkNoise(format Format, duration time.Duration) *Reader {
+	rnd := rand.New(rand.NewSource(1))
+	var b0, b1, b2 float64
+	return newReader(format, duration, func() float64 {
+		// The economy filter by Paul Kellet, which is accurate to within 0.05dB above 9.2Hz at 44.1kHz.
+		w := 2*rnd.Float64() - 1
+		b0 = 0.99765*b0 + w*0.0990460
+		b1 = 0.96300*b1 + w*0.2965164
+		b2 = 0.57000*b2 + w*1.0526913
+		return (b0 + b1 + b2 + w*0.1848) / 4
+	})
+}
+
+// Sweep generates a sine wave whose frequency changes exponentially from the frequency from to the
+// frequency to in Hz for the duration. duration must be positive.
+func Sweep(format Format, from, to float64, duration time.Duration) *Reader {
+	if duration <= 0 {
+		panic("gen: the duration of a sweep must be positive")
+	}
+	if from <= 0 || to <= 0 {
+		panic("gen: the frequencies of a sweep must be positive")
+	}
+	frames := float64(duration) * float64(format.SampleRate) / float64(time.Second)
+	ratio := math.Pow(to/from, 1/frames)
+	freq := from
+	var phase float64
+	return newReader(format, duration, func() float64 {
+		v := math.Sin(2 * math.Pi * phase)
+		phase += freq / float64(format.SampleRate)
+		phase -= math.Floor(phase)
+		freq *= ratio
+		return v
+	})
+}
@@ -0,0 +1,94 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gen_test
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/leibnewton/oto/gen"
+)
+
+func bytesToInt16s(b []byte) []int16 {
+	s := make([]int16, len(b)/2)
+	for i := range s {
+		s[i] = int16(b[2*i]) | int16(b[2*i+1])<<8
+	}
+	return s
+}
+
+func TestLength(t *testing.T) {
+	f := gen.Format{SampleRate: 44100, ChannelNum: 2, BytesPerSample: 2}
+	b, err := ioutil.ReadAll(gen.Sine(f, 440, 100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(b), 4410*4; got != want {
+		t.Errorf("len: got: %d, want: %d", got, want)
+	}
+}
+
+func TestSquare(t *testing.T) {
+	// 4 frames per cycle.
+	f := gen.Format{SampleRate: 8, ChannelNum: 1, BytesPerSample: 2}
+	b, err := ioutil.ReadAll(gen.Square(f, 2, time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := bytesToInt16s(b)
+	want := []int16{32767, 32767, -32767, -32767, 32767, 32767, -32767, -32767}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+func TestUnsigned8Bits(t *testing.T) {
+	f := gen.Format{SampleRate: 8, ChannelNum: 2, BytesPerSample: 1}
+	r := gen.Sawtooth(f, 2, time.Second)
+	r.SetAmplitude(0.5)
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{64, 64, 96, 96, 128, 128, 160, 160, 64, 64, 96, 96, 128, 128, 160, 160}
+	if !reflect.DeepEqual(b, want) {
+		t.Errorf("got: %v, want: %v", b, want)
+	}
+}
+
+func TestSmallReads(t *testing.T) {
+	f := gen.Format{SampleRate: 44100, ChannelNum: 2, BytesPerSample: 2}
+	all, err := ioutil.ReadAll(gen.PinkNoise(f, 10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Reading by 3 bytes splits frames, and must return the same data.
+	r := gen.PinkNoise(f, 10*time.Millisecond)
+	var got []byte
+	buf := make([]byte, 3)
+	for {
+		n, err := r.Read(buf)
+		got = append(got, buf[:n]...)
+		if err != nil {
+			break
+		}
+	}
+	if !reflect.DeepEqual(got, all) {
+		t.Errorf("the data read by small reads doesn't match")
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	"sync"
+
+	"github.com/leibnewton/oto/internal/backend"
+)
+
+var (
+	// gestureResume is whether ResumeOnUserGesture is called, and onAudioStateChange is its callback.
+	gestureResume      bool
+	onAudioStateChange func(state string)
+	gestureM           sync.Mutex
+)
+
+// ResumeOnUserGesture makes the sound resume at user gestures in browsers.
+//
+// Browsers start an AudioContext suspended until the user interacts with the page, and some browsers
+// suspend it again, e.g. when the page is in the background on iOS. By default, Oto resumes the sound
+// only at the first user gesture. After ResumeOnUserGesture is called, Oto listens to the user gestures
+// as long as the Context lives, and resumes the sound whenever it is not running.
+//
+// onStateChange, if not nil, is called with the state of the AudioContext when ResumeOnUserGesture is
+// called and whenever it changes: "suspended", "running", "interrupted" or "closed". For example, a game
+// can show "click to enable sound" while the state is not "running". onStateChange is called from the
+// event loop of the browser, and must not block.
+//
+// ResumeOnUserGesture can be called before or after creating the Context. On the other platforms,
+// ResumeOnUserGesture does nothing.
+func ResumeOnUserGesture(onStateChange func(state string)) {
+	gestureM.Lock()
+	gestureResume = true
+	onAudioStateChange = onStateChange
+	gestureM.Unlock()
+
+	c := currentContext()
+	if c == nil {
+		return
+	}
+	d := c.driverWriter
+	d.m.Lock()
+	defer d.m.Unlock()
+	if g, ok := d.driver.(backend.GestureResumer); ok {
+		g.ResumeOnUserGesture()
+	}
+}
+
+// gestureSettings returns the settings of ResumeOnUserGesture.
+func gestureSettings() (resume bool, onStateChange func(state string)) {
+	gestureM.Lock()
+	defer gestureM.Unlock()
+	return gestureResume, onAudioStateChange
+}
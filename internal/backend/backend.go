@@ -0,0 +1,237 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package backend is the interface between oto and its built-in drivers, which are the subpackages of
+// oto/driver.
+//
+// A built-in driver registers itself by Register in its init function. The driver is registered to the
+// package driver too, so that it can be opened by name as any other driver. oto opens the built-in
+// drivers with Params, which carries the settings of oto.Options that only the built-in drivers know, and
+// uses the optional interfaces declared here when the opened driver implements them.
+package backend
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/leibnewton/oto/driver"
+)
+
+// EventKind is the kind of a diagnostic event that a driver reports. oto reports the event as the
+// oto.EventKind of the same name.
+type EventKind int
+
+const (
+	EventDriverOpened EventKind = iota
+	EventAudioStateChanged
+	EventSessionWatchFailed
+)
+
+// XrunPolicy is oto.XrunPolicy, whose values are in the same order.
+type XrunPolicy int
+
+const (
+	XrunRecover XrunPolicy = iota
+	XrunReport
+	XrunFail
+)
+
+// ALSAAccess is oto.ALSAAccess, whose values are in the same order.
+type ALSAAccess int
+
+const (
+	ALSAAccessDefault ALSAAccess = iota
+	ALSAAccessHardware
+	ALSAAccessDmix
+)
+
+// RouteChange is oto.RouteChange, whose values are in the same order.
+type RouteChange int
+
+const (
+	RouteChangeNewDevice RouteChange = iota
+	RouteChangeOldDeviceUnavailable
+	RouteChangeOther
+)
+
+// PulseBufferAttr is oto.PulseBufferAttr.
+type PulseBufferAttr struct {
+	MaxLength    int
+	TargetLength int
+	Prebuffer    int
+	MinRequest   int
+}
+
+// Params represents the parameters to open a built-in driver. Params has the common parameters and the
+// settings of oto.Options for the built-in drivers. The settings are zero when the driver is opened by
+// name through the package driver.
+type Params struct {
+	driver.Params
+
+	// PeriodCount is the number of the periods in the device buffer. 0 means that the driver decides it.
+	PeriodCount int
+
+	// StartThresholdFrames is the number of the frames buffered before the device starts.
+	StartThresholdFrames int
+
+	// IOBufferFrames is the size of the I/O buffer of the device in frames on macOS.
+	IOBufferFrames int
+
+	// XrunPolicy and OnXrun are how the ALSA driver treats an underrun.
+	XrunPolicy XrunPolicy
+	OnXrun     func(count int64)
+
+	// ALSADevice is the name of the PCM device, and ALSAAccess is how the ALSA driver accesses it.
+	ALSADevice string
+	ALSAAccess ALSAAccess
+
+	// PulseBufferAttr, PulseAdjustLatency and MediaRole are the settings of the PulseAudio stream.
+	PulseBufferAttr    *PulseBufferAttr
+	PulseAdjustLatency bool
+	MediaRole          string
+
+	// SessionName and SessionIconPath are the name and the icon of the audio session of the process.
+	SessionName     string
+	SessionIconPath string
+
+	// WatchSessionVolume is whether the driver reports the changes of the volume of the audio session
+	// by SessionVolumeChanged.
+	WatchSessionVolume bool
+
+	// WinMMCallbackFunction is whether the winmm driver is notified by a callback function.
+	WinMMCallbackFunction bool
+
+	// Log reports a diagnostic event of the Context opening the driver. Log can be nil.
+	Log func(kind EventKind, err error, format string, args ...interface{})
+}
+
+// LogEvent reports a diagnostic event by p.Log, if any.
+func (p *Params) LogEvent(kind EventKind, err error, format string, args ...interface{}) {
+	if p.Log != nil {
+		p.Log(kind, err, format, args...)
+	}
+}
+
+// BytesPerFrame returns the size of a frame in bytes.
+func (p *Params) BytesPerFrame() int {
+	return p.ChannelNum * p.BytesPerSample
+}
+
+// BufferSizeInBytes returns the size of the device buffer in bytes.
+func (p *Params) BufferSizeInBytes() int {
+	return p.BufferFrames * p.BytesPerFrame()
+}
+
+// PeriodSizeInBytes returns the period in bytes, or 0 when the driver should decide the period.
+func (p *Params) PeriodSizeInBytes() int {
+	return p.PeriodFrames * p.BytesPerFrame()
+}
+
+// Periods returns the size of each device buffer in bytes and the number of the device buffers.
+// By default, each device buffer has the whole buffer size and two device buffers are used alternately.
+// When the period is specified, each device buffer has the period size and the device buffers cover the
+// whole buffer.
+func (p *Params) Periods() (size int, count int) {
+	size = p.BufferSizeInBytes()
+	count = 2
+	if ps := p.PeriodSizeInBytes(); ps > 0 {
+		size = ps
+		count = max(2, p.BufferSizeInBytes()/ps)
+	}
+	if p.PeriodCount > 0 {
+		count = p.PeriodCount
+	}
+	return size, count
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Capabilities is what a driver supports regardless of the device. See oto.Capabilities.
+type Capabilities struct {
+	Float        bool
+	MinLatency   time.Duration
+	DeviceSwitch bool
+}
+
+// Device is an output device listed by a driver. See oto.Device.
+type Device struct {
+	Name     string
+	Number   int
+	Channels int
+	Mid      uint16
+	Pid      uint16
+
+	// Formats and Support are WAVEOUTCAPS.dwFormats and WAVEOUTCAPS.dwSupport, whose bits are the same as
+	// oto.WaveFormats and oto.WaveSupport.
+	Formats uint32
+	Support uint32
+}
+
+// Driver is a built-in driver.
+type Driver struct {
+	// Name is the name of the driver, e.g. "winmm".
+	Name string
+
+	// Open opens the driver.
+	Open func(params *Params) (driver.Driver, error)
+
+	// Capabilities is what the driver supports.
+	Capabilities Capabilities
+
+	// Devices lists the output devices. mapperInclude is whether the device that follows the default
+	// device is listed too. Devices can be nil when the driver can't list the devices.
+	Devices func(mapperInclude bool) ([]*Device, error)
+
+	// CreateAggregateDevice and DestroyAggregateDevice implement oto.CreateAggregateDevice and
+	// oto.DestroyAggregateDevice. They can be nil when the platform has no aggregate devices.
+	CreateAggregateDevice  func(name string, devices []*Device, stacked bool) (*Device, error)
+	DestroyAggregateDevice func(device *Device) error
+}
+
+var (
+	driversM sync.Mutex
+	drivers  = map[string]*Driver{}
+)
+
+// Register makes a built-in driver available by its name, both to oto and to the package driver.
+//
+// Register panics if a driver is already registered with the same name.
+func Register(d *Driver) {
+	driversM.Lock()
+	if _, ok := drivers[d.Name]; ok {
+		driversM.Unlock()
+		panic(fmt.Sprintf("oto: Register is called twice for driver %q", d.Name))
+	}
+	drivers[d.Name] = d
+	driversM.Unlock()
+
+	driver.Register(d.Name, func(params driver.Params) (driver.Driver, error) {
+		return d.Open(&Params{Params: params})
+	})
+}
+
+// Lookup returns the built-in driver registered by the name.
+func Lookup(name string) (*Driver, bool) {
+	driversM.Lock()
+	defer driversM.Unlock()
+
+	d, ok := drivers[name]
+	return d, ok
+}
@@ -12,13 +12,15 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-package oto
+package backend
 
 import (
 	"time"
 )
 
-type dummyDriver struct {
+// Dummy is a driver that plays nothing at the speed of a device. Dummy is used when no device is
+// available.
+type Dummy struct {
 	sampleRate      int
 	channelNum      int
 	bitDepthInBytes int
@@ -26,19 +28,20 @@ type dummyDriver struct {
 	current int
 }
 
-func newDummyDriver(sampleRate, channelNum, bitDepthInBytes int) *dummyDriver {
-	return &dummyDriver{
+// NewDummy returns a Dummy for the format.
+func NewDummy(sampleRate, channelNum, bitDepthInBytes int) *Dummy {
+	return &Dummy{
 		sampleRate:      sampleRate,
 		channelNum:      channelNum,
 		bitDepthInBytes: bitDepthInBytes,
 	}
 }
 
-func (d *dummyDriver) bytes(t time.Duration) int {
+func (d *Dummy) bytes(t time.Duration) int {
 	return int(float64(d.sampleRate*d.channelNum*d.bitDepthInBytes) * float64(t) / float64(time.Second))
 }
 
-func (d *dummyDriver) TryWrite(buf []byte) (int, error) {
+func (d *Dummy) TryWrite(buf []byte) (int, error) {
 	d.current += len(buf)
 	b := d.bytes(100 * time.Millisecond)
 	for d.current >= b {
@@ -48,6 +51,6 @@ func (d *dummyDriver) TryWrite(buf []byte) (int, error) {
 	return len(buf), nil
 }
 
-func (d *dummyDriver) Close() error {
+func (d *Dummy) Close() error {
 	return nil
 }
@@ -0,0 +1,36 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+// The hooks below are the functions of oto that the built-in drivers call when the system notifies them.
+// oto sets them in its init function, before any driver is opened.
+var (
+	// DevicesChanged is called when an output device is added or removed.
+	DevicesChanged = func() {}
+
+	// SessionVolumeChanged is called when the volume or the mute of the audio session of the process
+	// changes.
+	SessionVolumeChanged = func(volume float64, muted bool) {}
+
+	// Interrupted is called when the system interrupts the sound and when the interruption ends. err is
+	// the error to restore the sound after the interruption, if any.
+	Interrupted = func(interrupted bool, err error) {}
+
+	// RouteChanged is called when the route of the sound changes.
+	RouteChanged = func(change RouteChange) {}
+
+	// GestureSettings returns the settings of oto.ResumeOnUserGesture.
+	GestureSettings = func() (resume bool, onStateChange func(state string)) { return false, nil }
+)
@@ -0,0 +1,121 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"time"
+)
+
+// The optional interfaces below are implemented by the built-in drivers that support the features. The
+// drivers can implement the optional interfaces of the package driver too, e.g. driver.Pauser.
+
+// BufferAcquirer is implemented by drivers that can expose their device buffers.
+// The mixed samples are read into the device buffers directly, which saves a copy.
+type BufferAcquirer interface {
+	// AcquireBuffer returns a free region of the device buffer. AcquireBuffer can return an empty
+	// region when the device buffer is full.
+	AcquireBuffer() ([]byte, error)
+
+	// CommitBuffer passes the first n bytes of the region returned by AcquireBuffer to the device.
+	CommitBuffer(n int) error
+}
+
+// SleepRecoverer is implemented by drivers whose device might not work after the system sleeps.
+// Such drivers are reopened when a sleep is detected.
+type SleepRecoverer interface {
+	ReopensAfterSleep()
+}
+
+// DefaultDeviceFollower is implemented by drivers playing on the default device that are notified when the
+// default device changes. Such drivers are reopened so that the sound moves to the new default device.
+type DefaultDeviceFollower interface {
+	// DefaultDeviceChanged reports whether the default device has changed since the last call.
+	DefaultDeviceChanged() bool
+}
+
+// FrameQueuer is implemented by drivers that know how much of the written data the device has played.
+// Unlike driver.FrameQueuer, QueuedFrames reports by ok whether the device knows it at the moment.
+// QueuedFrames is called from another goroutine than TryWrite.
+type FrameQueuer interface {
+	// QueuedFrames returns the number of the frames written to the driver but not played yet.
+	QueuedFrames() (frames int64, ok bool)
+}
+
+// DeviceRater is implemented by drivers that can change the playback rate or the pitch of the device
+// itself.
+type DeviceRater interface {
+	// DeviceRateSupport reports whether the device supports the playback rate and the pitch.
+	DeviceRateSupport() (rate, pitch bool)
+
+	// SetDeviceRate sets the playback rate keeping the pitch, and SetDevicePitch sets the ratio of the
+	// pitch keeping the speed.
+	SetDeviceRate(rate float64) error
+	SetDevicePitch(pitch float64) error
+}
+
+// DeviceVolumer is implemented by drivers that can control the volume of the device itself.
+type DeviceVolumer interface {
+	// DeviceVolumeSupport reports whether the device supports the volume, and whether the left and the
+	// right channels can be controlled separately.
+	DeviceVolumeSupport() (volume, stereo bool)
+
+	SetDeviceVolume(left, right float64) error
+	DeviceVolume() (left, right float64, err error)
+}
+
+// SessionVolumer is implemented by drivers that can control the volume of the audio session of the process
+// in the system mixer.
+type SessionVolumer interface {
+	SetSessionVolume(volume float64) error
+	SetSessionMute(muted bool) error
+	SessionVolume() (volume float64, muted bool, err error)
+}
+
+// GestureResumer is implemented by drivers whose device starts suspended until a user gesture, e.g. an
+// AudioContext in browsers. ResumeOnUserGesture is called when GestureSettings changes.
+type GestureResumer interface {
+	ResumeOnUserGesture()
+}
+
+// KeepAliver is implemented by drivers that need help to keep playing while the application is in the
+// background, e.g. a wake lock on Android.
+type KeepAliver interface {
+	SetKeepAlive(keepAlive bool) error
+}
+
+// OutputLatencier is implemented by drivers that know the output device. OutputLatency returns the
+// latency of the device after the driver's buffer, which is 0 if unknown, and whether the device is a
+// Bluetooth device.
+type OutputLatencier interface {
+	OutputLatency() (latency time.Duration, bluetooth bool)
+}
+
+// BluetoothLatency is the estimated latency of the codec and the transport of a Bluetooth A2DP device,
+// which is used when the platform doesn't report the latency. The actual value is from about 100ms to
+// 300ms depending on the codec and the device.
+const BluetoothLatency = 200 * time.Millisecond
+
+// Looper is implemented by drivers that can loop a buffer in the device, e.g. by WHDR_BEGINLOOP and
+// WHDR_ENDLOOP on Windows.
+type Looper interface {
+	// PlayLoop plays data loops times in the device. loops <= 0 means until the loop is closed.
+	PlayLoop(data []byte, loops int) (Loop, error)
+}
+
+// Loop is a buffer being looped by the device.
+type Loop interface {
+	IsPlaying() bool
+	Close() error
+}
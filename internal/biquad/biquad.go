@@ -0,0 +1,132 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package biquad offers an equalizer made of biquad filters.
+//
+// The coefficients follow the Audio EQ Cookbook by Robert Bristow-Johnson.
+package biquad
+
+import (
+	"math"
+)
+
+// Kind represents the kind of a band.
+type Kind int
+
+const (
+	// LowShelf changes the gain of the frequencies below Frequency.
+	LowShelf Kind = iota
+
+	// Peak changes the gain of the frequencies around Frequency. Q is the sharpness.
+	Peak
+
+	// HighShelf changes the gain of the frequencies above Frequency.
+	HighShelf
+)
+
+// Band represents a band of an equalizer. Gain is in decibels.
+type Band struct {
+	Kind      Kind
+	Frequency float64
+	Gain      float64
+	Q         float64
+}
+
+// filter is a biquad filter in the transposed direct form II.
+type filter struct {
+	b0, b1, b2, a1, a2 float64
+
+	// z1 and z2 are the states of each channel.
+	z1 []float64
+	z2 []float64
+}
+
+func newFilter(band Band, sampleRate, channelNum int) *filter {
+	a := math.Pow(10, band.Gain/40)
+	w0 := 2 * math.Pi * band.Frequency / float64(sampleRate)
+	cos := math.Cos(w0)
+	alpha := math.Sin(w0) / (2 * band.Q)
+	sa := 2 * math.Sqrt(a) * alpha
+
+	var b0, b1, b2, a0, a1, a2 float64
+	switch band.Kind {
+	case LowShelf:
+		b0 = a * ((a + 1) - (a-1)*cos + sa)
+		b1 = 2 * a * ((a - 1) - (a+1)*cos)
+		b2 = a * ((a + 1) - (a-1)*cos - sa)
+		a0 = (a + 1) + (a-1)*cos + sa
+		a1 = -2 * ((a - 1) + (a+1)*cos)
+		a2 = (a + 1) + (a-1)*cos - sa
+	case Peak:
+		b0 = 1 + alpha*a
+		b1 = -2 * cos
+		b2 = 1 - alpha*a
+		a0 = 1 + alpha/a
+		a1 = -2 * cos
+		a2 = 1 - alpha/a
+	case HighShelf:
+		b0 = a * ((a + 1) + (a-1)*cos + sa)
+		b1 = -2 * a * ((a - 1) + (a+1)*cos)
+		b2 = a * ((a + 1) + (a-1)*cos - sa)
+		a0 = (a + 1) - (a-1)*cos + sa
+		a1 = 2 * ((a - 1) - (a+1)*cos)
+		a2 = (a + 1) - (a-1)*cos - sa
+	default:
+		panic("not reached")
+	}
+	return &filter{
+		b0: b0 / a0,
+		b1: b1 / a0,
+		b2: b2 / a0,
+		a1: a1 / a0,
+		a2: a2 / a0,
+		z1: make([]float64, channelNum),
+		z2: make([]float64, channelNum),
+	}
+}
+
+func (f *filter) process(buf []float32) {
+	chs := len(f.z1)
+	for i, x := range buf {
+		ch := i % chs
+		in := float64(x)
+		out := f.b0*in + f.z1[ch]
+		f.z1[ch] = f.b1*in - f.a1*out + f.z2[ch]
+		f.z2[ch] = f.b2*in - f.a2*out
+		buf[i] = float32(out)
+	}
+}
+
+// EQ is an equalizer of bands in series.
+type EQ struct {
+	filters []*filter
+}
+
+// New creates a new EQ for interleaved frames of channelNum channels at sampleRate. The bands must be
+// valid: the frequencies must be between 0 and the Nyquist frequency exclusively, and Qs must be
+// positive.
+func New(bands []Band, sampleRate, channelNum int) *EQ {
+	e := &EQ{}
+	for _, b := range bands {
+		e.filters = append(e.filters, newFilter(b, sampleRate, channelNum))
+	}
+	return e
+}
+
+// Process equalizes the interleaved frames in buf in place.
+func (e *EQ) Process(buf []float32) {
+	for _, f := range e.filters {
+		f.process(buf)
+	}
+}
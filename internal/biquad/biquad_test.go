@@ -0,0 +1,61 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package biquad_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/leibnewton/oto/internal/biquad"
+)
+
+const sampleRate = 48000
+
+// gainAt returns the gain of the EQ in decibels at freq Hz, measured with a sine wave.
+func gainAt(e *biquad.EQ, freq float64) float64 {
+	buf := make([]float32, sampleRate/2)
+	for i := range buf {
+		buf[i] = float32(0.1 * math.Sin(2*math.Pi*freq*float64(i)/sampleRate))
+	}
+	e.Process(buf)
+	// Skip the transient at the start.
+	var peak float64
+	for _, x := range buf[len(buf)/2:] {
+		peak = math.Max(peak, math.Abs(float64(x)))
+	}
+	return 20 * math.Log10(peak/0.1)
+}
+
+func TestBands(t *testing.T) {
+	cases := []struct {
+		Band biquad.Band
+		Freq float64
+		Want float64
+	}{
+		{biquad.Band{Kind: biquad.Peak, Frequency: 1000, Gain: 6, Q: 1}, 1000, 6},
+		{biquad.Band{Kind: biquad.Peak, Frequency: 1000, Gain: 6, Q: 1}, 10000, 0},
+		{biquad.Band{Kind: biquad.Peak, Frequency: 1000, Gain: -12, Q: 2}, 1000, -12},
+		{biquad.Band{Kind: biquad.LowShelf, Frequency: 200, Gain: -6, Q: math.Sqrt2 / 2}, 30, -6},
+		{biquad.Band{Kind: biquad.LowShelf, Frequency: 200, Gain: -6, Q: math.Sqrt2 / 2}, 5000, 0},
+		{biquad.Band{Kind: biquad.HighShelf, Frequency: 4000, Gain: 6, Q: math.Sqrt2 / 2}, 15000, 6},
+		{biquad.Band{Kind: biquad.HighShelf, Frequency: 4000, Gain: 6, Q: math.Sqrt2 / 2}, 100, 0},
+	}
+	for _, c := range cases {
+		e := biquad.New([]biquad.Band{c.Band}, sampleRate, 1)
+		if got := gainAt(e, c.Freq); math.Abs(got-c.Want) > 0.5 {
+			t.Errorf("%+v at %v Hz: got: %.2f dB, want: %.2f dB", c.Band, c.Freq, got, c.Want)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package convert offers the conversion of PCM samples between sample rates, numbers of channels and
+// sample formats.
+package convert
+
+import (
+	"github.com/leibnewton/oto/internal/dsp"
+	"github.com/leibnewton/oto/internal/rate"
+)
+
+// Format represents a format of PCM samples. BytesPerSample is 1 for unsigned 8bit samples, and 2 for
+// little-endian signed 16bit samples.
+type Format struct {
+	SampleRate     int
+	ChannelNum     int
+	BytesPerSample int
+}
+
+func (f Format) bytesPerFrame() int {
+	return f.ChannelNum * f.BytesPerSample
+}
+
+// Converter converts a stream of samples from one format to another.
+//
+// The sample rate is converted by linear interpolation by default, which is cheap and good enough for a
+// fallback when the device doesn't support the requested rate. NewWithQuality chooses a better filter.
+// The resampling is rate.Varispeed's, which the playback rate of a Player uses too.
+type Converter struct {
+	from Format
+	to   Format
+
+	// varispeed converts the sample rate with a fixed rate, or is nil when the sample rates are the same.
+	// pending is the part of mapped that varispeed has not read yet.
+	varispeed *rate.Varispeed
+	pending   []float32
+
+	// rest is the partial frame that is not converted yet.
+	rest []byte
+
+	in     []float32
+	mapped []float32
+	out    []float32
+}
+
+// New creates a new Converter that converts the sample rate by linear interpolation.
+func New(from, to Format) *Converter {
+	return NewWithQuality(from, to, rate.QualityLinear)
+}
+
+// NewWithQuality creates a new Converter with the quality of the sample rate conversion.
+func NewWithQuality(from, to Format, quality rate.Quality) *Converter {
+	c := &Converter{
+		from: from,
+		to:   to,
+	}
+	if from.SampleRate != to.SampleRate {
+		c.varispeed = rate.NewVarispeed(to.ChannelNum, quality, c.read)
+		c.varispeed.SetRate(float64(from.SampleRate) / float64(to.SampleRate))
+	}
+	return c
+}
+
+// Convert converts the samples in src, and appends the result to dst. A partial frame at the end of src
+// is kept and converted with the next src.
+func (c *Converter) Convert(dst, src []byte) []byte {
+	if c.from == c.to {
+		return append(dst, src...)
+	}
+
+	bpf := c.from.bytesPerFrame()
+	if len(c.rest) > 0 {
+		n := bpf - len(c.rest)
+		if n > len(src) {
+			n = len(src)
+		}
+		c.rest = append(c.rest, src[:n]...)
+		src = src[n:]
+		if len(c.rest) < bpf {
+			return dst
+		}
+		dst = c.convert(dst, c.rest)
+		c.rest = c.rest[:0]
+	}
+	l := len(src) / bpf * bpf
+	dst = c.convert(dst, src[:l])
+	c.rest = append(c.rest, src[l:]...)
+	return dst
+}
+
+func (c *Converter) convert(dst, src []byte) []byte {
+	frames := len(src) / c.from.bytesPerFrame()
+	if frames == 0 {
+		return dst
+	}
+
+	c.in = grow(c.in, frames*c.from.ChannelNum)
+	switch c.from.BytesPerSample {
+	case 1:
+		dsp.Uint8sToFloat32s(c.in, src)
+	case 2:
+		dsp.Int16sToFloat32s(c.in, src)
+	}
+
+	c.mapped = grow(c.mapped, frames*c.to.ChannelNum)
+	mapChannels(c.mapped, c.in, c.from.ChannelNum, c.to.ChannelNum)
+
+	out := c.mapped
+	if c.varispeed != nil {
+		out = c.resample()
+	}
+
+	n := len(out) * c.to.BytesPerSample
+	l := len(dst)
+	if cap(dst) < l+n {
+		d := make([]byte, l, 2*(l+n))
+		copy(d, dst)
+		dst = d
+	}
+	dst = dst[:l+n]
+	switch c.to.BytesPerSample {
+	case 1:
+		dsp.Float32sToUint8s(dst[l:], out)
+	case 2:
+		dsp.Float32sToInt16s(dst[l:], out)
+	}
+	return dst
+}
+
+// mapChannels converts the number of channels of the interleaved samples. Mono is spread to all the
+// channels, and the channels are averaged into mono.
+func mapChannels(dst, src []float32, from, to int) {
+	frames := len(src) / from
+	switch {
+	case from == to:
+		copy(dst, src)
+	case from == 1:
+		for i := 0; i < frames; i++ {
+			for ch := 0; ch < to; ch++ {
+				dst[i*to+ch] = src[i]
+			}
+		}
+	case to == 1:
+		for i := 0; i < frames; i++ {
+			var v float32
+			for ch := 0; ch < from; ch++ {
+				v += src[i*from+ch]
+			}
+			dst[i] = v / float32(from)
+		}
+	default:
+		for i := 0; i < frames; i++ {
+			for ch := 0; ch < to; ch++ {
+				var v float32
+				if ch < from {
+					v = src[i*from+ch]
+				}
+				dst[i*to+ch] = v
+			}
+		}
+	}
+}
+
+// resample converts the sample rate of the frames in c.mapped, and returns the result.
+func (c *Converter) resample() []float32 {
+	chs := c.to.ChannelNum
+	c.pending = c.mapped
+	// Read all the output frames that the input makes. n is a little more than them.
+	n := (int(int64(len(c.mapped)/chs)*int64(c.to.SampleRate)/int64(c.from.SampleRate)) + 2) * chs
+	c.out = c.out[:0]
+	for {
+		l := len(c.out)
+		if cap(c.out) < l+n {
+			out := make([]float32, l, 2*(l+n))
+			copy(out, c.out)
+			c.out = out
+		}
+		m := c.varispeed.Read(c.out[l : l+n])
+		c.out = c.out[:l+m]
+		// The pending frames must be read before mapped is reused.
+		if m < n && len(c.pending) == 0 {
+			return c.out
+		}
+	}
+}
+
+// read reads the pending frames. read implements rate.Source.
+func (c *Converter) read(buf []float32) int {
+	n := copy(buf, c.pending)
+	c.pending = c.pending[n:]
+	return n
+}
+
+func grow(buf []float32, n int) []float32 {
+	if cap(buf) < n {
+		return make([]float32, n)
+	}
+	return buf[:n]
+}
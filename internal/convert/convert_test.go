@@ -0,0 +1,164 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package convert_test
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/leibnewton/oto/internal/convert"
+	"github.com/leibnewton/oto/internal/rate"
+)
+
+func int16sToBytes(s []int16) []byte {
+	b := make([]byte, 2*len(s))
+	for i, v := range s {
+		b[2*i] = byte(v)
+		b[2*i+1] = byte(v >> 8)
+	}
+	return b
+}
+
+func bytesToInt16s(b []byte) []int16 {
+	s := make([]int16, len(b)/2)
+	for i := range s {
+		s[i] = int16(b[2*i]) | int16(b[2*i+1])<<8
+	}
+	return s
+}
+
+func TestSameFormat(t *testing.T) {
+	f := convert.Format{SampleRate: 44100, ChannelNum: 2, BytesPerSample: 2}
+	c := convert.New(f, f)
+	in := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	if got := c.Convert(nil, in); !bytes.Equal(got, in) {
+		t.Errorf("got: %v, want: %v", got, in)
+	}
+}
+
+func TestChannels(t *testing.T) {
+	mono := convert.Format{SampleRate: 44100, ChannelNum: 1, BytesPerSample: 2}
+	stereo := convert.Format{SampleRate: 44100, ChannelNum: 2, BytesPerSample: 2}
+
+	got := bytesToInt16s(convert.New(mono, stereo).Convert(nil, int16sToBytes([]int16{100, -200})))
+	if want := []int16{100, 100, -200, -200}; !reflect.DeepEqual(got, want) {
+		t.Errorf("mono to stereo: got: %v, want: %v", got, want)
+	}
+
+	got = bytesToInt16s(convert.New(stereo, mono).Convert(nil, int16sToBytes([]int16{100, 300, -200, 0})))
+	if want := []int16{200, -100}; !reflect.DeepEqual(got, want) {
+		t.Errorf("stereo to mono: got: %v, want: %v", got, want)
+	}
+}
+
+func TestBitDepth(t *testing.T) {
+	u8 := convert.Format{SampleRate: 44100, ChannelNum: 1, BytesPerSample: 1}
+	s16 := convert.Format{SampleRate: 44100, ChannelNum: 1, BytesPerSample: 2}
+
+	got := bytesToInt16s(convert.New(u8, s16).Convert(nil, []byte{0x80, 0xc0, 0x00}))
+	if want := []int16{0, 0x4000, -0x8000}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+func TestSampleRate(t *testing.T) {
+	from := convert.Format{SampleRate: 22050, ChannelNum: 1, BytesPerSample: 2}
+	to := convert.Format{SampleRate: 44100, ChannelNum: 1, BytesPerSample: 2}
+	c := convert.New(from, to)
+
+	// Convert in chunks of odd sizes so that the partial frames and the state between the chunks are
+	// tested.
+	in := int16sToBytes([]int16{1000, 2000, 3000, 4000})
+	var out []byte
+	for _, n := range []int{3, 1, 3, 1} {
+		out = c.Convert(out, in[:n])
+		in = in[n:]
+	}
+
+	// The output starts from the first input frame. The frames after the last input frame wait for the
+	// next input.
+	got := bytesToInt16s(out)
+	want := []int16{1000, 1500, 2000, 2500, 3000, 3500}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+// sineBytes returns n frames of a mono sine wave of freq Hz at rate Hz with the amplitude 10000.
+func sineBytes(n int, freq, rate float64) []byte {
+	s := make([]int16, n)
+	for i := range s {
+		s[i] = int16(10000 * math.Sin(2*math.Pi*freq*float64(i)/rate))
+	}
+	return int16sToBytes(s)
+}
+
+// peak returns the maximum absolute value of the samples after skip samples.
+func peak(s []int16, skip int) int {
+	var p int
+	for _, v := range s[skip:] {
+		a := int(v)
+		if a < 0 {
+			a = -a
+		}
+		if a > p {
+			p = a
+		}
+	}
+	return p
+}
+
+func TestSincSampleRate(t *testing.T) {
+	for _, q := range []rate.Quality{rate.QualityMedium, rate.QualityHigh} {
+		from := convert.Format{SampleRate: 44100, ChannelNum: 1, BytesPerSample: 2}
+		to := convert.Format{SampleRate: 48000, ChannelNum: 1, BytesPerSample: 2}
+		c := convert.NewWithQuality(from, to, q)
+
+		in := sineBytes(44100, 1000, 44100)
+		var out []byte
+		for len(in) > 0 {
+			n := 777
+			if n > len(in) {
+				n = len(in)
+			}
+			out = c.Convert(out, in[:n])
+			in = in[n:]
+		}
+		got := bytesToInt16s(out)
+		// The filter delays the output by its half length.
+		if len(got) < 47900 || len(got) > 48000 {
+			t.Errorf("quality %d: the number of frames: got: %d, want: about 48000", q, len(got))
+		}
+		if p := peak(got, 100); p < 9800 || p > 10200 {
+			t.Errorf("quality %d: peak: got: %d, want: about 10000", q, p)
+		}
+	}
+}
+
+func TestSincAntiAliasing(t *testing.T) {
+	from := convert.Format{SampleRate: 48000, ChannelNum: 1, BytesPerSample: 2}
+	to := convert.Format{SampleRate: 16000, ChannelNum: 1, BytesPerSample: 2}
+
+	// 10kHz is beyond the Nyquist frequency of 16kHz, and must be filtered out instead of aliasing.
+	in := sineBytes(4800, 10000, 48000)
+	if p := peak(bytesToInt16s(convert.NewWithQuality(from, to, rate.QualityHigh).Convert(nil, in)), 100); p > 100 {
+		t.Errorf("sinc: peak: got: %d, want: <= 100", p)
+	}
+	if p := peak(bytesToInt16s(convert.New(from, to).Convert(nil, in)), 100); p < 1000 {
+		t.Errorf("linear: peak: got: %d, want: >= 1000", p)
+	}
+}
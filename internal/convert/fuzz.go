@@ -0,0 +1,91 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build gofuzz
+
+package convert
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/leibnewton/oto/internal/rate"
+)
+
+// fuzzSampleRates are the sample rates that the fuzzer chooses from.
+var fuzzSampleRates = []int{8000, 11025, 16000, 22050, 32000, 44100, 48000, 96000}
+
+// Fuzz is the entry point of go-fuzz. Fuzz converts the samples with the formats chosen by data, written
+// in chunks of odd sizes, and checks that the output is made of whole frames:
+//
+//	go-fuzz-build github.com/leibnewton/oto/internal/convert
+//	go-fuzz -bin convert-fuzz.zip
+//
+// The first 3 bytes of data choose the formats and the quality, and the 4th byte is the seed of the
+// chunk sizes. The rest is the samples.
+func Fuzz(data []byte) int {
+	if len(data) < 4 {
+		return 0
+	}
+	format := func(b byte) Format {
+		return Format{
+			SampleRate:     fuzzSampleRates[int(b>>2)%len(fuzzSampleRates)],
+			ChannelNum:     1 + int(b&1),
+			BytesPerSample: 1 + int(b>>1&1),
+		}
+	}
+	from := format(data[0])
+	to := format(data[1])
+	quality := rate.Quality(int(data[2]) % 3)
+	seed := int(data[3])
+	src := data[4:]
+
+	c := NewWithQuality(from, to, quality)
+	var dst []byte
+	for len(src) > 0 {
+		// Write in chunks that are not aligned to the frames.
+		n := 1 + seed%7
+		seed = (seed*31 + 7) % 256
+		if n > len(src) {
+			n = len(src)
+		}
+		dst = c.Convert(dst, src[:n])
+		src = src[n:]
+		// The same formats are passed through as they are.
+		if from != to && len(dst)%to.bytesPerFrame() != 0 {
+			panic(fmt.Sprintf("convert: %d bytes are not whole frames of %+v", len(dst), to))
+		}
+	}
+
+	frames := (len(data) - 4) / from.bytesPerFrame()
+	if from == to {
+		if !bytes.Equal(dst, data[4:]) {
+			panic("convert: the samples in the same formats are changed")
+		}
+	} else if from.SampleRate == to.SampleRate {
+		if got := len(dst) / to.bytesPerFrame(); got != frames {
+			panic(fmt.Sprintf("convert: %d frames are converted to %d frames", frames, got))
+		}
+	} else {
+		// The resamplers delay the output, but never produce more frames than the ratio.
+		max := frames*to.SampleRate/from.SampleRate + 1
+		if got := len(dst) / to.bytesPerFrame(); got > max {
+			panic(fmt.Sprintf("convert: %d frames are resampled to %d frames, more than %d", frames, got, max))
+		}
+	}
+	if frames == 0 {
+		return 0
+	}
+	return 1
+}
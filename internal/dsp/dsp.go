@@ -0,0 +1,179 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dsp offers the hot loops of sample conversion and mixing.
+//
+// The functions use SIMD instructions where available (AVX2 on amd64, NEON on arm64), and fall back
+// to pure Go otherwise. Float samples are in the range of [-1, 1].
+package dsp
+
+import (
+	"math"
+)
+
+const (
+	int16Scale    = 1 << 15
+	invInt16Scale = 1.0 / int16Scale
+	roundMagic    = 1.5 * (1 << 23)
+)
+
+// Int16sToFloat32s converts little-endian signed 16bit samples in src to float samples in dst.
+// The number of converted samples is the minimum of len(dst) and len(src)/2.
+func Int16sToFloat32s(dst []float32, src []byte) {
+	n := len(src) / 2
+	if len(dst) < n {
+		n = len(dst)
+	}
+	if n == 0 {
+		return
+	}
+	done := int16sToFloat32s(dst[:n], src[:2*n])
+	int16sToFloat32sGeneric(dst[done:n], src[2*done:2*n])
+}
+
+// Float32sToInt16s converts float samples in src to little-endian signed 16bit samples in dst.
+// Samples out of the range are clamped. The number of converted samples is the minimum of
+// len(dst)/2 and len(src).
+func Float32sToInt16s(dst []byte, src []float32) {
+	n := len(dst) / 2
+	if len(src) < n {
+		n = len(src)
+	}
+	if n == 0 {
+		return
+	}
+	done := float32sToInt16s(dst[:2*n], src[:n])
+	float32sToInt16sGeneric(dst[2*done:2*n], src[done:n])
+}
+
+// Uint8sToFloat32s converts unsigned 8bit samples in src to float samples in dst.
+func Uint8sToFloat32s(dst []float32, src []byte) {
+	n := len(src)
+	if len(dst) < n {
+		n = len(dst)
+	}
+	for i := 0; i < n; i++ {
+		dst[i] = float32(int(src[i])-128) / 128
+	}
+}
+
+// Float32sToUint8s converts float samples in src to unsigned 8bit samples in dst.
+// Samples out of the range are clamped.
+func Float32sToUint8s(dst []byte, src []float32) {
+	n := len(src)
+	if len(dst) < n {
+		n = len(dst)
+	}
+	for i := 0; i < n; i++ {
+		x := src[i] * 128
+		if x > 127 {
+			x = 127
+		}
+		if x < -128 {
+			x = -128
+		}
+		// Round half to even like Float32sToInt16s.
+		dst[i] = byte(int(float32(x+roundMagic)-roundMagic) + 128)
+	}
+}
+
+// Add adds src to dst sample by sample. This is used to mix sources.
+// The number of added samples is the minimum of len(dst) and len(src).
+func Add(dst, src []float32) {
+	n := len(src)
+	if len(dst) < n {
+		n = len(dst)
+	}
+	if n == 0 {
+		return
+	}
+	done := add(dst[:n], src[:n])
+	addGeneric(dst[done:n], src[done:n])
+}
+
+// Scale multiplies all the samples in buf by gain.
+func Scale(buf []float32, gain float32) {
+	if len(buf) == 0 {
+		return
+	}
+	done := scale(buf, gain)
+	scaleGeneric(buf[done:], gain)
+}
+
+// Ramp multiplies the interleaved frames of channelNum channels in buf by the gain ramping linearly
+// from from to to. The gain reaches to at the last frame.
+func Ramp(buf []float32, channelNum int, from, to float32) {
+	frames := len(buf) / channelNum
+	d := (to - from) / float32(frames)
+	for i := 0; i < frames; i++ {
+		g := from + d*float32(i+1)
+		for ch := 0; ch < channelNum; ch++ {
+			buf[i*channelNum+ch] *= g
+		}
+	}
+}
+
+// SoftClip bends the samples beyond knee smoothly towards 1 so that they don't exceed the range of
+// [-1, 1]. The samples within [-knee, knee] are not changed. knee must be in [0, 1).
+func SoftClip(buf []float32, knee float32) {
+	k := float64(knee)
+	r := 1 - k
+	for i, x := range buf {
+		if x <= knee && x >= -knee {
+			continue
+		}
+		// tanh keeps both the value and the slope continuous at the knee.
+		a := math.Abs(float64(x))
+		y := float32(k + r*math.Tanh((a-k)/r))
+		if x < 0 {
+			y = -y
+		}
+		buf[i] = y
+	}
+}
+
+func int16sToFloat32sGeneric(dst []float32, src []byte) {
+	for i := range dst {
+		dst[i] = float32(int16(src[2*i])|int16(src[2*i+1])<<8) * invInt16Scale
+	}
+}
+
+func float32sToInt16sGeneric(dst []byte, src []float32) {
+	for i, f := range src {
+		x := f * int16Scale
+		if x > int16Scale-1 {
+			x = int16Scale - 1
+		}
+		if x < -int16Scale {
+			x = -int16Scale
+		}
+		// Round half to even like the SIMD version does. Adding and subtracting 1.5 * 2^23 drops the
+		// fraction in the current rounding mode.
+		v := int16(float32(x+roundMagic) - roundMagic)
+		dst[2*i] = byte(v)
+		dst[2*i+1] = byte(v >> 8)
+	}
+}
+
+func addGeneric(dst, src []float32) {
+	for i := range dst {
+		dst[i] += src[i]
+	}
+}
+
+func scaleGeneric(buf []float32, gain float32) {
+	for i := range buf {
+		buf[i] *= gain
+	}
+}
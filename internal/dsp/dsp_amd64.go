@@ -0,0 +1,73 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !appengine,!gopherjs
+
+package dsp
+
+import (
+	"golang.org/x/sys/cpu"
+)
+
+var hasAVX2 = cpu.X86.HasAVX2
+
+// The assembly functions process n samples. n must be a multiple of 8 (16 for float32sToInt16sAVX2).
+
+//go:noescape
+func int16sToFloat32sAVX2(dst *float32, src *byte, n int)
+
+//go:noescape
+func float32sToInt16sAVX2(dst *byte, src *float32, n int)
+
+//go:noescape
+func addAVX2(dst, src *float32, n int)
+
+//go:noescape
+func scaleAVX2(buf *float32, gain float32, n int)
+
+func int16sToFloat32s(dst []float32, src []byte) int {
+	n := len(dst) &^ 7
+	if !hasAVX2 || n == 0 {
+		return 0
+	}
+	int16sToFloat32sAVX2(&dst[0], &src[0], n)
+	return n
+}
+
+func float32sToInt16s(dst []byte, src []float32) int {
+	n := len(src) &^ 15
+	if !hasAVX2 || n == 0 {
+		return 0
+	}
+	float32sToInt16sAVX2(&dst[0], &src[0], n)
+	return n
+}
+
+func add(dst, src []float32) int {
+	n := len(dst) &^ 7
+	if !hasAVX2 || n == 0 {
+		return 0
+	}
+	addAVX2(&dst[0], &src[0], n)
+	return n
+}
+
+func scale(buf []float32, gain float32) int {
+	n := len(buf) &^ 7
+	if !hasAVX2 || n == 0 {
+		return 0
+	}
+	scaleAVX2(&buf[0], gain, n)
+	return n
+}
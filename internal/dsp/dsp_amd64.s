@@ -0,0 +1,114 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !appengine,!gopherjs
+
+#include "textflag.h"
+
+// 1/32768, 32768, 32767 and -32768 in float32.
+DATA invInt16Scale<>+0(SB)/4, $0x38000000
+GLOBL invInt16Scale<>(SB), RODATA|NOPTR, $4
+DATA int16Scale<>+0(SB)/4, $0x47000000
+GLOBL int16Scale<>(SB), RODATA|NOPTR, $4
+DATA int16Max<>+0(SB)/4, $0x46fffe00
+GLOBL int16Max<>(SB), RODATA|NOPTR, $4
+DATA int16Min<>+0(SB)/4, $0xc7000000
+GLOBL int16Min<>(SB), RODATA|NOPTR, $4
+
+// func int16sToFloat32sAVX2(dst *float32, src *byte, n int)
+TEXT ·int16sToFloat32sAVX2(SB), NOSPLIT, $0-24
+	MOVQ dst+0(FP), DI
+	MOVQ src+8(FP), SI
+	MOVQ n+16(FP), CX
+	VBROADCASTSS invInt16Scale<>(SB), Y2
+
+loop:
+	// Sign-extend 8 int16s to int32s, convert them to floats, and scale them.
+	VPMOVSXWD (SI), Y0
+	VCVTDQ2PS Y0, Y0
+	VMULPS    Y2, Y0, Y0
+	VMOVUPS   Y0, (DI)
+	ADDQ      $16, SI
+	ADDQ      $32, DI
+	SUBQ      $8, CX
+	JNZ       loop
+
+	VZEROUPPER
+	RET
+
+// func float32sToInt16sAVX2(dst *byte, src *float32, n int)
+TEXT ·float32sToInt16sAVX2(SB), NOSPLIT, $0-24
+	MOVQ dst+0(FP), DI
+	MOVQ src+8(FP), SI
+	MOVQ n+16(FP), CX
+	VBROADCASTSS int16Scale<>(SB), Y4
+	VBROADCASTSS int16Max<>(SB), Y5
+	VBROADCASTSS int16Min<>(SB), Y6
+
+loop:
+	// Scale and clamp 16 floats, and convert them to int32s with rounding to the nearest.
+	VMULPS    (SI), Y4, Y0
+	VMULPS    32(SI), Y4, Y1
+	VMINPS    Y5, Y0, Y0
+	VMINPS    Y5, Y1, Y1
+	VMAXPS    Y6, Y0, Y0
+	VMAXPS    Y6, Y1, Y1
+	VCVTPS2DQ Y0, Y0
+	VCVTPS2DQ Y1, Y1
+
+	// Pack them to int16s. VPACKSSDW works in each 128bit lane, so reorder the quadwords.
+	VPACKSSDW Y1, Y0, Y0
+	VPERMQ    $0xd8, Y0, Y0
+	VMOVDQU   Y0, (DI)
+	ADDQ      $64, SI
+	ADDQ      $32, DI
+	SUBQ      $16, CX
+	JNZ       loop
+
+	VZEROUPPER
+	RET
+
+// func addAVX2(dst, src *float32, n int)
+TEXT ·addAVX2(SB), NOSPLIT, $0-24
+	MOVQ dst+0(FP), DI
+	MOVQ src+8(FP), SI
+	MOVQ n+16(FP), CX
+
+loop:
+	VMOVUPS (DI), Y0
+	VADDPS  (SI), Y0, Y0
+	VMOVUPS Y0, (DI)
+	ADDQ    $32, SI
+	ADDQ    $32, DI
+	SUBQ    $8, CX
+	JNZ     loop
+
+	VZEROUPPER
+	RET
+
+// func scaleAVX2(buf *float32, gain float32, n int)
+TEXT ·scaleAVX2(SB), NOSPLIT, $0-24
+	MOVQ         buf+0(FP), DI
+	VBROADCASTSS gain+8(FP), Y1
+	MOVQ         n+16(FP), CX
+
+loop:
+	VMULPS  (DI), Y1, Y0
+	VMOVUPS Y0, (DI)
+	ADDQ    $32, DI
+	SUBQ    $8, CX
+	JNZ     loop
+
+	VZEROUPPER
+	RET
@@ -0,0 +1,59 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !appengine,!gopherjs
+
+package dsp
+
+import (
+	"golang.org/x/sys/cpu"
+)
+
+var hasASIMD = cpu.ARM64.HasASIMD
+
+// The conversions are not accelerated on arm64 yet.
+
+func int16sToFloat32s(dst []float32, src []byte) int {
+	return 0
+}
+
+func float32sToInt16s(dst []byte, src []float32) int {
+	return 0
+}
+
+// The assembly functions process n samples. n must be a multiple of 4.
+
+//go:noescape
+func addNEON(dst, src *float32, n int)
+
+//go:noescape
+func scaleNEON(buf *float32, gain float32, n int)
+
+func add(dst, src []float32) int {
+	n := len(dst) &^ 3
+	if !hasASIMD || n == 0 {
+		return 0
+	}
+	addNEON(&dst[0], &src[0], n)
+	return n
+}
+
+func scale(buf []float32, gain float32) int {
+	n := len(buf) &^ 3
+	if !hasASIMD || n == 0 {
+		return 0
+	}
+	scaleNEON(&buf[0], gain, n)
+	return n
+}
@@ -0,0 +1,54 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+// +build !appengine,!gopherjs
+
+#include "textflag.h"
+
+// Old arm64 assemblers lack the vector FADD and FMUL, so they are done by VFMLA (Vd += Vn * Vm).
+// Multiplying by 1 and adding to 0 are exact, so the results are the same as FADD and FMUL.
+
+// func addNEON(dst, src *float32, n int)
+TEXT ·addNEON(SB), NOSPLIT, $0-24
+	MOVD  dst+0(FP), R0
+	MOVD  src+8(FP), R1
+	MOVD  n+16(FP), R2
+	FMOVS $1.0, F2
+	VDUP  V2.S[0], V2.S4
+
+loop:
+	VLD1   (R0), [V0.S4]
+	VLD1.P 16(R1), [V1.S4]
+	VFMLA  V1.S4, V2.S4, V0.S4
+	VST1.P [V0.S4], 16(R0)
+	SUBS   $4, R2, R2
+	BNE    loop
+	RET
+
+// func scaleNEON(buf *float32, gain float32, n int)
+TEXT ·scaleNEON(SB), NOSPLIT, $0-24
+	MOVD  buf+0(FP), R0
+	FMOVS gain+8(FP), F2
+	MOVD  n+16(FP), R2
+	VDUP  V2.S[0], V2.S4
+
+loop:
+	VLD1  (R0), [V1.S4]
+	VEOR  V0.B16, V0.B16, V0.B16
+	VFMLA V1.S4, V2.S4, V0.S4
+	VST1.P [V0.S4], 16(R0)
+	SUBS  $4, R2, R2
+	BNE   loop
+	RET
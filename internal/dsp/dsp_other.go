@@ -0,0 +1,36 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !amd64,!arm64 appengine gopherjs
+
+package dsp
+
+// The accelerated functions return the number of processed samples. The rest is processed by the
+// generic functions.
+
+func int16sToFloat32s(dst []float32, src []byte) int {
+	return 0
+}
+
+func float32sToInt16s(dst []byte, src []float32) int {
+	return 0
+}
+
+func add(dst, src []float32) int {
+	return 0
+}
+
+func scale(buf []float32, gain float32) int {
+	return 0
+}
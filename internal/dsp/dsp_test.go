@@ -0,0 +1,235 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dsp_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/leibnewton/oto/internal/dsp"
+)
+
+// The lengths cover both the SIMD part and the rest.
+const maxLen = 70
+
+func TestInt16sToFloat32s(t *testing.T) {
+	for n := 0; n < maxLen; n++ {
+		src := make([]byte, 2*n)
+		want := make([]float32, n)
+		for i := 0; i < n; i++ {
+			v := int16(i*1237 - 32768)
+			src[2*i] = byte(v)
+			src[2*i+1] = byte(v >> 8)
+			want[i] = float32(v) / 32768
+		}
+		got := make([]float32, n)
+		dsp.Int16sToFloat32s(got, src)
+		for i := range got {
+			if got[i] != want[i] {
+				t.Fatalf("n: %d, index %d: got: %v, want: %v", n, i, got[i], want[i])
+			}
+		}
+	}
+}
+
+func TestFloat32sToInt16s(t *testing.T) {
+	for n := 0; n < maxLen; n++ {
+		src := make([]float32, n)
+		want := make([]int16, n)
+		for i := 0; i < n; i++ {
+			// Include values out of the range and halfway values.
+			f := float32(i-n/2) / float32(n/4+1) * 1.3
+			if i%5 == 0 {
+				f = float32(i-n/2) / 65536
+			}
+			src[i] = f
+			x := math.RoundToEven(float64(f) * 32768)
+			if x > 32767 {
+				x = 32767
+			}
+			if x < -32768 {
+				x = -32768
+			}
+			want[i] = int16(x)
+		}
+		got := make([]byte, 2*n)
+		dsp.Float32sToInt16s(got, src)
+		for i := 0; i < n; i++ {
+			if v := int16(got[2*i]) | int16(got[2*i+1])<<8; v != want[i] {
+				t.Fatalf("n: %d, index %d (%v): got: %d, want: %d", n, i, src[i], v, want[i])
+			}
+		}
+	}
+}
+
+func TestUint8(t *testing.T) {
+	src := []byte{0, 1, 127, 128, 129, 255}
+	f := make([]float32, len(src))
+	dsp.Uint8sToFloat32s(f, src)
+	got := make([]byte, len(src))
+	dsp.Float32sToUint8s(got, f)
+	for i := range src {
+		if got[i] != src[i] {
+			t.Errorf("index %d: got: %d, want: %d", i, got[i], src[i])
+		}
+	}
+
+	// The samples between the steps are rounded to the nearest, and halfway values to even.
+	f = []float32{0.7 / 128, -0.7 / 128, 1.5 / 128, 2.5 / 128, -1.5 / 128}
+	want := []byte{129, 127, 130, 130, 126}
+	got = make([]byte, len(f))
+	dsp.Float32sToUint8s(got, f)
+	for i := range f {
+		if got[i] != want[i] {
+			t.Errorf("index %d (%v): got: %d, want: %d", i, f[i], got[i], want[i])
+		}
+	}
+}
+
+func TestAdd(t *testing.T) {
+	for n := 0; n < maxLen; n++ {
+		dst := make([]float32, n)
+		src := make([]float32, n)
+		want := make([]float32, n)
+		for i := 0; i < n; i++ {
+			dst[i] = float32(i) / 7
+			src[i] = -float32(i) / 3
+			want[i] = dst[i] + src[i]
+		}
+		dsp.Add(dst, src)
+		for i := range dst {
+			if dst[i] != want[i] {
+				t.Fatalf("n: %d, index %d: got: %v, want: %v", n, i, dst[i], want[i])
+			}
+		}
+	}
+}
+
+func TestScale(t *testing.T) {
+	const gain = 0.3
+	for n := 0; n < maxLen; n++ {
+		buf := make([]float32, n)
+		want := make([]float32, n)
+		for i := 0; i < n; i++ {
+			buf[i] = float32(i) / 7
+			want[i] = buf[i] * gain
+		}
+		dsp.Scale(buf, gain)
+		for i := range buf {
+			if buf[i] != want[i] {
+				t.Fatalf("n: %d, index %d: got: %v, want: %v", n, i, buf[i], want[i])
+			}
+		}
+	}
+}
+
+func TestRamp(t *testing.T) {
+	buf := []float32{1, 1, 1, 1, 1, 1, 1, 1}
+	dsp.Ramp(buf, 2, 0, 1)
+	want := []float32{0.25, 0.25, 0.5, 0.5, 0.75, 0.75, 1, 1}
+	for i := range buf {
+		if buf[i] != want[i] {
+			t.Errorf("index %d: got: %v, want: %v", i, buf[i], want[i])
+		}
+	}
+}
+
+func TestSoftClip(t *testing.T) {
+	const knee = 0.5
+	in := []float32{0, 0.25, -0.5, 0.75, -1, 2, -100}
+	buf := append([]float32(nil), in...)
+	dsp.SoftClip(buf, knee)
+	for i, x := range buf {
+		if math.Abs(float64(in[i])) <= knee {
+			if x != in[i] {
+				t.Errorf("index %d: got: %v, want: %v", i, x, in[i])
+			}
+			continue
+		}
+		if math.Abs(float64(x)) > 1 || math.Abs(float64(x)) <= knee || (x < 0) != (in[i] < 0) {
+			t.Errorf("index %d: %v is clipped to %v", i, in[i], x)
+		}
+	}
+	// Larger samples stay larger after clipping.
+	if !(buf[3] < buf[5]) {
+		t.Errorf("SoftClip must be monotonic: %v, %v", buf[3], buf[5])
+	}
+}
+
+const benchLen = 4096
+
+func BenchmarkInt16sToFloat32s(b *testing.B) {
+	src := make([]byte, 2*benchLen)
+	dst := make([]float32, benchLen)
+	b.SetBytes(int64(len(src)))
+	for i := 0; i < b.N; i++ {
+		dsp.Int16sToFloat32s(dst, src)
+	}
+}
+
+func BenchmarkFloat32sToInt16s(b *testing.B) {
+	src := make([]float32, benchLen)
+	dst := make([]byte, 2*benchLen)
+	b.SetBytes(int64(len(dst)))
+	for i := 0; i < b.N; i++ {
+		dsp.Float32sToInt16s(dst, src)
+	}
+}
+
+func BenchmarkAdd(b *testing.B) {
+	src := make([]float32, benchLen)
+	dst := make([]float32, benchLen)
+	b.SetBytes(int64(4 * len(dst)))
+	for i := 0; i < b.N; i++ {
+		dsp.Add(dst, src)
+	}
+}
+
+func TestRamper(t *testing.T) {
+	var r dsp.Ramper
+	r.Reset(1)
+	r.Set(0, 4)
+
+	// The ramp spans two buffers.
+	buf := []float32{1, 1, 1, 1, 1, 1}
+	r.Apply(buf, 2)
+	want := []float32{0.75, 0.75, 0.5, 0.5, 0.25, 0.25}
+	for i := range buf {
+		if buf[i] != want[i] {
+			t.Errorf("index %d: got: %v, want: %v", i, buf[i], want[i])
+		}
+	}
+	buf = []float32{1, 1, 1, 1}
+	r.Apply(buf, 2)
+	want = []float32{0, 0, 0, 0}
+	for i := range buf {
+		if buf[i] != want[i] {
+			t.Errorf("index %d: got: %v, want: %v", i, buf[i], want[i])
+		}
+	}
+	if r.Ramping() {
+		t.Errorf("Ramping() after the ramp: got: true, want: false")
+	}
+
+	// Setting the same target again doesn't restart the ramp.
+	r.Set(1, 2)
+	r.Set(1, 2)
+	if got, want := r.Next(), float32(0.5); got != want {
+		t.Errorf("Next(): got: %v, want: %v", got, want)
+	}
+	if got, want := r.Next(), float32(1); got != want {
+		t.Errorf("Next(): got: %v, want: %v", got, want)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build gofuzz
+
+package dsp
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Fuzz is the entry point of go-fuzz. Fuzz checks that the kernels agree with the pure Go versions for
+// any samples and any lengths, and that the conversions stay in the range:
+//
+//	go-fuzz-build github.com/leibnewton/oto/internal/dsp
+//	go-fuzz -bin dsp-fuzz.zip
+//
+// The first byte of data is the gain, and the rest is signed 16bit samples.
+func Fuzz(data []byte) int {
+	if len(data) < 1 {
+		return 0
+	}
+	gain := float32(int8(data[0])) / 16
+	src := data[1:]
+	src = src[:len(src)/2*2]
+	n := len(src) / 2
+
+	f := make([]float32, n)
+	g := make([]float32, n)
+	Int16sToFloat32s(f, src)
+	int16sToFloat32sGeneric(g, src)
+	for i := range f {
+		if f[i] != g[i] {
+			panic(fmt.Sprintf("dsp: Int16sToFloat32s: f[%d]: %v != %v", i, f[i], g[i]))
+		}
+		if f[i] < -1 || f[i] >= 1 {
+			panic(fmt.Sprintf("dsp: Int16sToFloat32s: f[%d]: %v is out of range", i, f[i]))
+		}
+	}
+
+	// The round trip is exact.
+	out := make([]byte, 2*n)
+	Float32sToInt16s(out, f)
+	if !bytes.Equal(out, src) {
+		panic("dsp: the round trip of Int16sToFloat32s and Float32sToInt16s is not exact")
+	}
+
+	// Mix with the gain, and clamp at the conversion.
+	Scale(f, gain)
+	scaleGeneric(g, gain)
+	Add(f, g)
+	addGeneric(g, g)
+	for i := range f {
+		if f[i] != g[i] {
+			panic(fmt.Sprintf("dsp: Scale and Add: f[%d]: %v != %v", i, f[i], g[i]))
+		}
+	}
+	out2 := make([]byte, 2*n)
+	Float32sToInt16s(out, f)
+	float32sToInt16sGeneric(out2, g)
+	if !bytes.Equal(out, out2) {
+		panic("dsp: Float32sToInt16s doesn't match the generic version")
+	}
+
+	u := make([]byte, n)
+	Float32sToUint8s(u, f)
+	Uint8sToFloat32s(g, u)
+	for i := range g {
+		if g[i] < -1 || g[i] >= 1 {
+			panic(fmt.Sprintf("dsp: Uint8sToFloat32s: g[%d]: %v is out of range", i, g[i]))
+		}
+	}
+
+	SoftClip(f, 0.5)
+	for i := range f {
+		if f[i] < -1 || f[i] > 1 {
+			panic(fmt.Sprintf("dsp: SoftClip: f[%d]: %v is out of range", i, f[i]))
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return 1
+}
@@ -0,0 +1,92 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dsp
+
+// Ramper moves a value linearly to its target over a fixed number of frames, so that a change of a
+// parameter like a gain doesn't click. The zero Ramper is 0.
+type Ramper struct {
+	value  float32
+	target float32
+	step   float32
+
+	// left is the number of the frames until the value reaches the target.
+	left int
+}
+
+// Reset sets the value to v at once.
+func (r *Ramper) Reset(v float32) {
+	r.value = v
+	r.target = v
+	r.left = 0
+}
+
+// Set starts a ramp from the current value to target over frames. Set does nothing when target is the
+// target already, so that calling Set for every period doesn't restart the ramp.
+func (r *Ramper) Set(target float32, frames int) {
+	if target == r.target {
+		return
+	}
+	r.target = target
+	if frames <= 0 {
+		r.Reset(target)
+		return
+	}
+	r.step = (target - r.value) / float32(frames)
+	r.left = frames
+}
+
+// Value returns the current value.
+func (r *Ramper) Value() float32 {
+	return r.value
+}
+
+// Ramping reports whether the value is still moving to the target.
+func (r *Ramper) Ramping() bool {
+	return r.left > 0
+}
+
+// Next advances the ramp by a frame, and returns the value for the frame.
+func (r *Ramper) Next() float32 {
+	if r.left > 0 {
+		r.left--
+		r.value += r.step
+		if r.left == 0 {
+			r.value = r.target
+		}
+	}
+	return r.value
+}
+
+// Apply multiplies the interleaved frames of channelNum channels in buf by the value, advancing the ramp
+// by the frames.
+func (r *Ramper) Apply(buf []float32, channelNum int) {
+	if r.left > 0 {
+		n := len(buf) / channelNum
+		if n > r.left {
+			n = r.left
+		}
+		to := r.value + r.step*float32(n)
+		r.left -= n
+		if r.left == 0 {
+			to = r.target
+		}
+		Ramp(buf[:n*channelNum], channelNum, r.value, to)
+		r.value = to
+		buf = buf[n*channelNum:]
+	}
+	if r.value != 1 {
+		Scale(buf, r.value)
+	}
+}
@@ -12,16 +12,5 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-// +build darwin,ios
-// +build !js
-
-package oto
-
-// #cgo LDFLAGS: -framework Foundation -framework AVFoundation
-//
-// #import <AudioToolbox/AudioToolbox.h>
-import "C"
-
-func componentSubType() C.OSType {
-	return C.kAudioUnitSubType_RemoteIO
-}
+// Package hotplug watches the sound cards of ALSA being added and removed on Linux.
+package hotplug
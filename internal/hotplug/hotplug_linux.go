@@ -0,0 +1,110 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !android
+
+package hotplug
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"github.com/leibnewton/oto/internal/backend"
+)
+
+// soundDeviceDir is the directory of the device nodes of ALSA. udev creates controlC<card> when a sound card
+// is added, and deletes it when the card is removed.
+const soundDeviceDir = "/dev/snd"
+
+var (
+	// cardRemovals is the number of the times each sound card was removed.
+	cardRemovals    = map[int]int64{}
+	cardRemovalsM   sync.Mutex
+	cardWatcherOnce sync.Once
+)
+
+// StartCardWatcher starts watching the sound cards by inotify if not yet. The watcher lives as long as the
+// process, and reports the added and the removed cards by backend.DevicesChanged. When inotify is not
+// available, the removal is detected only by the failures of the writes as before.
+func StartCardWatcher() {
+	cardWatcherOnce.Do(func() {
+		fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+		if err != nil {
+			return
+		}
+		if _, err := syscall.InotifyAddWatch(fd, soundDeviceDir, syscall.IN_CREATE|syscall.IN_DELETE); err != nil {
+			syscall.Close(fd)
+			return
+		}
+		go watchCards(fd)
+	})
+}
+
+func watchCards(fd int) {
+	defer syscall.Close(fd)
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := syscall.Read(fd, buf)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil || n <= 0 {
+			return
+		}
+		changed := false
+		for i := 0; i+syscall.SizeofInotifyEvent <= n; {
+			e := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[i]))
+			name := buf[i+syscall.SizeofInotifyEvent : i+syscall.SizeofInotifyEvent+int(e.Len)]
+			i += syscall.SizeofInotifyEvent + int(e.Len)
+
+			card, ok := controlCard(strings.TrimRight(string(name), "\x00"))
+			if !ok {
+				continue
+			}
+			if e.Mask&syscall.IN_DELETE != 0 {
+				cardRemovalsM.Lock()
+				cardRemovals[card]++
+				cardRemovalsM.Unlock()
+			}
+			changed = true
+		}
+		if changed {
+			backend.DevicesChanged()
+		}
+	}
+}
+
+// controlCard returns the card number of the name of the control node, e.g. 1 for "controlC1".
+func controlCard(name string) (int, bool) {
+	const prefix = "controlC"
+	if !strings.HasPrefix(name, prefix) {
+		return 0, false
+	}
+	card, err := strconv.Atoi(name[len(prefix):])
+	if err != nil {
+		return 0, false
+	}
+	return card, true
+}
+
+// CardRemovalCount returns the number of the times the sound card was removed.
+func CardRemovalCount(card int) int64 {
+	cardRemovalsM.Lock()
+	defer cardRemovalsM.Unlock()
+	return cardRemovals[card]
+}
@@ -0,0 +1,162 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package limiter offers a lookahead brickwall limiter.
+package limiter
+
+import (
+	"math"
+	"time"
+)
+
+// Lookahead is the delay that the limiter adds to the sound.
+const Lookahead = 5 * time.Millisecond
+
+// Limiter keeps the peaks of float samples under a threshold.
+//
+// The limiter sees the samples Lookahead ahead, and lowers the gain smoothly before a peak arrives so
+// that the peak is never clipped. The gain recovers with the release time after the peak.
+type Limiter struct {
+	channelNum int
+	threshold  float32
+	release    float32
+	lookahead  int
+
+	// delay is the ring buffer of the delayed frames.
+	delay    []float32
+	delayPos int
+
+	// queue is the ring buffer of the monotonic queue to find the minimum of the required gains in the
+	// lookahead window.
+	queue     []entry
+	queueHead int
+	queueLen  int
+	n         int64
+
+	// envelope is the gain after the release.
+	envelope float32
+
+	// box is the ring buffer of the envelope to smooth the gain by the moving average.
+	box    []float32
+	boxPos int
+	boxSum float64
+}
+
+type entry struct {
+	index int64
+	gain  float32
+}
+
+// New creates a new Limiter. threshold is the maximum absolute value of the output samples.
+func New(channelNum, sampleRate int, threshold float32, release time.Duration) *Limiter {
+	lookahead := int(int64(sampleRate) * int64(Lookahead) / int64(time.Second))
+	if lookahead < 1 {
+		lookahead = 1
+	}
+	var r float32 = 1
+	if release > 0 {
+		r = float32(1 - math.Exp(-float64(time.Second)/(float64(release)*float64(sampleRate))))
+	}
+	l := &Limiter{
+		channelNum: channelNum,
+		threshold:  threshold,
+		release:    r,
+		lookahead:  lookahead,
+		delay:      make([]float32, lookahead*channelNum),
+		queue:      make([]entry, lookahead+1),
+		envelope:   1,
+		box:        make([]float32, lookahead),
+		boxSum:     float64(lookahead),
+	}
+	for i := range l.box {
+		l.box[i] = 1
+	}
+	return l
+}
+
+// Process limits the interleaved frames in buf in place.
+func (l *Limiter) Process(buf []float32) {
+	chs := l.channelNum
+	frames := len(buf) / chs
+	for i := 0; i < frames; i++ {
+		frame := buf[i*chs : (i+1)*chs]
+
+		var peak float32
+		for _, x := range frame {
+			if x < 0 {
+				x = -x
+			}
+			if x > peak {
+				peak = x
+			}
+		}
+		var req float32 = 1
+		if peak > l.threshold {
+			req = l.threshold / peak
+		}
+
+		// The gain for the frame leaving the delay must be the minimum of the required gains of the frames
+		// in the delay and the new frame.
+		l.push(req)
+		min := l.queue[l.queueHead].gain
+
+		e := l.envelope + (1-l.envelope)*l.release
+		if min < e {
+			e = min
+		}
+		l.envelope = e
+
+		// The moving average of the last lookahead envelopes doesn't exceed the required gain of the frame
+		// leaving the delay, since all of them are the minimums of windows including the frame.
+		l.boxSum += float64(e - l.box[l.boxPos])
+		l.box[l.boxPos] = e
+		l.boxPos = (l.boxPos + 1) % l.lookahead
+		g := float32(l.boxSum / float64(l.lookahead))
+
+		d := l.delay[l.delayPos*chs : (l.delayPos+1)*chs]
+		for ch, x := range frame {
+			y := d[ch] * g
+			// Clamp the rounding errors of the sum.
+			if y > l.threshold {
+				y = l.threshold
+			}
+			if y < -l.threshold {
+				y = -l.threshold
+			}
+			d[ch] = x
+			frame[ch] = y
+		}
+		l.delayPos = (l.delayPos + 1) % l.lookahead
+	}
+}
+
+// push adds the required gain of the new frame to the monotonic queue, and drops the gains of the frames
+// out of the window.
+func (l *Limiter) push(gain float32) {
+	size := len(l.queue)
+	for l.queueLen > 0 {
+		last := (l.queueHead + l.queueLen - 1) % size
+		if l.queue[last].gain < gain {
+			break
+		}
+		l.queueLen--
+	}
+	l.queue[(l.queueHead+l.queueLen)%size] = entry{index: l.n, gain: gain}
+	l.queueLen++
+	for l.queue[l.queueHead].index <= l.n-int64(size) {
+		l.queueHead = (l.queueHead + 1) % size
+		l.queueLen--
+	}
+	l.n++
+}
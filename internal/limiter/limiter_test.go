@@ -0,0 +1,82 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package limiter_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/leibnewton/oto/internal/limiter"
+)
+
+func TestLimiter(t *testing.T) {
+	const (
+		sampleRate = 48000
+		threshold  = 0.5
+	)
+	l := limiter.New(2, sampleRate, threshold, 50*time.Millisecond)
+	delay := int(sampleRate * limiter.Lookahead / time.Second)
+
+	// A quiet tone with a loud burst in the middle.
+	const frames = 4800
+	in := make([]float32, 2*frames)
+	for i := 0; i < frames; i++ {
+		a := 0.1
+		if i >= 2000 && i < 2100 {
+			a = 2
+		}
+		v := float32(a * math.Sin(2*math.Pi*440*float64(i)/sampleRate))
+		in[2*i] = v
+		in[2*i+1] = -v
+	}
+
+	out := append([]float32(nil), in...)
+	// Process in chunks of odd sizes to test the state between the calls.
+	for b := out; len(b) > 0; {
+		n := 2 * 333
+		if n > len(b) {
+			n = len(b)
+		}
+		l.Process(b[:n])
+		b = b[n:]
+	}
+
+	for i, y := range out {
+		if y > threshold || y < -threshold {
+			t.Fatalf("index %d: %v exceeds the threshold", i, y)
+		}
+	}
+	// The quiet part before the burst passes through with the delay.
+	for i := 0; i < 2*1000; i++ {
+		if got, want := out[2*delay+i], in[i]; math.Abs(float64(got-want)) > 1e-6 {
+			t.Fatalf("index %d: got: %v, want: %v", i, got, want)
+		}
+	}
+	// The gain changes smoothly without steps, which would click.
+	prev, prevFrame := 1.0, 0
+	for i := 0; i < frames-delay; i++ {
+		x := float64(in[2*i])
+		if math.Abs(x) < 0.05 {
+			continue
+		}
+		g := float64(out[2*(i+delay)]) / x
+		// The gain moves by at most 1/delay per frame.
+		if math.Abs(g-prev) > float64(i-prevFrame)/float64(delay)+1e-4 {
+			t.Fatalf("frame %d: the gain jumps from %v to %v", i, prev, g)
+		}
+		prev, prevFrame = g, i
+	}
+}
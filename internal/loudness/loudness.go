@@ -0,0 +1,208 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package loudness measures the integrated loudness of a sound as specified by ITU-R BS.1770 and EBU R128.
+package loudness
+
+import (
+	"math"
+)
+
+const (
+	// absoluteGate is the absolute threshold of the gating in LUFS.
+	absoluteGate = -70
+
+	// relativeGate is the relative threshold of the gating in LU.
+	relativeGate = -10
+
+	// The gating blocks are binned by their loudness from absoluteGate to maxLoudness with the resolution
+	// binsPerLU, so that the memory doesn't grow with the length of the sound.
+	maxLoudness = 10
+	binsPerLU   = 10
+)
+
+// biquad is a biquad filter in the transposed direct form II.
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	z1, z2             float64
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.z1
+	f.z1 = f.b1*x - f.a1*y + f.z2
+	f.z2 = f.b2*x - f.a2*y
+	return y
+}
+
+// kWeighting returns the two stages of the K-weighting filter: the high shelf modelling the head, and
+// the high-pass filter. The coefficients are those of BS.1770 at 48000 Hz adapted to the sample rate.
+func kWeighting(sampleRate int) (shelf, highPass biquad) {
+	const (
+		shelfFrequency = 1681.974450955533
+		shelfGain      = 3.999843853973347
+		shelfQ         = 0.7071752369554196
+
+		highPassFrequency = 38.13547087602444
+		highPassQ         = 0.5003270373238773
+	)
+
+	k := math.Tan(math.Pi * shelfFrequency / float64(sampleRate))
+	vh := math.Pow(10, shelfGain/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/shelfQ + k*k
+	shelf = biquad{
+		b0: (vh + vb*k/shelfQ + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/shelfQ + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/shelfQ + k*k) / a0,
+	}
+
+	k = math.Tan(math.Pi * highPassFrequency / float64(sampleRate))
+	a0 = 1 + k/highPassQ + k*k
+	highPass = biquad{
+		b0: 1,
+		b1: -2,
+		b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/highPassQ + k*k) / a0,
+	}
+	return
+}
+
+// Meter measures the integrated loudness.
+//
+// The loudness is measured in gating blocks of 400 milliseconds overlapping by 75%. The blocks quieter
+// than the absolute gate and then than the relative gate are ignored, so that silence and quiet passages
+// don't lower the loudness.
+type Meter struct {
+	channelNum int
+
+	shelves    []biquad
+	highPasses []biquad
+
+	// subBlock is the number of frames of a quarter of a gating block. sum is the sum of the squares of
+	// the weighted samples of each channel in the current quarter, and pos is the number of its frames.
+	subBlock int
+	sum      []float64
+	pos      int
+
+	// quarters are the mean squares of the last four quarters summed over the channels, and quarterNum is
+	// the number of the quarters measured, at most 4.
+	quarters   [4]float64
+	quarterNum int
+
+	// powers and counts are the sums of the mean squares and the numbers of the gating blocks of each bin.
+	powers []float64
+	counts []int
+}
+
+// New creates a new Meter.
+func New(channelNum, sampleRate int) *Meter {
+	m := &Meter{
+		channelNum: channelNum,
+		shelves:    make([]biquad, channelNum),
+		highPasses: make([]biquad, channelNum),
+		subBlock:   sampleRate / 10,
+		sum:        make([]float64, channelNum),
+		powers:     make([]float64, (maxLoudness-absoluteGate)*binsPerLU),
+		counts:     make([]int, (maxLoudness-absoluteGate)*binsPerLU),
+	}
+	for ch := 0; ch < channelNum; ch++ {
+		m.shelves[ch], m.highPasses[ch] = kWeighting(sampleRate)
+	}
+	return m
+}
+
+// Process measures the interleaved frames in buf.
+func (m *Meter) Process(buf []float32) {
+	chs := m.channelNum
+	for i := 0; i+chs <= len(buf); i += chs {
+		for ch := 0; ch < chs; ch++ {
+			y := m.highPasses[ch].process(m.shelves[ch].process(float64(buf[i+ch])))
+			m.sum[ch] += y * y
+		}
+		m.pos++
+		if m.pos == m.subBlock {
+			m.endQuarter()
+		}
+	}
+}
+
+// endQuarter finishes the current quarter, and adds the gating block ending at it.
+func (m *Meter) endQuarter() {
+	var z float64
+	for ch := range m.sum {
+		// The channel weights of BS.1770 are 1 for the front channels.
+		z += m.sum[ch] / float64(m.subBlock)
+		m.sum[ch] = 0
+	}
+	m.pos = 0
+	copy(m.quarters[:], m.quarters[1:])
+	m.quarters[3] = z
+	if m.quarterNum < 4 {
+		m.quarterNum++
+		if m.quarterNum < 4 {
+			return
+		}
+	}
+
+	power := (m.quarters[0] + m.quarters[1] + m.quarters[2] + m.quarters[3]) / 4
+	l := loudness(power)
+	if l <= absoluteGate {
+		return
+	}
+	b := int((l - absoluteGate) * binsPerLU)
+	if b >= len(m.powers) {
+		b = len(m.powers) - 1
+	}
+	m.powers[b] += power
+	m.counts[b]++
+}
+
+// loudness returns the loudness in LUFS of the mean square summed over the channels.
+func loudness(power float64) float64 {
+	return -0.691 + 10*math.Log10(power)
+}
+
+// Integrated returns the integrated loudness in LUFS of the frames processed so far. Integrated returns
+// -Inf when no gating block is louder than the gates, e.g. for silence or less than 400 milliseconds.
+func (m *Meter) Integrated() float64 {
+	mean := func(from int) float64 {
+		var power float64
+		var count int
+		for b := from; b < len(m.powers); b++ {
+			power += m.powers[b]
+			count += m.counts[b]
+		}
+		if count == 0 {
+			return 0
+		}
+		return power / float64(count)
+	}
+
+	p := mean(0)
+	if p == 0 {
+		return math.Inf(-1)
+	}
+	b := int(math.Ceil((loudness(p) + relativeGate - absoluteGate) * binsPerLU))
+	if b < 0 {
+		b = 0
+	}
+	p = mean(b)
+	if p == 0 {
+		return math.Inf(-1)
+	}
+	return loudness(p)
+}
@@ -0,0 +1,62 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loudness_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/leibnewton/oto/internal/loudness"
+)
+
+const sampleRate = 48000
+
+// sine returns the stereo frames of a 1 kHz sine wave with the amplitude in dBFS.
+func sine(dbfs float64, seconds float64, sampleRate int) []float32 {
+	a := math.Pow(10, dbfs/20)
+	buf := make([]float32, 2*int(seconds*float64(sampleRate)))
+	for i := 0; i < len(buf)/2; i++ {
+		v := float32(a * math.Sin(2*math.Pi*1000*float64(i)/float64(sampleRate)))
+		buf[2*i] = v
+		buf[2*i+1] = v
+	}
+	return buf
+}
+
+func TestIntegrated(t *testing.T) {
+	// The stereo 1 kHz sine wave at -23 dBFS is -23 LUFS by the definition of EBU R128.
+	for _, rate := range []int{44100, 48000} {
+		m := loudness.New(2, rate)
+		m.Process(sine(-23, 5, rate))
+		if got := m.Integrated(); math.Abs(got+23) > 0.1 {
+			t.Errorf("rate %d: got: %v LUFS, want: -23 LUFS", rate, got)
+		}
+	}
+}
+
+func TestGating(t *testing.T) {
+	m := loudness.New(2, sampleRate)
+	if got := m.Integrated(); !math.IsInf(got, -1) {
+		t.Errorf("no frames: got: %v, want: -Inf", got)
+	}
+
+	// Silence and the quiet part 20 LU below are gated out.
+	m.Process(sine(-20, 10, sampleRate))
+	m.Process(make([]float32, 2*10*sampleRate))
+	m.Process(sine(-40, 10, sampleRate))
+	if got := m.Integrated(); math.Abs(got+20) > 0.2 {
+		t.Errorf("got: %v LUFS, want: -20 LUFS", got)
+	}
+}
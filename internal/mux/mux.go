@@ -15,38 +15,246 @@
 package mux
 
 import (
-	"bufio"
 	"io"
 	"runtime"
 	"sync"
+
+	"github.com/leibnewton/oto/internal/dsp"
+	"github.com/leibnewton/oto/internal/limiter"
 )
 
 // Mux is a multiplexer for multiple io.Reader objects.
+//
+// Mux is designed to be read by one real-time loop. Read never waits for a slow reader: a reader that
+// doesn't have enough data is padded with silence. Thus, the readers' Read should not block.
 type Mux struct {
 	channelNum      int
 	bitDepthInBytes int
-	readers         map[io.Reader]*bufio.Reader
+	readers         map[io.Reader]*input
 	closed          bool
 
+	// rampFrames is the length of the ramps of the gain changes in frames.
+	rampFrames int
+
+	// masterGain is multiplied to the mixed samples, and knee is the threshold of the soft clipping.
+	// knee 0 means the hard clipping. mixed is whether any samples have been mixed.
+	masterGain dsp.Ramper
+	knee       float32
+	mixed      bool
+
+	// tail is the fading-out samples of the removed readers, which are added to the next Reads.
+	tail []float32
+
+	// processor processes the mixed samples before the master gain if not nil.
+	processor Processor
+
+	// monitor observes the mixed samples after the master processing if not nil.
+	monitor Monitor
+
+	// limiter limits the mixed samples after the master gain if not nil.
+	limiter *limiter.Limiter
+
+	// facc is the accumulator of the mixed samples, and fbuf holds the converted samples of one reader.
+	// They are reused so that Read doesn't allocate in the steady state.
+	facc []float32
+	fbuf []float32
+
 	m sync.RWMutex
 }
 
+// Gainer is implemented by readers that have their own gain. The mux multiplies the reader's samples by
+// the gain. Gain is called after every Read of the reader, and the gain is for the data of the Read.
+// Gain should not block.
+//
+// When the gain changes, the mux ramps the gain linearly from the current one over the ramp frames (see
+// SetRampFrames) so that the change doesn't click. The ramp is independent of the size of the Read.
+type Gainer interface {
+	Gain() float32
+}
+
+// GainSnapper is implemented by Gainers whose gain sometimes has to be applied at once, e.g. for a reader
+// that starts at a sample-accurate frame after silence. When SnapGain returns true after a Read, the mux
+// applies the gain from the first frame of the Read without a ramp.
+type GainSnapper interface {
+	SnapGain() bool
+}
+
+// Finisher is implemented by readers that finish, e.g. one-shot sounds. When Finished returns true after a
+// Read, the mux removes the reader after mixing the data of the Read, so that a finished reader is not
+// mixed any more. RemoveSource does nothing for a finished reader that has been removed so. Finished
+// should not block.
+type Finisher interface {
+	Finished() bool
+}
+
+// Processor processes float samples in place. The samples are interleaved frames in the range of
+// [-1, 1]. Process is called from the goroutine reading the Mux, and should not block.
+//
+// When a reader implements Processor, the mux processes the reader's samples before applying the gain
+// and mixing them.
+type Processor interface {
+	Process(buf []float32)
+}
+
+// Monitor is implemented by readers that observe their samples after the gain is applied, e.g. to meter
+// the levels. Monitor is called from the goroutine reading the Mux, and should not block. buf must not be
+// modified or retained.
+type Monitor interface {
+	Monitor(buf []float32)
+}
+
+// updateGain sets the target of the gain after a read. The first gain is taken at once, and a change of
+// the gain afterwards ramps over rampFrames unless the reader snaps the gain.
+func (s *input) updateGain(rampFrames int) {
+	to := float32(1)
+	if g, ok := s.r.(Gainer); ok {
+		to = g.Gain()
+	}
+	snap := false
+	if g, ok := s.r.(GainSnapper); ok {
+		snap = g.SnapGain()
+	}
+	if !s.started || snap {
+		s.gain.Reset(to)
+		s.started = true
+		return
+	}
+	s.gain.Set(to, rampFrames)
+}
+
+// input holds the state of a reader.
+type input struct {
+	r   io.Reader
+	buf []byte
+
+	// rest is the remainder of the last read that is not enough to make a frame.
+	rest []byte
+
+	// gain is the ramping gain of the reader. started is whether the reader has been read.
+	gain    dsp.Ramper
+	started bool
+}
+
+// read reads at most l bytes from the reader, and returns the frame-aligned part of the data.
+// The returned slice is valid until the next read.
+func (s *input) read(l, bytesPerFrame int) ([]byte, error) {
+	if len(s.buf) < l {
+		s.buf = make([]byte, l)
+	}
+	n := copy(s.buf[:l], s.rest)
+	s.rest = s.rest[:0]
+	if n < l {
+		m, err := s.r.Read(s.buf[n:l])
+		n += m
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+	}
+	aligned := n / bytesPerFrame * bytesPerFrame
+	s.rest = append(s.rest, s.buf[aligned:n]...)
+	return s.buf[:aligned], nil
+}
+
 // New creates a new Mux with the specified number of channels and bit depth.
 func New(channelNum, bitDepthInBytes int) *Mux {
 	m := &Mux{
 		channelNum:      channelNum,
 		bitDepthInBytes: bitDepthInBytes,
-		readers:         map[io.Reader]*bufio.Reader{},
+		readers:         map[io.Reader]*input{},
+		rampFrames:      DefaultRampFrames,
 	}
+	m.masterGain.Reset(1)
 	runtime.SetFinalizer(m, (*Mux).Close)
 	return m
 }
 
+// SetMaster sets the gain of the mixed sound and the knee of the soft clipping. A gain less than 1 makes
+// headroom so that overlapping readers are less likely to clip. A knee in (0, 1) bends the samples beyond
+// it smoothly instead of clipping them harshly, and 0 disables the soft clipping.
+//
+// A change of the gain ramps over the ramp frames so that it doesn't click.
+func (m *Mux) SetMaster(gain, knee float32) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	if m.mixed {
+		m.masterGain.Set(gain, m.rampFrames)
+	} else {
+		m.masterGain.Reset(gain)
+	}
+	m.knee = knee
+}
+
+// MasterRamping reports whether the master gain was still ramping at the end of the last Read.
+func (m *Mux) MasterRamping() bool {
+	m.m.RLock()
+	defer m.m.RUnlock()
+	return m.masterGain.Ramping()
+}
+
+// DefaultRampFrames is the default length of the ramps of the gain changes in frames.
+const DefaultRampFrames = 256
+
+// SetRampFrames sets the length of the ramps of the gain changes in frames. The ramps should be a few
+// milliseconds: long enough not to click, and short enough not to be heard as fades. The ramps that have
+// already started keep their lengths.
+func (m *Mux) SetRampFrames(frames int) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	if frames < 1 {
+		frames = 1
+	}
+	m.rampFrames = frames
+}
+
+// Sync calls f while the Mux is not being read. The changes of the readers' states by f take effect at the
+// same period, e.g. to start fades of two readers at the same sample.
+func (m *Mux) Sync(f func()) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	f()
+}
+
+// SetProcessor sets the processor applied to the mixed sound before the master gain. nil removes the
+// processor.
+func (m *Mux) SetProcessor(p Processor) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	m.processor = p
+}
+
+// SetMonitor sets the monitor of the mixed sound after the master processing. nil removes the monitor.
+func (m *Mux) SetMonitor(mon Monitor) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	m.monitor = mon
+}
+
+// SetLimiter sets the limiter applied to the mixed sound after the master gain. nil disables the
+// limiter.
+func (m *Mux) SetLimiter(l *limiter.Limiter) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	m.limiter = l
+}
+
+// master applies the master gain, the limiter and the soft clipping to the mixed float samples.
+func (m *Mux) master(acc []float32) {
+	m.mixed = true
+	m.masterGain.Apply(acc, m.channelNum)
+	if m.limiter != nil {
+		m.limiter.Process(acc)
+	}
+	if m.knee > 0 {
+		dsp.SoftClip(acc, m.knee)
+	}
+}
+
 // Read reads data from all of its readers, interprets it as samples with the bit depth
 // specified during its creation, then adds all of the samples together and fills the buf
 // slice with the result of this.
 //
-// If there are no readers, Read fills in some zeros to prevent a program from freezing.
+// Read always fills the frame-aligned part of buf. If a reader doesn't have enough data, the rest is
+// filled with silence so that the real-time loop reading the Mux never blocks.
 func (m *Mux) Read(buf []byte) (int, error) {
 	m.m.Lock()
 	defer m.m.Unlock()
@@ -55,102 +263,119 @@ func (m *Mux) Read(buf []byte) (int, error) {
 		return 0, io.EOF
 	}
 
-	if len(m.readers) == 0 {
-		// When there is no reader, Read should return with 0s or Read caller can block forever.
-		// See https://github.com/hajimehoshi/go-mp3/issues/28
-		n := 256
-		if len(buf) < 256 {
-			n = len(buf)
-		}
-
-		switch m.bitDepthInBytes {
-		case 1:
-			const offset = 128
-			for i := 0; i < n; i++ {
-				buf[i] = offset
-			}
-			return n, nil
-		case 2:
-			copy(buf, make([]byte, n))
-			return n, nil
-		default:
-			panic("not reached")
-		}
-	}
-
 	bs := m.channelNum * m.bitDepthInBytes
 	l := len(buf)
 	l = l / bs * bs // Adjust the length in order not to mix different channels.
 
-	bufs := map[*bufio.Reader][]byte{}
-	for _, p := range m.readers {
-		peeked, err := p.Peek(l)
-		if err != nil && err != bufio.ErrBufferFull && err != io.EOF {
-			return 0, err
-		}
-		if l > len(peeked) {
-			l = len(peeked)
-			l = l / bs * bs
-		}
-		bufs[p] = peeked[:l]
+	silence := byte(0)
+	if m.bitDepthInBytes == 1 {
+		silence = 128
 	}
-
-	if l == 0 {
-		// Returning 0 without error can block the caller of Read forever. Call Gosched to encourage context switching.
-		runtime.Gosched()
-		return 0, nil
+	for i := 0; i < l; i++ {
+		buf[i] = silence
+	}
+	if len(m.readers) == 0 && len(m.tail) == 0 {
+		return l, nil
 	}
 
-	for _, p := range m.readers {
-		if _, err := p.Discard(l); err != nil && err != io.EOF {
+	// Mix the samples as floats with the SIMD kernels. The sum of integer samples is exact in float32
+	// unless there are a huge number of readers, and the result is clamped at the conversion.
+	acc, f := m.floatAccumulator(l / m.bitDepthInBytes)
+	for r, s := range m.readers {
+		b, err := s.read(l, bs)
+		if err != nil {
 			return 0, err
 		}
+		n := m.decode(f, b)
+		m.process(s, f[:n])
+		dsp.Add(acc[:n], f[:n])
+		if fin, ok := r.(Finisher); ok && fin.Finished() {
+			delete(m.readers, r)
+		}
+	}
+	if len(m.tail) > 0 {
+		n := copy(f, m.tail)
+		dsp.Add(acc[:n], f[:n])
+		m.tail = m.tail[:copy(m.tail, m.tail[n:])]
+	}
+	if m.processor != nil {
+		m.processor.Process(acc)
+	}
+	m.master(acc)
+	if m.monitor != nil {
+		m.monitor.Monitor(acc)
+	}
+	switch m.bitDepthInBytes {
+	case 1:
+		dsp.Float32sToUint8s(buf[:l], acc)
+	case 2:
+		dsp.Float32sToInt16s(buf[:l], acc)
 	}
 
+	return l, nil
+}
+
+// decode converts the samples in b to floats in f, and returns the number of the samples.
+func (m *Mux) decode(f []float32, b []byte) int {
+	n := len(b) / m.bitDepthInBytes
 	switch m.bitDepthInBytes {
 	case 1:
-		const (
-			max    = 127
-			min    = -128
-			offset = 128
-		)
-		for i := 0; i < l; i++ {
-			x := 0
-			for _, b := range bufs {
-				x += int(b[i]) - offset
-			}
-			if x > max {
-				x = max
-			}
-			if x < min {
-				x = min
-			}
-			buf[i] = byte(x + offset)
-		}
+		dsp.Uint8sToFloat32s(f[:n], b)
 	case 2:
-		const (
-			max = (1 << 15) - 1
-			min = -(1 << 15)
-		)
-		for i := 0; i < l/2; i++ {
-			x := 0
-			for _, b := range bufs {
-				x += int(int16(b[2*i]) | (int16(b[2*i+1]) << 8))
-			}
-			if x > max {
-				x = max
-			}
-			if x < min {
-				x = min
-			}
-			buf[2*i] = byte(x)
-			buf[2*i+1] = byte(x >> 8)
-		}
+		dsp.Int16sToFloat32s(f[:n], b)
 	default:
 		panic("not reached")
 	}
+	return n
+}
 
-	return l, nil
+// process applies the reader's processor and gain to the samples just read, and passes them to the
+// reader's monitor.
+func (m *Mux) process(s *input, f []float32) {
+	if p, ok := s.r.(Processor); ok {
+		p.Process(f)
+	}
+	s.updateGain(m.rampFrames)
+	s.gain.Apply(f, m.channelNum)
+	if mon, ok := s.r.(Monitor); ok {
+		mon.Monitor(f)
+	}
+}
+
+// fadeOut reads the data for a ramp from a reader being removed, and adds it to the tail ramping the gain
+// down to 0, so that removing an audible reader doesn't click.
+func (m *Mux) fadeOut(s *input) {
+	bs := m.channelNum * m.bitDepthInBytes
+	b, err := s.read(m.rampFrames*bs, bs)
+	if err != nil || len(b) == 0 {
+		return
+	}
+	f := make([]float32, len(b)/m.bitDepthInBytes)
+	m.decode(f, b)
+	if p, ok := s.r.(Processor); ok {
+		p.Process(f)
+	}
+	s.gain.Set(0, len(b)/bs)
+	s.gain.Apply(f, m.channelNum)
+	if mon, ok := s.r.(Monitor); ok {
+		mon.Monitor(f)
+	}
+	if len(m.tail) < len(f) {
+		m.tail = append(m.tail, make([]float32, len(f)-len(m.tail))...)
+	}
+	dsp.Add(m.tail[:len(f)], f)
+}
+
+func (m *Mux) floatAccumulator(n int) (acc, buf []float32) {
+	if cap(m.facc) < n {
+		m.facc = make([]float32, n)
+		m.fbuf = make([]float32, n)
+	}
+	acc = m.facc[:n]
+	for i := range acc {
+		acc[i] = 0
+	}
+	return acc, m.fbuf[:n]
 }
 
 // Close invalidates the Mux. It doesn't close its readers.
@@ -172,21 +397,34 @@ func (m *Mux) AddSource(source io.Reader) {
 	if _, ok := m.readers[source]; ok {
 		panic("mux: the io.Reader cannot be added multiple times")
 	}
-	m.readers[source] = bufio.NewReaderSize(source, 256)
+	m.readers[source] = &input{r: source}
 	m.m.Unlock()
 }
 
-// RemoveSource removes a reader from the Mux.
+// RemoveSource removes a reader from the Mux. RemoveSource does nothing after the Mux is closed, since
+// Close removes all the readers.
+//
+// When the reader is audible, RemoveSource reads the data for a ramp from the reader at once, and the
+// next Reads play it fading out so that the removal doesn't click. Thus, the reader must be readable
+// until RemoveSource returns.
 func (m *Mux) RemoveSource(source io.Reader) {
 	m.m.Lock()
+	defer m.m.Unlock()
 	if m.closed {
-		panic("mux: already closed")
+		return
 	}
-	if _, ok := m.readers[source]; !ok {
+	s, ok := m.readers[source]
+	if !ok {
+		if fin, ok := source.(Finisher); ok && fin.Finished() {
+			// The mux has removed the finished reader.
+			return
+		}
 		panic("mux: the io.Reader is already removed")
 	}
 	delete(m.readers, source)
-	m.m.Unlock()
+	if s.started && (s.gain.Value() != 0 || s.gain.Ramping()) {
+		m.fadeOut(s)
+	}
 }
 
 // Sources returns all the registered readers.
@@ -122,6 +122,198 @@ func TestMux16Bits(t *testing.T) {
 	}
 }
 
+type gainReader struct {
+	io.Reader
+	gain float32
+}
+
+func (g *gainReader) Gain() float32 {
+	return g.gain
+}
+
+func TestGain(t *testing.T) {
+	m := mux.New(1, 2)
+	defer m.Close()
+	m.AddSource(&gainReader{Reader: bytes.NewReader(int16sToBytes([]int16{100, -200, 300})), gain: 0.5})
+	m.AddSource(bytes.NewReader(int16sToBytes([]int16{1, 2, 3})))
+
+	buf := make([]byte, 6)
+	if _, err := io.ReadFull(m, buf); err != nil {
+		t.Fatal(err)
+	}
+	got := bytesToInt16s(buf)
+	want := []int16{51, -98, 153}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+func TestGainRamp(t *testing.T) {
+	m := mux.New(1, 2)
+	defer m.Close()
+	r := &gainReader{Reader: bytes.NewReader(int16sToBytes([]int16{1000, 1000, 1000, 1000, 1000, 1000, 1000, 1000})), gain: 1}
+	m.AddSource(r)
+
+	buf := make([]byte, 8)
+	if _, err := io.ReadFull(m, buf); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := bytesToInt16s(buf), []int16{1000, 1000, 1000, 1000}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+
+	// The ramp has a fixed length in frames regardless of the size of the read.
+	m.SetRampFrames(2)
+	r.gain = 0
+	if _, err := io.ReadFull(m, buf); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := bytesToInt16s(buf), []int16{500, 0, 0, 0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+func TestGainRampOverReads(t *testing.T) {
+	m := mux.New(1, 2)
+	defer m.Close()
+	m.SetRampFrames(8)
+	r := &gainReader{Reader: bytes.NewReader(int16sToBytes([]int16{1000, 1000, 1000, 1000, 1000, 1000, 1000, 1000, 1000, 1000, 1000, 1000})), gain: 1}
+	m.AddSource(r)
+
+	buf := make([]byte, 8)
+	if _, err := io.ReadFull(m, buf); err != nil {
+		t.Fatal(err)
+	}
+	r.gain = 0
+	for _, want := range [][]int16{{875, 750, 625, 500}, {375, 250, 125, 0}} {
+		if _, err := io.ReadFull(m, buf); err != nil {
+			t.Fatal(err)
+		}
+		if got := bytesToInt16s(buf); !reflect.DeepEqual(got, want) {
+			t.Errorf("got: %v, want: %v", got, want)
+		}
+	}
+}
+
+type snapReader struct {
+	gainReader
+	snap bool
+}
+
+func (s *snapReader) SnapGain() bool {
+	return s.snap
+}
+
+func TestSnapGain(t *testing.T) {
+	m := mux.New(1, 2)
+	defer m.Close()
+	m.SetRampFrames(4)
+	r := &snapReader{gainReader: gainReader{Reader: bytes.NewReader(int16sToBytes([]int16{0, 0, 1000, 1000, 1000, 1000, 1000, 1000}))}}
+	m.AddSource(r)
+
+	buf := make([]byte, 8)
+	if _, err := io.ReadFull(m, buf); err != nil {
+		t.Fatal(err)
+	}
+	// The gain is applied at once from the first frame of the read.
+	r.gain = 1
+	r.snap = true
+	if _, err := io.ReadFull(m, buf); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := bytesToInt16s(buf), []int16{1000, 1000, 1000, 1000}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+// finishingReader finishes at io.EOF.
+type finishingReader struct {
+	io.Reader
+	finished bool
+	reads    int
+}
+
+func (f *finishingReader) Read(buf []byte) (int, error) {
+	f.reads++
+	n, err := f.Reader.Read(buf)
+	if err == io.EOF {
+		f.finished = true
+	}
+	return n, err
+}
+
+func (f *finishingReader) Finished() bool {
+	return f.finished
+}
+
+func TestFinisher(t *testing.T) {
+	m := mux.New(1, 2)
+	defer m.Close()
+	r := &finishingReader{Reader: bytes.NewReader(int16sToBytes([]int16{1000, 1000}))}
+	m.AddSource(r)
+
+	buf := make([]byte, 8)
+	for i := 0; i < 3; i++ {
+		if _, err := io.ReadFull(m, buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The finished reader is removed after the read reaching io.EOF, and is not read any more.
+	if got, want := r.reads, 2; got != want {
+		t.Errorf("reads: got: %d, want: %d", got, want)
+	}
+	if got := len(m.Sources()); got != 0 {
+		t.Errorf("len(Sources()): got: %d, want: 0", got)
+	}
+	// Removing the finished reader again does nothing.
+	m.RemoveSource(r)
+}
+
+func TestRemoveSourceFadesOut(t *testing.T) {
+	m := mux.New(1, 2)
+	defer m.Close()
+	m.SetRampFrames(4)
+	r := bytes.NewReader(int16sToBytes([]int16{1000, 1000, 1000, 1000, 1000, 1000, 1000, 1000}))
+	m.AddSource(r)
+
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(m, buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// The removed reader is played fading out over the ramp across the reads, and then is silent.
+	m.RemoveSource(r)
+	for _, want := range [][]int16{{750, 500}, {250, 0}, {0, 0}} {
+		if _, err := io.ReadFull(m, buf); err != nil {
+			t.Fatal(err)
+		}
+		if got := bytesToInt16s(buf); !reflect.DeepEqual(got, want) {
+			t.Errorf("got: %v, want: %v", got, want)
+		}
+	}
+}
+
+func TestMaster(t *testing.T) {
+	m := mux.New(1, 2)
+	defer m.Close()
+	m.SetMaster(0.5, 0.8)
+	m.AddSource(bytes.NewReader(int16sToBytes([]int16{1000, 30000, -30000})))
+	m.AddSource(bytes.NewReader(int16sToBytes([]int16{1000, 30000, -30000})))
+
+	buf := make([]byte, 6)
+	if _, err := io.ReadFull(m, buf); err != nil {
+		t.Fatal(err)
+	}
+	got := bytesToInt16s(buf)
+	if got[0] != 1000 {
+		t.Errorf("got[0]: got: %d, want: %d", got[0], 1000)
+	}
+	// 30000 is beyond the knee, and is bent below the full scale instead of being clamped.
+	if got[1] <= 26214 || got[1] >= 30000 || got[2] != -got[1] {
+		t.Errorf("got[1:]: %v", got[1:])
+	}
+}
+
 func TestNoReader(t *testing.T) {
 	m := mux.New(2, 2)
 	buf := make([]byte, 4096)
@@ -140,3 +332,72 @@ func TestNoReader(t *testing.T) {
 		t.Errorf("got: %v, want: %v", buf, make([]byte, len(buf)))
 	}
 }
+
+func TestPartialFrames(t *testing.T) {
+	m := mux.New(2, 2)
+
+	// The source has one and a half frames. Only the first frame is mixed and the rest is filled with silence.
+	m.AddSource(bytes.NewReader(int16sToBytes([]int16{1, 2, 3})))
+
+	buf := make([]byte, 8)
+	n, err := m.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(buf) {
+		t.Errorf("got: %d, want: %d", n, len(buf))
+	}
+	got := bytesToInt16s(buf)
+	want := []int16{1, 2, 0, 0}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+	m.Close()
+}
+
+// zeroReader is an endless reader of zeros.
+type zeroReader struct {
+	read int
+}
+
+func (z *zeroReader) Read(buf []byte) (int, error) {
+	for i := range buf {
+		buf[i] = 0
+	}
+	z.read += len(buf)
+	return len(buf), nil
+}
+
+func TestReadAllocs(t *testing.T) {
+	m := mux.New(2, 2)
+	for i := 0; i < 4; i++ {
+		m.AddSource(&zeroReader{})
+	}
+	buf := make([]byte, 4096)
+	// Warm up the internal buffers.
+	m.Read(buf)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, err := m.Read(buf); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("allocs: got: %v, want: 0", allocs)
+	}
+	m.Close()
+}
+
+func BenchmarkRead(b *testing.B) {
+	m := mux.New(2, 2)
+	for i := 0; i < 4; i++ {
+		m.AddSource(&zeroReader{})
+	}
+	buf := make([]byte, 4096)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(buf)))
+	for i := 0; i < b.N; i++ {
+		m.Read(buf)
+	}
+	m.Close()
+}
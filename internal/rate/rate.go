@@ -0,0 +1,195 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rate changes the playback rate of streams of float samples.
+//
+// Varispeed changes the rate by resampling, which changes the pitch together like a tape, and converts the
+// sample rate with a fixed rate. WSOLA changes the rate without changing the pitch by the waveform
+// similarity overlap-add.
+//
+// Both read the interleaved input frames from a Source on demand, so that they can produce the exact
+// number of output frames that a real-time loop asks for.
+package rate
+
+import (
+	"math"
+)
+
+// Source reads interleaved float samples into buf, and returns the number of the samples read. Source
+// returns fewer samples than len(buf) when no more samples are available now. The number of samples must
+// be a multiple of the number of channels.
+type Source func(buf []float32) int
+
+// input is the buffer of the input frames read from a Source.
+type input struct {
+	src        Source
+	channelNum int
+
+	// buf holds the frames from the absolute frame index base.
+	buf  []float32
+	base int64
+}
+
+// end returns the absolute index of the end of the buffered frames.
+func (in *input) end() int64 {
+	return in.base + int64(len(in.buf)/in.channelNum)
+}
+
+// fill reads the frames until the frame at the absolute index end is buffered, and reports whether it
+// succeeds.
+func (in *input) fill(end int64) bool {
+	for in.end() < end {
+		n := int(end-in.end()) * in.channelNum
+		l := len(in.buf)
+		if cap(in.buf) < l+n {
+			buf := make([]float32, l, 2*(l+n))
+			copy(buf, in.buf)
+			in.buf = buf
+		}
+		m := in.src(in.buf[l : l+n])
+		in.buf = in.buf[:l+m]
+		if m < n {
+			return false
+		}
+	}
+	return true
+}
+
+// frame returns the frame at the absolute index i, which must be buffered.
+func (in *input) frame(i int64) []float32 {
+	j := int(i-in.base) * in.channelNum
+	return in.buf[j : j+in.channelNum]
+}
+
+// drop discards the frames before the absolute index i.
+func (in *input) drop(i int64) {
+	n := int(i - in.base)
+	if n <= 0 {
+		return
+	}
+	if max := len(in.buf) / in.channelNum; n > max {
+		n = max
+	}
+	in.buf = in.buf[:copy(in.buf, in.buf[n*in.channelNum:])]
+	in.base += int64(n)
+}
+
+// Varispeed changes the playback rate by resampling. The samples are interpolated linearly, or filtered by a
+// windowed-sinc filter, depending on the quality.
+type Varispeed struct {
+	in   input
+	rate float64
+
+	// kernel is the windowed-sinc filter, or nil for the linear interpolation.
+	kernel  *kernel
+	quality Quality
+
+	// pos is the absolute position of the next output frame in the input frames.
+	pos float64
+}
+
+// NewVarispeed creates a new Varispeed reading from src with the quality of the resampling.
+func NewVarispeed(channelNum int, quality Quality, src Source) *Varispeed {
+	v := &Varispeed{
+		in:      input{src: src, channelNum: channelNum},
+		rate:    1,
+		quality: quality,
+	}
+	if quality != QualityLinear {
+		v.kernel = newKernel(quality, 1)
+		// The leading silence is the history of the first frame.
+		h := v.kernel.half - 1
+		v.in.buf = make([]float32, h*channelNum)
+		v.in.base = -int64(h)
+	}
+	return v
+}
+
+// SetRate sets the playback rate. 2 plays twice as fast an octave higher.
+func (v *Varispeed) SetRate(rate float64) {
+	v.rate = rate
+}
+
+// Read writes the output frames to dst, and returns the number of the samples written. Read returns fewer
+// samples than len(dst) when the Source doesn't have enough samples.
+func (v *Varispeed) Read(dst []float32) int {
+	if len(dst) < v.in.channelNum {
+		return 0
+	}
+	if v.kernel != nil {
+		return v.readSinc(dst)
+	}
+	return v.readLinear(dst)
+}
+
+func (v *Varispeed) readLinear(dst []float32) int {
+	chs := v.in.channelNum
+	frames := len(dst) / chs
+	// Read the input frames for all the output frames at once, since the Source might be expensive.
+	v.in.fill(int64(v.pos+v.rate*float64(frames-1)) + 2)
+	n := 0
+	for ; n < frames; n++ {
+		i := int64(v.pos)
+		if i+2 > v.in.end() {
+			break
+		}
+		t := float32(v.pos - float64(i))
+		a, b := v.in.frame(i), v.in.frame(i+1)
+		for ch := 0; ch < chs; ch++ {
+			dst[n*chs+ch] = a[ch] + (b[ch]-a[ch])*t
+		}
+		v.pos += v.rate
+	}
+	v.in.drop(int64(v.pos))
+	return n * chs
+}
+
+func (v *Varispeed) readSinc(dst []float32) int {
+	// The cutoff follows the rate when playing faster, so that the sound doesn't alias. The filter is
+	// designed again only when the rate changes much, since that allocates.
+	if step := math.Max(1, v.rate); math.Abs(step/v.kernel.step-1) > 0.1 {
+		v.kernel = newKernel(v.quality, step)
+	}
+
+	chs := v.in.channelNum
+	frames := len(dst) / chs
+	half := int64(v.kernel.half)
+	taps := 2 * v.kernel.half
+	table := v.kernel.table
+	v.in.fill(int64(v.pos+v.rate*float64(frames-1)) + half + 1)
+	n := 0
+	for ; n < frames; n++ {
+		i := int64(v.pos)
+		if i+half >= v.in.end() {
+			break
+		}
+		p := (v.pos - float64(i)) * sincPhases
+		j := int(p)
+		t := float32(p - float64(j))
+		r0 := table[j*taps : (j+1)*taps]
+		r1 := table[(j+1)*taps : (j+2)*taps]
+		first := v.in.buf[int(i-half+1-v.in.base)*chs:]
+		for ch := 0; ch < chs; ch++ {
+			var s float32
+			for k := 0; k < taps; k++ {
+				c := r0[k] + (r1[k]-r0[k])*t
+				s += c * first[k*chs+ch]
+			}
+			dst[n*chs+ch] = s
+		}
+		v.pos += v.rate
+	}
+	v.in.drop(int64(v.pos) - half + 1)
+	return n * chs
+}
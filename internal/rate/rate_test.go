@@ -0,0 +1,157 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rate_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/leibnewton/oto/internal/rate"
+)
+
+const sampleRate = 48000
+
+// sine returns a Source of a mono sine wave with the specified number of frames.
+func sine(freq float64, frames int) rate.Source {
+	i := 0
+	return func(buf []float32) int {
+		n := 0
+		for ; n < len(buf) && i < frames; n++ {
+			buf[n] = float32(0.5 * math.Sin(2*math.Pi*freq*float64(i)/sampleRate))
+			i++
+		}
+		return n
+	}
+}
+
+// readAll reads all the frames from r.
+func readAll(r interface{ Read([]float32) int }) []float32 {
+	var out []float32
+	buf := make([]float32, 512)
+	for {
+		n := r.Read(buf)
+		out = append(out, buf[:n]...)
+		if n < len(buf) {
+			return out
+		}
+	}
+}
+
+// frequency estimates the frequency of the sine wave in buf from the zero crossings.
+func frequency(buf []float32) float64 {
+	var first, last, crossings int
+	for i := 1; i < len(buf); i++ {
+		if buf[i-1] < 0 && buf[i] >= 0 {
+			if crossings == 0 {
+				first = i
+			}
+			last = i
+			crossings++
+		}
+	}
+	return float64(crossings-1) * sampleRate / float64(last-first)
+}
+
+func TestVarispeed(t *testing.T) {
+	for _, q := range []rate.Quality{rate.QualityLinear, rate.QualityMedium, rate.QualityHigh} {
+		const frames = sampleRate
+		v := rate.NewVarispeed(1, q, sine(440, frames))
+		v.SetRate(2)
+		out := readAll(v)
+		// The windowed-sinc filter keeps its half length of the input at the end.
+		if got, want := len(out), frames/2; math.Abs(float64(got-want)) > 20 {
+			t.Errorf("quality %d: frames: got: %d, want: %d", q, got, want)
+		}
+		if got := frequency(out); math.Abs(got-880) > 5 {
+			t.Errorf("quality %d: frequency: got: %v, want: 880", q, got)
+		}
+	}
+}
+
+func TestVarispeedAntiAliasing(t *testing.T) {
+	// 15kHz played twice as fast is beyond the Nyquist frequency, and must be filtered out instead of
+	// aliasing.
+	peak := func(q rate.Quality) float64 {
+		v := rate.NewVarispeed(1, q, sine(15000, sampleRate/10))
+		v.SetRate(2)
+		var p float64
+		for _, s := range readAll(v)[100:] {
+			p = math.Max(p, math.Abs(float64(s)))
+		}
+		return p
+	}
+	if p := peak(rate.QualityHigh); p > 0.01 {
+		t.Errorf("sinc: peak: got: %v, want: <= 0.01", p)
+	}
+	if p := peak(rate.QualityLinear); p < 0.05 {
+		t.Errorf("linear: peak: got: %v, want: >= 0.05", p)
+	}
+}
+
+func TestWSOLA(t *testing.T) {
+	const frames = sampleRate
+	for _, r := range []float64{0.5, 1, 1.5, 2} {
+		w := rate.NewWSOLA(1, sampleRate, sine(440, frames))
+		w.SetRate(r)
+		out := readAll(w)
+		want := float64(frames) / r
+		if got := float64(len(out)); math.Abs(got-want) > want*0.05 {
+			t.Errorf("rate %v: frames: got: %v, want: %v", r, got, want)
+		}
+		// Skip the fade-in of the first segment.
+		if got := frequency(out[sampleRate/50:]); math.Abs(got-440) > 5 {
+			t.Errorf("rate %v: frequency: got: %v, want: 440", r, got)
+		}
+	}
+}
+
+func TestWSOLAContinuity(t *testing.T) {
+	// The segments must overlap in phase: the sound must not be louder or quieter at the overlaps.
+	w := rate.NewWSOLA(1, sampleRate, sine(440, sampleRate))
+	w.SetRate(1.5)
+	out := readAll(w)
+	for i := sampleRate / 50; i < len(out)-sampleRate/50; i++ {
+		if math.Abs(float64(out[i])) > 0.55 {
+			t.Fatalf("out[%d]: got: %v, want: in [-0.55, 0.55]", i, out[i])
+		}
+	}
+	// Find the peaks of the half cycles, which must keep the amplitude.
+	period := int(sampleRate / 440)
+	for i := sampleRate / 50; i+period < len(out)-sampleRate/50; i += period {
+		var peak float64
+		for _, v := range out[i : i+period] {
+			peak = math.Max(peak, math.Abs(float64(v)))
+		}
+		if peak < 0.45 {
+			t.Fatalf("peak at %d: got: %v, want: >= 0.45", i, peak)
+		}
+	}
+}
+
+func TestPitchShift(t *testing.T) {
+	// Time-stretching and then resampling shifts the pitch without changing the duration.
+	const frames = sampleRate
+	w := rate.NewWSOLA(1, sampleRate, sine(440, frames))
+	w.SetRate(0.5)
+	v := rate.NewVarispeed(1, rate.QualityLinear, w.Read)
+	v.SetRate(2)
+	out := readAll(v)
+	if got, want := float64(len(out)), float64(frames); math.Abs(got-want) > want*0.05 {
+		t.Errorf("frames: got: %v, want: %v", got, want)
+	}
+	if got := frequency(out[sampleRate/50:]); math.Abs(got-880) > 10 {
+		t.Errorf("frequency: got: %v, want: 880", got)
+	}
+}
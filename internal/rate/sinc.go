@@ -0,0 +1,114 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rate
+
+import (
+	"math"
+)
+
+// Quality represents the quality of the resampling.
+type Quality int
+
+const (
+	// QualityLinear interpolates the samples linearly. This is the cheapest, but aliases audibly.
+	QualityLinear Quality = iota
+
+	// QualityMedium uses a windowed-sinc filter with 8 zero crossings on each side.
+	QualityMedium
+
+	// QualityHigh uses a windowed-sinc filter with 32 zero crossings on each side.
+	QualityHigh
+)
+
+// sincPhases is the number of the precomputed fractional positions of the filter.
+// The coefficients between them are interpolated linearly.
+const sincPhases = 256
+
+// kernel is a polyphase windowed-sinc filter.
+type kernel struct {
+	// half is the number of the taps on each side of the output position.
+	half int
+
+	// step is the number of the input frames per output frame that the filter is designed for.
+	step float64
+
+	// table has sincPhases+1 rows of 2*half coefficients. The row j is for the fractional position
+	// j/sincPhases.
+	table []float32
+}
+
+// sincHalf returns the number of the taps on each side for the quality.
+func sincHalf(quality Quality) int {
+	if quality == QualityHigh {
+		return 32
+	}
+	return 8
+}
+
+func newKernel(quality Quality, step float64) *kernel {
+	half := sincHalf(quality)
+	rolloff := 0.9
+	if quality == QualityHigh {
+		rolloff = 0.97
+	}
+	// Lower the cutoff below the output Nyquist frequency when downsampling to avoid aliasing.
+	cutoff := rolloff
+	if step > 1 {
+		cutoff /= step
+	}
+
+	taps := 2 * half
+	table := make([]float32, (sincPhases+1)*taps)
+	for j := 0; j <= sincPhases; j++ {
+		f := float64(j) / sincPhases
+		row := table[j*taps : (j+1)*taps]
+		var sum float64
+		for k := range row {
+			// The tap k is for the input frame at floor(pos) - half + 1 + k.
+			x := float64(k-half+1) - f
+			v := cutoff * sinc(cutoff*x) * blackman(x/float64(half))
+			row[k] = float32(v)
+			sum += v
+		}
+		// Normalize the gain at DC for each phase so that the phases don't modulate the level.
+		for k := range row {
+			row[k] = float32(float64(row[k]) / sum)
+		}
+	}
+
+	return &kernel{
+		half:  half,
+		step:  step,
+		table: table,
+	}
+}
+
+// sinc is the normalized sinc function.
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	x *= math.Pi
+	return math.Sin(x) / x
+}
+
+// blackman is the Blackman window over [-1, 1].
+func blackman(x float64) float64 {
+	if x <= -1 || x >= 1 {
+		return 0
+	}
+	t := math.Pi * (x + 1)
+	return 0.42 - 0.5*math.Cos(t) + 0.08*math.Cos(2*t)
+}
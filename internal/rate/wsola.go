@@ -0,0 +1,165 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rate
+
+import (
+	"math"
+)
+
+// WSOLA changes the playback rate without changing the pitch.
+//
+// The output is made of windowed segments of the input overlapping by the half. Each segment is taken
+// around the position that the rate specifies, at the offset where the segment is the most similar to
+// the natural continuation of the previous segment, so that the phases match at the overlaps.
+type WSOLA struct {
+	in   input
+	rate float64
+
+	// hop is the number of the output frames per segment, and a segment has 2*hop frames. tolerance is
+	// the maximum offset of a segment from its nominal position.
+	hop       int
+	tolerance int
+	window    []float32
+
+	// nominal is the absolute nominal input position of the next segment, and prev is the absolute input
+	// position of the last segment.
+	nominal float64
+	prev    int64
+	started bool
+
+	// ola accumulates the overlapping segments, and out holds the output frames not read yet.
+	ola []float32
+	out []float32
+}
+
+// NewWSOLA creates a new WSOLA reading from src.
+func NewWSOLA(channelNum, sampleRate int, src Source) *WSOLA {
+	// 10 milliseconds hops and 20 milliseconds segments are short enough to keep transients, and long
+	// enough for the pitches of voices.
+	hop := sampleRate / 100
+	if hop < 1 {
+		hop = 1
+	}
+	window := make([]float32, 2*hop)
+	for i := range window {
+		// The periodic Hann window, whose overlaps by the half sum to 1.
+		window[i] = float32(0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(len(window))))
+	}
+	return &WSOLA{
+		in:        input{src: src, channelNum: channelNum},
+		rate:      1,
+		hop:       hop,
+		tolerance: sampleRate * 3 / 1000,
+		window:    window,
+		ola:       make([]float32, 2*hop*channelNum),
+	}
+}
+
+// SetRate sets the playback rate. 2 plays twice as fast at the same pitch.
+func (w *WSOLA) SetRate(rate float64) {
+	w.rate = rate
+}
+
+// Read writes the output frames to dst, and returns the number of the samples written. Read returns fewer
+// samples than len(dst) when the Source doesn't have enough samples.
+func (w *WSOLA) Read(dst []float32) int {
+	n := 0
+	for n < len(dst) {
+		if len(w.out) == 0 && !w.step() {
+			break
+		}
+		m := copy(dst[n:], w.out)
+		w.out = w.out[m:]
+		n += m
+	}
+	return n
+}
+
+// step adds the next segment, and makes hop output frames. step reports whether it succeeds.
+func (w *WSOLA) step() bool {
+	chs := w.in.channelNum
+	seg := 2 * w.hop
+	nominal := int64(w.nominal)
+	if !w.started {
+		// The first segment has no previous segment to match.
+		w.prev = nominal - int64(w.hop)
+	}
+
+	lo := nominal - int64(w.tolerance)
+	if lo < w.in.base {
+		lo = w.in.base
+	}
+	hi := nominal + int64(w.tolerance)
+	// The segment and the natural continuation of the previous segment must be buffered.
+	end := hi + int64(seg)
+	if c := w.prev + int64(w.hop) + int64(w.hop); c > end {
+		end = c
+	}
+	if !w.in.fill(end) {
+		return false
+	}
+
+	best := nominal
+	if w.started {
+		best = w.search(lo, hi)
+	}
+
+	// Overlap-add the segment, and output the first hop frames.
+	for i := 0; i < seg; i++ {
+		f := w.in.frame(best + int64(i))
+		g := w.window[i]
+		for ch := 0; ch < chs; ch++ {
+			w.ola[i*chs+ch] += f[ch] * g
+		}
+	}
+	w.out = append(w.out[:0], w.ola[:w.hop*chs]...)
+	copy(w.ola, w.ola[w.hop*chs:])
+	for i := w.hop * chs; i < len(w.ola); i++ {
+		w.ola[i] = 0
+	}
+
+	w.prev = best
+	w.started = true
+	w.nominal += float64(w.hop) * w.rate
+	drop := int64(w.nominal) - int64(w.tolerance)
+	if c := w.prev + int64(w.hop); c < drop {
+		drop = c
+	}
+	w.in.drop(drop)
+	return true
+}
+
+// search returns the position in [lo, hi] where the first hop frames are the most similar to the natural
+// continuation of the previous segment.
+func (w *WSOLA) search(lo, hi int64) int64 {
+	chs := w.in.channelNum
+	natural := w.prev + int64(w.hop)
+	best := lo
+	bestScore := math.Inf(-1)
+	for p := lo; p <= hi; p++ {
+		var score float64
+		for i := 0; i < w.hop; i++ {
+			a := w.in.frame(natural + int64(i))
+			b := w.in.frame(p + int64(i))
+			for ch := 0; ch < chs; ch++ {
+				score += float64(a[ch] * b[ch])
+			}
+		}
+		if score > bestScore {
+			best, bestScore = p, score
+		}
+	}
+	return best
+}
@@ -0,0 +1,323 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ring offers a lock-free single-producer single-consumer ring buffer.
+package ring
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// cacheLineSize is the assumed size of a CPU cache line. The positions are padded so that the producer
+// and the consumer don't share a cache line.
+const cacheLineSize = 64
+
+// Buffer is a fixed-size ring buffer of bytes between one writer goroutine and one reader goroutine.
+//
+// Buffer works like io.Pipe, but Buffer has its own storage so that the writer doesn't have to wait for
+// the reader as long as the storage has space. The writer can also render data into the storage directly
+// by Acquire and Commit.
+//
+// The reader and the writer never take a lock in the steady state. The writer blocks only when the
+// storage is full, and the reader wakes the writer up only in that case.
+type Buffer struct {
+	// head is the position to read, and tail is the position to write. Both increase monotonically.
+	// head is updated only by the reader, and tail is updated only by the writer.
+	head int64
+	_    [cacheLineSize - 8]byte
+	tail int64
+	_    [cacheLineSize - 8]byte
+
+	overflows  int64
+	underflows int64
+
+	buf []byte
+
+	// writerWaiting and readerWaiting are 1 when the writer or the reader is waiting for the other side.
+	writerWaiting int32
+	readerWaiting int32
+	spaceCh       chan struct{}
+	dataCh        chan struct{}
+
+	// starved is whether the last TryRead couldn't fill the given slice. starved is used only by the
+	// reader.
+	starved bool
+
+	writeClosed    int32
+	readClosed     int32
+	writeClosedCh  chan struct{}
+	readClosedCh   chan struct{}
+	writeCloseOnce sync.Once
+	readCloseOnce  sync.Once
+}
+
+// New creates a new Buffer with the given size.
+func New(size int) *Buffer {
+	if size <= 0 {
+		panic("ring: size must be positive")
+	}
+	return &Buffer{
+		buf:           make([]byte, size),
+		spaceCh:       make(chan struct{}, 1),
+		dataCh:        make(chan struct{}, 1),
+		writeClosedCh: make(chan struct{}),
+		readClosedCh:  make(chan struct{}),
+	}
+}
+
+// Size returns the size of the storage.
+func (b *Buffer) Size() int {
+	return len(b.buf)
+}
+
+// Len returns the number of bytes that can be read.
+func (b *Buffer) Len() int {
+	return int(atomic.LoadInt64(&b.tail) - atomic.LoadInt64(&b.head))
+}
+
+// ReadBytes returns the total number of bytes read from the buffer.
+func (b *Buffer) ReadBytes() int64 {
+	return atomic.LoadInt64(&b.head)
+}
+
+// Overflows returns the number of times the writer had to wait since the storage was full.
+func (b *Buffer) Overflows() int64 {
+	return atomic.LoadInt64(&b.overflows)
+}
+
+// Underflows returns the number of times TryRead started to fail to fill the given slice while the
+// writer was open. Consecutive failures are counted as one underflow.
+func (b *Buffer) Underflows() int64 {
+	return atomic.LoadInt64(&b.underflows)
+}
+
+func (b *Buffer) isWriteClosed() bool {
+	return atomic.LoadInt32(&b.writeClosed) != 0
+}
+
+func (b *Buffer) isReadClosed() bool {
+	return atomic.LoadInt32(&b.readClosed) != 0
+}
+
+// notify wakes the other side up if it is waiting.
+func notify(waiting *int32, ch chan struct{}) {
+	if atomic.CompareAndSwapInt32(waiting, 1, 0) {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Read reads data from the buffer. Read blocks until any data is available.
+//
+// Read returns io.EOF when the writer is closed and all the data is read.
+func (b *Buffer) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	for {
+		if b.isReadClosed() {
+			return 0, io.ErrClosedPipe
+		}
+		if b.Len() > 0 {
+			return b.read(p), nil
+		}
+		if b.isWriteClosed() {
+			// Check the data again, since the writer might commit data just before closing.
+			if b.Len() > 0 {
+				continue
+			}
+			return 0, io.EOF
+		}
+
+		atomic.StoreInt32(&b.readerWaiting, 1)
+		if b.Len() > 0 {
+			atomic.StoreInt32(&b.readerWaiting, 0)
+			continue
+		}
+		select {
+		case <-b.dataCh:
+		case <-b.writeClosedCh:
+		case <-b.readClosedCh:
+		}
+	}
+}
+
+// TryRead reads data from the buffer without blocking. TryRead returns 0 and nil when no data is
+// available.
+//
+// TryRead returns io.EOF when the writer is closed and all the data is read.
+func (b *Buffer) TryRead(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if b.isReadClosed() {
+		return 0, io.ErrClosedPipe
+	}
+
+	writeClosed := b.isWriteClosed()
+	n := b.read(p)
+	switch {
+	case n == len(p):
+		b.starved = false
+	case !writeClosed && atomic.LoadInt64(&b.tail) > 0:
+		// Count an underflow only when the writer has ever written data and is still open.
+		if !b.starved {
+			atomic.AddInt64(&b.underflows, 1)
+		}
+		b.starved = true
+	}
+	if n == 0 && writeClosed {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+func (b *Buffer) read(p []byte) int {
+	head := b.head
+	tail := atomic.LoadInt64(&b.tail)
+
+	n := 0
+	for n < len(p) && head < tail {
+		pos := int(head % int64(len(b.buf)))
+		end := len(b.buf)
+		if avail := int(tail - head); pos+avail < end {
+			end = pos + avail
+		}
+		c := copy(p[n:], b.buf[pos:end])
+		n += c
+		head += int64(c)
+	}
+	if n > 0 {
+		atomic.StoreInt64(&b.head, head)
+		notify(&b.writerWaiting, b.spaceCh)
+	}
+	return n
+}
+
+// Peek returns a copy of the data that can be read without consuming it. Peek can be called from any
+// goroutine while the reader is not reading, since the writer never overwrites the readable data.
+func (b *Buffer) Peek() []byte {
+	head := atomic.LoadInt64(&b.head)
+	tail := atomic.LoadInt64(&b.tail)
+	p := make([]byte, int(tail-head))
+	n := 0
+	for n < len(p) {
+		pos := int((head + int64(n)) % int64(len(b.buf)))
+		n += copy(p[n:], b.buf[pos:])
+	}
+	return p
+}
+
+// Write writes data to the buffer. Write blocks until all the data is written.
+//
+// Write returns io.ErrClosedPipe when the buffer is closed.
+func (b *Buffer) Write(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		buf, err := b.Acquire(len(p) - n)
+		if err != nil {
+			return n, err
+		}
+		c := copy(buf, p[n:])
+		b.Commit(c)
+		n += c
+	}
+	return n, nil
+}
+
+// Acquire returns a contiguous free region of the storage. The length of the region is at most n, and can be
+// shorter than n. Acquire blocks until any free space is available.
+//
+// The caller writes data into the region and then calls Commit with the number of written bytes.
+// Acquire must not be called again before Commit is called.
+func (b *Buffer) Acquire(n int) ([]byte, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+
+	waited := false
+	for {
+		if b.isWriteClosed() || b.isReadClosed() {
+			return nil, io.ErrClosedPipe
+		}
+		if b.free() > 0 {
+			break
+		}
+
+		if !waited {
+			atomic.AddInt64(&b.overflows, 1)
+			waited = true
+		}
+		atomic.StoreInt32(&b.writerWaiting, 1)
+		if b.free() > 0 {
+			atomic.StoreInt32(&b.writerWaiting, 0)
+			break
+		}
+		select {
+		case <-b.spaceCh:
+		case <-b.writeClosedCh:
+		case <-b.readClosedCh:
+		}
+	}
+
+	tail := b.tail
+	pos := int(tail % int64(len(b.buf)))
+	end := len(b.buf)
+	if free := b.free(); pos+free < end {
+		end = pos + free
+	}
+	if pos+n < end {
+		end = pos + n
+	}
+	return b.buf[pos:end], nil
+}
+
+func (b *Buffer) free() int {
+	return len(b.buf) - int(atomic.LoadInt64(&b.tail)-atomic.LoadInt64(&b.head))
+}
+
+// Commit makes the n bytes written into the region returned by Acquire readable.
+func (b *Buffer) Commit(n int) {
+	if n <= 0 {
+		return
+	}
+	if n > b.free() {
+		panic("ring: committed more than acquired")
+	}
+	atomic.StoreInt64(&b.tail, b.tail+int64(n))
+	notify(&b.readerWaiting, b.dataCh)
+}
+
+// CloseWrite closes the writer side. The reader can still read the remaining data.
+func (b *Buffer) CloseWrite() error {
+	b.writeCloseOnce.Do(func() {
+		atomic.StoreInt32(&b.writeClosed, 1)
+		close(b.writeClosedCh)
+	})
+	return nil
+}
+
+// CloseRead closes the reader side. Both Read and Write fail after CloseRead.
+func (b *Buffer) CloseRead() error {
+	b.readCloseOnce.Do(func() {
+		atomic.StoreInt32(&b.readClosed, 1)
+		close(b.readClosedCh)
+	})
+	return nil
+}
@@ -0,0 +1,244 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ring_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"runtime"
+	"testing"
+
+	"github.com/leibnewton/oto/internal/ring"
+)
+
+func TestReadWrite(t *testing.T) {
+	in := make([]byte, 10000)
+	for i := range in {
+		in[i] = byte(i)
+	}
+
+	b := ring.New(256)
+	go func() {
+		// Write in odd-sized chunks so that the data wraps around at various positions.
+		for i := 0; i < len(in); i += 77 {
+			end := i + 77
+			if end > len(in) {
+				end = len(in)
+			}
+			if _, err := b.Write(in[i:end]); err != nil {
+				panic(err)
+			}
+		}
+		b.CloseWrite()
+	}()
+
+	out, err := ioutil.ReadAll(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, in) {
+		t.Errorf("the read data doesn't match with the written data")
+	}
+}
+
+func TestPeek(t *testing.T) {
+	b := ring.New(8)
+	if _, err := b.Write([]byte{1, 2, 3, 4, 5, 6}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Read(make([]byte, 4)); err != nil {
+		t.Fatal(err)
+	}
+	// The data wraps around the end of the storage.
+	if _, err := b.Write([]byte{7, 8, 9, 10}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.Peek(), []byte{5, 6, 7, 8, 9, 10}; !bytes.Equal(got, want) {
+		t.Errorf("Peek(): got: %v, want: %v", got, want)
+	}
+	if got, want := b.Len(), 6; got != want {
+		t.Errorf("Len() after Peek: got: %d, want: %d", got, want)
+	}
+}
+
+func TestAcquireCommit(t *testing.T) {
+	b := ring.New(8)
+
+	buf, err := b.Acquire(6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(buf), 6; got != want {
+		t.Errorf("len(buf): got: %d, want: %d", got, want)
+	}
+	copy(buf, []byte{1, 2, 3, 4, 5, 6})
+	b.Commit(6)
+
+	out := make([]byte, 4)
+	if _, err := io.ReadFull(b, out); err != nil {
+		t.Fatal(err)
+	}
+
+	// The free region wraps around the end of the storage, so only the contiguous part is returned.
+	buf, err = b.Acquire(6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(buf), 2; got != want {
+		t.Errorf("len(buf): got: %d, want: %d", got, want)
+	}
+	b.Commit(len(buf))
+
+	if got, want := b.Len(), 4; got != want {
+		t.Errorf("Len(): got: %d, want: %d", got, want)
+	}
+}
+
+func TestCloseRead(t *testing.T) {
+	b := ring.New(4)
+	if _, err := b.Write([]byte{1, 2, 3, 4}); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() {
+		// This blocks since the buffer is full.
+		_, err := b.Write([]byte{5})
+		done <- err
+	}()
+	b.CloseRead()
+
+	if err := <-done; err != io.ErrClosedPipe {
+		t.Errorf("got: %v, want: %v", err, io.ErrClosedPipe)
+	}
+}
+
+func TestAccounting(t *testing.T) {
+	b := ring.New(4)
+
+	buf := make([]byte, 4)
+	if _, err := b.TryRead(buf); err != nil {
+		t.Fatal(err)
+	}
+	// Nothing has been written yet, so this is not an underflow.
+	if got, want := b.Underflows(), int64(0); got != want {
+		t.Errorf("Underflows(): got: %d, want: %d", got, want)
+	}
+
+	if _, err := b.Write([]byte{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := b.TryRead(buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Consecutive underflows are counted as one.
+	if got, want := b.Underflows(), int64(1); got != want {
+		t.Errorf("Underflows(): got: %d, want: %d", got, want)
+	}
+
+	if _, err := b.Write([]byte{1, 2, 3, 4}); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		// This blocks until the reader reads.
+		b.Write([]byte{5})
+		close(done)
+	}()
+	for b.Overflows() == 0 {
+		runtime.Gosched()
+	}
+	if _, err := b.TryRead(buf); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	if got, want := b.Overflows(), int64(1); got != want {
+		t.Errorf("Overflows(): got: %d, want: %d", got, want)
+	}
+	if got, want := b.ReadBytes(), int64(6); got != want {
+		t.Errorf("ReadBytes(): got: %d, want: %d", got, want)
+	}
+}
+
+func TestTryReadConcurrently(t *testing.T) {
+	const total = 100000
+
+	b := ring.New(1000)
+	go func() {
+		buf := make([]byte, 333)
+		for i := 0; i < total; i += len(buf) {
+			for j := range buf {
+				buf[j] = byte(i + j)
+			}
+			if _, err := b.Write(buf); err != nil {
+				panic(err)
+			}
+		}
+		b.CloseWrite()
+	}()
+
+	var i int
+	buf := make([]byte, 256)
+	for {
+		n, err := b.TryRead(buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range buf[:n] {
+			if v != byte(i) {
+				t.Fatalf("data at %d: got: %d, want: %d", i, v, byte(i))
+			}
+			i++
+		}
+		if n == 0 {
+			runtime.Gosched()
+		}
+	}
+}
+
+func TestWriteAllocs(t *testing.T) {
+	b := ring.New(4096)
+	in := make([]byte, 1000)
+	out := make([]byte, 1000)
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, err := b.Write(in); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := b.TryRead(out); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("allocs: got: %v, want: 0", allocs)
+	}
+}
+
+func BenchmarkWrite(b *testing.B) {
+	r := ring.New(4096)
+	in := make([]byte, 1024)
+	out := make([]byte, 1024)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(in)))
+	for i := 0; i < b.N; i++ {
+		r.Write(in)
+		r.TryRead(out)
+	}
+}
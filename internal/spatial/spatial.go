@@ -0,0 +1,156 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package spatial renders a sound at a position around the listener to stereo.
+//
+// The head-related transfer function is approximated by the spherical head model of Brown and Duda
+// ("A structural model for binaural sound synthesis", 1998): each ear has the head shadow filter and the
+// interaural time delay for the angle between the ear and the source.
+package spatial
+
+import (
+	"math"
+)
+
+const (
+	// headRadius is the radius of the head in meters.
+	headRadius = 0.0875
+
+	// speedOfSound is in meters per second.
+	speedOfSound = 343.0
+
+	// minAlpha and minTheta are the parameters of the head shadow: the high frequencies are attenuated
+	// the most by minAlpha at minTheta from the ear.
+	minAlpha = 0.1
+	minTheta = 150 * math.Pi / 180
+
+	// refDistance is the distance where the distance attenuation is 0dB. The sound is not louder than
+	// that at a nearer distance.
+	refDistance = 1.0
+)
+
+// ear is the state of the rendering for an ear.
+type ear struct {
+	// delay is the delay in frames for the position of the last period.
+	delay float64
+
+	// b0, b1 and a1 are the coefficients of the head shadow filter, and x1 and y1 are its state.
+	b0, b1, a1 float64
+	x1, y1     float64
+}
+
+// Renderer renders the sound of a source to stereo. Renderer is not safe for concurrent use.
+type Renderer struct {
+	sampleRate int
+
+	// line is the ring buffer of the mono input, and pos is the index to write the next frame.
+	line []float32
+	pos  int
+
+	ears [2]ear
+	gain float64
+
+	started bool
+}
+
+// New creates a new Renderer at sampleRate.
+func New(sampleRate int) *Renderer {
+	maxDelay := headRadius / speedOfSound * (math.Pi/2 + 1) * float64(sampleRate)
+	return &Renderer{
+		sampleRate: sampleRate,
+		line:       make([]float32, int(math.Ceil(maxDelay))+2),
+	}
+}
+
+// params returns the delay in frames, the head shadow coefficients for the ear, and the distance gain.
+// side is 1 for the right ear and -1 for the left ear. The listener is at the origin, facing the negative
+// z axis with the positive y axis up, like OpenAL.
+func (r *Renderer) params(x, y, z float64, side float64) (delay, b0, b1, a1 float64) {
+	d := math.Sqrt(x*x + y*y + z*z)
+	cos := 0.0
+	if d > 0 {
+		cos = side * x / d
+	}
+	// theta is the angle between the ear's axis and the direction to the source.
+	theta := math.Acos(math.Max(-1, math.Min(1, cos)))
+
+	// The delay is shifted by a/c from the model so that it is never negative.
+	t := headRadius / speedOfSound
+	if theta < math.Pi/2 {
+		delay = t * (1 - math.Cos(theta))
+	} else {
+		delay = t * (theta - math.Pi/2 + 1)
+	}
+	delay *= float64(r.sampleRate)
+
+	alpha := (1 + minAlpha/2) + (1-minAlpha/2)*math.Cos(theta/minTheta*math.Pi)
+	// H(s) = (1 + alpha*beta*s) / (1 + beta*s) with beta = a / 2c, by the bilinear transform.
+	beta := headRadius / (2 * speedOfSound)
+	k := 2 * float64(r.sampleRate)
+	n := 1 + beta*k
+	b0 = (1 + alpha*beta*k) / n
+	b1 = (1 - alpha*beta*k) / n
+	a1 = (1 - beta*k) / n
+	return delay, b0, b1, a1
+}
+
+// Process renders the interleaved stereo frames in buf in place for the source at (x, y, z) in meters.
+// The input is mixed down to mono first. The delays and the gain move from the last position during buf
+// to avoid clicks.
+func (r *Renderer) Process(buf []float32, x, y, z float64) {
+	frames := len(buf) / 2
+	if frames == 0 {
+		return
+	}
+
+	gain := refDistance / math.Max(refDistance, math.Sqrt(x*x+y*y+z*z))
+	var delays [2]float64
+	for i, side := range []float64{-1, 1} {
+		e := &r.ears[i]
+		delays[i], e.b0, e.b1, e.a1 = r.params(x, y, z, side)
+	}
+	if !r.started {
+		for i := range r.ears {
+			r.ears[i].delay = delays[i]
+		}
+		r.gain = gain
+		r.started = true
+	}
+
+	size := len(r.line)
+	for i := 0; i < frames; i++ {
+		r.line[r.pos] = (buf[2*i] + buf[2*i+1]) / 2
+		t := float64(i+1) / float64(frames)
+		g := r.gain + (gain-r.gain)*t
+		for ch := range r.ears {
+			e := &r.ears[ch]
+			d := e.delay + (delays[ch]-e.delay)*t
+			// Read the delayed input with the linear interpolation.
+			di := int(d)
+			f := d - float64(di)
+			a := r.line[(r.pos-di+size)%size]
+			b := r.line[(r.pos-di-1+size)%size]
+			in := float64(a) + (float64(b)-float64(a))*f
+
+			out := e.b0*in + e.b1*e.x1 - e.a1*e.y1
+			e.x1, e.y1 = in, out
+			buf[2*i+ch] = float32(out * g)
+		}
+		r.pos = (r.pos + 1) % size
+	}
+	for i := range r.ears {
+		r.ears[i].delay = delays[i]
+	}
+	r.gain = gain
+}
@@ -0,0 +1,69 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spatial_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/leibnewton/oto/internal/spatial"
+)
+
+const sampleRate = 48000
+
+// render renders a stereo sine wave at the position, and returns the RMS of each channel.
+func render(freq, x, y, z float64) (left, right float64) {
+	r := spatial.New(sampleRate)
+	const frames = 4800
+	buf := make([]float32, 2*frames)
+	for i := 0; i < frames; i++ {
+		v := float32(0.5 * math.Sin(2*math.Pi*freq*float64(i)/sampleRate))
+		buf[2*i] = v
+		buf[2*i+1] = v
+	}
+	r.Process(buf, x, y, z)
+	for i := frames / 2; i < frames; i++ {
+		left += float64(buf[2*i]) * float64(buf[2*i])
+		right += float64(buf[2*i+1]) * float64(buf[2*i+1])
+	}
+	return math.Sqrt(left / frames * 2), math.Sqrt(right / frames * 2)
+}
+
+func TestFront(t *testing.T) {
+	l, r := render(1000, 0, 0, -1)
+	if math.Abs(l-r) > 1e-6 {
+		t.Errorf("a source in front must be centered: left: %v, right: %v", l, r)
+	}
+}
+
+func TestSide(t *testing.T) {
+	// The high frequencies are shadowed by the head.
+	l, r := render(8000, 1, 0, 0)
+	if !(r > 2*l) {
+		t.Errorf("a source on the right must be louder on the right: left: %v, right: %v", l, r)
+	}
+	l, r = render(8000, -1, 0, 0)
+	if !(l > 2*r) {
+		t.Errorf("a source on the left must be louder on the left: left: %v, right: %v", l, r)
+	}
+}
+
+func TestDistance(t *testing.T) {
+	l1, _ := render(1000, 0, 0, -1)
+	l4, _ := render(1000, 0, 0, -4)
+	if got, want := l4/l1, 0.25; math.Abs(got-want) > 0.01 {
+		t.Errorf("the gain at 4m relative to 1m: got: %v, want: %v", got, want)
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	"sync/atomic"
+)
+
+// The reasons of the interruption of a Context. A Context is interrupted while any of them applies.
+const (
+	interruptedByFocus int32 = 1 << iota
+	interruptedBySystem
+)
+
+// setInterrupted adds or removes a reason of the interruption. All the Players are paused while the
+// Context is interrupted. Each Player fades out like Player.Pause.
+func (c *Context) setInterrupted(reason int32, interrupted bool) {
+	for {
+		old := atomic.LoadInt32(&c.interrupted)
+		v := old &^ reason
+		if interrupted {
+			v = old | reason
+		}
+		if atomic.CompareAndSwapInt32(&c.interrupted, old, v) {
+			return
+		}
+	}
+}
+
+// notifyInterruption is called by the drivers when the system interrupts the sound and when the
+// interruption ends. err is the error to restore the sound after the interruption, if any.
+func notifyInterruption(interrupted bool, err error) {
+	c := currentContext()
+	if c == nil {
+		return
+	}
+
+	c.setInterrupted(interruptedBySystem, interrupted)
+	if interrupted {
+		logEvent(c.options, EventInterruptionBegan, nil, "the sound is interrupted by the system")
+	} else {
+		logEvent(c.options, EventInterruptionEnded, err, "the interruption ended")
+	}
+	if c.options.OnInterruption != nil {
+		c.options.OnInterruption(interrupted)
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/leibnewton/oto/shmring"
+)
+
+// IPCPlayer plays the PCM that another process writes to a ring buffer in shared memory, e.g. a sandboxed
+// plugin process playing through the host's Context. The other process opens the ring with shmring.Open
+// by the name, or with shmring.OpenFile by the file passed to it, and writes PCM in the Context's format.
+//
+// An IPCPlayer is mixed like a Player, but it has no buffer other than the ring: while the other process
+// doesn't write enough data, silence is played. IPCPlayer can be used from different goroutines
+// concurrently.
+type IPCPlayer struct {
+	context *Context
+	source  *ipcSource
+	closed  bool
+	m       sync.Mutex
+}
+
+// NewIPCPlayer creates a ring buffer in shared memory with the name and size bytes of data, and plays the
+// data written to it. A size of 0 means the size of a Player's buffer. The name must be unique in the
+// system, and on Linux an empty name creates an anonymous ring to pass to a child process with File.
+// See the shmring package for where the memory lives on each platform.
+func (c *Context) NewIPCPlayer(name string, size int) (*IPCPlayer, error) {
+	if size < 0 {
+		return nil, fmt.Errorf("oto: the size of the ring must not be negative but %d", size)
+	}
+	if size == 0 {
+		size = c.playerBufferSize()
+	}
+	if c.isClosed() {
+		return nil, ErrContextClosed
+	}
+	ring, err := shmring.Create(name, shmring.Format{
+		SampleRate:     c.options.SampleRate,
+		ChannelNum:     c.options.ChannelNum,
+		BytesPerSample: c.options.Format.BytesPerSample(),
+	}, size)
+	if err != nil {
+		return nil, err
+	}
+	p := &IPCPlayer{
+		context: c,
+		source: &ipcSource{
+			ring:        ring,
+			volume:      math.Float32bits(1),
+			interrupted: &c.interrupted,
+			fadeOut:     newFadeOut(c.options),
+		},
+	}
+	c.mux.AddSource(p.source)
+	return p, nil
+}
+
+// Name returns the name of the ring. The name is empty for an anonymous ring.
+func (p *IPCPlayer) Name() string {
+	return p.source.ring.Name()
+}
+
+// File returns the file backing the ring to pass to a child process, e.g. as one of exec.Cmd's
+// ExtraFiles. File returns nil on Windows, where the ring is opened by the name.
+func (p *IPCPlayer) File() *os.File {
+	return p.source.ring.File()
+}
+
+// SetVolume sets the volume of the IPCPlayer like Player.SetVolume.
+func (p *IPCPlayer) SetVolume(volume float64) {
+	if volume < 0 || math.IsNaN(volume) {
+		volume = 0
+	}
+	atomic.StoreUint32(&p.source.volume, math.Float32bits(float32(volume)))
+}
+
+// Volume returns the volume of the IPCPlayer.
+func (p *IPCPlayer) Volume() float64 {
+	return float64(math.Float32frombits(atomic.LoadUint32(&p.source.volume)))
+}
+
+// Connected reports whether a writer has the ring open. Connected is false before the other process
+// opens the ring, and after it closes the ring.
+func (p *IPCPlayer) Connected() bool {
+	return p.source.ring.Connected()
+}
+
+// Close stops playing and removes the ring. The other process's writes fail with shmring.ErrClosed.
+// Close does nothing when the IPCPlayer is already closed.
+func (p *IPCPlayer) Close() error {
+	p.m.Lock()
+	defer p.m.Unlock()
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	p.context.mux.RemoveSource(p.source)
+	return p.source.Close()
+}
+
+// ipcSource is the source of an IPCPlayer for the mux. The fields other than the atomic ones are used only
+// by the Context's loop.
+type ipcSource struct {
+	ring *shmring.Ring
+
+	// volume is the bits of the float32 gain.
+	volume uint32
+
+	// interrupted points to the Context's interrupted, which pauses the IPCPlayers too.
+	interrupted *int32
+
+	// gain is the gain for the data of the last Read, and fadeOut plays the data for the gain ramp after
+	// the interruption starts.
+	gain    float32
+	fadeOut fadeOut
+}
+
+func (s *ipcSource) Read(buf []byte) (int, error) {
+	if atomic.LoadInt32(s.interrupted) != 0 {
+		s.gain = 0
+		if s.fadeOut.done() {
+			// Leave the data in the ring so that the writer waits until the interruption ends.
+			return 0, nil
+		}
+		return s.read(buf[:s.fadeOut.next(len(buf))])
+	}
+	s.gain = math.Float32frombits(atomic.LoadUint32(&s.volume))
+	s.fadeOut.reset()
+	return s.read(buf)
+}
+
+func (s *ipcSource) read(buf []byte) (int, error) {
+	// The ring fails only after it is closed, and then the source is being removed. An error of a source
+	// would stop the whole mux, so it is treated as the end of the data.
+	n, err := s.ring.TryRead(buf)
+	if err != nil {
+		return 0, nil
+	}
+	return n, nil
+}
+
+// Gain implements mux.Gainer.
+func (s *ipcSource) Gain() float32 {
+	return s.gain
+}
+
+// Close implements io.Closer. The Context closes its sources when it is closed.
+func (s *ipcSource) Close() error {
+	return s.ring.Close()
+}
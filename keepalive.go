@@ -0,0 +1,62 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	"github.com/leibnewton/oto/internal/backend"
+)
+
+// SetKeepAlive sets whether the Context keeps the device playing while the application is in the
+// background, e.g. for a music application running a foreground service on Android. While keepAlive is
+// true, the device is not suspended by Options.SuspendOnSilence, and on Android a partial wake lock is
+// held so that the CPU keeps feeding the device while the screen is off. The application must have the
+// WAKE_LOCK permission. The default value is false.
+//
+// When the stream is killed anyway, e.g. after doze, the device is created again automatically, and
+// EventDeviceLost and EventDeviceReopened are reported to the Logger.
+func (c *Context) SetKeepAlive(keepAlive bool) error {
+	d := c.driverWriter
+	d.m.Lock()
+	defer d.m.Unlock()
+	d.keepAlive = keepAlive
+	err := d.applyKeepAlive()
+	if err == nil && keepAlive {
+		err = d.resumeIfSuspended()
+	}
+	return err
+}
+
+// applyKeepAlive applies the keep-alive setting to the driver, e.g. after the driver is reopened.
+// applyKeepAlive must be called with d.m locked.
+func (d *driverWriter) applyKeepAlive() error {
+	k, ok := d.driver.(backend.KeepAliver)
+	if !ok {
+		return nil
+	}
+	return k.SetKeepAlive(d.keepAlive)
+}
+
+// applySettings applies the settings of the Context that the driver keeps, e.g. after the driver is
+// reopened. applySettings must be called with d.m locked.
+func (d *driverWriter) applySettings() error {
+	if err := d.applyKeepAlive(); err != nil {
+		return err
+	}
+	d.applyDevicePause()
+	if err := d.applyDeviceRate(); err != nil {
+		return err
+	}
+	return d.applyDeviceVolume()
+}
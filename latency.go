@@ -0,0 +1,58 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	"time"
+
+	"github.com/leibnewton/oto/internal/backend"
+)
+
+// Latency returns the estimated time from when a sample is mixed until it is heard. This is the duration
+// of the device buffer plus the latency of the output device. When the output is a Bluetooth device,
+// e.g. A2DP headphones, the latency of its codec and transport is included. It is reported by the
+// platform where available (iOS and macOS), and estimated otherwise.
+//
+// A rhythm game can offset the timing of the input by Latency to match what the user hears. The output
+// device might change while playing, so call Latency again after EventRouteChanged or
+// Options.OnRouteChange. Latency queries the platform, and should not be called every frame.
+func (c *Context) Latency() time.Duration {
+	d := c.driverWriter
+	d.m.Lock()
+	l := time.Second * time.Duration(d.bufferSize) / time.Duration(d.bytesPerSecond)
+	d.m.Unlock()
+	return l + c.outputLatency()
+}
+
+// outputLatency returns the latency of the output device after the device buffer.
+func (c *Context) outputLatency() time.Duration {
+	d := c.driverWriter
+	d.m.Lock()
+	driver := d.driver
+	d.m.Unlock()
+
+	if c, ok := driver.(*convertingDriver); ok {
+		driver = c.driver
+	}
+	o, ok := driver.(backend.OutputLatencier)
+	if !ok {
+		return 0
+	}
+	out, bluetooth := o.OutputLatency()
+	if out == 0 && bluetooth {
+		out = backend.BluetoothLatency
+	}
+	return out
+}
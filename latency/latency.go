@@ -0,0 +1,167 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package latency measures the round-trip latency of the audio path by playing a chirp and finding it
+// in a recording of the output, e.g. with a loopback cable or a microphone next to the speaker.
+//
+// Oto doesn't offer a capture API, so the recording is done by a Recorder that the caller provides. The
+// Recorder of the ototest package records the in-memory driver, which measures the latency of Oto's
+// buffers without a device. See also cmd/otolatency.
+//
+//	d, err := latency.Measure(c.NewPlayer(), latency.Format{SampleRate: 48000, ChannelNum: 2, BytesPerSample: 2}, recorder)
+//
+// The result includes the latency of the recorder. Compare the results with different buffer settings
+// on the same machine, rather than reading the absolute value.
+package latency
+
+import (
+	"errors"
+	"io"
+	"math"
+	"time"
+)
+
+// Format represents the format of the samples written to the Player. BytesPerSample is 1 for unsigned
+// 8bit samples and 2 for signed 16bit little-endian samples, like oto.Format.
+type Format struct {
+	SampleRate     int
+	ChannelNum     int
+	BytesPerSample int
+}
+
+// Recorder records sound from an input device.
+type Recorder interface {
+	// Start starts recording.
+	Start() error
+
+	// Stop stops recording, and returns the samples from -1 to 1 recorded since Start, in mono at the
+	// same sample rate as the Format passed to Measure.
+	Stop() ([]float32, error)
+}
+
+const (
+	chirpDuration = 50 * time.Millisecond
+	chirpFrom     = 500
+	chirpTo       = 8000
+
+	// leadDuration is the silence before the chirp, and tailDuration is the silence after the chirp,
+	// which leaves time for the chirp to be played and recorded.
+	leadDuration = 100 * time.Millisecond
+	tailDuration = time.Second
+)
+
+// ErrNotFound is returned when the chirp is not found in the recording.
+var ErrNotFound = errors.New("latency: the chirp is not found in the recording")
+
+// Chirp returns a chirp, a sine wave whose frequency rises linearly, at the sample rate. The chirp has
+// a sharp peak of the auto-correlation, so that it can be found accurately in a recording.
+func Chirp(sampleRate int) []float32 {
+	n := int(int64(chirpDuration) * int64(sampleRate) / int64(time.Second))
+	s := make([]float32, n)
+	d := chirpDuration.Seconds()
+	for i := range s {
+		t := float64(i) / float64(sampleRate)
+		phase := 2 * math.Pi * (chirpFrom*t + (chirpTo-chirpFrom)*t*t/(2*d))
+		// The Hann window suppresses the clicks at the edges.
+		w := 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(n-1))
+		s[i] = float32(math.Sin(phase) * w)
+	}
+	return s
+}
+
+// Find returns the position in frames where signal appears in recording, by cross-correlation.
+// Find returns ErrNotFound when the correlation is too weak.
+func Find(recording, signal []float32) (int, error) {
+	if len(signal) == 0 || len(recording) < len(signal) {
+		return 0, ErrNotFound
+	}
+	var energy float64
+	for _, v := range signal {
+		energy += float64(v) * float64(v)
+	}
+
+	best, bestPos := 0.0, -1
+	for pos := 0; pos+len(signal) <= len(recording); pos++ {
+		var c, e float64
+		r := recording[pos : pos+len(signal)]
+		for i, v := range signal {
+			c += float64(r[i]) * float64(v)
+			e += float64(r[i]) * float64(r[i])
+		}
+		if e == 0 {
+			continue
+		}
+		// Normalize the correlation so that a loud noise isn't taken for the chirp.
+		if n := c / math.Sqrt(e*energy); n > best {
+			best, bestPos = n, pos
+		}
+	}
+	const threshold = 0.5
+	if best < threshold {
+		return 0, ErrNotFound
+	}
+	return bestPos, nil
+}
+
+// Measure plays a chirp by writing it to w, a Player, while recording by rec, and returns the time from
+// writing the chirp until it is recorded.
+func Measure(w io.Writer, format Format, rec Recorder) (time.Duration, error) {
+	chirp := Chirp(format.SampleRate)
+	lead := int(int64(leadDuration) * int64(format.SampleRate) / int64(time.Second))
+	tail := int(int64(tailDuration) * int64(format.SampleRate) / int64(time.Second))
+	samples := make([]float32, lead+len(chirp)+tail)
+	copy(samples[lead:], chirp)
+
+	if err := rec.Start(); err != nil {
+		return 0, err
+	}
+	if _, err := w.Write(encode(samples, format)); err != nil {
+		rec.Stop()
+		return 0, err
+	}
+	// Write returns when the data is buffered. Wait until the tail is played too.
+	time.Sleep(tailDuration)
+	recording, err := rec.Stop()
+	if err != nil {
+		return 0, err
+	}
+
+	pos, err := Find(recording, chirp)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(int64(pos-lead) * int64(time.Second) / int64(format.SampleRate)), nil
+}
+
+// encode encodes mono samples into the format, writing the same value to all the channels.
+func encode(samples []float32, format Format) []byte {
+	bpf := format.ChannelNum * format.BytesPerSample
+	b := make([]byte, len(samples)*bpf)
+	for i, v := range samples {
+		f := b[i*bpf : (i+1)*bpf]
+		switch format.BytesPerSample {
+		case 1:
+			for j := range f {
+				f[j] = byte(int(math.Round(float64(v)*127)) + 128)
+			}
+		case 2:
+			s := int16(math.Round(float64(v) * 32767))
+			for j := 0; j < len(f); j += 2 {
+				f[j] = byte(s)
+				f[j+1] = byte(s >> 8)
+			}
+		}
+	}
+	return b
+}
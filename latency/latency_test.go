@@ -0,0 +1,92 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package latency_test
+
+import (
+	"io"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/leibnewton/oto/latency"
+)
+
+func TestFind(t *testing.T) {
+	const sampleRate = 8000
+	chirp := latency.Chirp(sampleRate)
+
+	// Put the attenuated chirp into noise.
+	rnd := rand.New(rand.NewSource(1))
+	recording := make([]float32, 4000)
+	for i := range recording {
+		recording[i] = (rnd.Float32()*2 - 1) * 0.05
+	}
+	const pos = 1234
+	for i, v := range chirp {
+		recording[pos+i] += v * 0.3
+	}
+
+	got, err := latency.Find(recording, chirp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != pos {
+		t.Errorf("got: %d, want: %d", got, pos)
+	}
+
+	if _, err := latency.Find(make([]float32, 4000), chirp); err != latency.ErrNotFound {
+		t.Errorf("got: %v, want: %v", err, latency.ErrNotFound)
+	}
+}
+
+// loopback is a Recorder that records what is written with a fixed delay.
+type loopback struct {
+	delay    int
+	recorded []float32
+}
+
+func (l *loopback) Write(buf []byte) (int, error) {
+	l.recorded = make([]float32, l.delay)
+	// The format is mono 16 bits.
+	for i := 0; i+1 < len(buf); i += 2 {
+		l.recorded = append(l.recorded, float32(int16(buf[i])|int16(buf[i+1])<<8)/32768)
+	}
+	return len(buf), nil
+}
+
+func (l *loopback) Start() error {
+	return nil
+}
+
+func (l *loopback) Stop() ([]float32, error) {
+	return l.recorded, nil
+}
+
+var _ io.Writer = (*loopback)(nil)
+
+func TestMeasure(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Measure waits for a second")
+	}
+	const sampleRate = 8000
+	l := &loopback{delay: 400}
+	d, err := latency.Measure(l, latency.Format{SampleRate: sampleRate, ChannelNum: 1, BytesPerSample: 2}, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 50 * time.Millisecond; d != want {
+		t.Errorf("got: %v, want: %v", d, want)
+	}
+}
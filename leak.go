@@ -0,0 +1,47 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	"runtime/debug"
+)
+
+// Leak describes a Player or a Context that is not closed. See Options.OnLeak.
+type Leak struct {
+	// Kind is "Player" or "Context".
+	Kind string
+
+	// Stack is the stack trace of the goroutine that created the Player or the Context.
+	Stack string
+}
+
+// creationStack returns the current stack trace when the leak detection is enabled.
+func creationStack(options *Options) string {
+	if options.OnLeak == nil {
+		return ""
+	}
+	return string(debug.Stack())
+}
+
+// reportLeak reports the leak of an object created at stack, when the leak detection is enabled.
+func reportLeak(options *Options, kind, stack string) {
+	if options.OnLeak == nil {
+		return
+	}
+	options.OnLeak(Leak{
+		Kind:  kind,
+		Stack: stack,
+	})
+}
@@ -0,0 +1,206 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/leibnewton/oto/internal/backend"
+)
+
+// EventKind represents a kind of Event.
+type EventKind int
+
+const (
+	// EventDriverOpened is reported when the driver opens the device.
+	EventDriverOpened EventKind = iota
+
+	// EventFormatNegotiated is reported when the device doesn't support the requested format and
+	// another format is used. See Options.ExactFormat.
+	EventFormatNegotiated
+
+	// EventUnderrun is reported when the device underruns.
+	EventUnderrun
+
+	// EventDeviceLost is reported when the device is lost, or stalls.
+	EventDeviceLost
+
+	// EventDeviceReopened is reported when the device is reopened, e.g. after the device was lost or
+	// the system slept.
+	EventDeviceReopened
+
+	// EventBufferResized is reported when the buffer grows by Options.AdaptiveBuffer.
+	EventBufferResized
+
+	// EventDeviceSuspended is reported when the device is closed after silence by
+	// Options.SuspendOnSilence.
+	EventDeviceSuspended
+
+	// EventDeviceResumed is reported when the suspended device is opened again.
+	EventDeviceResumed
+
+	// EventAudioFocusChanged is reported when the audio focus changes. See Context.SetAudioFocus.
+	EventAudioFocusChanged
+
+	// EventInterruptionBegan is reported when the system interrupts the sound. See
+	// Options.OnInterruption.
+	EventInterruptionBegan
+
+	// EventInterruptionEnded is reported when the interruption ends. Err is set when the sound cannot
+	// be restored.
+	EventInterruptionEnded
+
+	// EventRouteChanged is reported when the route of the sound changes. See Options.OnRouteChange.
+	EventRouteChanged
+
+	// EventAudioStateChanged is reported when the state of the AudioContext changes in browsers. See
+	// ResumeOnUserGesture.
+	EventAudioStateChanged
+
+	// EventDriverFallback is reported when a driver in Options.Drivers fails to open and the next one is
+	// tried. Err is the reason.
+	EventDriverFallback
+
+	// EventDevicePaused is reported when the device is paused since all the Players are paused. See
+	// Player.Pause.
+	EventDevicePaused
+
+	// EventDeviceRestarted is reported when the paused device is restarted.
+	EventDeviceRestarted
+
+	// EventDevicesChanged is reported when an output device is added or removed. See
+	// Options.OnDevicesChanged.
+	EventDevicesChanged
+
+	// EventSessionWatchFailed is reported when the driver fails to watch the volume of the audio session,
+	// and Options.OnSessionVolumeChange is not called. Err is the reason.
+	EventSessionWatchFailed
+)
+
+// String returns the name of the event kind.
+func (k EventKind) String() string {
+	switch k {
+	case EventDriverOpened:
+		return "driver-opened"
+	case EventFormatNegotiated:
+		return "format-negotiated"
+	case EventUnderrun:
+		return "underrun"
+	case EventDeviceLost:
+		return "device-lost"
+	case EventDeviceReopened:
+		return "device-reopened"
+	case EventBufferResized:
+		return "buffer-resized"
+	case EventDeviceSuspended:
+		return "device-suspended"
+	case EventDeviceResumed:
+		return "device-resumed"
+	case EventAudioFocusChanged:
+		return "audio-focus-changed"
+	case EventInterruptionBegan:
+		return "interruption-began"
+	case EventInterruptionEnded:
+		return "interruption-ended"
+	case EventRouteChanged:
+		return "route-changed"
+	case EventAudioStateChanged:
+		return "audio-state-changed"
+	case EventDriverFallback:
+		return "driver-fallback"
+	case EventDevicePaused:
+		return "device-paused"
+	case EventDeviceRestarted:
+		return "device-restarted"
+	case EventDevicesChanged:
+		return "devices-changed"
+	case EventSessionWatchFailed:
+		return "session-watch-failed"
+	}
+	return fmt.Sprintf("EventKind(%d)", int(k))
+}
+
+// Event is a diagnostic event reported to the Logger.
+type Event struct {
+	Kind EventKind
+
+	// Driver is the name of the driver, e.g. "winmm".
+	Driver string
+
+	// Message describes the event.
+	Message string
+
+	// Err is the cause of the event, if any.
+	Err error
+}
+
+// Logger receives the diagnostic events of Oto.
+//
+// Log is called from the goroutine feeding the device, so Log must not block.
+type Logger interface {
+	Log(event Event)
+}
+
+// LoggerFunc is a function that implements Logger.
+type LoggerFunc func(event Event)
+
+// Log implements Logger.
+func (f LoggerFunc) Log(event Event) {
+	f(event)
+}
+
+var (
+	logger  Logger
+	loggerM sync.Mutex
+)
+
+// SetLogger sets the Logger that receives the diagnostic events. nil disables logging, which is the
+// default.
+//
+// SetLogger can be called from any goroutine.
+func SetLogger(l Logger) {
+	loggerM.Lock()
+	defer loggerM.Unlock()
+	logger = l
+}
+
+// driverEventKind returns the EventKind of an event reported by a built-in driver.
+func driverEventKind(kind backend.EventKind) EventKind {
+	switch kind {
+	case backend.EventAudioStateChanged:
+		return EventAudioStateChanged
+	case backend.EventSessionWatchFailed:
+		return EventSessionWatchFailed
+	}
+	return EventDriverOpened
+}
+
+// logEvent reports an event to the Logger if any.
+func logEvent(options *Options, kind EventKind, err error, format string, args ...interface{}) {
+	loggerM.Lock()
+	l := logger
+	loggerM.Unlock()
+	if l == nil {
+		return
+	}
+
+	l.Log(Event{
+		Kind:    kind,
+		Driver:  options.resolvedDriverName(),
+		Message: fmt.Sprintf(format, args...),
+		Err:     err,
+	})
+}
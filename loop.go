@@ -0,0 +1,116 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/leibnewton/oto/internal/backend"
+)
+
+// Loop is a short sound looped by the device. See Context.PlayLoop.
+type Loop struct {
+	context *contextState
+	loop    backend.Loop
+	closed  bool
+	m       sync.Mutex
+}
+
+// PlayLoop plays data repeatedly in the device, e.g. for a short looped effect like an engine. The device
+// repeats the buffer by itself, so the CPU doesn't submit the data for each cycle. data is in the format
+// of the Context, and must be whole frames. loops is the number of times to play data, and loops <= 0
+// means until the Loop is closed.
+//
+// The Loop is played besides the Players, and is not affected by the Players' volume, the effects or the
+// Context's master processing. It is not played when the driver is reopened.
+//
+// PlayLoop returns an error when the driver can't loop a buffer. Only the winmm driver supports it by
+// WHDR_BEGINLOOP and WHDR_ENDLOOP, and only when the device accepts the Context's format as is.
+func (c *Context) PlayLoop(data []byte, loops int) (*Loop, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("oto: data of PlayLoop must not be empty")
+	}
+	if bpf := c.options.bytesPerFrame(); len(data)%bpf != 0 {
+		return nil, fmt.Errorf("oto: PlayLoop length %d is not a multiple of the frame size %d", len(data), bpf)
+	}
+
+	d := c.driverWriter
+	d.m.Lock()
+	defer d.m.Unlock()
+	if d.driver == nil {
+		return nil, ErrContextClosed
+	}
+	l, ok := d.driver.(backend.Looper)
+	if !ok {
+		return nil, fmt.Errorf("oto: the driver doesn't support looping in the device")
+	}
+	loop, err := l.PlayLoop(data, loops)
+	if err != nil {
+		return nil, err
+	}
+	lp := &Loop{context: c.contextState, loop: loop}
+	c.loopsM.Lock()
+	if c.loops == nil {
+		c.loops = map[*Loop]struct{}{}
+	}
+	c.loops[lp] = struct{}{}
+	c.loopsM.Unlock()
+	return lp, nil
+}
+
+// closeLoops closes the Loops that are not closed yet, when the Context is closed.
+func (c *Context) closeLoops() error {
+	c.loopsM.Lock()
+	loops := c.loops
+	c.loops = nil
+	c.loopsM.Unlock()
+
+	var err error
+	for l := range loops {
+		if cerr := l.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// IsPlaying reports whether the Loop is still playing. IsPlaying is false after the data is played loops
+// times, or after Close.
+func (l *Loop) IsPlaying() bool {
+	l.m.Lock()
+	defer l.m.Unlock()
+	if l.closed {
+		return false
+	}
+	return l.loop.IsPlaying()
+}
+
+// Close stops the Loop and frees its resources. Close can be called more than once. The Loops are closed
+// when the Context is closed.
+func (l *Loop) Close() error {
+	l.m.Lock()
+	defer l.m.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+
+	c := l.context
+	c.loopsM.Lock()
+	delete(c.loops, l)
+	c.loopsM.Unlock()
+	return l.loop.Close()
+}
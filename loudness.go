@@ -0,0 +1,100 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+
+	"github.com/leibnewton/oto/internal/loudness"
+)
+
+// SetGainDB sets the gain of the Player in decibels, which is multiplied to the volume. 0 is the default,
+// and a negative gain attenuates the sound. This is for the gain of loudness normalization like
+// ReplayGain, so that the volume can be left for the user.
+//
+// The gain ramps like the volume. NaN is treated as 0.
+func (p *Player) SetGainDB(db float64) {
+	if math.IsNaN(db) {
+		db = 0
+	}
+	atomic.StoreUint32(&p.source.gainDB, math.Float32bits(float32(db)))
+}
+
+// GainDB returns the gain of the Player in decibels.
+func (p *Player) GainDB() float64 {
+	return float64(math.Float32frombits(atomic.LoadUint32(&p.source.gainDB)))
+}
+
+// gainDB32 returns the linear gain of the gain in decibels.
+func (s *playerSource) gainDB32() float32 {
+	db := math.Float32frombits(atomic.LoadUint32(&s.gainDB))
+	if db == 0 {
+		return 1
+	}
+	return float32(math.Pow(10, float64(db)/20))
+}
+
+// loudnessState is the analyzer of the integrated loudness of a Player.
+type loudnessState struct {
+	meter *loudness.Meter
+
+	// m guards meter, which is processed by the context's loop and read by the Player's goroutines.
+	m sync.Mutex
+}
+
+// SetLoudnessAnalysis sets whether the Player measures the integrated loudness of its data as specified
+// by EBU R128. Enabling the analysis starts a new measurement, and disabling it discards the measurement.
+// The analysis is disabled by default.
+//
+// The loudness is measured before the volume, the gain and the effects are applied, so that music
+// players can normalize the perceived volume of tracks:
+//
+//	if l := p.Loudness(); !math.IsInf(l, -1) {
+//		p.SetGainDB(-23 - l)
+//	}
+func (p *Player) SetLoudnessAnalysis(enabled bool) {
+	if !enabled {
+		p.source.loudness.Store((*loudnessState)(nil))
+		return
+	}
+	p.source.loudness.Store(&loudnessState{
+		meter: loudness.New(p.source.channelNum, p.source.sampleRate),
+	})
+}
+
+// Loudness returns the integrated loudness in LUFS of the data played since the analysis was enabled.
+// Loudness returns -Inf when the analysis is disabled, or when nothing loud enough has been played.
+func (p *Player) Loudness() float64 {
+	l, _ := p.source.loudness.Load().(*loudnessState)
+	if l == nil {
+		return math.Inf(-1)
+	}
+	l.m.Lock()
+	defer l.m.Unlock()
+	return l.meter.Integrated()
+}
+
+// analyzeLoudness measures the loudness of buf if the analysis is enabled.
+func (s *playerSource) analyzeLoudness(buf []float32) {
+	l, _ := s.loudness.Load().(*loudnessState)
+	if l == nil {
+		return
+	}
+	l.m.Lock()
+	l.meter.Process(buf)
+	l.m.Unlock()
+}
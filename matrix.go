@@ -0,0 +1,133 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	"fmt"
+	"math"
+	"sync/atomic"
+)
+
+// channelMatrix holds the routing matrix of a Player.
+type channelMatrix struct {
+	// gains holds the []float32 of the flattened matrix, gains[out*channelNum+in]. nil means the identity.
+	gains atomic.Value
+
+	// last is the matrix applied at the last period, and out is the buffer of a frame. They are used only
+	// by the Context's loop.
+	last  []float32
+	out   []float32
+	ident []float32
+}
+
+// SetChannelMatrix sets the matrix to route and scale the channels of the Player. matrix[out][in] is the
+// linear gain of the input channel in to the output channel out, and matrix must be ChannelNum ×
+// ChannelNum. For example, this routes the left channel to both channels at -6dB in a stereo Context:
+//
+//	p.SetChannelMatrix([][]float64{{0.5, 0}, {0.5, 0}})
+//
+// nil resets the matrix to the identity. The matrix is applied after the effects, and the change ramps
+// during a period.
+func (p *Player) SetChannelMatrix(matrix [][]float64) error {
+	if matrix == nil {
+		p.source.matrix.gains.Store([]float32(nil))
+		return nil
+	}
+	chs := p.context.options.ChannelNum
+	if len(matrix) != chs {
+		return fmt.Errorf("oto: the channel matrix must have %d rows but %d", chs, len(matrix))
+	}
+	gains := make([]float32, 0, chs*chs)
+	for _, row := range matrix {
+		if len(row) != chs {
+			return fmt.Errorf("oto: the channel matrix must have %d columns but %d", chs, len(row))
+		}
+		for _, g := range row {
+			if math.IsNaN(g) || math.IsInf(g, 0) {
+				return fmt.Errorf("oto: invalid gain in the channel matrix: %v", g)
+			}
+			gains = append(gains, float32(g))
+		}
+	}
+	p.source.matrix.gains.Store(gains)
+	return nil
+}
+
+// process applies the matrix to the interleaved frames of channelNum channels in buf.
+func (m *channelMatrix) process(buf []float32, channelNum int) {
+	gains, _ := m.gains.Load().([]float32)
+	if gains == nil && m.last == nil {
+		return
+	}
+	if gains == nil {
+		gains = m.identity(channelNum)
+	}
+	from := m.last
+	if from == nil {
+		from = m.identity(channelNum)
+	}
+	if len(m.out) != channelNum {
+		m.out = make([]float32, channelNum)
+	}
+
+	frames := len(buf) / channelNum
+	for i := 0; i < frames; i++ {
+		t := float32(i+1) / float32(frames)
+		frame := buf[i*channelNum : (i+1)*channelNum]
+		for o := range m.out {
+			var v float32
+			for in, x := range frame {
+				k := o*channelNum + in
+				v += (from[k] + (gains[k]-from[k])*t) * x
+			}
+			m.out[o] = v
+		}
+		copy(frame, m.out)
+	}
+	if frames == 0 {
+		return
+	}
+	if m.isIdentity(gains, channelNum) {
+		m.last = nil
+		return
+	}
+	m.last = gains
+}
+
+func (m *channelMatrix) isIdentity(gains []float32, channelNum int) bool {
+	for o := 0; o < channelNum; o++ {
+		for in := 0; in < channelNum; in++ {
+			want := float32(0)
+			if o == in {
+				want = 1
+			}
+			if gains[o*channelNum+in] != want {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// identity returns the identity matrix, which is cached so that the loop doesn't allocate.
+func (m *channelMatrix) identity(channelNum int) []float32 {
+	if len(m.ident) != channelNum*channelNum {
+		m.ident = make([]float32, channelNum*channelNum)
+		for i := 0; i < channelNum; i++ {
+			m.ident[i*channelNum+i] = 1
+		}
+	}
+	return m.ident
+}
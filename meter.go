@@ -0,0 +1,106 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// Level represents the level of a channel during a period. Peak is the maximum absolute value of the
+// samples, and RMS is the root mean square of the samples. Both are linear, and 1 is the full scale.
+type Level struct {
+	Peak float64
+	RMS  float64
+}
+
+// maxMeterChannels is the maximum number of channels that a meter measures.
+const maxMeterChannels = 2
+
+// meter holds the levels of the last period. The levels are written by the Context's loop and read by
+// any goroutine.
+type meter struct {
+	// peaks and rmss are the bits of the float32 levels.
+	peaks [maxMeterChannels]uint32
+	rmss  [maxMeterChannels]uint32
+
+	channelNum int
+
+	// levels and onLevels are used only by the Context's loop.
+	levels   []Level
+	onLevels func([]Level)
+}
+
+func newMeter(channelNum int, onLevels func([]Level)) *meter {
+	return &meter{
+		channelNum: channelNum,
+		levels:     make([]Level, channelNum),
+		onLevels:   onLevels,
+	}
+}
+
+// Monitor implements mux.Monitor.
+func (m *meter) Monitor(buf []float32) {
+	chs := m.channelNum
+	frames := len(buf) / chs
+	if frames == 0 {
+		return
+	}
+	for ch := 0; ch < chs; ch++ {
+		var peak float32
+		var sum float64
+		for i := ch; i < frames*chs; i += chs {
+			x := buf[i]
+			sum += float64(x) * float64(x)
+			if x < 0 {
+				x = -x
+			}
+			if x > peak {
+				peak = x
+			}
+		}
+		rms := math.Sqrt(sum / float64(frames))
+		atomic.StoreUint32(&m.peaks[ch], math.Float32bits(peak))
+		atomic.StoreUint32(&m.rmss[ch], math.Float32bits(float32(rms)))
+		m.levels[ch] = Level{Peak: float64(peak), RMS: rms}
+	}
+	if m.onLevels != nil {
+		m.onLevels(m.levels)
+	}
+}
+
+// load returns the levels of the last period.
+func (m *meter) load() []Level {
+	levels := make([]Level, m.channelNum)
+	for ch := range levels {
+		levels[ch] = Level{
+			Peak: float64(math.Float32frombits(atomic.LoadUint32(&m.peaks[ch]))),
+			RMS:  float64(math.Float32frombits(atomic.LoadUint32(&m.rmss[ch]))),
+		}
+	}
+	return levels
+}
+
+// Levels returns the levels of each channel of the Player during the last period, after the volume and
+// the effects are applied.
+func (p *Player) Levels() []Level {
+	return p.source.meter.load()
+}
+
+// Levels returns the levels of each channel of the mixed sound during the last period, after the master
+// processing like the limiter. See also Options.OnLevels.
+func (c *Context) Levels() []Level {
+	return c.meter.load()
+}
@@ -0,0 +1,87 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	"time"
+)
+
+// MetricsSink receives the metrics of a Context periodically. See Options.MetricsSink.
+//
+// The names of the metrics are as follows:
+//
+//	Counters:
+//	  oto.underruns          Stats.Underruns
+//	  oto.player_underruns   Stats.PlayerUnderruns
+//	  oto.player_overruns    Stats.PlayerOverruns
+//	  oto.device_restarts    Stats.DeviceRestarts
+//	  oto.frames_written     Stats.FramesWritten
+//	Gauges:
+//	  oto.buffer_fill        The ratio of the data in the Players' buffers to their sizes, from 0 to 1
+//	  oto.latency_seconds    The estimated time until the data written now is played
+//	  oto.jitter_seconds     Stats.Jitter
+//
+// The counters are cumulative values, not deltas.
+type MetricsSink interface {
+	Counter(name string, value int64)
+	Gauge(name string, value float64)
+}
+
+const defaultMetricsInterval = time.Second
+
+// reportMetrics reports the metrics to Options.MetricsSink every Options.MetricsInterval until stop is
+// closed.
+func (c *Context) reportMetrics(stop <-chan struct{}) {
+	t := time.NewTicker(c.options.MetricsInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			c.publishMetrics(c.options.MetricsSink)
+		}
+	}
+}
+
+func (c *Context) publishMetrics(sink MetricsSink) {
+	s := c.Stats()
+	sink.Counter("oto.underruns", s.Underruns)
+	sink.Counter("oto.player_underruns", s.PlayerUnderruns)
+	sink.Counter("oto.player_overruns", s.PlayerOverruns)
+	sink.Counter("oto.device_restarts", s.DeviceRestarts)
+	sink.Counter("oto.frames_written", s.FramesWritten)
+
+	var queued, size int
+	for _, r := range c.mux.Sources() {
+		if p, ok := r.(*playerSource); ok {
+			queued += p.buf.Len()
+			size += p.buf.Size()
+		}
+	}
+	fill := 0.0
+	if size > 0 {
+		fill = float64(queued) / float64(size)
+	}
+	sink.Gauge("oto.buffer_fill", fill)
+
+	// The data written now waits for the data queued in the Player and in the device.
+	latency := c.options.BufferDuration
+	if n := len(c.mux.Sources()); n > 0 {
+		latency += FramesToDuration(queued/n/c.options.bytesPerFrame(), c.options.SampleRate)
+	}
+	sink.Gauge("oto.latency_seconds", latency.Seconds())
+	sink.Gauge("oto.jitter_seconds", s.Jitter.Seconds())
+}
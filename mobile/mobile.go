@@ -0,0 +1,214 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mobile is a subset of oto that can be bound by gomobile, for using oto from Java, Kotlin,
+// Objective-C or Swift directly:
+//
+//	gomobile bind -target=android github.com/leibnewton/oto/mobile
+//
+// The API uses only the types that gomobile supports, e.g. bytes, ints and structs of them.
+package mobile
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/leibnewton/oto"
+)
+
+// Options represents options to create a Context. Use NewOptions to get the default values.
+type Options struct {
+	// Driver is the name of the audio driver. The empty string means the default driver.
+	Driver string
+
+	// SampleRate is the number of frames played in one second.
+	SampleRate int
+
+	// ChannelNum is the number of channels, 1 or 2.
+	ChannelNum int
+
+	// BytesPerSample is the number of bytes of one sample. 1 means unsigned 8bit, and 2 means signed
+	// 16bit little endian.
+	BytesPerSample int
+
+	// BufferSizeInBytes is the size of the device buffer. 0 means the default size.
+	BufferSizeInBytes int
+
+	// Device is the number of the output device from DeviceCount. -1 means the default device.
+	Device int
+}
+
+// NewOptions returns the default options, which means 44100Hz stereo signed 16bit sound on the default
+// device.
+func NewOptions() *Options {
+	return &Options{
+		SampleRate:     44100,
+		ChannelNum:     2,
+		BytesPerSample: 2,
+		Device:         -1,
+	}
+}
+
+func (o *Options) otoOptions() (*oto.Options, error) {
+	var format oto.Format
+	switch o.BytesPerSample {
+	case 1:
+		format = oto.FormatUnsignedInt8
+	case 2:
+		format = oto.FormatSignedInt16LE
+	default:
+		return nil, fmt.Errorf("oto: BytesPerSample must be 1 or 2 but %d", o.BytesPerSample)
+	}
+	options := &oto.Options{
+		Driver:            o.Driver,
+		SampleRate:        o.SampleRate,
+		ChannelNum:        o.ChannelNum,
+		Format:            format,
+		BufferSizeInBytes: o.BufferSizeInBytes,
+	}
+	if o.Device >= 0 {
+		devs, err := oto.GetDevices(false)
+		if err != nil {
+			return nil, err
+		}
+		if o.Device >= len(devs) {
+			return nil, fmt.Errorf("oto: Device must be less than %d but %d", len(devs), o.Device)
+		}
+		options.Device = devs[o.Device]
+	}
+	return options, nil
+}
+
+// DeviceCount returns the number of the output devices.
+func DeviceCount() (int, error) {
+	devs, err := oto.GetDevices(false)
+	if err != nil {
+		return 0, err
+	}
+	return len(devs), nil
+}
+
+// DeviceName returns the name of the i-th output device.
+func DeviceName(i int) (string, error) {
+	devs, err := oto.GetDevices(false)
+	if err != nil {
+		return "", err
+	}
+	if i < 0 || i >= len(devs) {
+		return "", fmt.Errorf("oto: device index %d is out of range", i)
+	}
+	return devs[i].Name, nil
+}
+
+// Context is the entry point to the sound playback. See oto.Context.
+type Context struct {
+	context *oto.Context
+}
+
+// NewContext creates a new Context. nil options means the default options.
+//
+// There can only be one Context at any time.
+func NewContext(options *Options) (*Context, error) {
+	if options == nil {
+		options = NewOptions()
+	}
+	o, err := options.otoOptions()
+	if err != nil {
+		return nil, err
+	}
+	c, err := oto.NewContextFromOptions(o)
+	if err != nil {
+		return nil, err
+	}
+	return &Context{context: c}, nil
+}
+
+// NewPlayer creates a new Player.
+func (c *Context) NewPlayer() *Player {
+	return &Player{player: c.context.NewPlayer()}
+}
+
+// Driver returns the name of the driver that the Context uses.
+func (c *Context) Driver() string {
+	return c.context.Driver()
+}
+
+// SetAudioFocus reacts to a change of the audio focus. focusChange is the value passed to
+// AudioManager.OnAudioFocusChangeListener. See oto.Context.SetAudioFocus.
+func (c *Context) SetAudioFocus(focusChange int) error {
+	return c.context.SetAudioFocus(oto.AudioFocus(focusChange))
+}
+
+// SetKeepAlive sets whether the Context keeps playing in the background, e.g. in a foreground service.
+// See oto.Context.SetKeepAlive.
+func (c *Context) SetKeepAlive(keepAlive bool) error {
+	return c.context.SetKeepAlive(keepAlive)
+}
+
+// LatencyMillis returns the estimated latency from when a sample is mixed until it is heard in
+// milliseconds, including the latency of a Bluetooth device. See oto.Context.Latency.
+func (c *Context) LatencyMillis() int64 {
+	return int64(c.context.Latency() / time.Millisecond)
+}
+
+// Close closes the Context. See oto.Context.Close.
+func (c *Context) Close() error {
+	return c.context.Close()
+}
+
+// Player is a PCM stream to play. See oto.Player.
+type Player struct {
+	player *oto.Player
+}
+
+// Write writes PCM samples to the Player. Write blocks until all the samples are buffered.
+func (p *Player) Write(data []byte) (int, error) {
+	return p.player.Write(data)
+}
+
+// SetVolume sets the volume of the Player. 1 is the original volume.
+func (p *Player) SetVolume(volume float64) {
+	p.player.SetVolume(volume)
+}
+
+// Volume returns the volume of the Player.
+func (p *Player) Volume() float64 {
+	return p.player.Volume()
+}
+
+// Pause pauses the Player.
+func (p *Player) Pause() {
+	p.player.Pause()
+}
+
+// Resume resumes the paused Player.
+func (p *Player) Resume() {
+	p.player.Resume()
+}
+
+// IsPaused reports whether the Player is paused.
+func (p *Player) IsPaused() bool {
+	return p.player.IsPaused()
+}
+
+// PositionMillis returns the position of the Player's data played by the device in milliseconds. See
+// oto.Player.Position.
+func (p *Player) PositionMillis() int64 {
+	return int64(p.player.Position() / time.Millisecond)
+}
+
+// Close closes the Player.
+func (p *Player) Close() error {
+	return p.player.Close()
+}
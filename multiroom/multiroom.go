@@ -0,0 +1,269 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package multiroom keeps several machines playing the same stream in sync over UDP, as a reference
+// implementation of the synchronized playback with Oto's audio clock.
+//
+// One machine is the Leader, whose playback is the reference. The Leader tells the Followers which frame
+// of the stream is heard at which time on its clock. Each Follower estimates the offset between the
+// clocks by timestamped round trips, starts its Player with Context.StartAt, and then follows the
+// Leader's position with Player.SetRateTrim:
+//
+//	// On the leader:
+//	l := multiroom.NewLeader(conn)
+//	go l.Serve()
+//	l.SetAnchor(multiroom.AnchorOf(c, p, 0, sampleRate))
+//
+//	// On each follower:
+//	f := multiroom.NewFollower(conn, sampleRate)
+//	for i := 0; i < 8; i++ {
+//		f.Sync(time.Second)
+//	}
+//	frame := int64(...) // The frame of the stream to start from, a little in the future.
+//	c.StartAt(f.StartTime(frame), p)
+//	for range time.Tick(time.Second) {
+//		f.Sync(time.Second)
+//		f.Adjust(c, p, frame)
+//	}
+//
+// The precision is a few milliseconds on a local network, which depends on the network jitter and the
+// devices' counters. The latencies of the output devices are included where the platforms report them.
+package multiroom
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/leibnewton/oto"
+)
+
+const (
+	kindRequest = 1
+	kindReply   = 2
+
+	requestSize = 1 + 8
+	replySize   = 1 + 8*4
+
+	// syncSamples is the number of the recent round trips that the clock offset is estimated from. The
+	// round trip with the shortest time is the least affected by the network jitter.
+	syncSamples = 8
+
+	// correctionPeriod is the time over which Adjust corrects the difference from the Leader.
+	correctionPeriod = 10 * time.Second
+)
+
+// ErrNoAnchor is returned by Follower.Sync when the Leader doesn't have an Anchor yet.
+var ErrNoAnchor = errors.New("multiroom: the leader doesn't have an anchor")
+
+// Anchor ties the stream to a clock: the frame Frame of the stream is heard at Time.
+type Anchor struct {
+	Frame int64
+	Time  time.Time
+}
+
+// AnchorOf returns the Anchor of the Player p of the Context c now. startFrame is the frame of the stream
+// at which p started, and sampleRate is the sample rate of c.
+func AnchorOf(c *oto.Context, p *oto.Player, startFrame int64, sampleRate int) Anchor {
+	clock := c.Clock()
+	return Anchor{
+		Frame: startFrame + int64(oto.DurationToFrames(p.Position(), sampleRate)),
+		Time:  clock.Time,
+	}
+}
+
+// Leader answers the timestamp requests of the Followers with its clock and its Anchor.
+type Leader struct {
+	conn net.PacketConn
+
+	anchor    Anchor
+	hasAnchor bool
+	m         sync.Mutex
+}
+
+// NewLeader creates a Leader answering on conn, e.g. a UDP socket from net.ListenPacket.
+func NewLeader(conn net.PacketConn) *Leader {
+	return &Leader{conn: conn}
+}
+
+// SetAnchor sets the Anchor of the Leader's playback, e.g. by AnchorOf. Set it again when the stream
+// jumps, e.g. after a seek.
+func (l *Leader) SetAnchor(a Anchor) {
+	l.m.Lock()
+	defer l.m.Unlock()
+	l.anchor = a
+	l.hasAnchor = true
+}
+
+// Serve answers the requests until conn is closed, and returns the error of reading conn.
+func (l *Leader) Serve() error {
+	buf := make([]byte, 64)
+	for {
+		n, addr, err := l.conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		received := time.Now()
+		if n != requestSize || buf[0] != kindRequest {
+			continue
+		}
+
+		l.m.Lock()
+		a, ok := l.anchor, l.hasAnchor
+		l.m.Unlock()
+		if !ok {
+			// An anchor frame of -1 tells the Follower that there is no anchor.
+			a = Anchor{Frame: -1, Time: received}
+		}
+		reply := make([]byte, replySize)
+		reply[0] = kindReply
+		copy(reply[1:9], buf[1:9])
+		binary.BigEndian.PutUint64(reply[9:], uint64(received.UnixNano()))
+		binary.BigEndian.PutUint64(reply[17:], uint64(a.Frame))
+		binary.BigEndian.PutUint64(reply[25:], uint64(a.Time.UnixNano()))
+		// A lost reply is retried by the Follower.
+		l.conn.WriteTo(reply, addr)
+	}
+}
+
+// sample is a round trip of Follower.Sync.
+type sample struct {
+	rtt    time.Duration
+	offset time.Duration
+}
+
+// Follower follows the playback of a Leader.
+type Follower struct {
+	conn       net.Conn
+	sampleRate int
+
+	samples []sample
+	anchor  Anchor
+	synced  bool
+	m       sync.Mutex
+}
+
+// NewFollower creates a Follower asking the Leader on conn, e.g. a UDP socket from net.Dial. sampleRate is
+// the sample rate of the stream.
+func NewFollower(conn net.Conn, sampleRate int) *Follower {
+	return &Follower{
+		conn:       conn,
+		sampleRate: sampleRate,
+	}
+}
+
+// Sync makes a timestamped round trip to the Leader, and updates the clock offset and the Anchor. Sync
+// waits for the reply until timeout. Call Sync a few times before starting, and then periodically, e.g.
+// every second.
+func (f *Follower) Sync(timeout time.Duration) error {
+	sent := time.Now()
+	req := make([]byte, requestSize)
+	req[0] = kindRequest
+	binary.BigEndian.PutUint64(req[1:], uint64(sent.UnixNano()))
+	if err := f.conn.SetDeadline(sent.Add(timeout)); err != nil {
+		return err
+	}
+	if _, err := f.conn.Write(req); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 64)
+	for {
+		n, err := f.conn.Read(buf)
+		if err != nil {
+			return err
+		}
+		received := time.Now()
+		// Ignore the late replies to the earlier requests.
+		if n != replySize || buf[0] != kindReply || int64(binary.BigEndian.Uint64(buf[1:])) != sent.UnixNano() {
+			continue
+		}
+		leader := time.Unix(0, int64(binary.BigEndian.Uint64(buf[9:])))
+		frame := int64(binary.BigEndian.Uint64(buf[17:]))
+		at := time.Unix(0, int64(binary.BigEndian.Uint64(buf[25:])))
+
+		// The Leader's clock is read at the middle of the round trip.
+		rtt := received.Sub(sent)
+		s := sample{
+			rtt:    rtt,
+			offset: leader.Sub(sent.Add(rtt / 2)),
+		}
+		f.m.Lock()
+		defer f.m.Unlock()
+		f.samples = append(f.samples, s)
+		if len(f.samples) > syncSamples {
+			f.samples = f.samples[1:]
+		}
+		if frame < 0 {
+			return ErrNoAnchor
+		}
+		f.anchor = Anchor{Frame: frame, Time: at}
+		f.synced = true
+		return nil
+	}
+}
+
+// Offset returns the estimated offset of the Leader's clock from the local clock, and the round-trip
+// time of the sample it was estimated from.
+func (f *Follower) Offset() (offset, rtt time.Duration) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	return f.offset()
+}
+
+func (f *Follower) offset() (offset, rtt time.Duration) {
+	for i, s := range f.samples {
+		if i == 0 || s.rtt < rtt {
+			offset, rtt = s.offset, s.rtt
+		}
+	}
+	return offset, rtt
+}
+
+// StartTime returns the local time when the frame of the stream is heard on the Leader. Pass it to
+// Context.StartAt to start the Player whose data starts from the frame. StartTime returns the zero time
+// before Sync succeeds.
+func (f *Follower) StartTime(frame int64) time.Time {
+	f.m.Lock()
+	defer f.m.Unlock()
+	if !f.synced {
+		return time.Time{}
+	}
+	offset, _ := f.offset()
+	d := time.Duration((frame - f.anchor.Frame) * int64(time.Second) / int64(f.sampleRate))
+	return f.anchor.Time.Add(d).Add(-offset)
+}
+
+// Adjust trims the playback rate of the Player p of the Context c so that p converges to the Leader's
+// position in about 10 seconds, and returns the difference in frames, which is positive when p is behind.
+// startFrame is the frame of the stream at which p started. Adjust does nothing before Sync succeeds.
+//
+// The trim is limited by Player.SetRateTrim, so a large difference takes long to converge. Restart the
+// Player when the difference is too large, e.g. after the Leader seeks.
+func (f *Follower) Adjust(c *oto.Context, p *oto.Player, startFrame int64) int64 {
+	f.m.Lock()
+	defer f.m.Unlock()
+	if !f.synced {
+		return 0
+	}
+	clock := c.Clock()
+	offset, _ := f.offset()
+	own := startFrame + int64(oto.DurationToFrames(p.Position(), f.sampleRate))
+	leader := f.anchor.Frame + int64(clock.Time.Add(offset).Sub(f.anchor.Time))*int64(f.sampleRate)/int64(time.Second)
+	diff := leader - own
+	p.SetRateTrim(float64(diff) / (correctionPeriod.Seconds() * float64(f.sampleRate)) * 1e6)
+	return diff
+}
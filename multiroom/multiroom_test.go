@@ -0,0 +1,64 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package multiroom_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/leibnewton/oto/multiroom"
+)
+
+func TestSync(t *testing.T) {
+	lc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lc.Close()
+	l := multiroom.NewLeader(lc)
+	go l.Serve()
+
+	fc, err := net.Dial("udp", lc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fc.Close()
+	f := multiroom.NewFollower(fc, 48000)
+
+	if err := f.Sync(time.Second); err != multiroom.ErrNoAnchor {
+		t.Errorf("Sync without an anchor: got: %v, want: %v", err, multiroom.ErrNoAnchor)
+	}
+	if got := f.StartTime(0); !got.IsZero() {
+		t.Errorf("StartTime before the anchor: got: %v, want: the zero time", got)
+	}
+
+	anchor := time.Now()
+	l.SetAnchor(multiroom.Anchor{Frame: 1000, Time: anchor})
+	for i := 0; i < 4; i++ {
+		if err := f.Sync(time.Second); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The clocks are the same on one machine.
+	offset, rtt := f.Offset()
+	if offset < -rtt || offset > rtt {
+		t.Errorf("Offset(): got: %v, want: within the round trip %v", offset, rtt)
+	}
+	// The frame one second after the anchor is heard one second later.
+	if d := f.StartTime(1000 + 48000).Sub(anchor.Add(time.Second)); d < -rtt || d > rtt {
+		t.Errorf("StartTime(): got: %v off, want: within the round trip %v", d, rtt)
+	}
+}
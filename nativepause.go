@@ -0,0 +1,135 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	"sync/atomic"
+
+	otodriver "github.com/leibnewton/oto/driver"
+)
+
+// pauserValue wraps a driver.Pauser so that atomic.Value can hold the different types. The driver.Pauser
+// is nil when the driver doesn't implement it.
+type pauserValue struct {
+	otodriver.Pauser
+}
+
+// pauserOf returns the driver.Pauser of the driver, or nil.
+func pauserOf(driver tryWriteCloser) otodriver.Pauser {
+	if c, ok := driver.(*convertingDriver); ok {
+		driver = c.driver
+	}
+	if r, ok := driver.(*registeredDriver); ok {
+		p, _ := r.Driver.(otodriver.Pauser)
+		return p
+	}
+	p, _ := driver.(otodriver.Pauser)
+	return p
+}
+
+// updateDevicePause pauses the device when all the Players are paused, and restarts it otherwise.
+// pausing is the Player about to be paused, which is regarded as paused.
+//
+// The device is paused before the last Player is marked as paused, so that the Player's data keeps
+// filling the device buffer without fading out, and resumes seamlessly.
+func (c *Context) updateDevicePause(pausing *playerSource) {
+	c.pauseM.Lock()
+	defer c.pauseM.Unlock()
+
+	if c.pauseStopped {
+		return
+	}
+	d := c.driverWriter
+	v, _ := d.pauser.Load().(pauserValue)
+	if v.Pauser == nil {
+		return
+	}
+
+	pause := c.allPlayersPaused(pausing)
+	if pause == (atomic.LoadInt32(&d.devicePaused) != 0) {
+		return
+	}
+	if pause {
+		if err := v.Pause(); err != nil {
+			// The Players are paused in software anyway.
+			logEvent(c.options, EventDevicePaused, err, "failed to pause the device")
+			return
+		}
+		atomic.StoreInt32(&d.devicePaused, 1)
+		logEvent(c.options, EventDevicePaused, nil, "paused the device")
+		return
+	}
+	atomic.StoreInt32(&d.devicePaused, 0)
+	if err := v.Restart(); err != nil {
+		logEvent(c.options, EventDeviceRestarted, err, "failed to restart the device")
+		return
+	}
+	logEvent(c.options, EventDeviceRestarted, nil, "restarted the device")
+}
+
+// endDevicePause restarts the device paused by updateDevicePause before the Context is closed. The device
+// is not paused any more after endDevicePause.
+func (c *Context) endDevicePause() {
+	c.pauseM.Lock()
+	defer c.pauseM.Unlock()
+
+	c.pauseStopped = true
+	d := c.driverWriter
+	if !atomic.CompareAndSwapInt32(&d.devicePaused, 1, 0) {
+		return
+	}
+	if v, _ := d.pauser.Load().(pauserValue); v.Pauser != nil {
+		if err := v.Restart(); err != nil {
+			logEvent(c.options, EventDeviceRestarted, err, "failed to restart the device")
+		}
+	}
+}
+
+// allPlayersPaused reports whether there are Players and all of them are paused. pausing is regarded as
+// paused.
+func (c *Context) allPlayersPaused(pausing *playerSource) bool {
+	sources := c.mux.Sources()
+	if len(sources) == 0 {
+		return false
+	}
+	for _, r := range sources {
+		s, ok := r.(*playerSource)
+		if !ok {
+			return false
+		}
+		if s != pausing && atomic.LoadInt32(&s.paused) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// applyDevicePause pauses the driver when the device was paused, e.g. after the driver is reopened.
+// Failing to pause the device is not fatal, since the Players are paused in software anyway.
+// applyDevicePause must be called with d.m locked.
+func (d *driverWriter) applyDevicePause() {
+	if atomic.LoadInt32(&d.devicePaused) == 0 {
+		return
+	}
+	p := pauserOf(d.driver)
+	if p == nil {
+		atomic.StoreInt32(&d.devicePaused, 0)
+		return
+	}
+	if err := p.Pause(); err != nil {
+		atomic.StoreInt32(&d.devicePaused, 0)
+		logEvent(d.options, EventDevicePaused, err, "failed to pause the reopened device")
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	"time"
+)
+
+// Option configures a Context created by NewContextWithOptions. Each Option sets fields of Options.
+type Option func(*Options)
+
+// NewContextWithOptions creates a new context configured by the given options. The options are applied
+// in order, so a later option overrides the fields set by an earlier one. The fields that are not set by
+// the options have the default values of Options.
+//
+//	c, err := oto.NewContextWithOptions(
+//		oto.WithFormat(48000, 2, oto.FormatSignedInt16LE),
+//		oto.WithLowLatency(),
+//	)
+func NewContextWithOptions(opts ...Option) (*Context, error) {
+	var o Options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return NewContextFromOptions(&o)
+}
+
+// WithDriver specifies the name of the audio driver. See Options.Driver.
+func WithDriver(name string) Option {
+	return func(o *Options) {
+		o.Driver = name
+	}
+}
+
+// WithDrivers specifies the drivers tried in order. See Options.Drivers.
+func WithDrivers(names ...string) Option {
+	return func(o *Options) {
+		o.Drivers = names
+	}
+}
+
+// WithDevice specifies the output device. See Options.Device.
+func WithDevice(device *Device) Option {
+	return func(o *Options) {
+		o.Device = device
+	}
+}
+
+// WithFormat specifies the sample rate, the number of channels and the format of samples.
+func WithFormat(sampleRate, channelNum int, format Format) Option {
+	return func(o *Options) {
+		o.SampleRate = sampleRate
+		o.ChannelNum = channelNum
+		o.Format = format
+	}
+}
+
+// WithBufferDuration specifies the length of the buffer. See Options.BufferDuration.
+func WithBufferDuration(d time.Duration) Option {
+	return func(o *Options) {
+		o.BufferDuration = d
+	}
+}
+
+// WithLowLatency specifies a small buffer of two periods and real-time scheduling of the feeding thread,
+// for games and synthesizers that care about the latency more than CPU time. Like a Profile, WithLowLatency
+// fills only the buffer and period options that are not specified before it.
+func WithLowLatency() Option {
+	return func(o *Options) {
+		if o.BufferSizeInBytes == 0 && o.BufferFrames == 0 && o.BufferDuration == 0 {
+			o.BufferDuration = lowLatencyBufferDuration
+		}
+		if o.PeriodFrames == 0 && o.PeriodDuration == 0 && o.PeriodCount == 0 {
+			o.PeriodCount = 2
+		}
+		o.RealtimeThread = true
+	}
+}
+
+// WithOptions sets all the fields to the given options. This is useful for the settings that have no
+// Option functions.
+//
+// The Options are applied in order, and WithOptions replaces all the fields including the ones set by the
+// preceding Options. Put WithOptions first to combine it with other Options.
+func WithOptions(options Options) Option {
+	return func(o *Options) {
+		*o = options
+	}
+}
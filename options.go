@@ -0,0 +1,852 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"github.com/leibnewton/oto/internal/limiter"
+)
+
+// Format represents the format of a PCM sample.
+type Format int
+
+const (
+	// FormatSignedInt16LE is signed 16bit integer in little endian. This is the default format.
+	FormatSignedInt16LE Format = iota
+
+	// FormatUnsignedInt8 is unsigned 8bit integer. 128 represents silence.
+	FormatUnsignedInt8
+)
+
+// String returns the name of the format.
+func (f Format) String() string {
+	switch f {
+	case FormatSignedInt16LE:
+		return "s16le"
+	case FormatUnsignedInt8:
+		return "u8"
+	}
+	return fmt.Sprintf("Format(%d)", int(f))
+}
+
+// BytesPerSample returns the number of bytes of one sample of one channel.
+// BytesPerSample returns 0 for an unknown format.
+func (f Format) BytesPerSample() int {
+	switch f {
+	case FormatSignedInt16LE:
+		return 2
+	case FormatUnsignedInt8:
+		return 1
+	}
+	return 0
+}
+
+func formatFromBitDepthInBytes(bitDepthInBytes int) (Format, error) {
+	switch bitDepthInBytes {
+	case 1:
+		return FormatUnsignedInt8, nil
+	case 2:
+		return FormatSignedInt16LE, nil
+	}
+	return 0, fmt.Errorf("oto: bitDepthInBytes must be 1 or 2 but %d", bitDepthInBytes)
+}
+
+// PulseBufferAttr represents the metrics of a PulseAudio stream's buffer in bytes.
+// 0 means the default value.
+type PulseBufferAttr struct {
+	// MaxLength is the maximum length of the buffer.
+	MaxLength int
+
+	// TargetLength is the target length of the buffer. The server tries to keep this amount of data
+	// in the buffer.
+	TargetLength int
+
+	// Prebuffer is the amount of data required before the playback starts.
+	Prebuffer int
+
+	// MinRequest is the minimum amount of data that the server requests at once.
+	MinRequest int
+}
+
+// CloseMode represents how Context.Close treats the data that is not played yet.
+type CloseMode int
+
+const (
+	// DrainThenClose makes Close wait until the data buffered in the Players and the device is played.
+	// This is the default mode.
+	DrainThenClose CloseMode = iota
+
+	// ImmediateClose makes Close stop the device right away and drop the buffered data.
+	ImmediateClose
+)
+
+// String returns the name of the close mode.
+func (m CloseMode) String() string {
+	switch m {
+	case DrainThenClose:
+		return "drain-then-close"
+	case ImmediateClose:
+		return "immediate-close"
+	}
+	return fmt.Sprintf("CloseMode(%d)", int(m))
+}
+
+// XrunPolicy represents how the driver treats an underrun (xrun) of the device.
+type XrunPolicy int
+
+const (
+	// XrunRecover recovers the stream silently and continues playing. This is the default policy.
+	XrunRecover XrunPolicy = iota
+
+	// XrunReport recovers the stream and calls Options.OnXrun.
+	XrunReport
+
+	// XrunFail stops playing with an error. The error is returned by the Players' Write.
+	XrunFail
+)
+
+// String returns the name of the policy.
+func (p XrunPolicy) String() string {
+	switch p {
+	case XrunRecover:
+		return "recover"
+	case XrunReport:
+		return "report"
+	case XrunFail:
+		return "fail"
+	}
+	return fmt.Sprintf("XrunPolicy(%d)", int(p))
+}
+
+// ALSAAccess represents how the ALSA driver accesses the sound card.
+type ALSAAccess int
+
+const (
+	// ALSAAccessDefault opens Options.ALSADevice as configured, which is usually through the plug layer
+	// that converts the format and the sample rate. This is the default.
+	ALSAAccessDefault ALSAAccess = iota
+
+	// ALSAAccessHardware opens the card directly without the plug layer, e.g. for the lowest latency on
+	// embedded and pro-audio setups. "default" means "hw:0,0", and "plughw:" is replaced with "hw:". The
+	// sample rate is not resampled by ALSA: when the card doesn't support the format, the closest format
+	// is used and converted by oto unless Options.ExactFormat is set. The card is not shared with other
+	// processes.
+	ALSAAccessHardware
+
+	// ALSAAccessDmix opens the card through dmix so that the card is shared with other processes even
+	// when the configuration doesn't use dmix. "default" means "dmix", and "hw:" and "plughw:" are
+	// replaced with "dmix:". As with ALSAAccessHardware, the format is converted by oto.
+	ALSAAccessDmix
+)
+
+// String returns the name of the access.
+func (a ALSAAccess) String() string {
+	switch a {
+	case ALSAAccessDefault:
+		return "default"
+	case ALSAAccessHardware:
+		return "hardware"
+	case ALSAAccessDmix:
+		return "dmix"
+	}
+	return fmt.Sprintf("ALSAAccess(%d)", int(a))
+}
+
+// Profile represents a preset of the buffer settings for a kind of application.
+type Profile int
+
+const (
+	// ProfileDefault uses the default values of the options.
+	ProfileDefault Profile = iota
+
+	// ProfilePowerSave is for podcast and music players that care about battery more than the
+	// latency. ProfilePowerSave uses a large buffer consisting of two long periods so that the device
+	// wakes the process up less frequently.
+	//
+	// None of the current drivers supports the hardware offload, so ProfilePowerSave affects only the
+	// buffer settings.
+	ProfilePowerSave
+)
+
+// String returns the name of the profile.
+func (p Profile) String() string {
+	switch p {
+	case ProfileDefault:
+		return "default"
+	case ProfilePowerSave:
+		return "power-save"
+	}
+	return fmt.Sprintf("Profile(%d)", int(p))
+}
+
+const (
+	lowLatencyBufferDuration = 20 * time.Millisecond
+	powerSaveBufferDuration  = 500 * time.Millisecond
+)
+
+const (
+	defaultSampleRate     = 44100
+	defaultChannelNum     = 2
+	defaultBufferDuration = 50 * time.Millisecond
+
+	defaultMaxBufferDuration = 500 * time.Millisecond
+
+	defaultCloseTimeout = 5 * time.Second
+
+	minSampleRate     = 8000
+	maxSampleRate     = 384000
+	maxBufferDuration = 10 * time.Second
+
+	defaultLimiterThreshold = -1
+	defaultLimiterRelease   = 100 * time.Millisecond
+
+	defaultDuckVolume = 0.2
+
+	// softClipKnee is the level above which SoftClip bends the samples.
+	softClipKnee = 0.8
+)
+
+// Options represents options to create a Context.
+//
+// The zero value is a valid Options, which means 44100Hz stereo signed 16bit sound on the default
+// device with the default driver.
+type Options struct {
+	// Driver is the name of the audio driver to use.
+	// The empty string means the default driver of the platform, which is "winmm" on Windows. winmm is the
+	// only driver built in on Windows.
+	// "dummy" is a driver that discards the sound and is available on all the platforms.
+	// The drivers registered to the package driver are available by their names too.
+	Driver string
+
+	// Drivers is the list of the drivers tried in order when Driver is empty. The first driver that
+	// opens is used, and why the earlier ones failed is reported by Context.DriverAttempts. The names
+	// of the drivers that are not available on the platform are skipped.
+	//
+	// nil means only the default driver. Listing a registered driver and then the default one, e.g.
+	// "winmm" on Windows, still plays the sound on a broken audio stack where the registered driver fails
+	// to open.
+	Drivers []string
+
+	// Device is the output device. Devices are listed by GetDevices.
+	// nil means the default device. On macOS, Device can be an aggregate device. See
+	// CreateAggregateDevice.
+	Device *Device
+
+	// SampleRate specifies the number of samples that should be played during one second.
+	// Usual numbers are 44100 or 48000. 0 means 44100.
+	SampleRate int
+
+	// ChannelNum specifies the number of channels. One channel is mono playback. Two
+	// channels are stereo playback. No other values are supported. 0 means 2.
+	ChannelNum int
+
+	// Format specifies the format of samples that are written to Players.
+	Format Format
+
+	// BusyRetryTimeout specifies how long creating a Context retries opening the device while the
+	// device is busy, e.g. another application holds a single-client device. The retries are done with
+	// exponential backoff. 0 means that creating a Context fails immediately with an error matching
+	// ErrDeviceBusy.
+	BusyRetryTimeout time.Duration
+
+	// OnDeviceBusy is called with the number of the attempts and the error before each retry by
+	// BusyRetryTimeout.
+	OnDeviceBusy func(attempt int, err error)
+
+	// MetricsSink receives the metrics of the Context every MetricsInterval. nil disables the metrics.
+	// The package expvarsink offers a MetricsSink publishing the metrics by expvar.
+	MetricsSink MetricsSink
+
+	// MetricsInterval specifies the interval to report the metrics to MetricsSink. The default value is
+	// 1 second.
+	MetricsInterval time.Duration
+
+	// DebugDumpPath is the path of a WAV file to write a copy of everything passed to the device, for
+	// debugging. The samples are in the format of the Context, after mixing the Players. When the device
+	// doesn't support the format and Oto converts the samples (see Context.DeviceFormat), the dump has the
+	// samples before the conversion, so the dump doesn't depend on the device. This is useful to attach to
+	// a bug report when the sound is wrong. The environment variable OTO_DUMP specifies the path too when
+	// DebugDumpPath is empty.
+	DebugDumpPath string
+
+	// OnLeak enables the leak detection for debugging. Recording the stack traces is costly, so this
+	// should not be set in production.
+	//
+	// OnLeak is called when a Player or a Context is garbage-collected without Close. The leaked object is
+	// closed then. The Leak has the stack trace where the object was created. OnLeak can be called from
+	// any goroutine.
+	OnLeak func(Leak)
+
+	// Headroom specifies the attenuation of the mixed sound of all the Players in decibels. Some headroom
+	// keeps overlapping Players from clipping. 0 means no attenuation.
+	Headroom float64
+
+	// SoftClip specifies whether the mixed sound is clipped softly. Samples beyond about -2dB full scale
+	// are bent smoothly instead of being cut off harshly at the full scale.
+	SoftClip bool
+
+	// Limiter specifies whether the mixed sound goes through a brickwall limiter, which keeps the peaks
+	// under LimiterThreshold without clipping them. The limiter delays the sound by 5 milliseconds to see
+	// the peaks ahead.
+	Limiter bool
+
+	// LimiterThreshold is the maximum level of the limiter's output in dBFS. This must not be positive.
+	// 0 means -1dBFS.
+	LimiterThreshold float64
+
+	// LimiterRelease is the time for the limiter to recover the gain after a peak. The default value is
+	// 100 milliseconds.
+	LimiterRelease time.Duration
+
+	// SuspendOnSilence specifies how long the mixed sound must be silent before the device is closed to
+	// save power and to release the device for other applications. The device is opened again as soon as
+	// any Player plays sound. 0 disables the suspension.
+	SuspendOnSilence time.Duration
+
+	// DuckVolume specifies the volume of the mixed sound while it is ducked for another application, e.g.
+	// by AudioFocusLossTransientCanDuck. DuckVolume must be in (0, 1]. The default value is 0.2.
+	DuckVolume float64
+
+	// OnLevels is called with the levels of each channel of the mixed sound at every period while there
+	// are any Players. OnLevels is called from the Context's loop in real time, and must return quickly.
+	// The slice is valid only during the call.
+	OnLevels func(levels []Level)
+
+	// OnInterruption is called when the system interrupts the sound, e.g. by a phone call, Siri or an
+	// alarm on iOS, with true, and when the interruption ends, with false. All the Players are paused
+	// during the interruption without changing their paused states, and are resumed after it.
+	// OnInterruption is called from a system thread, and must not block.
+	OnInterruption func(interrupted bool)
+
+	// UnplugPolicy specifies what happens when the output device becomes unavailable, e.g. headphones
+	// are unplugged on iOS, or the default output device is unplugged on macOS.
+	UnplugPolicy UnplugPolicy
+
+	// OnRouteChange is called when the route of the sound changes, e.g. headphones are plugged in or
+	// unplugged on iOS, or the default output device changes on macOS. OnRouteChange is called after
+	// UnplugPolicy is applied, from a system thread, and must not block.
+	//
+	// On macOS, the Context playing on the default device moves to the new default device.
+	OnRouteChange func(change RouteChange)
+
+	// OnDevicesChanged is called when an output device is added or removed, e.g. a USB interface is
+	// plugged in, so that the application can list the devices again by GetDevices. OnDevicesChanged is
+	// called from a system thread or a goroutine watching the devices, and must not block.
+	//
+	// OnDevicesChanged is called on Windows, macOS and Linux. When the device in use is removed, the
+	// Context moves to another device regardless of OnDevicesChanged.
+	OnDevicesChanged func()
+
+	// DeviceCrossfade specifies how long the sound is crossfaded between the old and the new devices when
+	// the Context moves to another device, by Context.SetDevice or when the default device changes on
+	// macOS. The new device is opened while the old device is playing, so the switch doesn't make a gap.
+	// When the device can't be opened twice, the sound fades out and in sequentially instead. 0 disables
+	// the crossfade. A typical value is 50 milliseconds.
+	DeviceCrossfade time.Duration
+
+	// StallPeriods specifies how many periods the device can stop consuming the data before it is
+	// regarded as stalled. The Players' Write returns an error matching ErrDeviceStalled then, unless
+	// ReopenOnStall is set. 0 disables the detection.
+	StallPeriods int
+
+	// ReopenOnStall specifies whether the device is reopened when it is stalled, instead of failing.
+	ReopenOnStall bool
+
+	// ExactFormat specifies whether creating a Context fails when the device doesn't support the sample
+	// rate, the number of channels or the format. By default, the closest format that the device
+	// supports is used instead, and the samples are converted. Context.DeviceFormat reports the format
+	// in use.
+	ExactFormat bool
+
+	// ResampleQuality specifies the quality of the resampling: the sample rate conversion when the device
+	// doesn't support the sample rate (see ExactFormat), the playback rate and the pitch shift of Players,
+	// and the clock-drift compensation.
+	ResampleQuality ResampleQuality
+
+	// CloseMode specifies whether Context.Close plays the buffered data or drops it.
+	CloseMode CloseMode
+
+	// CloseTimeout specifies the longest time Context.Close takes. When the driver doesn't return in
+	// time, e.g. a misbehaving Bluetooth stack blocks, Close abandons the driver and returns an error
+	// matching ErrCloseTimeout. The Players are closed in any case. The default value is 5 seconds.
+	CloseTimeout time.Duration
+
+	// Profile specifies the preset of the buffer settings. The profile fills only the buffer and
+	// period options that are not specified, so each setting can still be overridden.
+	Profile Profile
+
+	// BufferDuration specifies the length of the buffer of the Context. This means, how long
+	// the Context can remember before actually playing them. Bigger buffer can reduce the number
+	// of Player's Write calls, thus reducing CPU time. Smaller buffer enables more precise timing.
+	//
+	// BufferDuration is ignored when BufferSizeInBytes or BufferFrames is specified. When all of
+	// them are 0, a default value is used.
+	BufferDuration time.Duration
+
+	// BufferFrames specifies the size of the buffer of the Context in frames. A frame consists of
+	// one sample for each channel.
+	//
+	// BufferFrames is ignored when BufferSizeInBytes is specified, and takes priority over
+	// BufferDuration.
+	BufferFrames int
+
+	// BufferSizeInBytes specifies the size of the buffer of the Context in bytes.
+	BufferSizeInBytes int
+
+	// PeriodFrames specifies the number of frames that the driver passes to the device at once.
+	// PeriodFrames must not exceed the buffer size.
+	//
+	// PeriodFrames takes priority over PeriodDuration. When both are 0, the driver decides the
+	// period. Drivers honor the period as closely as the platform allows.
+	PeriodFrames int
+
+	// PeriodDuration specifies the period in time.
+	PeriodDuration time.Duration
+
+	// PeriodCount specifies the number of periods queued in the device at once. Fewer periods
+	// reduce the latency, and more periods make the playback more robust against underruns.
+	// For example, 2 small periods are suitable for a synthesizer, and 8 periods are suitable for a
+	// music player.
+	//
+	// When PeriodCount is specified without the period, the period is the buffer size divided by
+	// PeriodCount. PeriodCount must be 2 or more if specified. 0 means the driver decides the number.
+	PeriodCount int
+
+	// StartThresholdFrames specifies the number of frames that the device buffer must have before the
+	// device starts playing. A bigger threshold avoids an underrun right after starting on devices with
+	// large transfers like USB, and a smaller threshold starts playing earlier. 0 means the driver's
+	// default.
+	//
+	// StartThresholdFrames is used only by the ALSA driver, and must not exceed the buffer size.
+	StartThresholdFrames int
+
+	// IOBufferFrames specifies the size of the I/O buffer of the device in frames, that is, how many
+	// frames the device processes in one I/O cycle. Smaller I/O buffers reduce the latency at the cost
+	// of CPU time. 0 means the system's default, which is usually 512 frames.
+	//
+	// IOBufferFrames is used only on macOS (kAudioDevicePropertyBufferFrameSize of the default output
+	// device) and iOS (the preferred I/O buffer duration of the audio session). The system might not
+	// honor the value exactly.
+	IOBufferFrames int
+
+	// XrunPolicy specifies how an underrun of the device is treated.
+	//
+	// XrunPolicy is used only by the ALSA driver. The number of underruns is available as
+	// Stats.Underruns regardless of the policy.
+	XrunPolicy XrunPolicy
+
+	// OnXrun is called with the number of underruns so far when an underrun happens with XrunReport.
+	// OnXrun is called on the goroutine feeding the device, and must return quickly.
+	OnXrun func(count int64)
+
+	// ALSADevice is the name of the PCM device of the ALSA driver, e.g. "default", "hw:1,0",
+	// "plughw:CARD=USB,DEV=0" or "dmix". Empty means "default". ALSAAccess specifies how the device is
+	// accessed.
+	ALSADevice string
+
+	// ALSAAccess specifies whether the ALSA driver bypasses the plug layer or forces dmix. See
+	// ALSAAccess.
+	ALSAAccess ALSAAccess
+
+	// PulseBufferAttr specifies the metrics of the stream's buffer on PulseAudio. nil means that the
+	// target length is the buffer size, the minimum request is the period when specified, and the others
+	// are the server's defaults.
+	//
+	// PulseBufferAttr is used only by the PulseAudio driver, which is enabled by the pulseaudio build
+	// tag on Linux.
+	PulseBufferAttr *PulseBufferAttr
+
+	// PulseAdjustLatency specifies whether the stream is created with PA_STREAM_ADJUST_LATENCY. With
+	// the flag, the target length is the overall latency including the device buffer, and the server
+	// adjusts the device buffer for it. Without the flag, the server might add its own buffering,
+	// which is often 200ms or more.
+	//
+	// PulseAdjustLatency is used only by the PulseAudio driver.
+	PulseAdjustLatency bool
+
+	// FlushFrames specifies the minimum number of frames passed to the driver at once. Smaller
+	// writes are coalesced in an internal buffer until they reach FlushFrames, which reduces the
+	// number of calls into the device. 0 means the size of the device buffer, which is the period when
+	// specified.
+	//
+	// FlushFrames must not exceed the buffer size.
+	FlushFrames int
+
+	// AdaptiveBuffer specifies whether the Context grows the buffer automatically when the device
+	// underruns. The Context starts with the given buffer, and doubles it at each underrun up to
+	// MaxBufferDuration. Thus, the buffer converges on the smallest size that plays reliably on the
+	// machine. The device is reopened at each resize.
+	//
+	// Underruns are detected by the winmm and ALSA drivers. AdaptiveBuffer has no effect with the
+	// other drivers.
+	AdaptiveBuffer bool
+
+	// MaxBufferDuration is the upper limit of the buffer grown by AdaptiveBuffer. 0 means 500ms.
+	MaxBufferDuration time.Duration
+
+	// OnBufferResize is called with the new buffer size in frames when AdaptiveBuffer grows the buffer.
+	// OnBufferResize is called on the goroutine feeding the device, and must return quickly.
+	OnBufferResize func(bufferFrames int)
+
+	// RealtimeThread specifies whether the OS thread feeding the device is promoted to real-time
+	// scheduling: SCHED_FIFO on Linux, and the time-constraint policy on macOS and iOS.
+	// When the process lacks the permission, the thread runs with the normal priority.
+	//
+	// On Windows, the thread is always registered with MMCSS regardless of RealtimeThread.
+	RealtimeThread bool
+
+	// WinMMCallbackFunction specifies whether the winmm driver is notified of the played buffers by a
+	// callback function (CALLBACK_FUNCTION) instead of an event (CALLBACK_EVENT). Try this when the sound
+	// stutters with small buffers, since the events are signaled late on some systems.
+	//
+	// WinMMCallbackFunction has no effect with the other drivers.
+	WinMMCallbackFunction bool
+
+	// SessionName and SessionIconPath are the display name and the icon of the audio session of the
+	// process, which the volume mixer shows instead of the name of the executable. Empty means the
+	// default of the system.
+	//
+	// On Windows, SessionIconPath is a path to an icon resource, e.g. `C:\MyGame\MyGame.exe,-101`. With
+	// the PulseAudio driver, which PipeWire also serves, they are application.name and
+	// application.icon_name of the stream, and SessionIconPath is an icon name of the icon theme, e.g.
+	// "mygame". They have no effect on the other platforms.
+	SessionName     string
+	SessionIconPath string
+
+	// MediaRole is media.role of the stream with the PulseAudio driver, e.g. "game", "music", "video",
+	// "phone" or "event". The desktop applies its policies of the routing and the ducking to the stream by
+	// the role. Empty means no role. MediaRole has no effect with the other drivers.
+	MediaRole string
+
+	// OnSessionVolumeChange is called when the volume or the mute of the audio session of the process
+	// changes, e.g. by the user in the volume mixer of Windows or by Context.SetSessionVolume, so that an
+	// in-app volume slider can stay in sync. OnSessionVolumeChange is called from a goroutine watching the
+	// session, and must not block.
+	//
+	// OnSessionVolumeChange is called only on Windows.
+	OnSessionVolumeChange func(volume float64, muted bool)
+}
+
+// DurationToFrames returns the number of frames played in the duration d at the sample rate.
+// The result is rounded down.
+func DurationToFrames(d time.Duration, sampleRate int) int {
+	return int(int64(d) * int64(sampleRate) / int64(time.Second))
+}
+
+// FramesToDuration returns the duration to play the given number of frames at the sample rate.
+func FramesToDuration(frames, sampleRate int) time.Duration {
+	return time.Duration(int64(frames) * int64(time.Second) / int64(sampleRate))
+}
+
+// resolve returns a copy of the options whose zero values are replaced with the default values. nil
+// options are resolved as the zero Options.
+func (o *Options) resolve() (*Options, error) {
+	var r Options
+	if o != nil {
+		r = *o
+	}
+	if err := r.applyProfile(); err != nil {
+		return nil, err
+	}
+	if r.SampleRate == 0 {
+		r.SampleRate = defaultSampleRate
+	}
+	if r.DebugDumpPath == "" {
+		r.DebugDumpPath = os.Getenv(dumpEnv)
+	}
+	if r.ChannelNum == 0 {
+		r.ChannelNum = defaultChannelNum
+	}
+	if r.BufferSizeInBytes == 0 && r.BufferFrames == 0 && r.BufferDuration == 0 {
+		r.BufferDuration = defaultBufferDuration
+	}
+
+	if r.SampleRate < minSampleRate || r.SampleRate > maxSampleRate {
+		return nil, fmt.Errorf("oto: SampleRate must be between %d and %d but %d", minSampleRate, maxSampleRate, r.SampleRate)
+	}
+	if r.ChannelNum != 1 && r.ChannelNum != 2 {
+		return nil, fmt.Errorf("oto: ChannelNum must be 1 or 2 but %d", r.ChannelNum)
+	}
+	if r.Format.BytesPerSample() == 0 {
+		return nil, fmt.Errorf("oto: invalid Format: %v", r.Format)
+	}
+	if r.BufferSizeInBytes < 0 {
+		return nil, fmt.Errorf("oto: BufferSizeInBytes must not be negative but %d", r.BufferSizeInBytes)
+	}
+	if r.BufferSizeInBytes%r.bytesPerFrame() != 0 {
+		return nil, fmt.Errorf("oto: BufferSizeInBytes %d is not a multiple of the frame size %d", r.BufferSizeInBytes, r.bytesPerFrame())
+	}
+	if r.BufferFrames < 0 {
+		return nil, fmt.Errorf("oto: BufferFrames must not be negative but %d", r.BufferFrames)
+	}
+	if r.BufferDuration < 0 {
+		return nil, fmt.Errorf("oto: BufferDuration must not be negative but %v", r.BufferDuration)
+	}
+	if r.PeriodFrames < 0 {
+		return nil, fmt.Errorf("oto: PeriodFrames must not be negative but %d", r.PeriodFrames)
+	}
+	if r.PeriodDuration < 0 {
+		return nil, fmt.Errorf("oto: PeriodDuration must not be negative but %v", r.PeriodDuration)
+	}
+	if r.MaxBufferDuration < 0 || r.MaxBufferDuration > maxBufferDuration {
+		return nil, fmt.Errorf("oto: MaxBufferDuration must be between 0 and %v but %v", maxBufferDuration, r.MaxBufferDuration)
+	}
+	if r.AdaptiveBuffer && r.MaxBufferDuration == 0 {
+		r.MaxBufferDuration = defaultMaxBufferDuration
+	}
+	if r.StartThresholdFrames < 0 {
+		return nil, fmt.Errorf("oto: StartThresholdFrames must not be negative but %d", r.StartThresholdFrames)
+	}
+	if r.IOBufferFrames < 0 {
+		return nil, fmt.Errorf("oto: IOBufferFrames must not be negative but %d", r.IOBufferFrames)
+	}
+	if a := r.PulseBufferAttr; a != nil && (a.MaxLength < 0 || a.TargetLength < 0 || a.Prebuffer < 0 || a.MinRequest < 0) {
+		return nil, fmt.Errorf("oto: PulseBufferAttr must not have negative values: %+v", *a)
+	}
+	if r.BusyRetryTimeout < 0 {
+		return nil, fmt.Errorf("oto: BusyRetryTimeout must not be negative but %v", r.BusyRetryTimeout)
+	}
+	if r.XrunPolicy < XrunRecover || r.XrunPolicy > XrunFail {
+		return nil, fmt.Errorf("oto: invalid XrunPolicy: %v", r.XrunPolicy)
+	}
+	if r.ALSAAccess < ALSAAccessDefault || r.ALSAAccess > ALSAAccessDmix {
+		return nil, fmt.Errorf("oto: invalid ALSAAccess: %v", r.ALSAAccess)
+	}
+	if r.UnplugPolicy != UnplugPause && r.UnplugPolicy != UnplugContinue {
+		return nil, fmt.Errorf("oto: invalid UnplugPolicy: %v", r.UnplugPolicy)
+	}
+	if r.CloseMode != DrainThenClose && r.CloseMode != ImmediateClose {
+		return nil, fmt.Errorf("oto: invalid CloseMode: %v", r.CloseMode)
+	}
+	if r.CloseTimeout < 0 {
+		return nil, fmt.Errorf("oto: CloseTimeout must not be negative but %v", r.CloseTimeout)
+	}
+	if r.CloseTimeout == 0 {
+		r.CloseTimeout = defaultCloseTimeout
+	}
+	if r.FlushFrames < 0 {
+		return nil, fmt.Errorf("oto: FlushFrames must not be negative but %d", r.FlushFrames)
+	}
+	if r.MetricsInterval < 0 {
+		return nil, fmt.Errorf("oto: MetricsInterval must not be negative but %v", r.MetricsInterval)
+	}
+	if r.MetricsInterval == 0 {
+		r.MetricsInterval = defaultMetricsInterval
+	}
+	if r.ResampleQuality < ResampleQualityLinear || r.ResampleQuality > ResampleQualityHigh {
+		return nil, fmt.Errorf("oto: invalid ResampleQuality: %d", r.ResampleQuality)
+	}
+	if r.Headroom < 0 || math.IsNaN(r.Headroom) {
+		return nil, fmt.Errorf("oto: Headroom must not be negative but %v", r.Headroom)
+	}
+	if r.LimiterThreshold > 0 || math.IsNaN(r.LimiterThreshold) {
+		return nil, fmt.Errorf("oto: LimiterThreshold must not be positive but %v", r.LimiterThreshold)
+	}
+	if r.LimiterThreshold == 0 {
+		r.LimiterThreshold = defaultLimiterThreshold
+	}
+	if r.LimiterRelease < 0 {
+		return nil, fmt.Errorf("oto: LimiterRelease must not be negative but %v", r.LimiterRelease)
+	}
+	if r.LimiterRelease == 0 {
+		r.LimiterRelease = defaultLimiterRelease
+	}
+	if r.DeviceCrossfade < 0 {
+		return nil, fmt.Errorf("oto: DeviceCrossfade must not be negative but %v", r.DeviceCrossfade)
+	}
+	if r.SuspendOnSilence < 0 {
+		return nil, fmt.Errorf("oto: SuspendOnSilence must not be negative but %v", r.SuspendOnSilence)
+	}
+	if r.DuckVolume < 0 || r.DuckVolume > 1 || math.IsNaN(r.DuckVolume) {
+		return nil, fmt.Errorf("oto: DuckVolume must be in (0, 1] but %v", r.DuckVolume)
+	}
+	if r.DuckVolume == 0 {
+		r.DuckVolume = defaultDuckVolume
+	}
+	if r.StallPeriods < 0 {
+		return nil, fmt.Errorf("oto: StallPeriods must not be negative but %d", r.StallPeriods)
+	}
+	if r.PeriodCount < 0 || r.PeriodCount == 1 {
+		return nil, fmt.Errorf("oto: PeriodCount must be 0, or 2 or more but %d", r.PeriodCount)
+	}
+	if driverForTesting() != nil {
+		r.Driver = testDriverName
+	}
+	if r.Driver != "" && !isAvailableDriver(r.Driver) {
+		return nil, fmt.Errorf("oto: driver %q is not available on this platform", r.Driver)
+	}
+	if r.Driver == "" {
+		names := r.Drivers
+		r.Drivers = availableDrivers(names)
+		if len(names) > 0 && len(r.Drivers) == 0 {
+			return nil, fmt.Errorf("oto: none of the drivers %q is available on this platform", names)
+		}
+	}
+
+	if r.BufferSizeInBytes == 0 {
+		if r.BufferFrames == 0 {
+			r.BufferFrames = DurationToFrames(r.BufferDuration, r.SampleRate)
+		}
+		r.BufferSizeInBytes = r.BufferFrames * r.bytesPerFrame()
+	}
+	r.BufferFrames = r.BufferSizeInBytes / r.bytesPerFrame()
+	r.BufferDuration = FramesToDuration(r.BufferFrames, r.SampleRate)
+	if r.BufferFrames == 0 {
+		return nil, fmt.Errorf("oto: the buffer must be one frame or more")
+	}
+	if r.BufferDuration > maxBufferDuration {
+		return nil, fmt.Errorf("oto: the buffer (%v) must not exceed %v", r.BufferDuration, maxBufferDuration)
+	}
+
+	if r.PeriodFrames == 0 {
+		r.PeriodFrames = DurationToFrames(r.PeriodDuration, r.SampleRate)
+	}
+	if r.PeriodFrames == 0 && r.PeriodCount > 0 {
+		r.PeriodFrames = r.BufferFrames / r.PeriodCount
+		if r.PeriodFrames == 0 {
+			return nil, fmt.Errorf("oto: the buffer (%d frames) is too small for %d periods", r.BufferFrames, r.PeriodCount)
+		}
+	}
+	r.PeriodDuration = FramesToDuration(r.PeriodFrames, r.SampleRate)
+	if r.PeriodFrames > r.BufferFrames {
+		return nil, fmt.Errorf("oto: the period (%d frames) must not exceed the buffer (%d frames)", r.PeriodFrames, r.BufferFrames)
+	}
+
+	if r.StartThresholdFrames > r.BufferFrames {
+		return nil, fmt.Errorf("oto: StartThresholdFrames (%d frames) must not exceed the buffer (%d frames)", r.StartThresholdFrames, r.BufferFrames)
+	}
+
+	if r.FlushFrames == 0 {
+		size, _ := r.periods()
+		r.FlushFrames = size / r.bytesPerFrame()
+	}
+	if r.FlushFrames > r.BufferFrames {
+		return nil, fmt.Errorf("oto: FlushFrames (%d frames) must not exceed the buffer (%d frames)", r.FlushFrames, r.BufferFrames)
+	}
+	return &r, nil
+}
+
+func (o *Options) applyProfile() error {
+	var bufferDuration time.Duration
+	switch o.Profile {
+	case ProfileDefault:
+		return nil
+	case ProfilePowerSave:
+		bufferDuration = powerSaveBufferDuration
+		if o.MaxBufferDuration == 0 {
+			o.MaxBufferDuration = 2 * powerSaveBufferDuration
+		}
+	default:
+		return fmt.Errorf("oto: invalid Profile: %v", o.Profile)
+	}
+	if o.BufferSizeInBytes == 0 && o.BufferFrames == 0 && o.BufferDuration == 0 {
+		o.BufferDuration = bufferDuration
+	}
+	if o.PeriodFrames == 0 && o.PeriodDuration == 0 && o.PeriodCount == 0 {
+		o.PeriodCount = 2
+	}
+	return nil
+}
+
+// grown returns the resolved options with the doubled buffer for AdaptiveBuffer.
+// grown returns nil when the buffer has already reached MaxBufferDuration.
+func (o *Options) grown() (*Options, error) {
+	maxFrames := DurationToFrames(o.MaxBufferDuration, o.SampleRate)
+	if o.BufferFrames >= maxFrames {
+		return nil, nil
+	}
+	r := *o
+	r.BufferFrames = min(2*o.BufferFrames, maxFrames)
+	r.BufferSizeInBytes = 0
+	r.BufferDuration = 0
+	// Keep the period and increase the number of periods, unless the number of periods is specified.
+	if r.PeriodCount > 0 {
+		r.PeriodFrames = 0
+		r.PeriodDuration = 0
+	}
+	r.FlushFrames = 0
+	return r.resolve()
+}
+
+// withDeviceFormat returns the resolved options with the format replaced with f. The durations of the
+// buffer and the period are kept.
+func (o *Options) withDeviceFormat(f DeviceFormat) (*Options, error) {
+	r := *o
+	r.SampleRate = f.SampleRate
+	r.ChannelNum = f.ChannelNum
+	r.Format = f.Format
+	r.BufferSizeInBytes = 0
+	r.BufferFrames = 0
+	r.PeriodFrames = 0
+	r.FlushFrames = 0
+	r.StartThresholdFrames = o.StartThresholdFrames * f.SampleRate / o.SampleRate
+	r.IOBufferFrames = o.IOBufferFrames * f.SampleRate / o.SampleRate
+	return r.resolve()
+}
+
+func (o *Options) bytesPerFrame() int {
+	return o.ChannelNum * o.Format.BytesPerSample()
+}
+
+// periodSizeInBytes returns the period in bytes, or 0 when the driver should decide the period.
+func (o *Options) periodSizeInBytes() int {
+	return o.PeriodFrames * o.bytesPerFrame()
+}
+
+// periods returns the size of each device buffer in bytes and the number of the device buffers.
+// By default, each device buffer has the whole buffer size and two device buffers are used alternately.
+// When the period is specified, each device buffer has the period size and the device buffers cover the
+// whole buffer.
+func (o *Options) periods() (size int, count int) {
+	size = o.BufferSizeInBytes
+	count = 2
+	if ps := o.periodSizeInBytes(); ps > 0 {
+		size = ps
+		count = max(2, o.BufferSizeInBytes/ps)
+	}
+	if o.PeriodCount > 0 {
+		count = o.PeriodCount
+	}
+	return size, count
+}
+
+// master returns the master gain and the knee of the soft clipping for the mux.
+func (o *Options) master() (gain, knee float32) {
+	gain = float32(math.Pow(10, -o.Headroom/20))
+	if o.SoftClip {
+		knee = softClipKnee
+	}
+	return gain, knee
+}
+
+// limiter returns the limiter for the mux, or nil if the limiter is disabled.
+func (o *Options) limiter() *limiter.Limiter {
+	if !o.Limiter {
+		return nil
+	}
+	threshold := float32(math.Pow(10, o.LimiterThreshold/20))
+	return limiter.New(o.ChannelNum, o.SampleRate, threshold, o.LimiterRelease)
+}
+
+func (o *Options) deviceNum() int {
+	if o.Device == nil {
+		return -1
+	}
+	return o.Device.Number
+}
@@ -0,0 +1,451 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ototest provides in-memory drivers to test the audio logic of applications without a device.
+//
+//	d := ototest.NewDriver()
+//	defer oto.SetDriverForTesting(d.Open)()
+//
+//	c, err := oto.NewContextFromOptions(&oto.Options{SampleRate: 48000})
+//	...
+//	// d.Bytes() is the PCM that the Context has written to the device, including the silence.
+//
+// A Driver created by NewVirtualDriver plays only when its clock is advanced by Advance, so that tests of
+// buffering, underruns and pausing are deterministic without sleeps.
+//
+// The captured data is bit-exact, and can be compared with a golden file written by WriteWAV.
+package ototest
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/leibnewton/oto/driver"
+	"github.com/leibnewton/oto/wav"
+)
+
+// Chunk is the data passed to the driver by one TryWrite.
+type Chunk struct {
+	// Time is the time of the Driver's clock when the data is written. This is the time since the
+	// Driver is opened first, or the time advanced by Advance with the virtual clock.
+	Time time.Duration
+
+	// Data is the PCM data.
+	Data []byte
+}
+
+// chunk is a Chunk whose data is in Driver.data.
+type chunk struct {
+	time   time.Duration
+	offset int
+	size   int
+}
+
+// Driver is an in-memory driver that captures everything written by a Context.
+type Driver struct {
+	params  driver.Params
+	data    []byte
+	chunks  []chunk
+	start   time.Time
+	opened  bool
+	closeCh chan struct{}
+
+	// virtual is whether the clock of the Driver is advanced by Advance instead of the real time.
+	virtual bool
+
+	// queued is the number of the bytes in the buffer that are not played yet, played is the number of
+	// the played bytes, and underruns is the number of the underruns since the Driver is created. They are
+	// used only with the virtual clock.
+	queued    int
+	played    int64
+	underruns int64
+
+	// waiting is whether TryWrite waits for the buffer to have room.
+	waiting bool
+
+	cond *sync.Cond
+	m    sync.Mutex
+}
+
+// NewDriver creates a new Driver that plays in real time.
+//
+// The Driver paces the writes like a device, so that the Context's buffering works as usual: TryWrite
+// blocks while more than the buffer is written ahead of the time since the Driver is opened.
+func NewDriver() *Driver {
+	d := &Driver{}
+	d.cond = sync.NewCond(&d.m)
+	return d
+}
+
+// NewVirtualDriver creates a new Driver whose clock is advanced by Advance.
+//
+// The Driver accepts the data up to the buffer size, and TryWrite blocks until Advance plays enough
+// data to make room. Nothing is played unless Advance is called. Closing a Context with
+// oto.DrainThenClose waits for the data to be played, so use oto.ImmediateClose in tests, or advance the
+// clock from another goroutine while closing.
+func NewVirtualDriver() *Driver {
+	d := NewDriver()
+	d.virtual = true
+	return d
+}
+
+// Open opens the Driver with the parameters. Open is a driver.OpenFunc, and is passed to
+// oto.SetDriverForTesting or driver.Register. The captured data is kept when the Driver is opened
+// again, e.g. when the Context reopens the device.
+func (d *Driver) Open(params driver.Params) (driver.Driver, error) {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	d.params = params
+	if d.start.IsZero() {
+		d.start = time.Now()
+	}
+	d.opened = true
+	d.closeCh = make(chan struct{})
+	d.queued = 0
+	d.waiting = false
+	return &writer{d: d, start: time.Now(), closeCh: d.closeCh, underrunsBase: d.underruns}, nil
+}
+
+// Params returns the parameters that the Driver is opened with last.
+func (d *Driver) Params() driver.Params {
+	d.m.Lock()
+	defer d.m.Unlock()
+	return d.params
+}
+
+// Bytes returns a copy of the data written to the Driver.
+func (d *Driver) Bytes() []byte {
+	d.m.Lock()
+	defer d.m.Unlock()
+	return append([]byte(nil), d.data...)
+}
+
+// Chunks returns a copy of the data written to the Driver with the timestamps.
+func (d *Driver) Chunks() []Chunk {
+	d.m.Lock()
+	defer d.m.Unlock()
+	chunks := make([]Chunk, 0, len(d.chunks))
+	for _, c := range d.chunks {
+		chunks = append(chunks, Chunk{
+			Time: c.time,
+			Data: append([]byte(nil), d.data[c.offset:c.offset+c.size]...),
+		})
+	}
+	return chunks
+}
+
+// WriteWAV writes the data written to the Driver into a WAV file in the format of the parameters.
+func (d *Driver) WriteWAV(w io.WriteSeeker) error {
+	p := d.Params()
+	ww, err := wav.NewWriter(w, wav.Format{
+		SampleRate:     p.SampleRate,
+		ChannelNum:     p.ChannelNum,
+		BytesPerSample: p.BytesPerSample,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := ww.Write(d.Bytes()); err != nil {
+		return err
+	}
+	return ww.Close()
+}
+
+// Reset discards the data written to the Driver.
+func (d *Driver) Reset() {
+	d.m.Lock()
+	defer d.m.Unlock()
+	d.data = d.data[:0]
+	d.chunks = d.chunks[:0]
+}
+
+// capture appends the written data. capture must be called with d.m locked.
+func (d *Driver) capture(data []byte) {
+	t := time.Since(d.start)
+	if d.virtual {
+		t = d.playedDuration()
+	}
+	d.chunks = append(d.chunks, chunk{time: t, offset: len(d.data), size: len(data)})
+	d.data = append(d.data, data...)
+}
+
+// IsOpened reports whether the Driver is opened and not closed.
+func (d *Driver) IsOpened() bool {
+	d.m.Lock()
+	defer d.m.Unlock()
+	return d.opened
+}
+
+// Advance advances the virtual clock by t, and plays the data of t from the buffer. When the buffer
+// doesn't have enough data, the rest is played as silence and an underrun is counted.
+//
+// Advance waits until the Context fills the buffer before and after playing, or the Driver is closed, so
+// that the state of the Context is settled when Advance returns. Advance(0) only waits for the buffer to
+// be filled. Advance does nothing before the Driver is opened.
+// Advance panics if the Driver is not created by NewVirtualDriver.
+func (d *Driver) Advance(t time.Duration) {
+	if !d.virtual {
+		panic("ototest: Advance is called for a Driver without the virtual clock")
+	}
+
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	// Wait for the buffer to be filled first, e.g. just after the Context is created.
+	for d.opened && !d.waiting {
+		d.cond.Wait()
+	}
+	if !d.opened {
+		return
+	}
+
+	bytesPerFrame := d.params.ChannelNum * d.params.BytesPerSample
+	n := int(int64(t)*int64(d.params.SampleRate)/int64(time.Second)) * bytesPerFrame
+	if n > d.queued {
+		d.underruns++
+		d.queued = 0
+	} else {
+		d.queued -= n
+	}
+	d.played += int64(n)
+	if n == 0 {
+		return
+	}
+
+	d.waiting = false
+	d.cond.Broadcast()
+	for d.opened && !d.waiting {
+		d.cond.Wait()
+	}
+}
+
+// Played returns the duration played by the virtual clock.
+func (d *Driver) Played() time.Duration {
+	d.m.Lock()
+	defer d.m.Unlock()
+	return d.playedDuration()
+}
+
+// playedDuration returns the duration played by the virtual clock. playedDuration must be called with d.m
+// locked.
+func (d *Driver) playedDuration() time.Duration {
+	bytesPerFrame := d.params.ChannelNum * d.params.BytesPerSample
+	if bytesPerFrame == 0 {
+		return 0
+	}
+	return time.Duration(d.played/int64(bytesPerFrame)) * time.Second / time.Duration(d.params.SampleRate)
+}
+
+// playedOffset returns the offset in d.data of the frame being played. playedOffset must be called with
+// d.m locked.
+func (d *Driver) playedOffset() int {
+	bytesPerFrame := d.params.ChannelNum * d.params.BytesPerSample
+	if bytesPerFrame == 0 {
+		return 0
+	}
+	var n int64
+	if d.virtual {
+		n = d.played
+	} else {
+		n = int64(time.Since(d.start)) * int64(d.params.SampleRate) / int64(time.Second) * int64(bytesPerFrame)
+	}
+	// The frames not written yet are not captured.
+	if n > int64(len(d.data)) {
+		n = int64(len(d.data)) / int64(bytesPerFrame) * int64(bytesPerFrame)
+	}
+	return int(n)
+}
+
+// Recorder records the sound that a Driver plays, as if the output were connected to an input by a
+// loopback cable. Recorder implements latency.Recorder, so the latency of a Context is measured without
+// a device:
+//
+//	d, err := latency.Measure(c.NewPlayer(), format, driver.NewRecorder())
+type Recorder struct {
+	d     *Driver
+	start int
+}
+
+// NewRecorder creates a Recorder of the sound played by the Driver.
+func (d *Driver) NewRecorder() *Recorder {
+	return &Recorder{d: d}
+}
+
+// Start starts recording from the frame being played.
+func (r *Recorder) Start() error {
+	r.d.m.Lock()
+	defer r.d.m.Unlock()
+	r.start = r.d.playedOffset()
+	return nil
+}
+
+// Stop stops recording, and returns the frames played since Start in mono. The channels are averaged.
+func (r *Recorder) Stop() ([]float32, error) {
+	d := r.d
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	var data []byte
+	if end := d.playedOffset(); r.start < end {
+		data = d.data[r.start:end]
+	}
+	chs, bps := d.params.ChannelNum, d.params.BytesPerSample
+	s := make([]float32, len(data)/(chs*bps))
+	for i := range s {
+		var v float32
+		for ch := 0; ch < chs; ch++ {
+			b := data[(i*chs+ch)*bps:]
+			switch bps {
+			case 1:
+				v += float32(int(b[0])-128) / 128
+			case 2:
+				v += float32(int16(b[0])|int16(b[1])<<8) / 32768
+			}
+		}
+		s[i] = v / float32(chs)
+	}
+	return s, nil
+}
+
+// Underruns returns the number of the underruns of the virtual clock since the Driver is created. The
+// underruns are counted across the opens of the Driver, while the opened driver reports the underruns
+// since it is opened as driver.UnderrunCounter.
+func (d *Driver) Underruns() int64 {
+	d.m.Lock()
+	defer d.m.Unlock()
+	return d.underruns
+}
+
+// writer is an opened Driver.
+type writer struct {
+	d *Driver
+
+	// start is the time when the writer is opened, and written is the number of the bytes written since
+	// then.
+	start   time.Time
+	written int64
+
+	// canceled is whether Cancel is called. closeCh is closed at Close.
+	canceled bool
+	closeCh  chan struct{}
+
+	// underrunsBase is the Driver's underruns when the writer is opened.
+	underrunsBase int64
+}
+
+func (w *writer) TryWrite(data []byte) (int, error) {
+	if w.d.virtual {
+		return w.tryWriteVirtual(data)
+	}
+
+	d := w.d
+	d.m.Lock()
+	d.capture(data)
+	w.written += int64(len(data))
+	p := d.params
+	d.m.Unlock()
+
+	// Wait until the data beyond the buffer is played.
+	bytesPerFrame := int64(p.ChannelNum * p.BytesPerSample)
+	ahead := time.Duration(w.written/bytesPerFrame-int64(p.BufferFrames)) * time.Second / time.Duration(p.SampleRate)
+	if wait := ahead - time.Since(w.start); wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-w.closeCh:
+		}
+	}
+	return len(data), nil
+}
+
+func (w *writer) tryWriteVirtual(data []byte) (int, error) {
+	d := w.d
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	// Wait until the buffer has room for the whole data, so that the Context doesn't retry with the rest.
+	size := d.params.BufferFrames * d.params.ChannelNum * d.params.BytesPerSample
+	for d.queued > 0 && size-d.queued < len(data) && !w.canceled && !w.isClosed() {
+		d.waiting = true
+		d.cond.Broadcast()
+		d.cond.Wait()
+	}
+	if w.canceled || w.isClosed() {
+		return len(data), nil
+	}
+	n := len(data)
+	if n > size-d.queued {
+		n = size - d.queued
+	}
+	d.capture(data[:n])
+	d.queued += n
+	w.written += int64(n)
+	return n, nil
+}
+
+// isClosed reports whether the writer is closed. isClosed must be called with d.m locked.
+func (w *writer) isClosed() bool {
+	select {
+	case <-w.closeCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// Cancel implements driver.Canceler. The virtual clock doesn't advance while the Context is closed, so
+// the data after Cancel is discarded.
+func (w *writer) Cancel() {
+	d := w.d
+	d.m.Lock()
+	defer d.m.Unlock()
+	w.canceled = true
+	d.cond.Broadcast()
+}
+
+// QueuedFrames implements driver.FrameQueuer.
+func (w *writer) QueuedFrames() int64 {
+	d := w.d
+	d.m.Lock()
+	defer d.m.Unlock()
+	bytesPerFrame := int64(d.params.ChannelNum * d.params.BytesPerSample)
+	if d.virtual {
+		return int64(d.queued) / bytesPerFrame
+	}
+	played := int64(time.Since(w.start) * time.Duration(d.params.SampleRate) / time.Second)
+	if q := w.written/bytesPerFrame - played; q > 0 {
+		return q
+	}
+	return 0
+}
+
+// Underruns implements driver.UnderrunCounter. The underruns are counted since the writer is opened.
+func (w *writer) Underruns() int64 {
+	return w.d.Underruns() - w.underrunsBase
+}
+
+func (w *writer) Close() error {
+	d := w.d
+	d.m.Lock()
+	defer d.m.Unlock()
+	if d.closeCh == w.closeCh {
+		d.opened = false
+	}
+	if !w.isClosed() {
+		close(w.closeCh)
+	}
+	d.cond.Broadcast()
+	return nil
+}
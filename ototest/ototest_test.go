@@ -0,0 +1,244 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ototest_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/leibnewton/oto"
+	"github.com/leibnewton/oto/driver"
+	"github.com/leibnewton/oto/latency"
+	"github.com/leibnewton/oto/ototest"
+	"github.com/leibnewton/oto/wav"
+)
+
+func TestDriver(t *testing.T) {
+	d := ototest.NewDriver()
+	defer oto.SetDriverForTesting(d.Open)()
+
+	c, err := oto.NewContextFromOptions(&oto.Options{
+		Driver:            "dummy",
+		SampleRate:        44100,
+		ChannelNum:        1,
+		BufferSizeInBytes: 4410,
+		CloseMode:         oto.ImmediateClose,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if got, want := c.Driver(), "test"; got != want {
+		t.Errorf("Driver(): got: %q, want: %q", got, want)
+	}
+	if got, want := d.Params().BufferFrames, 2205; got != want {
+		t.Errorf("BufferFrames: got: %d, want: %d", got, want)
+	}
+
+	// 1000 in signed 16bit little endian.
+	want := bytes.Repeat([]byte{0xe8, 0x03}, 441)
+	p := c.NewPlayer()
+	defer p.Close()
+	if _, err := p.Write(want); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !bytes.Contains(d.Bytes(), want) {
+		if time.Now().After(deadline) {
+			t.Fatal("the written data was not captured")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestVirtualDriver(t *testing.T) {
+	d := ototest.NewVirtualDriver()
+	defer oto.SetDriverForTesting(d.Open)()
+
+	c, err := oto.NewContextFromOptions(&oto.Options{
+		SampleRate:        44100,
+		ChannelNum:        1,
+		BufferSizeInBytes: 4410,
+		CloseMode:         oto.ImmediateClose,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	want := bytes.Repeat([]byte{0xe8, 0x03}, 2205)
+	p := c.NewPlayer()
+	defer p.Close()
+	if _, err := p.Write(want); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		d.Advance(10 * time.Millisecond)
+	}
+	if got, want := d.Played(), 100*time.Millisecond; got != want {
+		t.Errorf("Played(): got: %v, want: %v", got, want)
+	}
+	if got := c.Stats().Underruns; got != 0 {
+		t.Errorf("Underruns: got: %d, want: 0", got)
+	}
+	if !bytes.Contains(d.Bytes(), want) {
+		t.Errorf("the written data was not captured")
+	}
+	// The buffer is full of 50ms of data after Advance.
+	if got, want := len(d.Bytes()), 4410*3; got != want {
+		t.Errorf("len(Bytes()): got: %d, want: %d", got, want)
+	}
+}
+
+func TestUnderrunsAfterReopen(t *testing.T) {
+	d := ototest.NewVirtualDriver()
+	params := driver.Params{SampleRate: 1000, ChannelNum: 1, BytesPerSample: 2, BufferFrames: 100}
+
+	w, err := d.Open(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Keep the buffer filled like a Context until the writer is closed.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, 200)
+		for d.IsOpened() {
+			if _, err := w.TryWrite(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	// Playing more than the buffer underruns once.
+	d.Advance(200 * time.Millisecond)
+	if got, want := w.(driver.UnderrunCounter).Underruns(), int64(1); got != want {
+		t.Errorf("Underruns of the opened driver: got: %d, want: %d", got, want)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+
+	// The reopened driver counts the underruns since it is opened, and the Driver counts all of them.
+	w, err = d.Open(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if got, want := w.(driver.UnderrunCounter).Underruns(), int64(0); got != want {
+		t.Errorf("Underruns of the reopened driver: got: %d, want: %d", got, want)
+	}
+	if got, want := d.Underruns(), int64(1); got != want {
+		t.Errorf("Underruns of the Driver: got: %d, want: %d", got, want)
+	}
+}
+
+func TestChunksAndWAV(t *testing.T) {
+	d := ototest.NewVirtualDriver()
+	defer oto.SetDriverForTesting(d.Open)()
+
+	c, err := oto.NewContextFromOptions(&oto.Options{
+		SampleRate:        44100,
+		ChannelNum:        1,
+		BufferSizeInBytes: 4410,
+		CloseMode:         oto.ImmediateClose,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		d.Advance(10 * time.Millisecond)
+	}
+	c.Close()
+
+	var all []byte
+	var last time.Duration
+	for _, ch := range d.Chunks() {
+		if ch.Time < last {
+			t.Errorf("the time of the chunk goes back: %v after %v", ch.Time, last)
+		}
+		last = ch.Time
+		all = append(all, ch.Data...)
+	}
+	if !bytes.Equal(all, d.Bytes()) {
+		t.Errorf("the chunks don't match Bytes()")
+	}
+
+	f, err := ioutil.TempFile("", "ototest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if err := d.WriteWAV(f); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	r, err := wav.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := r.Format, (wav.Format{SampleRate: 44100, ChannelNum: 1, BytesPerSample: 2}); got != want {
+		t.Errorf("format: got: %+v, want: %+v", got, want)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, all) {
+		t.Errorf("the WAV data doesn't match Bytes()")
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Measure waits for a second")
+	}
+
+	d := ototest.NewDriver()
+	defer oto.SetDriverForTesting(d.Open)()
+
+	c, err := oto.NewContextFromOptions(&oto.Options{
+		SampleRate:     8000,
+		ChannelNum:     1,
+		BufferDuration: 100 * time.Millisecond,
+		CloseMode:      oto.ImmediateClose,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	p := c.NewPlayer()
+	defer p.Close()
+
+	// The chirp is played after the device buffer, which is filled by the Context.
+	got, err := latency.Measure(p, latency.Format{SampleRate: 8000, ChannelNum: 1, BytesPerSample: 2}, d.NewRecorder())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got < 50*time.Millisecond || got > 400*time.Millisecond {
+		t.Errorf("latency: got: %v, want: about the buffer duration 100ms", got)
+	}
+}
@@ -16,91 +16,519 @@
 package oto
 
 import (
+	"fmt"
 	"io"
+	"math"
 	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/leibnewton/oto/internal/biquad"
+	"github.com/leibnewton/oto/internal/rate"
+	"github.com/leibnewton/oto/internal/ring"
 )
 
 // Player is a PCM (pulse-code modulation) audio player.
 // Player implements io.WriteCloser.
 // Use Write method to play samples.
+//
+// Write, SetVolume, SetEQ, SetChannelMatrix, SetRate, SetPitch, Pause, Resume and Close can be called from
+// different goroutines concurrently.
 type Player struct {
 	context *Context
-	r       io.ReadCloser
-	w       io.WriteCloser
+	buf     *ring.Buffer
+	source  *playerSource
+
+	// closed is 1 after Close is called.
+	closed int32
+
+	// writeM serializes the writers, since the buffer has only one writer.
+	writeM sync.Mutex
+
+	closeM sync.Mutex
+
+	// acquired is the length of the region returned by the last AcquireBuffer that is not committed yet.
+	acquired int
+
+	// stack is where the Player was created, which is recorded only when Options.OnLeak is set.
+	stack string
 }
 
 func newPlayer(context *Context) *Player {
-	r, w := pipe()
 	p := &Player{
 		context: context,
-		r:       r,
-		w:       w,
+		buf:     ring.New(context.playerBufferSize()),
+		stack:   creationStack(context.options),
 	}
-	context.mux.AddSource(r)
-	runtime.SetFinalizer(p, (*Player).Close)
+	p.source = &playerSource{
+		buf:    p.buf,
+		id:     atomic.AddInt64(&context.playerIDs, 1),
+		volume: math.Float32bits(1),
+		gain:   1,
+		width:  math.Float32bits(1),
+		rate:   math.Float32bits(1),
+
+		interrupted: &context.interrupted,
+		mixedFrames: &context.driverWriter.stats.framesWritten,
+		outputShift: &context.driverWriter.outputShift,
+
+		meter:          newMeter(context.options.ChannelNum, nil),
+		channelNum:     context.options.ChannelNum,
+		sampleRate:     context.options.SampleRate,
+		bytesPerSample: context.options.Format.BytesPerSample(),
+		fade:           fadeState{gain: 1},
+		fadeOut:        newFadeOut(context.options),
+		rampFrames:     gainRampFrames(context.options.SampleRate),
+		drift:          driftState{level: -1},
+
+		resampleQuality: context.options.ResampleQuality.rateQuality(),
+	}
+	if context.options.ChannelNum == 2 {
+		p.source.stereo = newStereoState()
+		p.source.spatial = &spatialState{}
+	}
+	context.mux.AddSource(p.source)
+	runtime.SetFinalizer(p, (*Player).finalize)
 	return p
 }
 
+func (p *Player) finalize() {
+	reportLeak(p.context.options, "Player", p.stack)
+	p.Close()
+}
+
+// playerSource is the source of a Player for the mux.
+//
+// Read doesn't block so that the context's loop never waits for a slow Player. The volume and the
+// paused state are accessed atomically, since they are set by the Player's goroutines and read by the
+// context's loop.
+type playerSource struct {
+	// The 64-bit fields accessed atomically come first so that they are aligned on 32-bit platforms.
+
+	// startFrame is the Player's frame at which the buffer starts, which is not 0 for a Player restored by
+	// Context.Restore.
+	startFrame int64
+
+	// driftTarget is the buffer level in bytes kept by the drift compensation. 0 disables the compensation.
+	// See Player.SetDriftCompensation.
+	driftTarget int64
+	drift       driftState
+
+	// startAt is the mixed frame at which the Player scheduled by Context.StartAt starts, and scheduled is
+	// 1 until the Player starts.
+	startAt   int64
+	scheduled int32
+
+	buf *ring.Buffer
+
+	// id is the serial number of the Player in the Context.
+	id int64
+
+	// volume is the bits of the float32 gain, and gainDB is the bits of the float32 gain in decibels.
+	// rateTrim is the bits of the float32 ratio of the playback rate set by Player.SetRateTrim, and 0
+	// means 1.
+	volume   uint32
+	gainDB   uint32
+	rateTrim uint32
+	paused   int32
+	muted    int32
+
+	// interrupted points to the Context's interrupted, which pauses all the Players.
+	interrupted *int32
+
+	// mixedFrames points to the number of the frames that the Context has mixed, and progress maps the
+	// mixed frames to the Player's frames. See Player.Position.
+	mixedFrames *int64
+	progress    progress
+
+	// outputShift points to the playback rate and the pitch of the whole output applied in software.
+	outputShift *outputShift
+
+	// eq holds the *biquad.EQ of the Player, which can be nil.
+	eq atomic.Value
+
+	// loudness holds the *loudnessState of the Player, which can be nil.
+	loudness atomic.Value
+
+	effects        effectChain
+	fade           fadeState
+	matrix         channelMatrix
+	meter          *meter
+	spatial        *spatialState
+	channelNum     int
+	sampleRate     int
+	bytesPerSample int
+
+	// resampleQuality is the quality of the resampling for the playback rate and the pitch.
+	resampleQuality rate.Quality
+
+	// rate is the bits of the float32 playback rate, and pitch is the bits of the float32 pitch shift in
+	// semitones. preservePitch is 1 when the rate keeps the pitch.
+	rate          uint32
+	pitch         uint32
+	preservePitch int32
+
+	// balance and width are the bits of the float32 stereo parameters. stereo is used for stereo Contexts.
+	balance uint32
+	width   uint32
+	stereo  *stereoState
+
+	// The following fields are used only by the context's loop.
+
+	// gain is the gain for the data of the last Read. fadeOut plays the data for the gain ramp after the
+	// Player is paused, and rampFrames is the length of the ramp. played is whether any data has been
+	// played.
+	gain       float32
+	fadeOut    fadeOut
+	rampFrames int
+	played     bool
+
+	// snapGain is whether the gain for the data of the last Read is applied without a ramp, which is used
+	// for the start scheduled by Context.StartAt.
+	snapGain bool
+
+	// rateState is created when the playback rate or the pitch first differs from the default.
+	rateState *rateState
+}
+
+func (s *playerSource) Read(buf []byte) (int, error) {
+	bytesPerFrame := int64(s.channelNum * s.bytesPerSample)
+	from := s.buf.ReadBytes() / bytesPerFrame
+	// The mux is about to mix the chunk after the frames written so far.
+	out := atomic.LoadInt64(s.mixedFrames)
+	var n int
+	var err error
+	if atomic.LoadInt32(&s.scheduled) != 0 && atomic.LoadInt32(&s.paused) == 0 && atomic.LoadInt32(s.interrupted) == 0 {
+		n, err = s.readScheduled(buf, out)
+	} else {
+		n, err = s.readPaused(buf)
+	}
+	s.progress.record(out, int64(len(buf))/bytesPerFrame, from, s.buf.ReadBytes()/bytesPerFrame)
+	return n, err
+}
+
+// readPaused reads the data for the mux. Nothing is read while the Player is paused.
+func (s *playerSource) readPaused(buf []byte) (int, error) {
+	s.snapGain = false
+	if atomic.LoadInt32(&s.paused) != 0 || atomic.LoadInt32(s.interrupted) != 0 {
+		s.gain = 0
+		if s.fadeOut.done() || !s.played {
+			// Nothing is consumed while paused. The mux plays silence instead. A Player paused before
+			// playing doesn't need to fade out, and starts from its first frame, e.g. by StartSynced.
+			s.fadeOut.finish()
+			return 0, nil
+		}
+		// Play the data for the ramp while the mux ramps the gain down to 0 so that pausing doesn't click.
+		return s.read(buf[:s.fadeOut.next(len(buf))])
+	}
+	s.gain = s.targetGain()
+	s.fadeOut.reset()
+	n, err := s.read(buf)
+	if n > 0 {
+		s.played = true
+	}
+	return n, err
+}
+
+// targetGain returns the gain of the Player while it is playing.
+func (s *playerSource) targetGain() float32 {
+	if atomic.LoadInt32(&s.muted) != 0 {
+		return 0
+	}
+	return s.volume32() * s.gainDB32()
+}
+
+func (s *playerSource) volume32() float32 {
+	return math.Float32frombits(atomic.LoadUint32(&s.volume))
+}
+
+// Process implements mux.Processor.
+func (s *playerSource) Process(buf []float32) {
+	s.analyzeLoudness(buf)
+	if e, _ := s.eq.Load().(*biquad.EQ); e != nil {
+		e.Process(buf)
+	}
+	s.effects.process(buf, s.channelNum)
+	s.matrix.process(buf, s.channelNum)
+	if s.spatial == nil || !s.spatial.process(buf, s.sampleRate) {
+		if s.stereo != nil {
+			s.processStereo(buf)
+		}
+	}
+	s.fade.process(buf, s.channelNum)
+}
+
+// Monitor implements mux.Monitor.
+func (s *playerSource) Monitor(buf []float32) {
+	s.meter.Monitor(buf)
+}
+
+// Gain implements mux.Gainer. The mux ramps the gain from the previous one over a few milliseconds.
+func (s *playerSource) Gain() float32 {
+	return s.gain
+}
+
+// SnapGain implements mux.GainSnapper.
+func (s *playerSource) SnapGain() bool {
+	return s.snapGain
+}
+
+func (s *playerSource) Close() error {
+	return s.buf.CloseRead()
+}
+
 // Write writes PCM samples to the Player.
 //
 // The format is as follows:
-//   [data]      = [sample 1] [sample 2] [sample 3] ...
-//   [sample *]  = [channel 1] ...
-//   [channel *] = [byte 1] [byte 2] ...
-// Byte ordering is little endian.
 //
-// The data is first put into the Player's buffer. Once the buffer is full, Player starts playing
-// the data and empties the buffer.
+//	[data]      = [sample 1] [sample 2] [sample 3] ...
+//	[sample *]  = [channel 1] ...
+//	[channel *] = [byte 1] [byte 2] ...
+//
+// Byte ordering is little endian. The length of buf must be a multiple of the frame size, the number
+// of channels times the bytes per sample. Otherwise, Write returns an error without writing anything.
+//
+// The data is first put into the Player's buffer. The Context's loop takes the data from the buffer
+// period by period, mixes it with the other Players' data, and passes the result to the device.
+// Thus, small writes are cheap: they don't reach the device one by one, and the mixed data is passed
+// to the driver in chunks of Options.FlushFrames.
 //
 // If the supplied data doesn't fit into the Player's buffer, Write block until a sufficient amount
 // of data has been played (or at least started playing) and the remaining unplayed data fits into
 // the buffer.
 //
-// Note, that the Player won't start playing anything until the buffer is full.
+// Note, that the loop doesn't wait for the Player. If the Player's buffer doesn't have enough data
+// at a period, the lacking part is played as silence.
 func (p *Player) Write(buf []byte) (int, error) {
+	if p.isClosed() {
+		return 0, ErrPlayerClosed
+	}
+	if err := p.checkFrames("write", len(buf)); err != nil {
+		return 0, err
+	}
 	select {
 	case err := <-p.context.errCh:
 		return 0, err
 	default:
 	}
-	n, err := p.w.Write(buf)
-	// When the error is io.ErrClosedPipe, the context is already closed.
+
+	p.writeM.Lock()
+	defer p.writeM.Unlock()
+	n, err := p.buf.Write(buf)
+	return n, p.wrapError(err)
+}
+
+// ReadFrom reads PCM samples from r until EOF and writes them to the Player. ReadFrom is used by
+// io.Copy.
+//
+// Unlike Write, each Read of r doesn't have to return whole frames: a partial frame is kept until the
+// rest is read. When r ends with a partial frame, the partial frame is dropped and ReadFrom returns
+// io.ErrUnexpectedEOF.
+func (p *Player) ReadFrom(r io.Reader) (int64, error) {
+	bpf := p.context.options.bytesPerFrame()
+	buf := make([]byte, 32*1024/bpf*bpf)
+	var written int64
+	rest := 0
+	for {
+		n, err := r.Read(buf[rest:])
+		total := rest + n
+		if l := total / bpf * bpf; l > 0 {
+			m, werr := p.Write(buf[:l])
+			written += int64(m)
+			if werr != nil {
+				return written, werr
+			}
+			rest = copy(buf, buf[l:total])
+		} else {
+			rest = total
+		}
+		if err == io.EOF {
+			if rest != 0 {
+				return written, io.ErrUnexpectedEOF
+			}
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+}
+
+// SetVolume sets the volume of the Player. volume is a linear gain: 1 is the original volume and 0 is
+// silence. A negative volume or NaN is treated as 0. The default volume is 1.
+//
+// The new volume is applied from the next period, ramping from the current volume over a few
+// milliseconds so that the change doesn't click.
+func (p *Player) SetVolume(volume float64) {
+	if volume < 0 || math.IsNaN(volume) {
+		volume = 0
+	}
+	atomic.StoreUint32(&p.source.volume, math.Float32bits(float32(volume)))
+}
+
+// Volume returns the volume of the Player.
+func (p *Player) Volume() float64 {
+	return float64(p.source.volume32())
+}
+
+// SetMuted mutes or unmutes the Player. A muted Player keeps playing as silence, and its volume is kept.
+// Muting and unmuting ramp the gain like SetVolume so that they don't click.
+func (p *Player) SetMuted(muted bool) {
+	var v int32
+	if muted {
+		v = 1
+	}
+	atomic.StoreInt32(&p.source.muted, v)
+}
+
+// IsMuted reports whether the Player is muted.
+func (p *Player) IsMuted() bool {
+	return atomic.LoadInt32(&p.source.muted) != 0
+}
+
+// Pause pauses the Player. While the Player is paused, its buffered data is kept and the Player is
+// played as silence. Write blocks once the buffer is full. The sound fades out over a few milliseconds
+// before it becomes silent, and fades in at Resume.
+//
+// When all the Players are paused and the driver can pause the device, e.g. by waveOutPause on
+// Windows, the device is paused instead, keeping the data queued in it. Then the sound stops at once,
+// and Resume continues from there without draining or dropping the queued data.
+func (p *Player) Pause() {
+	p.context.updateDevicePause(p.source)
+	atomic.StoreInt32(&p.source.paused, 1)
+}
+
+// Resume resumes the Player paused by Pause.
+func (p *Player) Resume() {
+	atomic.StoreInt32(&p.source.paused, 0)
+	p.context.updateDevicePause(nil)
+}
+
+// IsPaused reports whether the Player is paused.
+func (p *Player) IsPaused() bool {
+	return atomic.LoadInt32(&p.source.paused) != 0
+}
+
+// checkFrames returns an error when n bytes are not whole frames.
+func (p *Player) checkFrames(op string, n int) error {
+	if bpf := p.context.options.bytesPerFrame(); n%bpf != 0 {
+		return fmt.Errorf("oto: %s length %d is not a multiple of the frame size %d", op, n, bpf)
+	}
+	return nil
+}
+
+func (p *Player) isClosed() bool {
+	return atomic.LoadInt32(&p.closed) != 0
+}
+
+// AcquireBuffer returns a region of the Player's buffer to write PCM samples into directly.
+// The length of the region is a multiple of the frame size and at most n. AcquireBuffer blocks until any
+// space is available in the buffer.
+//
+// The region is shorter than n when the free space of the buffer is less than n, or when the free space
+// wraps around the end of the buffer, which is a ring. In that case, only the region can be committed, and
+// the rest is acquired by calling AcquireBuffer again after CommitBuffer.
+//
+// Rendering into the region saves the copy from the caller's buffer that Write makes. The mixer still
+// reads the samples from the Player's buffer when it mixes them. The format of the samples is the same
+// as Write, and n must be a multiple of the frame size.
+//
+// The caller must call CommitBuffer with the number of written bytes before calling AcquireBuffer or
+// Write again. Unlike Write, AcquireBuffer and CommitBuffer must be called from one goroutine.
+func (p *Player) AcquireBuffer(n int) ([]byte, error) {
+	if p.isClosed() {
+		return nil, ErrPlayerClosed
+	}
+	if err := p.checkFrames("acquire", n); err != nil {
+		return nil, err
+	}
+	select {
+	case err := <-p.context.errCh:
+		return nil, err
+	default:
+	}
+	buf, err := p.buf.Acquire(n)
+	if err != nil {
+		return nil, p.wrapError(err)
+	}
+	// The reader consumes whole frames, so the free space is not expected to split a frame. Truncate the
+	// region anyway so that committing the whole region always keeps the buffer frame-aligned.
+	bpf := p.context.options.bytesPerFrame()
+	buf = buf[:len(buf)/bpf*bpf]
+	p.acquired = len(buf)
+	return buf, nil
+}
+
+// CommitBuffer makes the first n bytes of the region returned by AcquireBuffer ready to be played.
+// n must be a multiple of the frame size like Write, and must not exceed the length of the region.
+func (p *Player) CommitBuffer(n int) error {
+	if err := p.checkFrames("commit", n); err != nil {
+		return err
+	}
+	if n > p.acquired {
+		return fmt.Errorf("oto: commit length %d exceeds the acquired length %d", n, p.acquired)
+	}
+	if n > 0 && p.isClosed() {
+		return ErrPlayerClosed
+	}
+	p.acquired = 0
+	p.buf.Commit(n)
+	return nil
+}
+
+func (p *Player) wrapError(err error) error {
+	// When the error is io.ErrClosedPipe, the Player or the context is already closed.
 	if err == io.ErrClosedPipe {
+		if p.isClosed() {
+			return ErrPlayerClosed
+		}
 		select {
-		case err := <-p.context.errCh:
-			return n, err
+		case err, ok := <-p.context.errCh:
+			if ok {
+				return err
+			}
 		default:
 		}
+		return ErrContextClosed
 	}
-	return n, err
+	return err
 }
 
 // Close closes the Player and frees any resources associated with it. The Player is no longer
-// usable after calling Close.
+// usable after calling Close. Close can be called more than once.
+//
+// Write-ing in other goroutines fails with ErrPlayerClosed.
 func (p *Player) Close() error {
+	p.closeM.Lock()
+	defer p.closeM.Unlock()
+
 	runtime.SetFinalizer(p, nil)
 
 	// Already closed
-	if p.context == nil {
+	if p.isClosed() {
 		return nil
 	}
+	atomic.StoreInt32(&p.closed, 1)
 
-	select {
-	case err := <-p.context.errCh:
+	// Close the buffer writer before RemoveSource so that Write-ing in other goroutines fails.
+	if err := p.buf.CloseWrite(); err != nil {
 		return err
-	default:
 	}
 
-	// Close the pipe writer before RemoveSource, or Read-ing in the mux takes forever.
-	if err := p.w.Close(); err != nil {
+	p.context.mux.RemoveSource(p.source)
+	p.context.updateDevicePause(nil)
+
+	// Close the buffer reader after RemoveSource, or ErrClosedPipe happens at Read-ing in the mux.
+	if err := p.source.Close(); err != nil {
 		return err
 	}
 
-	p.context.mux.RemoveSource(p.r)
-	p.context = nil
-
-	// Close the pipe reader after RemoveSource, or ErrClosedPipe happens at Read-ing.
-	return p.r.Close()
+	select {
+	case err := <-p.context.errCh:
+		return err
+	default:
+	}
+	return nil
 }
 
 func max(a, b int) int {
@@ -0,0 +1,2590 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/leibnewton/oto"
+	"github.com/leibnewton/oto/driver"
+	"github.com/leibnewton/oto/ototest"
+	"github.com/leibnewton/oto/shmring"
+)
+
+func newDummyContext(t *testing.T) *oto.Context {
+	c, err := oto.NewContextFromOptions(&oto.Options{
+		Driver:            "dummy",
+		SampleRate:        44100,
+		ChannelNum:        2,
+		Format:            oto.FormatSignedInt16LE,
+		BufferSizeInBytes: 4096,
+		CloseMode:         oto.ImmediateClose,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// TestPlayerConcurrently calls the Player's methods from different goroutines. Run this with -race.
+func TestPlayerConcurrently(t *testing.T) {
+	c := newDummyContext(t)
+	defer c.Close()
+
+	p := c.NewPlayer()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, 400)
+			for {
+				if _, err := p.Write(buf); err != nil {
+					if err != oto.ErrPlayerClosed && err != oto.ErrContextClosed {
+						t.Error(err)
+					}
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				p.SetVolume(float64(j) / 100)
+				if j%2 == 0 {
+					p.Pause()
+				} else {
+					p.Resume()
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := p.Close(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// TestCloseConcurrently closes the Context and its Players at the same time.
+func TestCloseConcurrently(t *testing.T) {
+	c := newDummyContext(t)
+
+	var ps []*oto.Player
+	for i := 0; i < 4; i++ {
+		ps = append(ps, c.NewPlayer())
+	}
+
+	var wg sync.WaitGroup
+	for _, p := range ps {
+		p := p
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, 400)
+			for {
+				if _, err := p.Write(buf); err != nil {
+					return
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			time.Sleep(10 * time.Millisecond)
+			p.Close()
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			time.Sleep(10 * time.Millisecond)
+			if err := c.Close(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestWriteMisaligned(t *testing.T) {
+	c := newDummyContext(t)
+	defer c.Close()
+
+	p := c.NewPlayer()
+	defer p.Close()
+
+	n, err := p.Write(make([]byte, 1023))
+	if err == nil {
+		t.Fatal("Write(1023 bytes) must fail")
+	}
+	if n != 0 {
+		t.Errorf("n: got: %d, want: 0", n)
+	}
+	if got, want := err.Error(), "oto: write length 1023 is not a multiple of the frame size 4"; got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+}
+
+func TestInvalidOptions(t *testing.T) {
+	cases := []oto.Options{
+		{SampleRate: 100},
+		{SampleRate: 1000000},
+		{ChannelNum: 3},
+		{BufferSizeInBytes: 1023},
+		{BufferDuration: time.Minute},
+		{ALSAAccess: oto.ALSAAccessDmix + 1},
+		{DeviceCrossfade: -time.Millisecond},
+	}
+	for _, o := range cases {
+		o.Driver = "dummy"
+		if c, err := oto.NewContextFromOptions(&o); err == nil {
+			c.Close()
+			t.Errorf("NewContextFromOptions(%+v) must fail", o)
+		}
+	}
+}
+
+func TestPlayerLeak(t *testing.T) {
+	leaks := make(chan oto.Leak, 1)
+	c, err := oto.NewContextFromOptions(&oto.Options{
+		Driver:    "dummy",
+		CloseMode: oto.ImmediateClose,
+		OnLeak: func(l oto.Leak) {
+			leaks <- l
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// The Player is not closed.
+	c.NewPlayer()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		runtime.GC()
+		select {
+		case l := <-leaks:
+			if l.Kind != "Player" {
+				t.Errorf("Kind: got: %q, want: %q", l.Kind, "Player")
+			}
+			if !strings.Contains(l.Stack, "TestPlayerLeak") {
+				t.Errorf("the stack must contain the creator:\n%s", l.Stack)
+			}
+			return
+		case <-timeout:
+			t.Fatal("the leak was not reported")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestContextLeak(t *testing.T) {
+	d := ototest.NewVirtualDriver()
+	defer oto.SetDriverForTesting(d.Open)()
+
+	leaks := make(chan oto.Leak, 1)
+	options := &oto.Options{
+		CloseMode: oto.ImmediateClose,
+		OnLeak: func(l oto.Leak) {
+			leaks <- l
+		},
+	}
+	// The Context is not closed.
+	func() {
+		if _, err := oto.NewContextFromOptions(options); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		runtime.GC()
+		select {
+		case l := <-leaks:
+			if l.Kind != "Context" {
+				t.Errorf("Kind: got: %q, want: %q", l.Kind, "Context")
+			}
+			if !strings.Contains(l.Stack, "TestContextLeak") {
+				t.Errorf("the stack must contain the creator:\n%s", l.Stack)
+			}
+			// The leaked Context is closed, so a new Context can be created.
+			c, err := oto.NewContextFromOptions(options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.Close()
+			return
+		case <-timeout:
+			t.Fatal("the leak was not reported")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// unalignedReader returns 3 bytes at most at each Read.
+type unalignedReader struct {
+	r io.Reader
+}
+
+func (u *unalignedReader) Read(buf []byte) (int, error) {
+	if len(buf) > 3 {
+		buf = buf[:3]
+	}
+	return u.r.Read(buf)
+}
+
+func TestCopyUnaligned(t *testing.T) {
+	c := newDummyContext(t)
+	defer c.Close()
+
+	p := c.NewPlayer()
+	defer p.Close()
+
+	n, err := io.Copy(p, &unalignedReader{r: bytes.NewReader(make([]byte, 1000))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1000 {
+		t.Errorf("n: got: %d, want: 1000", n)
+	}
+
+	// The last partial frame is dropped.
+	n, err = io.Copy(p, &unalignedReader{r: bytes.NewReader(make([]byte, 1001))})
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("err: got: %v, want: %v", err, io.ErrUnexpectedEOF)
+	}
+	if n != 1000 {
+		t.Errorf("n: got: %d, want: 1000", n)
+	}
+}
+
+func TestWriteAfterClose(t *testing.T) {
+	c := newDummyContext(t)
+	defer c.Close()
+
+	p := c.NewPlayer()
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Write(make([]byte, 4)); err != oto.ErrPlayerClosed {
+		t.Errorf("Write: got: %v, want: %v", err, oto.ErrPlayerClosed)
+	}
+	if _, err := p.AcquireBuffer(4); err != oto.ErrPlayerClosed {
+		t.Errorf("AcquireBuffer: got: %v, want: %v", err, oto.ErrPlayerClosed)
+	}
+}
+
+type recordingDriver struct {
+	params  driver.Params
+	written chan int
+}
+
+func (d *recordingDriver) TryWrite(data []byte) (int, error) {
+	time.Sleep(10 * time.Millisecond)
+	select {
+	case d.written <- len(data):
+	default:
+	}
+	return len(data), nil
+}
+
+func (d *recordingDriver) Close() error {
+	return nil
+}
+
+func TestRegisteredDriver(t *testing.T) {
+	d := &recordingDriver{written: make(chan int, 1)}
+	driver.Register("test-recording", func(params driver.Params) (driver.Driver, error) {
+		d.params = params
+		return d, nil
+	})
+
+	c, err := oto.NewContextFromOptions(&oto.Options{
+		Driver:            "test-recording",
+		SampleRate:        48000,
+		ChannelNum:        1,
+		BufferSizeInBytes: 4800,
+		CloseMode:         oto.ImmediateClose,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if got, want := c.Driver(), "test-recording"; got != want {
+		t.Errorf("Driver(): got: %q, want: %q", got, want)
+	}
+	want := driver.Params{
+		SampleRate:     48000,
+		ChannelNum:     1,
+		BytesPerSample: 2,
+		BufferFrames:   2400,
+		Device:         -1,
+	}
+	if d.params != want {
+		t.Errorf("params: got: %+v, want: %+v", d.params, want)
+	}
+
+	select {
+	case <-d.written:
+	case <-time.After(5 * time.Second):
+		t.Errorf("the driver was not written")
+	}
+}
+
+func TestDriverFallback(t *testing.T) {
+	driver.Register("test-broken", func(params driver.Params) (driver.Driver, error) {
+		return nil, oto.ErrNoDevice
+	})
+	d := &recordingDriver{written: make(chan int, 1)}
+	driver.Register("test-fallback", func(params driver.Params) (driver.Driver, error) {
+		d.params = params
+		return d, nil
+	})
+
+	c, err := oto.NewContextFromOptions(&oto.Options{
+		Drivers:           []string{"test-unknown", "test-broken", "test-fallback"},
+		BufferSizeInBytes: 4096,
+		CloseMode:         oto.ImmediateClose,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if got, want := c.Driver(), "test-fallback"; got != want {
+		t.Errorf("Driver(): got: %q, want: %q", got, want)
+	}
+	attempts := c.DriverAttempts()
+	if len(attempts) != 1 || attempts[0].Driver != "test-broken" || attempts[0].Err != oto.ErrNoDevice {
+		t.Errorf("DriverAttempts(): got: %+v, want: test-broken with ErrNoDevice", attempts)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = oto.NewContextFromOptions(&oto.Options{Drivers: []string{"test-broken"}})
+	if err == nil {
+		t.Fatal("NewContextFromOptions must fail when all the drivers fail")
+	}
+	if !strings.Contains(err.Error(), "test-broken") {
+		t.Errorf("err: got: %v, want: the reason of test-broken", err)
+	}
+
+	if _, err := oto.NewContextFromOptions(&oto.Options{Drivers: []string{"test-unknown"}}); err == nil {
+		t.Error("NewContextFromOptions must fail when no driver is available")
+	}
+}
+
+type pausingDriver struct {
+	recordingDriver
+	pauses   int32
+	restarts int32
+}
+
+func (d *pausingDriver) Pause() error {
+	atomic.AddInt32(&d.pauses, 1)
+	return nil
+}
+
+func (d *pausingDriver) Restart() error {
+	atomic.AddInt32(&d.restarts, 1)
+	return nil
+}
+
+func TestDevicePause(t *testing.T) {
+	d := &pausingDriver{recordingDriver: recordingDriver{written: make(chan int, 1)}}
+	driver.Register("test-pausing", func(params driver.Params) (driver.Driver, error) {
+		return d, nil
+	})
+
+	c, err := oto.NewContextFromOptions(&oto.Options{
+		Driver:            "test-pausing",
+		BufferSizeInBytes: 4096,
+		CloseMode:         oto.ImmediateClose,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	<-d.written
+
+	p0 := c.NewPlayer()
+	defer p0.Close()
+	p1 := c.NewPlayer()
+	defer p1.Close()
+
+	// The device is paused only when all the Players are paused.
+	p0.Pause()
+	if got := atomic.LoadInt32(&d.pauses); got != 0 {
+		t.Errorf("pauses: got: %d, want: 0", got)
+	}
+	p1.Pause()
+	if got := atomic.LoadInt32(&d.pauses); got != 1 {
+		t.Errorf("pauses: got: %d, want: 1", got)
+	}
+	p0.Resume()
+	if got := atomic.LoadInt32(&d.restarts); got != 1 {
+		t.Errorf("restarts: got: %d, want: 1", got)
+	}
+	if !p1.IsPaused() {
+		t.Error("p1 must still be paused")
+	}
+}
+
+type removingDriver struct {
+	recordingDriver
+	removed int32
+}
+
+func (d *removingDriver) DeviceRemoved() bool {
+	return atomic.CompareAndSwapInt32(&d.removed, 1, 0)
+}
+
+func TestDeviceRemoved(t *testing.T) {
+	d := &removingDriver{recordingDriver: recordingDriver{written: make(chan int, 1)}}
+	var opens int32
+	driver.Register("test-removing", func(params driver.Params) (driver.Driver, error) {
+		atomic.AddInt32(&opens, 1)
+		return d, nil
+	})
+
+	c, err := oto.NewContextFromOptions(&oto.Options{
+		Driver:            "test-removing",
+		BufferSizeInBytes: 4096,
+		CloseMode:         oto.ImmediateClose,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	<-d.written
+
+	// The driver is reopened without any failed writes.
+	atomic.StoreInt32(&d.removed, 1)
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&opens) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("the driver was not reopened after the device was removed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := c.Stats().DeviceRestarts; got != 1 {
+		t.Errorf("DeviceRestarts: got: %d, want: 1", got)
+	}
+}
+
+func TestSetDevice(t *testing.T) {
+	d := &recordingDriver{written: make(chan int, 1)}
+	devices := make(chan int, 2)
+	driver.Register("test-moving", func(params driver.Params) (driver.Driver, error) {
+		devices <- params.Device
+		return d, nil
+	})
+
+	c, err := oto.NewContextFromOptions(&oto.Options{
+		Driver:            "test-moving",
+		BufferSizeInBytes: 4096,
+		CloseMode:         oto.ImmediateClose,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if got := <-devices; got != -1 {
+		t.Errorf("device: got: %d, want: -1", got)
+	}
+
+	p := c.NewPlayer()
+	defer p.Close()
+	if err := p.SetDevice(&oto.Device{Number: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-devices; got != 3 {
+		t.Errorf("device: got: %d, want: 3", got)
+	}
+	if got := c.Stats().DeviceRestarts; got != 1 {
+		t.Errorf("DeviceRestarts: got: %d, want: 1", got)
+	}
+}
+
+type closingDriver struct {
+	recordingDriver
+	closed chan struct{}
+}
+
+func (d *closingDriver) Close() error {
+	close(d.closed)
+	return nil
+}
+
+func TestDeviceCrossfade(t *testing.T) {
+	drivers := make(chan *closingDriver, 2)
+	driver.Register("test-crossfading", func(params driver.Params) (driver.Driver, error) {
+		d := &closingDriver{
+			recordingDriver: recordingDriver{params: params, written: make(chan int, 1)},
+			closed:          make(chan struct{}),
+		}
+		drivers <- d
+		return d, nil
+	})
+
+	c, err := oto.NewContextFromOptions(&oto.Options{
+		Driver:            "test-crossfading",
+		BufferSizeInBytes: 4096,
+		DeviceCrossfade:   50 * time.Millisecond,
+		CloseMode:         oto.ImmediateClose,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	old := <-drivers
+
+	if err := c.SetDevice(&oto.Device{Number: 2}); err != nil {
+		t.Fatal(err)
+	}
+	d := <-drivers
+	if got := d.params.Device; got != 2 {
+		t.Errorf("device: got: %d, want: 2", got)
+	}
+	// The old device is closed after the crossfade, while the new device is playing.
+	select {
+	case <-old.closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the old device was not closed")
+	}
+	select {
+	case <-d.closed:
+		t.Error("the new device must not be closed")
+	default:
+	}
+}
+
+func TestBusyRetry(t *testing.T) {
+	var opens int
+	driver.Register("test-busy", func(params driver.Params) (driver.Driver, error) {
+		opens++
+		if opens <= 3 {
+			return nil, oto.ErrDeviceBusy
+		}
+		return &recordingDriver{written: make(chan int, 1)}, nil
+	})
+
+	var attempts []int
+	start := time.Now()
+	c, err := oto.NewContextFromOptions(&oto.Options{
+		Driver:            "test-busy",
+		BufferSizeInBytes: 4096,
+		CloseMode:         oto.ImmediateClose,
+		BusyRetryTimeout:  5 * time.Second,
+		OnDeviceBusy: func(attempt int, err error) {
+			if err != oto.ErrDeviceBusy {
+				t.Errorf("OnDeviceBusy: got: %v, want: %v", err, oto.ErrDeviceBusy)
+			}
+			attempts = append(attempts, attempt)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	if got, want := fmt.Sprint(attempts), "[1 2 3]"; got != want {
+		t.Errorf("attempts: got: %s, want: %s", got, want)
+	}
+	// The retries wait 50ms, 100ms and 200ms.
+	if d := time.Since(start); d < 350*time.Millisecond {
+		t.Errorf("the retries took %v, want: >= 350ms", d)
+	}
+
+	// The device stays busy beyond the deadline.
+	opens = -100
+	start = time.Now()
+	_, err = oto.NewContextFromOptions(&oto.Options{
+		Driver:           "test-busy",
+		BusyRetryTimeout: 300 * time.Millisecond,
+	})
+	if err != oto.ErrDeviceBusy {
+		t.Errorf("NewContextFromOptions: got: %v, want: %v", err, oto.ErrDeviceBusy)
+	}
+	// The retries wait 50ms and 100ms, and give up before waiting 200ms beyond the deadline.
+	if d := time.Since(start); d < 150*time.Millisecond || d > 300*time.Millisecond {
+		t.Errorf("the retries took %v, want: in [150ms, 300ms]", d)
+	}
+}
+
+// stallingDriver stops consuming the data after the first write when stall is true.
+type stallingDriver struct {
+	stall  bool
+	writes int32
+}
+
+func (d *stallingDriver) TryWrite(data []byte) (int, error) {
+	if atomic.AddInt32(&d.writes, 1) > 1 && d.stall {
+		return 0, nil
+	}
+	time.Sleep(time.Millisecond)
+	return len(data), nil
+}
+
+func (d *stallingDriver) Close() error {
+	return nil
+}
+
+func TestStall(t *testing.T) {
+	for _, reopen := range []bool{false, true} {
+		t.Run(fmt.Sprintf("reopen=%t", reopen), func(t *testing.T) {
+			var drivers []*stallingDriver
+			var m sync.Mutex
+			name := fmt.Sprintf("test-stall-%t", reopen)
+			driver.Register(name, func(params driver.Params) (driver.Driver, error) {
+				m.Lock()
+				defer m.Unlock()
+				// Only the first driver stalls.
+				d := &stallingDriver{stall: len(drivers) == 0}
+				drivers = append(drivers, d)
+				return d, nil
+			})
+
+			c, err := oto.NewContextFromOptions(&oto.Options{
+				Driver:            name,
+				BufferSizeInBytes: 4096,
+				CloseMode:         oto.ImmediateClose,
+				StallPeriods:      4,
+				ReopenOnStall:     reopen,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+
+			p := c.NewPlayer()
+			defer p.Close()
+
+			errCh := make(chan error, 1)
+			go func() {
+				buf := make([]byte, 400)
+				deadline := time.Now().Add(time.Second)
+				for time.Now().Before(deadline) {
+					if _, err := p.Write(buf); err != nil {
+						errCh <- err
+						return
+					}
+				}
+				errCh <- nil
+			}()
+			var werr error
+			select {
+			case werr = <-errCh:
+			case <-time.After(5 * time.Second):
+				t.Fatal("Write blocked")
+			}
+
+			m.Lock()
+			defer m.Unlock()
+			if reopen {
+				if werr != nil {
+					t.Errorf("Write: %v", werr)
+				}
+				if len(drivers) != 2 {
+					t.Fatalf("the driver was opened %d times, want: 2", len(drivers))
+				}
+				if got := c.Stats().DeviceRestarts; got != 1 {
+					t.Errorf("DeviceRestarts: got: %d, want: 1", got)
+				}
+				if atomic.LoadInt32(&drivers[1].writes) == 0 {
+					t.Errorf("the reopened driver was not written")
+				}
+				return
+			}
+			if werr != oto.ErrDeviceStalled {
+				t.Errorf("Write: got: %v, want: %v", werr, oto.ErrDeviceStalled)
+			}
+			if len(drivers) != 1 {
+				t.Errorf("the driver was opened %d times, want: 1", len(drivers))
+			}
+		})
+	}
+}
+
+// blockingDriver blocks in TryWrite after the first write when blockWrite is true, and blocks in Close,
+// until release is closed.
+type blockingDriver struct {
+	blockWrite bool
+	writes     int32
+	release    chan struct{}
+}
+
+func (d *blockingDriver) TryWrite(data []byte) (int, error) {
+	if d.blockWrite && atomic.AddInt32(&d.writes, 1) > 1 {
+		<-d.release
+	}
+	time.Sleep(time.Millisecond)
+	return len(data), nil
+}
+
+func (d *blockingDriver) Close() error {
+	<-d.release
+	return nil
+}
+
+func TestCloseTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	for _, tc := range []struct {
+		name       string
+		blockWrite bool
+		stage      string
+	}{
+		{"close", false, "closing the device"},
+		{"write", true, "waiting for the write to the device in progress"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d := &blockingDriver{blockWrite: tc.blockWrite, release: release}
+			driver.Register("test-blocking-"+tc.name, func(params driver.Params) (driver.Driver, error) {
+				return d, nil
+			})
+
+			c, err := oto.NewContextFromOptions(&oto.Options{
+				Driver:            "test-blocking-" + tc.name,
+				BufferSizeInBytes: 4096,
+				CloseMode:         oto.ImmediateClose,
+				CloseTimeout:      200 * time.Millisecond,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(50 * time.Millisecond)
+
+			start := time.Now()
+			err = c.Close()
+			if d := time.Since(start); d > time.Second {
+				t.Errorf("Close took %v", d)
+			}
+			if e, ok := err.(interface{ Is(error) bool }); !ok || !e.Is(oto.ErrCloseTimeout) {
+				t.Fatalf("Close: got: %v, want: %v", err, oto.ErrCloseTimeout)
+			}
+			if !strings.Contains(err.Error(), tc.stage) {
+				t.Errorf("Close: got: %v, want: the error including %q", err, tc.stage)
+			}
+		})
+	}
+}
+
+// lostDriver reports that the device is lost at the first write.
+type lostDriver struct{}
+
+func (lostDriver) TryWrite(data []byte) (int, error) {
+	return 0, oto.ErrDeviceLost
+}
+
+func (lostDriver) Close() error {
+	return nil
+}
+
+func TestCloseWhileReopening(t *testing.T) {
+	var opens int32
+	retrying := make(chan struct{})
+	driver.Register("test-lost", func(params driver.Params) (driver.Driver, error) {
+		switch atomic.AddInt32(&opens, 1) {
+		case 1:
+			return lostDriver{}, nil
+		case 3:
+			close(retrying)
+		}
+		return nil, fmt.Errorf("the device is not back yet")
+	})
+
+	c, err := oto.NewContextFromOptions(&oto.Options{
+		Driver:            "test-lost",
+		BufferSizeInBytes: 4096,
+		CloseMode:         oto.ImmediateClose,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-retrying:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the driver was not reopened")
+	}
+
+	// The reopen retries for 10 seconds, which must block neither Stats nor Close.
+	start := time.Now()
+	if got := c.Stats().DeviceRestarts; got != 1 {
+		t.Errorf("DeviceRestarts: got: %d, want: 1", got)
+	}
+	if err := c.Close(); err != nil {
+		t.Error(err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Close took %v while reopening", d)
+	}
+	n := atomic.LoadInt32(&opens)
+	time.Sleep(200 * time.Millisecond)
+	if got := atomic.LoadInt32(&opens); got != n {
+		t.Errorf("the driver was opened %d times after Close", got-n)
+	}
+}
+
+func TestCloseMode(t *testing.T) {
+	for _, mode := range []oto.CloseMode{oto.DrainThenClose, oto.ImmediateClose} {
+		t.Run(mode.String(), func(t *testing.T) {
+			d := ototest.NewVirtualDriver()
+			defer oto.SetDriverForTesting(d.Open)()
+
+			c, err := oto.NewContextFromOptions(&oto.Options{
+				BufferSizeInBytes: 4096,
+				CloseMode:         mode,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Fill the device buffer with silence first, so that the Player's data is in the Player's
+			// buffer at Close.
+			d.Advance(0)
+			p := c.NewPlayer()
+			defer p.Close()
+			data := bytes.Repeat([]byte{1}, 4096)
+			if _, err := p.Write(data); err != nil {
+				t.Fatal(err)
+			}
+
+			// Draining needs the device to play. Without draining, nothing is played after Close starts.
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				if mode != oto.DrainThenClose {
+					return
+				}
+				for d.IsOpened() {
+					d.Advance(10 * time.Millisecond)
+				}
+			}()
+			if err := c.Close(); err != nil {
+				t.Fatal(err)
+			}
+			<-done
+
+			played := 0
+			for _, b := range d.Bytes() {
+				if b != 0 {
+					played++
+				}
+			}
+			if mode == oto.DrainThenClose && played != len(data) {
+				t.Errorf("played bytes: got: %d, want: %d", played, len(data))
+			}
+			if mode == oto.ImmediateClose && played != 0 {
+				t.Errorf("played bytes: got: %d, want: 0", played)
+			}
+		})
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	options := &oto.Options{
+		Driver:            "dummy",
+		SampleRate:        48000,
+		ChannelNum:        2,
+		BufferSizeInBytes: 4096,
+		CloseMode:         oto.ImmediateClose,
+	}
+	c, err := oto.NewContextFromOptions(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := c.NewPlayer()
+	p.Pause()
+	p.SetVolume(0.5)
+	p.SetRate(1.5)
+	if _, err := p.Write(make([]byte, 4000)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The state at closing is kept.
+	s := c.Snapshot()
+	if got := len(s.Players); got != 1 {
+		t.Fatalf("len(Players): got: %d, want: 1", got)
+	}
+	st := s.Players[0]
+	if !st.Paused || st.Volume != 0.5 || st.Rate != 1.5 {
+		t.Errorf("state: got: %+v", st)
+	}
+	if got, want := st.Position, oto.FramesToDuration((4000-len(st.Pending))/4, 48000); got != want {
+		t.Errorf("Position: got: %v, want: %v", got, want)
+	}
+
+	c, err = oto.NewContextFromOptions(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ps, err := c.Restore(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ps[0].IsPaused() || ps[0].Volume() != 0.5 || ps[0].Rate() != 1.5 {
+		t.Errorf("the restored Player doesn't have the state")
+	}
+	if got := ps[0].Position(); got < st.Position {
+		t.Errorf("Position(): got: %v, want: >= %v", got, st.Position)
+	}
+
+	s.SampleRate = 44100
+	if _, err := c.Restore(s); err == nil {
+		t.Errorf("Restore with a different format must return an error")
+	}
+}
+
+func TestVoicePool(t *testing.T) {
+	c, err := oto.NewContextFromOptions(&oto.Options{
+		Driver:            "dummy",
+		BufferSizeInBytes: 4096,
+		CloseMode:         oto.ImmediateClose,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if _, err := c.NewVoicePool(0, oto.StealOldest); err == nil {
+		t.Errorf("NewVoicePool with no voices must return an error")
+	}
+	pool, err := c.NewVoicePool(2, oto.StealLowestPriority)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	// The sounds are long enough not to finish during the test.
+	data := make([]byte, 44100*4*10)
+	v1, err := pool.Play(data, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2, err := pool.Play(data, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v3, err := pool.Play(data, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v1.IsPlaying() || v2.IsPlaying() || !v3.IsPlaying() {
+		t.Errorf("the voice with the lowest priority must be stolen")
+	}
+	if got := pool.Playing(); got != 2 {
+		t.Errorf("Playing(): got: %d, want: 2", got)
+	}
+	if _, err := pool.Play(data, 1, 0); err != oto.ErrVoiceLimit {
+		t.Errorf("Play with a lower priority: got: %v, want: %v", err, oto.ErrVoiceLimit)
+	}
+
+	// A finished voice frees its slot.
+	v1.Stop()
+	short, err := pool.Play(make([]byte, 4), 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for short.IsPlaying() || pool.Playing() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("the short voice didn't finish")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestVoicePoolPlayWhileClosing(t *testing.T) {
+	c, err := oto.NewContextFromOptions(&oto.Options{
+		Driver:            "dummy",
+		BufferSizeInBytes: 4096,
+		CloseMode:         oto.ImmediateClose,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool, err := c.NewVoicePool(4, oto.StealOldest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Play racing with Close must not add a voice to the closed mixer.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				if _, err := pool.Play(make([]byte, 4), 1, 0); err == oto.ErrContextClosed {
+					return
+				} else if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	if err := c.Close(); err != nil {
+		t.Error(err)
+	}
+	wg.Wait()
+}
+
+func TestStartSynced(t *testing.T) {
+	d := &recordingDriver{written: make(chan int, 1)}
+	driver.Register("test-synced", func(params driver.Params) (driver.Driver, error) {
+		return d, nil
+	})
+
+	c, err := oto.NewContextFromOptions(&oto.Options{
+		Driver:            "test-synced",
+		BufferSizeInBytes: 4096,
+		CloseMode:         oto.ImmediateClose,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	p1 := c.NewPlayer()
+	p2 := c.NewPlayer()
+	defer p1.Close()
+	defer p2.Close()
+	if err := c.StartSynced(p1, p2); err == nil {
+		t.Errorf("StartSynced with playing Players must return an error")
+	}
+	p1.Pause()
+	p2.Pause()
+	if _, err := p1.Write(make([]byte, 4096)); err != nil {
+		t.Fatal(err)
+	}
+	// The paused Players don't consume any data before they start.
+	time.Sleep(50 * time.Millisecond)
+	if _, err := p2.Write(make([]byte, 4096)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.StartSynced(p1, p2); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for p1.Position() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the Players didn't start")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// Compare the positions while the device doesn't progress between the calls.
+	for {
+		pos1, pos2 := p1.Position(), p2.Position()
+		if p1.Position() != pos1 {
+			continue
+		}
+		if pos1 != pos2 {
+			t.Errorf("Position(): got: %v and %v, want: the same positions", pos1, pos2)
+		}
+		break
+	}
+}
+
+func TestDriftCompensation(t *testing.T) {
+	d := &recordingDriver{written: make(chan int, 1)}
+	driver.Register("test-drift", func(params driver.Params) (driver.Driver, error) {
+		return d, nil
+	})
+
+	c, err := oto.NewContextFromOptions(&oto.Options{
+		Driver:            "test-drift",
+		BufferSizeInBytes: 4096,
+		CloseMode:         oto.ImmediateClose,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	p := c.NewPlayer()
+	defer p.Close()
+	if got := p.DriftCorrection(); got != 1 {
+		t.Errorf("DriftCorrection() before enabling: got: %v, want: 1", got)
+	}
+	p.SetDriftCompensation(time.Millisecond)
+	// The buffer is much fuller than the target, so the Player plays faster.
+	if _, err := p.Write(make([]byte, 4096)); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for p.DriftCorrection() == 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("the drift was not compensated")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := p.DriftCorrection(); got <= 1 || got > 1.005 {
+		t.Errorf("DriftCorrection(): got: %v, want: in (1, 1.005]", got)
+	}
+}
+
+func TestStartAt(t *testing.T) {
+	d := &recordingDriver{written: make(chan int, 1)}
+	driver.Register("test-scheduled", func(params driver.Params) (driver.Driver, error) {
+		return d, nil
+	})
+
+	c, err := oto.NewContextFromOptions(&oto.Options{
+		Driver:            "test-scheduled",
+		BufferSizeInBytes: 4096,
+		CloseMode:         oto.ImmediateClose,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	p := c.NewPlayer()
+	defer p.Close()
+	p.SetRateTrim(100)
+	if got := p.RateTrim(); math.Abs(got-100) > 1 {
+		t.Errorf("RateTrim(): got: %v, want: 100", got)
+	}
+	p.SetRateTrim(0)
+	p.Pause()
+	if _, err := p.Write(make([]byte, 4096)); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if err := c.StartAt(now.Add(200*time.Millisecond), p); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for p.Position() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the Player didn't start")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// The test driver consumes the data faster than the real time, so the Player starts a little early.
+	if d := time.Since(now); d < 80*time.Millisecond {
+		t.Errorf("the Player started %v after StartAt, want: about 200ms", d)
+	}
+}
+
+func TestStartAtFullGain(t *testing.T) {
+	d := ototest.NewVirtualDriver()
+	defer oto.SetDriverForTesting(d.Open)()
+
+	c, err := oto.NewContextFromOptions(&oto.Options{
+		SampleRate:        48000,
+		ChannelNum:        1,
+		BufferSizeInBytes: 4800,
+		FlushFrames:       480,
+		CloseMode:         oto.ImmediateClose,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	d.Advance(0)
+
+	p := c.NewPlayer()
+	defer p.Close()
+	p.Pause()
+	// 1000 in signed 16bit little endian.
+	if _, err := p.Write(bytes.Repeat([]byte{0xe8, 0x03}, 2400)); err != nil {
+		t.Fatal(err)
+	}
+	// StartAt reads the clock, which waits for the write blocked until the virtual clock advances.
+	started := make(chan error, 1)
+	go func() {
+		started <- c.StartAt(time.Now(), p)
+	}()
+	for done := false; !done; {
+		select {
+		case err := <-started:
+			if err != nil {
+				t.Fatal(err)
+			}
+			done = true
+		default:
+			d.Advance(10 * time.Millisecond)
+		}
+	}
+	for i := 0; i < 5; i++ {
+		d.Advance(10 * time.Millisecond)
+	}
+
+	// The gain doesn't ramp from the silence before the start.
+	data := d.Bytes()
+	i := 0
+	for i < len(data) && data[i] == 0 && data[i+1] == 0 {
+		i += 2
+	}
+	if i == len(data) {
+		t.Fatal("the Player didn't start")
+	}
+	if got, want := int16(data[i])|int16(data[i+1])<<8, int16(1000); got != want {
+		t.Errorf("the first frame: got: %d, want: %d", got, want)
+	}
+}
+
+func TestIPCPlayer(t *testing.T) {
+	d := &recordingDriver{written: make(chan int, 1)}
+	driver.Register("test-ipc", func(params driver.Params) (driver.Driver, error) {
+		return d, nil
+	})
+
+	c, err := oto.NewContextFromOptions(&oto.Options{
+		Driver:            "test-ipc",
+		BufferSizeInBytes: 4096,
+		CloseMode:         oto.ImmediateClose,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	name := fmt.Sprintf("oto-ipc-test-%d", os.Getpid())
+	p, err := c.NewIPCPlayer(name, 0)
+	if err != nil {
+		t.Skipf("shared memory is not available: %v", err)
+	}
+	defer p.Close()
+	if p.Connected() {
+		t.Errorf("Connected() before the writer opens the ring: got: true, want: false")
+	}
+
+	// The writer is usually another process.
+	w, err := shmring.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if got, want := w.Format(), (shmring.Format{SampleRate: 44100, ChannelNum: 2, BytesPerSample: 2}); got != want {
+		t.Errorf("Format(): got: %+v, want: %+v", got, want)
+	}
+	if !p.Connected() {
+		t.Errorf("Connected() after the writer opens the ring: got: false, want: true")
+	}
+	if _, err := w.Write(make([]byte, 16384)); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for w.Len() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the data in the ring was not played")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(make([]byte, 4)); err != shmring.ErrClosed {
+		t.Errorf("Write after Close: got: %v, want: %v", err, shmring.ErrClosed)
+	}
+}
+
+func TestSharedContext(t *testing.T) {
+	options := &oto.Options{
+		Driver:            "dummy",
+		BufferSizeInBytes: 4096,
+		CloseMode:         oto.ImmediateClose,
+	}
+	r0, err := oto.SharedContext(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r1, err := oto.SharedContext(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r0.Context() != r1.Context() {
+		t.Errorf("SharedContext must return the same Context")
+	}
+	if _, err := oto.SharedContext(&oto.Options{SampleRate: 48000}); err == nil {
+		t.Errorf("SharedContext with a different format must return an error")
+	}
+
+	// Closing a reference twice must not release the other reference.
+	if err := r0.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r0.Close(); err != nil {
+		t.Fatal(err)
+	}
+	p := r1.Context().NewPlayer()
+	if _, err := p.Write(make([]byte, 400)); err != nil {
+		t.Errorf("Write after closing the other reference: %v", err)
+	}
+	p.Close()
+
+	if err := r1.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// The shared Context is closed, and a new Context can be created.
+	c := newDummyContext(t)
+	c.Close()
+}
+
+func TestSharedContextWithNilOptions(t *testing.T) {
+	d := ototest.NewDriver()
+	defer oto.SetDriverForTesting(d.Open)()
+
+	r, err := oto.SharedContext(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := r.Context().DeviceFormat().SampleRate, 44100; got != want {
+		t.Errorf("SampleRate: got %d, want %d", got, want)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSharedContextWithNonSharedContext(t *testing.T) {
+	c := newDummyContext(t)
+	defer c.Close()
+
+	if _, err := oto.SharedContext(&oto.Options{Driver: "dummy"}); err == nil {
+		t.Errorf("SharedContext must return an error while a Context that is not shared exists")
+	}
+}
+
+func TestSetEQ(t *testing.T) {
+	c := newDummyContext(t)
+	defer c.Close()
+
+	p := c.NewPlayer()
+	defer p.Close()
+
+	if err := p.SetEQ([]oto.EQBand{{Kind: oto.EQPeak, Frequency: 1000, Gain: 3}}); err != nil {
+		t.Error(err)
+	}
+	if err := p.SetEQ([]oto.EQBand{{Kind: oto.EQPeak, Frequency: 30000, Gain: 3}}); err == nil {
+		t.Errorf("SetEQ with a frequency beyond the Nyquist frequency must return an error")
+	}
+	if err := p.SetEQ(nil); err != nil {
+		t.Error(err)
+	}
+	if err := c.SetEQ([]oto.EQBand{{Kind: oto.EQLowShelf, Frequency: 100, Gain: -6}}); err != nil {
+		t.Error(err)
+	}
+	if _, err := p.Write(make([]byte, 4096)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBalanceAndWidth(t *testing.T) {
+	c := newDummyContext(t)
+	defer c.Close()
+
+	p := c.NewPlayer()
+	defer p.Close()
+
+	p.SetBalance(2)
+	if got, want := p.Balance(), 1.0; got != want {
+		t.Errorf("Balance(): got: %v, want: %v", got, want)
+	}
+	p.SetWidth(-1)
+	if got, want := p.Width(), 0.0; got != want {
+		t.Errorf("Width(): got: %v, want: %v", got, want)
+	}
+	if _, err := p.Write(make([]byte, 4096)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSetMuted(t *testing.T) {
+	c := newDummyContext(t)
+	defer c.Close()
+
+	p := c.NewPlayer()
+	defer p.Close()
+
+	p.SetVolume(0.5)
+	p.SetMuted(true)
+	if !p.IsMuted() {
+		t.Errorf("IsMuted(): got: false, want: true")
+	}
+	// Muting keeps the volume for unmuting.
+	if got, want := p.Volume(), 0.5; got != want {
+		t.Errorf("Volume(): got: %v, want: %v", got, want)
+	}
+	if _, err := p.Write(make([]byte, 4096)); err != nil {
+		t.Error(err)
+	}
+	p.SetMuted(false)
+	if p.IsMuted() {
+		t.Errorf("IsMuted(): got: true, want: false")
+	}
+}
+
+// invertEffect inverts the phase of the samples.
+type invertEffect struct {
+	sampleRate int
+	channelNum int
+	processed  chan struct{}
+}
+
+func (e *invertEffect) Prepare(sampleRate, channelNum int) {
+	e.sampleRate = sampleRate
+	e.channelNum = channelNum
+}
+
+func (e *invertEffect) Process(in, out [][]float32) {
+	for ch := range in {
+		for i, x := range in[ch] {
+			out[ch][i] = -x
+		}
+	}
+	select {
+	case e.processed <- struct{}{}:
+	default:
+	}
+}
+
+func TestEffect(t *testing.T) {
+	c := newDummyContext(t)
+	defer c.Close()
+
+	p := c.NewPlayer()
+	defer p.Close()
+
+	e := &invertEffect{processed: make(chan struct{}, 1)}
+	p.AddEffect(e)
+	if e.sampleRate != 44100 || e.channelNum != 2 {
+		t.Errorf("Prepare: got: %d Hz, %d channels, want: 44100 Hz, 2 channels", e.sampleRate, e.channelNum)
+	}
+	if _, err := p.Write(make([]byte, 4096)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-e.processed:
+	case <-time.After(5 * time.Second):
+		t.Errorf("the effect was not processed")
+	}
+	p.RemoveEffect(e)
+}
+
+func TestSuspendOnSilence(t *testing.T) {
+	events := make(chan oto.EventKind, 16)
+	oto.SetLogger(oto.LoggerFunc(func(e oto.Event) {
+		select {
+		case events <- e.Kind:
+		default:
+		}
+	}))
+	defer oto.SetLogger(nil)
+
+	c, err := oto.NewContextFromOptions(&oto.Options{
+		Driver:            "dummy",
+		BufferSizeInBytes: 4096,
+		CloseMode:         oto.ImmediateClose,
+		SuspendOnSilence:  20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	wait := func(kind oto.EventKind) {
+		timeout := time.After(10 * time.Second)
+		for {
+			select {
+			case k := <-events:
+				if k == kind {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("%v was not reported", kind)
+			}
+		}
+	}
+	wait(oto.EventDeviceSuspended)
+
+	p := c.NewPlayer()
+	defer p.Close()
+	buf := make([]byte, 4096)
+	for i := range buf {
+		buf[i] = 1
+	}
+	if _, err := p.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	wait(oto.EventDeviceResumed)
+}
+
+func TestLevels(t *testing.T) {
+	levels := make(chan []oto.Level, 1)
+	c, err := oto.NewContextFromOptions(&oto.Options{
+		Driver:            "dummy",
+		ChannelNum:        2,
+		BufferSizeInBytes: 4096,
+		CloseMode:         oto.ImmediateClose,
+		OnLevels: func(l []oto.Level) {
+			if l[0].Peak == 0 {
+				return
+			}
+			select {
+			case levels <- append([]oto.Level(nil), l...):
+			default:
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	p := c.NewPlayer()
+	defer p.Close()
+
+	// A square wave of the half of the full scale on the left channel.
+	buf := make([]byte, 4096)
+	for i := 0; i < len(buf); i += 4 {
+		v := int16(1 << 14)
+		if (i/4)%2 == 1 {
+			v = -v
+		}
+		buf[i] = byte(v)
+		buf[i+1] = byte(v >> 8)
+	}
+	if _, err := p.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []oto.Level
+	select {
+	case got = <-levels:
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnLevels was not called with the sound")
+	}
+	if got[0].Peak != 0.5 || got[1].Peak != 0 {
+		t.Errorf("peaks: got: %v, %v, want: 0.5, 0", got[0].Peak, got[1].Peak)
+	}
+	if got[0].RMS <= 0 || got[0].RMS > 0.5 {
+		t.Errorf("RMS: got: %v, want: (0, 0.5]", got[0].RMS)
+	}
+	if l := p.Levels(); len(l) != 2 {
+		t.Errorf("len(Levels()): got: %d, want: 2", len(l))
+	}
+}
+
+func TestSetPosition(t *testing.T) {
+	c := newDummyContext(t)
+	defer c.Close()
+
+	p := c.NewPlayer()
+	defer p.Close()
+
+	p.SetPosition(1, 0, -2)
+	if _, err := p.Write(make([]byte, 4096)); err != nil {
+		t.Error(err)
+	}
+	p.ClearPosition()
+	if _, err := p.Write(make([]byte, 4096)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSetChannelMatrix(t *testing.T) {
+	c := newDummyContext(t)
+	defer c.Close()
+
+	p := c.NewPlayer()
+	defer p.Close()
+
+	if err := p.SetChannelMatrix([][]float64{{0.5, 0}, {0.5, 0}}); err != nil {
+		t.Error(err)
+	}
+	if err := p.SetChannelMatrix([][]float64{{1, 0}}); err == nil {
+		t.Errorf("SetChannelMatrix with a wrong size must return an error")
+	}
+	if _, err := p.Write(make([]byte, 4096)); err != nil {
+		t.Error(err)
+	}
+	if err := p.SetChannelMatrix(nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCrossfade(t *testing.T) {
+	c := newDummyContext(t)
+	defer c.Close()
+
+	buf := make([]byte, 4096)
+	for i := 0; i < len(buf); i += 2 {
+		buf[i+1] = 0x10
+	}
+	play := func() *oto.Player {
+		p := c.NewPlayer()
+		go func() {
+			for {
+				if _, err := p.Write(buf); err != nil {
+					return
+				}
+			}
+		}()
+		return p
+	}
+	from := play()
+	defer from.Close()
+	to := play()
+	defer to.Close()
+
+	oto.Crossfade(from, to, 10*time.Millisecond)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		lf, lt := from.Levels(), to.Levels()
+		if lf[0].Peak == 0 && lt[0].Peak > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the crossfade didn't finish: from: %v, to: %v", lf, lt)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSetGainDB(t *testing.T) {
+	levels := make(chan []oto.Level, 1)
+	c, err := oto.NewContextFromOptions(&oto.Options{
+		Driver:            "dummy",
+		ChannelNum:        1,
+		BufferSizeInBytes: 4096,
+		CloseMode:         oto.ImmediateClose,
+		OnLevels: func(l []oto.Level) {
+			if l[0].Peak == 0 {
+				return
+			}
+			select {
+			case levels <- append([]oto.Level(nil), l...):
+			default:
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	p := c.NewPlayer()
+	defer p.Close()
+	p.SetGainDB(-20 * math.Log10(2))
+	if got := p.Loudness(); !math.IsInf(got, -1) {
+		t.Errorf("Loudness without the analysis: got: %v, want: -Inf", got)
+	}
+
+	// A square wave of the half of the full scale is halved by -6 dB.
+	buf := make([]byte, 4096)
+	for i := 0; i < len(buf); i += 2 {
+		v := int16(1 << 14)
+		if (i/2)%2 == 1 {
+			v = -v
+		}
+		buf[i] = byte(v)
+		buf[i+1] = byte(v >> 8)
+	}
+	if _, err := p.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case got := <-levels:
+		if math.Abs(got[0].Peak-0.25) > 1e-3 {
+			t.Errorf("peak: got: %v, want: 0.25", got[0].Peak)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnLevels was not called with the sound")
+	}
+}
+
+func TestSetAudioFocus(t *testing.T) {
+	levels := make(chan struct{}, 1)
+	c, err := oto.NewContextFromOptions(&oto.Options{
+		Driver:            "dummy",
+		BufferSizeInBytes: 4096,
+		CloseMode:         oto.ImmediateClose,
+		OnLevels: func(l []oto.Level) {
+			if l[0].Peak == 0 {
+				return
+			}
+			select {
+			case levels <- struct{}{}:
+			default:
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := c.SetAudioFocus(0); err == nil {
+		t.Error("SetAudioFocus(0) must return an error")
+	}
+	if err := c.SetAudioFocus(oto.AudioFocusLossTransient); err != nil {
+		t.Fatal(err)
+	}
+
+	p := c.NewPlayer()
+	defer p.Close()
+	buf := make([]byte, 65536)
+	for i := range buf {
+		buf[i] = 0x40
+	}
+	// Write blocks while the focus is lost, since nothing is played.
+	go p.Write(buf)
+	select {
+	case <-levels:
+		t.Fatal("the Player must be paused while the focus is lost")
+	case <-time.After(500 * time.Millisecond):
+	}
+	if p.IsPaused() {
+		t.Error("the paused state of the Player must not change")
+	}
+
+	if err := c.SetAudioFocus(oto.AudioFocusGain); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-levels:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the Player must be resumed when the focus is back")
+	}
+}
+
+func TestLatency(t *testing.T) {
+	c := newDummyContext(t)
+	defer c.Close()
+
+	// The dummy driver has no output device, so the latency is the duration of the buffer.
+	if got, want := c.Latency(), time.Second*4096/(44100*4); got != want {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+func TestDeviceVolume(t *testing.T) {
+	c := newDummyContext(t)
+	defer c.Close()
+
+	if c.Capabilities().DeviceVolume {
+		t.Error("the dummy driver must not support the device volume")
+	}
+	if err := c.SetDeviceVolume(0.5, 0.5); err == nil {
+		t.Error("SetDeviceVolume must fail without the support of the driver")
+	}
+	if err := c.SetDeviceVolume(2, 0.5); err == nil {
+		t.Error("SetDeviceVolume must fail with an invalid volume")
+	}
+}
+
+func TestPlayLoop(t *testing.T) {
+	c := newDummyContext(t)
+	defer c.Close()
+
+	if _, err := c.PlayLoop(make([]byte, 3), 0); err == nil {
+		t.Error("PlayLoop must fail with a partial frame")
+	}
+	if _, err := c.PlayLoop(make([]byte, 4096), 0); err == nil {
+		t.Error("PlayLoop must fail without the support of the driver")
+	}
+}
+
+func TestNilOptions(t *testing.T) {
+	d := ototest.NewVirtualDriver()
+	defer oto.SetDriverForTesting(d.Open)()
+
+	c, err := oto.NewContextFromOptions(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	s := c.Snapshot()
+	if s.SampleRate != 44100 || s.ChannelNum != 2 || s.Format != oto.FormatSignedInt16LE {
+		t.Errorf("the format with nil options: got: %d Hz, %d channels, %v, want: the default format", s.SampleRate, s.ChannelNum, s.Format)
+	}
+}
+
+func TestContextWithOptions(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		opts         []oto.Option
+		sampleRate   int
+		channelNum   int
+		bufferFrames int
+		periodFrames int
+		flushFrames  int
+	}{
+		{
+			name:         "defaults",
+			sampleRate:   44100,
+			channelNum:   2,
+			bufferFrames: -1,
+		},
+		{
+			name:         "later format wins",
+			opts:         []oto.Option{oto.WithFormat(22050, 1, oto.FormatSignedInt16LE), oto.WithFormat(48000, 2, oto.FormatSignedInt16LE)},
+			sampleRate:   48000,
+			channelNum:   2,
+			bufferFrames: -1,
+		},
+		{
+			name:         "options then format",
+			opts:         []oto.Option{oto.WithOptions(oto.Options{SampleRate: 22050, BufferDuration: 100 * time.Millisecond}), oto.WithFormat(48000, 1, oto.FormatSignedInt16LE)},
+			sampleRate:   48000,
+			channelNum:   1,
+			bufferFrames: 4800,
+		},
+		{
+			name:         "format then options",
+			opts:         []oto.Option{oto.WithFormat(48000, 1, oto.FormatSignedInt16LE), oto.WithOptions(oto.Options{SampleRate: 22050})},
+			sampleRate:   22050,
+			channelNum:   2,
+			bufferFrames: -1,
+		},
+		{
+			name:         "buffer then low latency",
+			opts:         []oto.Option{oto.WithFormat(48000, 2, oto.FormatSignedInt16LE), oto.WithBufferDuration(100 * time.Millisecond), oto.WithLowLatency()},
+			sampleRate:   48000,
+			channelNum:   2,
+			bufferFrames: 4800,
+		},
+		{
+			name:         "low latency then buffer",
+			opts:         []oto.Option{oto.WithFormat(48000, 2, oto.FormatSignedInt16LE), oto.WithLowLatency(), oto.WithBufferDuration(100 * time.Millisecond)},
+			sampleRate:   48000,
+			channelNum:   2,
+			bufferFrames: 4800,
+		},
+		{
+			name:         "low latency",
+			opts:         []oto.Option{oto.WithFormat(48000, 2, oto.FormatSignedInt16LE), oto.WithLowLatency()},
+			sampleRate:   48000,
+			channelNum:   2,
+			bufferFrames: 960,
+		},
+		{
+			name:         "power save",
+			opts:         []oto.Option{oto.WithOptions(oto.Options{Profile: oto.ProfilePowerSave}), oto.WithFormat(48000, 2, oto.FormatSignedInt16LE)},
+			sampleRate:   48000,
+			channelNum:   2,
+			bufferFrames: 24000,
+			periodFrames: 12000,
+			flushFrames:  12000,
+		},
+		{
+			name:         "power save with buffer",
+			opts:         []oto.Option{oto.WithOptions(oto.Options{Profile: oto.ProfilePowerSave, BufferDuration: 100 * time.Millisecond}), oto.WithFormat(48000, 2, oto.FormatSignedInt16LE)},
+			sampleRate:   48000,
+			channelNum:   2,
+			bufferFrames: 4800,
+			periodFrames: 2400,
+			flushFrames:  2400,
+		},
+		{
+			name:         "power save with period",
+			opts:         []oto.Option{oto.WithOptions(oto.Options{Profile: oto.ProfilePowerSave, PeriodDuration: 50 * time.Millisecond}), oto.WithFormat(48000, 2, oto.FormatSignedInt16LE)},
+			sampleRate:   48000,
+			channelNum:   2,
+			bufferFrames: 24000,
+			periodFrames: 2400,
+			flushFrames:  2400,
+		},
+		{
+			name:         "power save with flush",
+			opts:         []oto.Option{oto.WithOptions(oto.Options{Profile: oto.ProfilePowerSave, FlushFrames: 480}), oto.WithFormat(48000, 2, oto.FormatSignedInt16LE)},
+			sampleRate:   48000,
+			channelNum:   2,
+			bufferFrames: 24000,
+			periodFrames: 12000,
+			flushFrames:  480,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d := ototest.NewDriver()
+			defer oto.SetDriverForTesting(d.Open)()
+
+			// Only the parameters matter, so the data is not drained.
+			immediateClose := func(o *oto.Options) {
+				o.CloseMode = oto.ImmediateClose
+			}
+			c, err := oto.NewContextWithOptions(append(tc.opts, immediateClose)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+
+			p := d.Params()
+			if p.SampleRate != tc.sampleRate || p.ChannelNum != tc.channelNum {
+				t.Errorf("got: %d Hz, %d channels, want: %d Hz, %d channels", p.SampleRate, p.ChannelNum, tc.sampleRate, tc.channelNum)
+			}
+			// -1 means the default buffer, which is not checked.
+			if tc.bufferFrames >= 0 && p.BufferFrames != tc.bufferFrames {
+				t.Errorf("BufferFrames: got: %d, want: %d", p.BufferFrames, tc.bufferFrames)
+			}
+			// 0 means that the period and the flush are not checked.
+			if tc.periodFrames > 0 && p.PeriodFrames != tc.periodFrames {
+				t.Errorf("PeriodFrames: got: %d, want: %d", p.PeriodFrames, tc.periodFrames)
+			}
+			if tc.flushFrames > 0 {
+				// The first write to the driver is of FlushFrames.
+				deadline := time.Now().Add(5 * time.Second)
+				for len(d.Chunks()) == 0 {
+					if time.Now().After(deadline) {
+						t.Fatal("nothing was written to the driver")
+					}
+					time.Sleep(time.Millisecond)
+				}
+				bytesPerFrame := p.ChannelNum * p.BytesPerSample
+				if got := len(d.Chunks()[0].Data) / bytesPerFrame; got != tc.flushFrames {
+					t.Errorf("FlushFrames: got: %d, want: %d", got, tc.flushFrames)
+				}
+			}
+		})
+	}
+}
+
+func TestDurationToFrames(t *testing.T) {
+	for _, tc := range []struct {
+		d          time.Duration
+		sampleRate int
+		frames     int
+	}{
+		{d: 10 * time.Millisecond, sampleRate: 44100, frames: 441},
+		{d: time.Second, sampleRate: 48000, frames: 48000},
+		// The frames are rounded down.
+		{d: 10*time.Millisecond + 10*time.Microsecond, sampleRate: 44100, frames: 441},
+		{d: time.Nanosecond, sampleRate: 48000, frames: 0},
+		{d: 2*time.Millisecond - time.Nanosecond, sampleRate: 1000, frames: 1},
+	} {
+		if got := oto.DurationToFrames(tc.d, tc.sampleRate); got != tc.frames {
+			t.Errorf("DurationToFrames(%v, %d): got: %d, want: %d", tc.d, tc.sampleRate, got, tc.frames)
+		}
+	}
+}
+
+func TestFramesToDuration(t *testing.T) {
+	for _, tc := range []struct {
+		frames     int
+		sampleRate int
+		d          time.Duration
+	}{
+		{frames: 441, sampleRate: 44100, d: 10 * time.Millisecond},
+		{frames: 3, sampleRate: 48000, d: 62500 * time.Nanosecond},
+		// The duration is rounded down to nanoseconds.
+		{frames: 1, sampleRate: 44100, d: 22675 * time.Nanosecond},
+		{frames: 0, sampleRate: 44100, d: 0},
+	} {
+		if got := oto.FramesToDuration(tc.frames, tc.sampleRate); got != tc.d {
+			t.Errorf("FramesToDuration(%d, %d): got: %v, want: %v", tc.frames, tc.sampleRate, got, tc.d)
+		}
+		// The round trip loses at most a frame by the rounding down.
+		if got := oto.DurationToFrames(oto.FramesToDuration(tc.frames, tc.sampleRate), tc.sampleRate); got != tc.frames && got != tc.frames-1 {
+			t.Errorf("DurationToFrames(FramesToDuration(%d, %d)): got: %d", tc.frames, tc.sampleRate, got)
+		}
+	}
+}
+
+func TestBufferSizing(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		options      oto.Options
+		bufferFrames int
+		periodFrames int
+		err          bool
+	}{
+		{
+			name:         "bytes of mono 8bit",
+			options:      oto.Options{SampleRate: 44100, ChannelNum: 1, Format: oto.FormatUnsignedInt8, BufferSizeInBytes: 441},
+			bufferFrames: 441,
+		},
+		{
+			name:         "bytes of stereo 16bit",
+			options:      oto.Options{SampleRate: 44100, ChannelNum: 2, Format: oto.FormatSignedInt16LE, BufferSizeInBytes: 1764},
+			bufferFrames: 441,
+		},
+		{
+			name:    "bytes not a multiple of the frame",
+			options: oto.Options{SampleRate: 44100, ChannelNum: 2, Format: oto.FormatSignedInt16LE, BufferSizeInBytes: 1766},
+			err:     true,
+		},
+		{
+			name:         "frames of stereo 8bit",
+			options:      oto.Options{SampleRate: 44100, ChannelNum: 2, Format: oto.FormatUnsignedInt8, BufferFrames: 441, PeriodFrames: 147},
+			bufferFrames: 441,
+			periodFrames: 147,
+		},
+		{
+			name:         "duration rounded down",
+			options:      oto.Options{SampleRate: 44100, ChannelNum: 1, BufferDuration: 10*time.Millisecond + 10*time.Microsecond},
+			bufferFrames: 441,
+		},
+		{
+			name:         "durations of stereo 8bit",
+			options:      oto.Options{SampleRate: 48000, ChannelNum: 2, Format: oto.FormatUnsignedInt8, BufferDuration: 20 * time.Millisecond, PeriodDuration: 5 * time.Millisecond},
+			bufferFrames: 960,
+			periodFrames: 240,
+		},
+		{
+			name:         "period count",
+			options:      oto.Options{SampleRate: 48000, ChannelNum: 1, BufferFrames: 1000, PeriodCount: 3},
+			bufferFrames: 1000,
+			periodFrames: 333,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d := ototest.NewDriver()
+			defer oto.SetDriverForTesting(d.Open)()
+
+			o := tc.options
+			o.CloseMode = oto.ImmediateClose
+			c, err := oto.NewContextFromOptions(&o)
+			if tc.err {
+				if err == nil {
+					c.Close()
+					t.Error("NewContextFromOptions must return an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+
+			p := d.Params()
+			if got, want := p.BytesPerSample, tc.options.Format.BytesPerSample(); got != want {
+				t.Errorf("BytesPerSample: got: %d, want: %d", got, want)
+			}
+			if p.BufferFrames != tc.bufferFrames {
+				t.Errorf("BufferFrames: got: %d, want: %d", p.BufferFrames, tc.bufferFrames)
+			}
+			if p.PeriodFrames != tc.periodFrames {
+				t.Errorf("PeriodFrames: got: %d, want: %d", p.PeriodFrames, tc.periodFrames)
+			}
+		})
+	}
+}
+
+// TestMixBitExact checks that the mixed samples are passed to the driver without any error.
+func TestMixBitExact(t *testing.T) {
+	d := ototest.NewVirtualDriver()
+	defer oto.SetDriverForTesting(d.Open)()
+
+	c, err := oto.NewContextFromOptions(&oto.Options{
+		SampleRate:        44100,
+		ChannelNum:        2,
+		BufferSizeInBytes: 4400,
+		CloseMode:         oto.ImmediateClose,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// Wait for the buffer to be filled, so that both the Players start at the same frame at the next
+	// Advance.
+	d.Advance(0)
+	p0 := c.NewPlayer()
+	defer p0.Close()
+	p1 := c.NewPlayer()
+	defer p1.Close()
+	const n = 1024
+	for _, w := range []struct {
+		p    *oto.Player
+		l, r int16
+	}{
+		{p0, 1000, 30000},
+		{p1, -300, 12345},
+	} {
+		buf := make([]byte, 0, 4*n)
+		for i := 0; i < n; i++ {
+			buf = append(buf, byte(w.l), byte(w.l>>8), byte(w.r), byte(w.r>>8))
+		}
+		if _, err := w.p.Write(buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		d.Advance(10 * time.Millisecond)
+	}
+
+	// The right channel is clamped.
+	var want []byte
+	for i := 0; i < n; i++ {
+		want = append(want, 0xbc, 0x02, 0xff, 0x7f)
+	}
+	for i, b := 0, d.Bytes(); i < len(b); i += 2 {
+		if i == 0 || b[i] != b[i-2] || b[i+1] != b[i-1] {
+			t.Logf("%d: %d", i, int16(b[i])|int16(b[i+1])<<8)
+		}
+	}
+	if !bytes.Contains(d.Bytes(), want) {
+		t.Errorf("the mixed samples are not bit-exact")
+	}
+}
+
+func TestPlayerPosition(t *testing.T) {
+	d := ototest.NewVirtualDriver()
+	defer oto.SetDriverForTesting(d.Open)()
+
+	c, err := oto.NewContextFromOptions(&oto.Options{
+		SampleRate:        44100,
+		ChannelNum:        2,
+		BufferSizeInBytes: 4400,
+		FlushFrames:       147,
+		CloseMode:         oto.ImmediateClose,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	d.Advance(0)
+	p := c.NewPlayer()
+	defer p.Close()
+	if got := p.Position(); got != 0 {
+		t.Errorf("Position() before playing: got: %v, want: 0", got)
+	}
+	// Keep the Player's buffer filled, since the virtual clock plays faster than the real time.
+	const frames10ms = 441
+	if _, err := p.Write(make([]byte, 2*frames10ms*4)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		d.Advance(10 * time.Millisecond)
+		if _, err := p.Write(make([]byte, frames10ms*4)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The silence in the buffer before the Player was played first.
+	if got := p.Position(); got < 450*time.Millisecond || got > 500*time.Millisecond {
+		t.Errorf("Position(): got: %v, want: in [450ms, 500ms]", got)
+	}
+
+	// The position stops after the data in the buffer is played.
+	p.Pause()
+	for i := 0; i < 5; i++ {
+		d.Advance(10 * time.Millisecond)
+	}
+	pos := p.Position()
+	for i := 0; i < 5; i++ {
+		d.Advance(10 * time.Millisecond)
+	}
+	if got := p.Position(); got != pos {
+		t.Errorf("Position() while paused: got: %v, want: %v", got, pos)
+	}
+}
+
+func TestSetDeviceRate(t *testing.T) {
+	d := ototest.NewVirtualDriver()
+	defer oto.SetDriverForTesting(d.Open)()
+
+	c, err := oto.NewContextFromOptions(&oto.Options{
+		SampleRate:        44100,
+		ChannelNum:        2,
+		BufferSizeInBytes: 88200,
+		FlushFrames:       441,
+		CloseMode:         oto.ImmediateClose,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if c.Capabilities().DeviceRate {
+		t.Error("the test driver must not support the device rate")
+	}
+	// The driver doesn't support the rate, so the Players are time-stretched in software.
+	if err := c.SetDeviceRate(2); err != nil {
+		t.Fatal(err)
+	}
+	d.Advance(0)
+	p := c.NewPlayer()
+	defer p.Close()
+	const n = 8820
+	buf := make([]byte, 0, 4*n)
+	for i := 0; i < n; i++ {
+		buf = append(buf, 0x00, 0x10, 0x00, 0x10)
+	}
+	if _, err := p.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	// Play the silence in the buffer and then the Player's data.
+	for i := 0; i < 100; i++ {
+		d.Advance(10 * time.Millisecond)
+	}
+
+	played := 0
+	b := d.Bytes()
+	for i := 0; i+4 <= len(b); i += 4 {
+		if b[i+1] != 0 || b[i+3] != 0 {
+			played++
+		}
+	}
+	if played < n/2-n/8 || played > n/2+n/8 {
+		t.Errorf("played frames: got: %d, want: about %d", played, n/2)
+	}
+}
+
+func TestWaveFormats(t *testing.T) {
+	d := &oto.Device{Formats: oto.WaveFormat4S16 | oto.WaveFormat48M08}
+	if !d.SupportsFormat(44100, 2, 16) {
+		t.Error("44.1kHz stereo 16bit must be supported")
+	}
+	if d.SupportsFormat(44100, 1, 16) || d.SupportsFormat(32000, 2, 16) {
+		t.Error("the formats not in the set must not be supported")
+	}
+	if got, want := d.Formats.String(), "44.1kHz stereo 16bit, 48kHz mono 8bit"; got != want {
+		t.Errorf("String(): got: %q, want: %q", got, want)
+	}
+	if got, want := (oto.WaveCapsVolume | oto.WaveCapsLRVolume).String(), "volume, left/right volume"; got != want {
+		t.Errorf("String(): got: %q, want: %q", got, want)
+	}
+}
+
+func TestAdaptiveBuffer(t *testing.T) {
+	d := ototest.NewVirtualDriver()
+	defer oto.SetDriverForTesting(d.Open)()
+
+	resized := make(chan int, 10)
+	c, err := oto.NewContextFromOptions(&oto.Options{
+		SampleRate:        48000,
+		ChannelNum:        1,
+		BufferDuration:    10 * time.Millisecond,
+		AdaptiveBuffer:    true,
+		MaxBufferDuration: 40 * time.Millisecond,
+		CloseMode:         oto.ImmediateClose,
+		OnBufferResize: func(bufferFrames int) {
+			resized <- bufferFrames
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// underrun plays more than the buffer, and waits for the buffer to be resized.
+	underrun := func(want int) {
+		d.Advance(100 * time.Millisecond)
+		select {
+		case got := <-resized:
+			if got != want {
+				t.Errorf("OnBufferResize: got: %d, want: %d", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("OnBufferResize was not called for %d frames", want)
+		}
+		// Wait for the reopened device to be filled.
+		d.Advance(0)
+	}
+
+	d.Advance(0)
+	underrun(960)
+	// A single underrun grows the buffer only once, even after the device is reopened.
+	d.Advance(time.Millisecond)
+	d.Advance(0)
+	select {
+	case got := <-resized:
+		t.Errorf("OnBufferResize after a single underrun: got: %d, want: no calls", got)
+	default:
+	}
+	underrun(1920)
+
+	// The buffer doesn't grow beyond MaxBufferDuration.
+	d.Advance(100 * time.Millisecond)
+	d.Advance(0)
+	select {
+	case got := <-resized:
+		t.Errorf("OnBufferResize at the maximum: got: %d, want: no calls", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if got, want := d.Params().BufferFrames, 1920; got != want {
+		t.Errorf("BufferFrames: got: %d, want: %d", got, want)
+	}
+	if got, want := d.Underruns(), int64(3); got != want {
+		t.Errorf("Underruns of the driver: got: %d, want: %d", got, want)
+	}
+}
+
+func TestFlushFrames(t *testing.T) {
+	d := ototest.NewDriver()
+	defer oto.SetDriverForTesting(d.Open)()
+
+	const flushFrames = 441
+	c, err := oto.NewContextFromOptions(&oto.Options{
+		SampleRate:        44100,
+		ChannelNum:        1,
+		BufferSizeInBytes: 8820,
+		FlushFrames:       flushFrames,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The data is written in small chunks, and doesn't fill a whole flush at the end.
+	data := bytes.Repeat([]byte{0xe8, 0x03}, 1000)
+	p := c.NewPlayer()
+	for i := 0; i < len(data); i += 20 {
+		if _, err := p.Write(data[i : i+20]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Close drains the Player's data.
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every write to the driver is of FlushFrames, and the tail is padded with silence and flushed.
+	chunks := d.Chunks()
+	if len(chunks) == 0 {
+		t.Fatal("nothing was written to the driver")
+	}
+	for i, ch := range chunks {
+		if got, want := len(ch.Data), flushFrames*2; got != want {
+			t.Errorf("chunk %d: len(Data): got: %d, want: %d", i, got, want)
+		}
+	}
+	if !bytes.Contains(d.Bytes(), data) {
+		t.Errorf("the data including its tail was not written to the driver")
+	}
+}
+
+func TestStats(t *testing.T) {
+	d := ototest.NewVirtualDriver()
+	defer oto.SetDriverForTesting(d.Open)()
+
+	const (
+		bufferFrames = 2205
+		flushFrames  = 441
+	)
+	c, err := oto.NewContextFromOptions(&oto.Options{
+		SampleRate:        44100,
+		ChannelNum:        1,
+		BufferSizeInBytes: bufferFrames * 2,
+		FlushFrames:       flushFrames,
+		CloseMode:         oto.ImmediateClose,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// The jitter is not measured until the buffer is filled first.
+	d.Advance(0)
+	s := c.Stats()
+	if got, want := s.FramesWritten, int64(bufferFrames); got != want {
+		t.Errorf("FramesWritten after the buffer is filled: got: %d, want: %d", got, want)
+	}
+	if s.Jitter != 0 || s.MaxJitter != 0 {
+		t.Errorf("Jitter and MaxJitter before the buffer is filled: got: %v and %v, want: 0 and 0", s.Jitter, s.MaxJitter)
+	}
+
+	// Each Advance makes room for a flush. The virtual clock advances much faster than the real time, so
+	// the intervals of the writes deviate from the written durations.
+	const n = 10
+	for i := 0; i < n; i++ {
+		d.Advance(10 * time.Millisecond)
+	}
+	s = c.Stats()
+	if got, want := s.FramesWritten, int64(bufferFrames+n*flushFrames); got != want {
+		t.Errorf("FramesWritten after %d Advance calls: got: %d, want: %d", n, got, want)
+	}
+	if s.MaxJitter <= 0 || s.Jitter <= 0 || s.Jitter > s.MaxJitter {
+		t.Errorf("Jitter and MaxJitter after the buffer is filled: got: %v and %v", s.Jitter, s.MaxJitter)
+	}
+	if got := s.Underruns; got != 0 {
+		t.Errorf("Underruns: got: %d, want: 0", got)
+	}
+	if got := s.DeviceRestarts; got != 0 {
+		t.Errorf("DeviceRestarts: got: %d, want: 0", got)
+	}
+}
+
+func TestStatsAcrossRestart(t *testing.T) {
+	d := ototest.NewVirtualDriver()
+	defer oto.SetDriverForTesting(d.Open)()
+
+	resized := make(chan int, 10)
+	c, err := oto.NewContextFromOptions(&oto.Options{
+		SampleRate:        48000,
+		ChannelNum:        1,
+		BufferDuration:    10 * time.Millisecond,
+		AdaptiveBuffer:    true,
+		MaxBufferDuration: 20 * time.Millisecond,
+		CloseMode:         oto.ImmediateClose,
+		OnBufferResize: func(bufferFrames int) {
+			resized <- bufferFrames
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// An underrun restarts the device to grow the buffer.
+	d.Advance(0)
+	d.Advance(100 * time.Millisecond)
+	select {
+	case <-resized:
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnBufferResize was not called")
+	}
+	d.Advance(0)
+	s := c.Stats()
+	if got, want := s.Underruns, int64(1); got != want {
+		t.Errorf("Underruns after the restart: got: %d, want: %d", got, want)
+	}
+	if got, want := s.DeviceRestarts, int64(1); got != want {
+		t.Errorf("DeviceRestarts after the restart: got: %d, want: %d", got, want)
+	}
+
+	// The underruns of the restarted device are added to the ones before the restart. The buffer is at the
+	// maximum, so the device is not restarted again.
+	d.Advance(100 * time.Millisecond)
+	d.Advance(0)
+	s = c.Stats()
+	if got, want := s.Underruns, int64(2); got != want {
+		t.Errorf("Underruns: got: %d, want: %d", got, want)
+	}
+	if got, want := s.DeviceRestarts, int64(1); got != want {
+		t.Errorf("DeviceRestarts: got: %d, want: %d", got, want)
+	}
+}
+
+func TestAcquireBufferAcrossWrap(t *testing.T) {
+	d := ototest.NewVirtualDriver()
+	defer oto.SetDriverForTesting(d.Open)()
+
+	const bufferSize = 4410
+	c, err := oto.NewContextFromOptions(&oto.Options{
+		SampleRate:        44100,
+		ChannelNum:        1,
+		BufferSizeInBytes: bufferSize,
+		CloseMode:         oto.ImmediateClose,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	p := c.NewPlayer()
+	defer p.Close()
+
+	fill := func(buf []byte, v int16) {
+		for i := 0; i < len(buf); i += 2 {
+			buf[i] = byte(v)
+			buf[i+1] = byte(v >> 8)
+		}
+	}
+
+	// Commit a part of the buffer, and let the mixer consume it so that the free space wraps around the
+	// end of the buffer.
+	const first = 3000
+	buf, err := p.AcquireBuffer(bufferSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(buf), bufferSize; got != want {
+		t.Fatalf("len(AcquireBuffer) of the empty buffer: got: %d, want: %d", got, want)
+	}
+	fill(buf[:first], 1000)
+	if err := p.CommitBuffer(first); err != nil {
+		t.Fatal(err)
+	}
+	d.Advance(50 * time.Millisecond)
+
+	// The region ends at the end of the buffer, and committing more than the region fails.
+	buf, err = p.AcquireBuffer(bufferSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(buf), bufferSize-first; got != want {
+		t.Fatalf("len(AcquireBuffer) at the wrap: got: %d, want: %d", got, want)
+	}
+	if err := p.CommitBuffer(len(buf) + 2); err == nil {
+		t.Errorf("CommitBuffer more than the region must return an error")
+	}
+	fill(buf, 2000)
+	if err := p.CommitBuffer(len(buf)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The rest is acquired from the start of the buffer.
+	const rest = first - 10
+	buf, err = p.AcquireBuffer(rest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(buf), rest; got != want {
+		t.Fatalf("len(AcquireBuffer) after the wrap: got: %d, want: %d", got, want)
+	}
+	fill(buf, 3000)
+	if err := p.CommitBuffer(len(buf)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		d.Advance(50 * time.Millisecond)
+	}
+
+	// The mixer runs out of the first samples before the rest is committed, so the region at the end of
+	// the buffer and the rest from its start are played contiguously after silence.
+	want := func(v int16, n int) []byte {
+		b := make([]byte, n)
+		fill(b, v)
+		return b
+	}
+	if !bytes.Contains(d.Bytes(), want(1000, first)) {
+		t.Errorf("the samples committed before the wrap were not played")
+	}
+	if !bytes.Contains(d.Bytes(), append(want(2000, bufferSize-first), want(3000, rest)...)) {
+		t.Errorf("the samples committed across the wrap were not played in order")
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	"sync/atomic"
+
+	"github.com/leibnewton/oto/internal/spatial"
+)
+
+// position is the position of a Player in the space.
+type position struct {
+	x, y, z float64
+}
+
+// spatialState holds the position of a Player and the renderer for the position.
+type spatialState struct {
+	// position holds the *position, which is nil when the Player is not spatialized.
+	position atomic.Value
+
+	// renderer is used only by the Context's loop.
+	renderer *spatial.Renderer
+}
+
+// SetPosition spatializes the Player at (x, y, z) in meters. The listener is at the origin, facing the
+// negative z axis with the positive y axis up, like OpenAL. The sound of the Player is mixed down to mono,
+// and is rendered to stereo with an approximated head-related transfer function. The sound is attenuated
+// by the inverse of the distance beyond 1 meter.
+//
+// The position is applied after the effects, instead of the balance and the width. SetPosition does
+// nothing for a mono Context. Moving the Player is smoothed during a period.
+func (p *Player) SetPosition(x, y, z float64) {
+	if p.source.spatial == nil {
+		return
+	}
+	p.source.spatial.position.Store(&position{x: x, y: y, z: z})
+}
+
+// ClearPosition stops spatializing the Player.
+func (p *Player) ClearPosition() {
+	if p.source.spatial == nil {
+		return
+	}
+	p.source.spatial.position.Store((*position)(nil))
+}
+
+// process spatializes the stereo frames in buf, and reports whether the Player is spatialized.
+func (s *spatialState) process(buf []float32, sampleRate int) bool {
+	pos, _ := s.position.Load().(*position)
+	if pos == nil {
+		// Start from the new position without moving from the old one.
+		s.renderer = nil
+		return false
+	}
+	if s.renderer == nil {
+		s.renderer = spatial.New(sampleRate)
+	}
+	s.renderer.Process(buf, pos.x, pos.y, pos.z)
+	return true
+}
@@ -0,0 +1,127 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/leibnewton/oto/internal/backend"
+)
+
+// queuerValue is the state of the driver being written to count the played frames without d.m, since the
+// loop holds it while the driver is writing. queuer is nil when the driver doesn't implement
+// backend.FrameQueuer.
+type queuerValue struct {
+	queuer       backend.FrameQueuer
+	bufferFrames int64
+}
+
+// playedFrames returns the number of the mixed frames that have been played by the device.
+//
+// The frames in the driver are counted by the device's counter when the driver implements
+// backend.FrameQueuer.
+// Otherwise, the driver is assumed to hold the whole buffer.
+func (d *driverWriter) playedFrames() int64 {
+	v, ok := d.queuer.Load().(queuerValue)
+	if !ok {
+		return 0
+	}
+	passed := atomic.LoadInt64(&d.stats.framesPassed)
+	queued := v.bufferFrames
+	if v.queuer != nil {
+		if n, ok := v.queuer.QueuedFrames(); ok {
+			queued = n
+		}
+	}
+	if queued > passed {
+		return 0
+	}
+	return passed - queued
+}
+
+// progressEntries is the number of the mixed chunks whose Player's frames are remembered. This is
+// enough to cover the device buffer, which is mixed in a few periods.
+const progressEntries = 64
+
+// progressEntry maps a chunk of the mixed frames to the Player's frames read for the chunk.
+type progressEntry struct {
+	// out is the first mixed frame of the chunk, and frames is the number of the mixed frames.
+	out    int64
+	frames int64
+
+	// from and to are the Player's frames before and after the chunk is read.
+	from int64
+	to   int64
+}
+
+// progress is the history of the chunks that a Player's data is mixed into. The history maps the mixed
+// frames that the device has played to the Player's frames.
+type progress struct {
+	entries [progressEntries]progressEntry
+	n       int
+
+	m sync.Mutex
+}
+
+// record records that the Player's frames [from, to) are read for the mixed frames [out, out+frames).
+func (p *progress) record(out, frames, from, to int64) {
+	p.m.Lock()
+	defer p.m.Unlock()
+	p.entries[p.n%progressEntries] = progressEntry{out: out, frames: frames, from: from, to: to}
+	p.n++
+}
+
+// at returns the Player's frame that is mixed at the mixed frame out.
+func (p *progress) at(out int64) int64 {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	if p.n == 0 {
+		return 0
+	}
+	oldest := 0
+	if p.n > progressEntries {
+		oldest = p.n - progressEntries
+	}
+	for i := p.n - 1; i >= oldest; i-- {
+		e := p.entries[i%progressEntries]
+		if e.out > out {
+			continue
+		}
+		if out >= e.out+e.frames {
+			return e.to
+		}
+		return e.from + (e.to-e.from)*(out-e.out)/e.frames
+	}
+	// The frame is older than the history, which happens only when the Player has just been created.
+	return p.entries[oldest%progressEntries].from
+}
+
+// Position returns the duration of the Player's data that has been played by the device. Position
+// counts the data written to the Player, so the position advances faster with SetRate greater than 1,
+// and stops while the Player is paused.
+//
+// The progress of the device is taken from the device's own sample counter where the driver reports it,
+// e.g. waveOutGetPosition on Windows. Otherwise, the device buffer is assumed to be full, and the
+// position is estimated from the bytes submitted to the device.
+//
+// Position is not related to SetPosition, which places the Player in space.
+func (p *Player) Position() time.Duration {
+	s := p.source
+	frames := atomic.LoadInt64(&s.startFrame) + s.progress.at(p.context.driverWriter.playedFrames())
+	return FramesToDuration(int(frames), s.sampleRate)
+}
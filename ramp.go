@@ -0,0 +1,70 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	"time"
+)
+
+// gainRampDuration is the length of the ramps of the gain changes, e.g. by Player.SetVolume and
+// Player.Pause. It is long enough not to click, and short enough not to be heard as a fade.
+const gainRampDuration = 5 * time.Millisecond
+
+// gainRampFrames returns the length of the gain ramps in frames at sampleRate.
+func gainRampFrames(sampleRate int) int {
+	return max(1, DurationToFrames(gainRampDuration, sampleRate))
+}
+
+// fadeOut plays the data for the gain ramp after a source stops, e.g. by Player.Pause, while the mux
+// ramps the gain down to 0 so that stopping doesn't click. fadeOut is used only by the context's loop.
+type fadeOut struct {
+	// size is the length of the gain ramp in bytes. left is the number of the bytes to play until the ramp
+	// ends, and fading is whether the fade-out has started.
+	size   int
+	left   int
+	fading bool
+}
+
+func newFadeOut(o *Options) fadeOut {
+	return fadeOut{size: gainRampFrames(o.SampleRate) * o.bytesPerFrame()}
+}
+
+// next returns the number of the bytes to play out of n for the fade-out. next returns 0 after the ramp
+// ends.
+func (f *fadeOut) next(n int) int {
+	if !f.fading {
+		f.fading = true
+		f.left = f.size
+	}
+	n = min(n, f.left)
+	f.left -= n
+	return n
+}
+
+// done reports whether the fade-out has ended.
+func (f *fadeOut) done() bool {
+	return f.fading && f.left == 0
+}
+
+// finish ends the fade-out at once, e.g. for a source that has played nothing.
+func (f *fadeOut) finish() {
+	f.fading = true
+	f.left = 0
+}
+
+// reset cancels the fade-out when the source plays again.
+func (f *fadeOut) reset() {
+	f.fading = false
+}
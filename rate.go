@@ -0,0 +1,191 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	"math"
+	"sync/atomic"
+
+	"github.com/leibnewton/oto/internal/dsp"
+	"github.com/leibnewton/oto/internal/rate"
+)
+
+const (
+	minRate = 0.25
+	maxRate = 4
+)
+
+// SetRate sets the playback rate of the Player. 1 is the original speed, which is the default, 2 plays
+// twice as fast, and 0.5 plays at the half speed. The rate is clamped to [0.25, 4].
+//
+// By default, the rate changes the pitch together like a tape. Call SetPreservePitch to keep the pitch,
+// e.g. to play a podcast at 1.5x.
+func (p *Player) SetRate(r float64) {
+	if math.IsNaN(r) {
+		r = 1
+	}
+	r = math.Max(minRate, math.Min(maxRate, r))
+	atomic.StoreUint32(&p.source.rate, math.Float32bits(float32(r)))
+}
+
+// Rate returns the playback rate of the Player.
+func (p *Player) Rate() float64 {
+	return float64(math.Float32frombits(atomic.LoadUint32(&p.source.rate)))
+}
+
+// SetPreservePitch sets whether the playback rate keeps the pitch. When preserve is true, the rate is
+// changed by time-stretching the sound with WSOLA (waveform similarity overlap-add) instead of
+// resampling it. This suits speech well, and might smear transients of music a little.
+//
+// Switching it during playback might skip a few milliseconds of the sound.
+func (p *Player) SetPreservePitch(preserve bool) {
+	v := int32(0)
+	if preserve {
+		v = 1
+	}
+	atomic.StoreInt32(&p.source.preservePitch, v)
+}
+
+// PreservePitch reports whether the playback rate keeps the pitch.
+func (p *Player) PreservePitch() bool {
+	return atomic.LoadInt32(&p.source.preservePitch) != 0
+}
+
+// SetPitch shifts the pitch of the Player by semitones without changing the speed. 12 plays an octave
+// higher, and -12 plays an octave lower. The shift is clamped to [-24, 24], and 0 is the default.
+//
+// The pitch is shifted by time-stretching the sound and then resampling it to the original speed. When
+// the rate doesn't preserve the pitch, the shift is added to the pitch change of the rate.
+func (p *Player) SetPitch(semitones float64) {
+	if math.IsNaN(semitones) {
+		semitones = 0
+	}
+	semitones = math.Max(-24, math.Min(24, semitones))
+	atomic.StoreUint32(&p.source.pitch, math.Float32bits(float32(semitones)))
+}
+
+// Pitch returns the pitch shift of the Player in semitones.
+func (p *Player) Pitch() float64 {
+	return float64(math.Float32frombits(atomic.LoadUint32(&p.source.pitch)))
+}
+
+// rateState converts the data of a Player to the playback rate and the pitch. rateState is created when
+// the rate or the pitch first differs from the default, and is kept afterwards so that the sound doesn't
+// jump when they return to the default.
+//
+// Without the pitch preservation and the pitch shift, the data is only resampled. Otherwise, the data is
+// time-stretched by WSOLA and then resampled: the resampling changes the pitch, and the time-stretching
+// makes up the speed.
+type rateState struct {
+	source         *playerSource
+	bytesPerSample int
+
+	varispeed *rate.Varispeed
+	wsola     *rate.WSOLA
+
+	// bytes and floats are reused so that read doesn't allocate in the steady state.
+	bytes  []byte
+	floats []float32
+}
+
+// read reads the Player's data at the playback rate and the pitch into buf.
+func (s *playerSource) read(buf []byte) (int, error) {
+	r := float64(math.Float32frombits(atomic.LoadUint32(&s.rate)))
+	semitones := float64(math.Float32frombits(atomic.LoadUint32(&s.pitch)))
+	preservePitch := atomic.LoadInt32(&s.preservePitch) != 0
+	if or, op := s.outputShift.load(); or != 1 || op != 0 {
+		// The rate of the whole output keeps the pitch, and its pitch shift is added to the Player's.
+		if !preservePitch {
+			semitones += 12 * math.Log2(r)
+			preservePitch = true
+		}
+		r *= float64(or)
+		semitones += float64(op)
+	}
+	if t := atomic.LoadUint32(&s.rateTrim); t != 0 {
+		r *= float64(math.Float32frombits(t))
+	}
+	if target := atomic.LoadInt64(&s.driftTarget); target > 0 {
+		frames := len(buf) / (s.channelNum * s.bytesPerSample)
+		r *= s.drift.update(int64(s.buf.Len()), target, frames, s.sampleRate)
+	}
+	if s.rateState == nil {
+		if r == 1 && semitones == 0 {
+			return s.buf.TryRead(buf)
+		}
+		s.rateState = &rateState{
+			source:         s,
+			bytesPerSample: s.bytesPerSample,
+		}
+	}
+	return s.rateState.read(buf, r, semitones, preservePitch)
+}
+
+func (r *rateState) read(buf []byte, speed, semitones float64, preservePitch bool) (int, error) {
+	n := len(buf) / r.bytesPerSample
+	if cap(r.floats) < n {
+		r.floats = make([]float32, n)
+	}
+	f := r.floats[:n]
+
+	s := r.source
+	if preservePitch || semitones != 0 {
+		// pitch is the ratio of the output frequency to the original one.
+		pitch := math.Pow(2, semitones/12)
+		if !preservePitch {
+			pitch *= speed
+		}
+		if r.wsola == nil {
+			r.wsola = rate.NewWSOLA(s.channelNum, s.sampleRate, r.decode)
+			r.varispeed = rate.NewVarispeed(s.channelNum, s.resampleQuality, r.wsola.Read)
+		}
+		r.wsola.SetRate(speed / pitch)
+		r.varispeed.SetRate(pitch)
+	} else {
+		if r.varispeed == nil || r.wsola != nil {
+			r.varispeed = rate.NewVarispeed(s.channelNum, s.resampleQuality, r.decode)
+		}
+		r.wsola = nil
+		r.varispeed.SetRate(speed)
+	}
+	n = r.varispeed.Read(f)
+
+	switch r.bytesPerSample {
+	case 1:
+		dsp.Float32sToUint8s(buf, f[:n])
+	case 2:
+		dsp.Float32sToInt16s(buf, f[:n])
+	}
+	return n * r.bytesPerSample, nil
+}
+
+// decode reads the Player's data from the buffer as floats. decode implements rate.Source.
+func (r *rateState) decode(f []float32) int {
+	l := len(f) * r.bytesPerSample
+	if cap(r.bytes) < l {
+		r.bytes = make([]byte, l)
+	}
+	b := r.bytes[:l]
+	n, _ := r.source.buf.TryRead(b)
+	n /= r.bytesPerSample * r.source.channelNum
+	n *= r.source.channelNum
+	switch r.bytesPerSample {
+	case 1:
+		dsp.Uint8sToFloat32s(f[:n], b[:n])
+	case 2:
+		dsp.Int16sToFloat32s(f[:n], b[:2*n])
+	}
+	return n
+}
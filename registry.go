@@ -0,0 +1,208 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	"fmt"
+	"sync"
+
+	otodriver "github.com/leibnewton/oto/driver"
+	"github.com/leibnewton/oto/internal/backend"
+)
+
+// dummyDriverName is the name of the dummy driver, which plays nothing. The dummy driver is used when no
+// device is available.
+const dummyDriverName = "dummy"
+
+// testDriverName is the name of the driver set by SetDriverForTesting.
+const testDriverName = "test"
+
+var (
+	testDriverM sync.Mutex
+	testDriver  otodriver.OpenFunc
+)
+
+// SetDriverForTesting makes the Contexts created after the call open the driver by open regardless of
+// Options.Driver, so that the application's audio logic can be tested without a device. nil stops
+// overriding the driver. The Context's Driver returns "test". SetDriverForTesting returns the function to
+// restore the previous driver:
+//
+//	d := ototest.NewDriver()
+//	defer oto.SetDriverForTesting(d.Open)()
+//
+// The Context writes to the driver as fast as TryWrite returns, so TryWrite should block like a device,
+// as the Driver of the package ototest does.
+func SetDriverForTesting(open otodriver.OpenFunc) (restore func()) {
+	testDriverM.Lock()
+	defer testDriverM.Unlock()
+
+	prev := testDriver
+	testDriver = open
+	return func() {
+		testDriverM.Lock()
+		defer testDriverM.Unlock()
+		testDriver = prev
+	}
+}
+
+func driverForTesting() otodriver.OpenFunc {
+	testDriverM.Lock()
+	defer testDriverM.Unlock()
+	return testDriver
+}
+
+// lookupDriver returns the function to open the driver registered to the package driver by the name.
+func lookupDriver(name string) (otodriver.OpenFunc, bool) {
+	if name == testDriverName {
+		if open := driverForTesting(); open != nil {
+			return open, true
+		}
+	}
+	return otodriver.Lookup(name)
+}
+
+// isBuiltinDriver reports whether the name is of a built-in driver, i.e. a subpackage of the package
+// driver, that is imported into the program. The built-in drivers are opened with all the options.
+func isBuiltinDriver(name string) bool {
+	_, ok := backend.Lookup(name)
+	return ok
+}
+
+// isRegisteredDriver reports whether the name is of a driver registered to the package driver or set by
+// SetDriverForTesting, except for the built-in drivers.
+func isRegisteredDriver(name string) bool {
+	if name == "" || name == dummyDriverName || isBuiltinDriver(name) {
+		return false
+	}
+	_, ok := lookupDriver(name)
+	return ok
+}
+
+// resolvedDriverName returns the name of the driver that the resolved options specify.
+func (o *Options) resolvedDriverName() string {
+	switch {
+	case o.Driver == "":
+	case o.Driver == dummyDriverName, isBuiltinDriver(o.Driver), isRegisteredDriver(o.Driver):
+		return o.Driver
+	}
+	return driverName
+}
+
+// newDriverByName opens the driver that the resolved options specify, except for the dummy driver.
+func newDriverByName(options *Options) (tryWriteCloser, error) {
+	name := options.resolvedDriverName()
+	if b, ok := backend.Lookup(name); ok {
+		return b.Open(options.backendParams())
+	}
+	open, ok := lookupDriver(name)
+	if !ok {
+		return nil, fmt.Errorf("oto: driver %q is not built into the program", name)
+	}
+	d, err := open(options.driverParams())
+	if err != nil {
+		return nil, err
+	}
+	return &registeredDriver{Driver: d}, nil
+}
+
+// driverParams returns the parameters to open a driver registered to the package driver.
+func (o *Options) driverParams() otodriver.Params {
+	return otodriver.Params{
+		SampleRate:     o.SampleRate,
+		ChannelNum:     o.ChannelNum,
+		BytesPerSample: o.Format.BytesPerSample(),
+		BufferFrames:   o.BufferFrames,
+		PeriodFrames:   o.PeriodFrames,
+		Device:         o.deviceNum(),
+	}
+}
+
+// backendParams returns the parameters to open a built-in driver.
+func (o *Options) backendParams() *backend.Params {
+	p := &backend.Params{
+		Params:                o.driverParams(),
+		PeriodCount:           o.PeriodCount,
+		StartThresholdFrames:  o.StartThresholdFrames,
+		IOBufferFrames:        o.IOBufferFrames,
+		XrunPolicy:            backend.XrunPolicy(o.XrunPolicy),
+		OnXrun:                o.OnXrun,
+		ALSADevice:            o.ALSADevice,
+		ALSAAccess:            backend.ALSAAccess(o.ALSAAccess),
+		PulseAdjustLatency:    o.PulseAdjustLatency,
+		MediaRole:             o.MediaRole,
+		SessionName:           o.SessionName,
+		SessionIconPath:       o.SessionIconPath,
+		WatchSessionVolume:    o.OnSessionVolumeChange != nil,
+		WinMMCallbackFunction: o.WinMMCallbackFunction,
+		Log: func(kind backend.EventKind, err error, format string, args ...interface{}) {
+			logEvent(o, driverEventKind(kind), err, format, args...)
+		},
+	}
+	if a := o.PulseBufferAttr; a != nil {
+		p.PulseBufferAttr = &backend.PulseBufferAttr{
+			MaxLength:    a.MaxLength,
+			TargetLength: a.TargetLength,
+			Prebuffer:    a.Prebuffer,
+			MinRequest:   a.MinRequest,
+		}
+	}
+	return p
+}
+
+func init() {
+	backend.DevicesChanged = notifyDevicesChanged
+	backend.SessionVolumeChanged = notifySessionVolumeChange
+	backend.Interrupted = notifyInterruption
+	backend.RouteChanged = func(change backend.RouteChange) {
+		notifyRouteChange(RouteChange(change))
+	}
+	backend.GestureSettings = gestureSettings
+}
+
+// registeredDriver adapts a registered driver to the optional interfaces of the built-in drivers.
+type registeredDriver struct {
+	otodriver.Driver
+}
+
+// Underruns implements driver.UnderrunCounter.
+func (r *registeredDriver) Underruns() int64 {
+	if u, ok := r.Driver.(otodriver.UnderrunCounter); ok {
+		return u.Underruns()
+	}
+	return 0
+}
+
+// QueuedFrames implements backend.FrameQueuer.
+func (r *registeredDriver) QueuedFrames() (int64, bool) {
+	if q, ok := r.Driver.(otodriver.FrameQueuer); ok {
+		return q.QueuedFrames(), true
+	}
+	return 0, false
+}
+
+// Cancel implements driver.Canceler.
+func (r *registeredDriver) Cancel() {
+	if c, ok := r.Driver.(otodriver.Canceler); ok {
+		c.Cancel()
+	}
+}
+
+// DeviceRemoved implements driver.RemovalWatcher.
+func (r *registeredDriver) DeviceRemoved() bool {
+	if w, ok := r.Driver.(otodriver.RemovalWatcher); ok {
+		return w.DeviceRemoved()
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// RouteChange represents a change of the route of the sound, e.g. to headphones.
+type RouteChange int
+
+const (
+	// RouteChangeNewDevice means a new output device is available, e.g. headphones are plugged in.
+	RouteChangeNewDevice RouteChange = iota
+
+	// RouteChangeOldDeviceUnavailable means the output device is unavailable, e.g. headphones are
+	// unplugged. What happens then is specified by Options.UnplugPolicy.
+	RouteChangeOldDeviceUnavailable
+
+	// RouteChangeOther means the route changes for another reason, e.g. by the category of the session.
+	RouteChangeOther
+)
+
+// String returns the name of the route change.
+func (r RouteChange) String() string {
+	switch r {
+	case RouteChangeNewDevice:
+		return "new-device"
+	case RouteChangeOldDeviceUnavailable:
+		return "old-device-unavailable"
+	case RouteChangeOther:
+		return "other"
+	}
+	return fmt.Sprintf("RouteChange(%d)", int(r))
+}
+
+// UnplugPolicy represents what happens when the output device becomes unavailable, e.g. headphones are
+// unplugged.
+type UnplugPolicy int
+
+const (
+	// UnplugPause pauses all the Players, as users expect on iOS so that the sound doesn't suddenly come
+	// out of the speaker. The Players stay paused until Player.Resume is called. This is the default
+	// policy.
+	UnplugPause UnplugPolicy = iota
+
+	// UnplugContinue keeps playing on the new route, e.g. the speaker.
+	UnplugContinue
+)
+
+// String returns the name of the unplug policy.
+func (p UnplugPolicy) String() string {
+	switch p {
+	case UnplugPause:
+		return "pause"
+	case UnplugContinue:
+		return "continue"
+	}
+	return fmt.Sprintf("UnplugPolicy(%d)", int(p))
+}
+
+// notifyRouteChange is called by the drivers when the route of the sound changes.
+func notifyRouteChange(change RouteChange) {
+	c := currentContext()
+	if c == nil {
+		return
+	}
+
+	if change == RouteChangeOldDeviceUnavailable && c.options.UnplugPolicy == UnplugPause {
+		for _, r := range c.mux.Sources() {
+			if s, ok := r.(*playerSource); ok {
+				atomic.StoreInt32(&s.paused, 1)
+			}
+		}
+	}
+	logEvent(c.options, EventRouteChanged, nil, "the route changed: %s", change)
+	if c.options.OnRouteChange != nil {
+		c.options.OnRouteChange(change)
+	}
+}
+
+// notifyDevicesChanged is called by the drivers when an output device is added or removed.
+func notifyDevicesChanged() {
+	c := currentContext()
+	if c == nil {
+		return
+	}
+	logEvent(c.options, EventDevicesChanged, nil, "the devices changed")
+	if c.options.OnDevicesChanged != nil {
+		c.options.OnDevicesChanged()
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	"fmt"
+
+	"github.com/leibnewton/oto/internal/backend"
+)
+
+// sessionVolumer returns the backend.SessionVolumer of the driver, or nil. sessionVolumer must be called with d.m
+// locked.
+func (d *driverWriter) sessionVolumer() backend.SessionVolumer {
+	driver := d.driver
+	if c, ok := driver.(*convertingDriver); ok {
+		driver = c.driver
+	}
+	v, _ := driver.(backend.SessionVolumer)
+	return v
+}
+
+// SetSessionVolume sets the volume of the audio session of the process in the system mixer, which is
+// what the user sees and controls as the volume of the application. volume is in [0, 1].
+//
+// SetSessionVolume returns an error when the driver doesn't support the session volume. Only the winmm
+// driver supports it, by ISimpleAudioVolume. See also Options.OnSessionVolumeChange.
+func (c *Context) SetSessionVolume(volume float64) error {
+	if volume < 0 || volume > 1 {
+		return fmt.Errorf("oto: the session volume must be in [0, 1] but %v", volume)
+	}
+	d := c.driverWriter
+	d.m.Lock()
+	defer d.m.Unlock()
+	v := d.sessionVolumer()
+	if v == nil {
+		return fmt.Errorf("oto: the driver doesn't support the session volume")
+	}
+	return v.SetSessionVolume(volume)
+}
+
+// SetSessionMute mutes or unmutes the audio session of the process in the system mixer.
+//
+// SetSessionMute returns an error when the driver doesn't support the session volume.
+func (c *Context) SetSessionMute(muted bool) error {
+	d := c.driverWriter
+	d.m.Lock()
+	defer d.m.Unlock()
+	v := d.sessionVolumer()
+	if v == nil {
+		return fmt.Errorf("oto: the driver doesn't support the session volume")
+	}
+	return v.SetSessionMute(muted)
+}
+
+// SessionVolume returns the volume and the mute of the audio session of the process in the system mixer.
+func (c *Context) SessionVolume() (volume float64, muted bool, err error) {
+	d := c.driverWriter
+	d.m.Lock()
+	defer d.m.Unlock()
+	v := d.sessionVolumer()
+	if v == nil {
+		return 0, false, fmt.Errorf("oto: the driver doesn't support the session volume")
+	}
+	return v.SessionVolume()
+}
+
+// notifySessionVolumeChange is called by the drivers when the volume or the mute of the session changes.
+func notifySessionVolumeChange(volume float64, muted bool) {
+	c := currentContext()
+	if c == nil || c.options.OnSessionVolumeChange == nil {
+		return
+	}
+	c.options.OnSessionVolumeChange(volume, muted)
+}
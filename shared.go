@@ -0,0 +1,116 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	"fmt"
+	"sync"
+)
+
+var (
+	sharedM     sync.Mutex
+	shared      *Context
+	sharedCount int
+)
+
+// SharedContextRef is a reference to the Context shared in the process. See SharedContext.
+type SharedContextRef struct {
+	context *Context
+	once    sync.Once
+}
+
+// SharedContext returns a reference to the Context shared in the process, creating the Context with the
+// options if there is no shared Context yet. This is for libraries that play sound independently of each
+// other, since there can only be one Context at any time.
+//
+// When the shared Context already exists, its format must be the same as the format that the options
+// specify, or SharedContext returns an error. The other options are ignored, and nil accepts any format.
+// nil options mean the default values of all the options when the shared Context is created.
+//
+// SharedContext returns an error when a Context that is not shared exists, e.g. one created by NewContext.
+//
+// The shared Context is closed when all the references are closed. The Context must not be closed
+// directly.
+func SharedContext(options *Options) (*SharedContextRef, error) {
+	sharedM.Lock()
+	defer sharedM.Unlock()
+
+	// The shared Context might have been closed by an error.
+	if shared != nil && shared.isClosed() {
+		shared = nil
+		sharedCount = 0
+	}
+
+	if shared == nil {
+		if options == nil {
+			options = &Options{}
+		}
+		c, err := newSharedContext(options)
+		if err != nil {
+			return nil, err
+		}
+		shared = c
+	} else if options != nil {
+		o, err := options.resolve()
+		if err != nil {
+			return nil, err
+		}
+		if got, want := o.deviceFormat(), shared.options.deviceFormat(); got != want {
+			return nil, fmt.Errorf("oto: the shared context is %+v, but %+v is requested", want, got)
+		}
+	}
+	sharedCount++
+	return &SharedContextRef{context: shared}, nil
+}
+
+// newSharedContext creates the shared Context, or returns an error when a Context that is not shared
+// exists.
+func newSharedContext(options *Options) (*Context, error) {
+	contextM.Lock()
+	defer contextM.Unlock()
+
+	if theContext != nil {
+		return nil, fmt.Errorf("oto: a Context that is not shared already exists")
+	}
+	return newContextFromOptions(options)
+}
+
+// Context returns the shared Context.
+func (r *SharedContextRef) Context() *Context {
+	return r.context
+}
+
+// Close releases the reference. The shared Context is closed when this is the last reference.
+//
+// Close does nothing but returns nil from the second call.
+func (r *SharedContextRef) Close() error {
+	var err error
+	r.once.Do(func() {
+		sharedM.Lock()
+		defer sharedM.Unlock()
+
+		if shared != r.context {
+			// The shared Context has already been replaced after it was closed by an error.
+			return
+		}
+		sharedCount--
+		if sharedCount > 0 {
+			return
+		}
+		shared = nil
+		err = r.context.Close()
+	})
+	return err
+}
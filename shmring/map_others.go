@@ -0,0 +1,40 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !darwin,!freebsd,!linux,!netbsd,!openbsd,!windows
+
+package shmring
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+func create(name string, size int) ([]byte, *os.File, func() error, error) {
+	return nil, nil, nil, fmt.Errorf("shmring: shared memory is not supported on %s", runtime.GOOS)
+}
+
+func open(name string) ([]byte, *os.File, func() error, error) {
+	return nil, nil, nil, fmt.Errorf("shmring: shared memory is not supported on %s", runtime.GOOS)
+}
+
+// OpenFile opens the Ring backed by f as the writer. OpenFile is not supported on this platform.
+func OpenFile(f *os.File) (*Ring, error) {
+	return nil, fmt.Errorf("shmring: shared memory is not supported on %s", runtime.GOOS)
+}
+
+func remove(name string) error {
+	return nil
+}
@@ -0,0 +1,130 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build darwin freebsd linux netbsd openbsd
+
+package shmring
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+func create(name string, size int) ([]byte, *os.File, func() error, error) {
+	var f *os.File
+	if name == "" {
+		af, err := anonymous()
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("shmring: creating an anonymous ring failed: %v", err)
+		}
+		f = af
+	} else {
+		p, err := path(name)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		nf, err := os.OpenFile(p, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("shmring: %v", err)
+		}
+		f = nf
+	}
+	mem, unmap, err := mapFile(f, size, true)
+	if err != nil {
+		f.Close()
+		if name != "" {
+			remove(name)
+		}
+		return nil, nil, nil, err
+	}
+	return mem, f, unmap, nil
+}
+
+func open(name string) ([]byte, *os.File, func() error, error) {
+	p, err := path(name)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	f, err := os.OpenFile(p, os.O_RDWR, 0)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("shmring: %v", err)
+	}
+	mem, unmap, err := mapExisting(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, nil, err
+	}
+	return mem, f, unmap, nil
+}
+
+// OpenFile opens the Ring backed by f as the writer, e.g. a file passed by the parent process that got it
+// with File. The Ring takes the ownership of f, and closes it when the Ring is closed.
+func OpenFile(f *os.File) (*Ring, error) {
+	mem, unmap, err := mapExisting(f)
+	if err != nil {
+		return nil, err
+	}
+	r, err := newWriter(mem, f, unmap)
+	if err != nil {
+		return nil, fmt.Errorf("shmring: %s: %v", f.Name(), err)
+	}
+	return r, nil
+}
+
+// mapExisting maps the whole file of an existing ring.
+func mapExisting(f *os.File) ([]byte, func() error, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, nil, fmt.Errorf("shmring: %v", err)
+	}
+	if fi.Size() < headerSize {
+		return nil, nil, fmt.Errorf("shmring: %s: not a ring", f.Name())
+	}
+	return mapFile(f, int(fi.Size()), false)
+}
+
+// mapFile maps size bytes of f in shared memory, extending f to the size first if extend is true.
+func mapFile(f *os.File, size int, extend bool) ([]byte, func() error, error) {
+	if extend {
+		if err := f.Truncate(int64(size)); err != nil {
+			return nil, nil, fmt.Errorf("shmring: %v", err)
+		}
+	}
+	mem, err := syscall.Mmap(int(f.Fd()), 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, fmt.Errorf("shmring: mmap failed: %v", err)
+	}
+	return mem, func() error {
+		return syscall.Munmap(mem)
+	}, nil
+}
+
+// path returns the path of the file of the ring with the name.
+func path(name string) (string, error) {
+	if strings.ContainsRune(name, '/') || name == "." || name == ".." {
+		return "", fmt.Errorf("shmring: invalid name: %q", name)
+	}
+	return filepath.Join(dir(), name), nil
+}
+
+func remove(name string) error {
+	p, err := path(name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(p)
+}
@@ -0,0 +1,129 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shmring
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"reflect"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	kernel32 = windows.NewLazySystemDLL("kernel32")
+
+	procCreateFileMappingW = kernel32.NewProc("CreateFileMappingW")
+	procOpenFileMappingW   = kernel32.NewProc("OpenFileMappingW")
+)
+
+const fileMapReadWrite = windows.FILE_MAP_READ | windows.FILE_MAP_WRITE
+
+func create(name string, size int) ([]byte, *os.File, func() error, error) {
+	if name == "" {
+		return nil, nil, nil, fmt.Errorf("shmring: a ring must have a name on Windows")
+	}
+	n, err := windows.UTF16PtrFromString(name)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("shmring: invalid name %q: %v", name, err)
+	}
+	// The memory is backed by the paging file, and is released when the last handle is closed.
+	h, _, e := procCreateFileMappingW.Call(uintptr(windows.InvalidHandle), 0, windows.PAGE_READWRITE,
+		uintptr(uint64(size)>>32), uintptr(uint32(size)), uintptr(unsafe.Pointer(n)))
+	if h == 0 {
+		return nil, nil, nil, fmt.Errorf("shmring: CreateFileMappingW failed: %v", e)
+	}
+	if e == windows.ERROR_ALREADY_EXISTS {
+		windows.CloseHandle(windows.Handle(h))
+		return nil, nil, nil, fmt.Errorf("shmring: the ring %q already exists", name)
+	}
+	mem, unmap, err := mapView(windows.Handle(h), size)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return mem, nil, unmap, nil
+}
+
+func open(name string) ([]byte, *os.File, func() error, error) {
+	n, err := windows.UTF16PtrFromString(name)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("shmring: invalid name %q: %v", name, err)
+	}
+	h, _, e := procOpenFileMappingW.Call(fileMapReadWrite, 0, uintptr(unsafe.Pointer(n)))
+	if h == 0 {
+		return nil, nil, nil, fmt.Errorf("shmring: OpenFileMappingW failed: %v", e)
+	}
+
+	// Map the header first to know the size of the whole ring.
+	addr, err := windows.MapViewOfFile(windows.Handle(h), fileMapReadWrite, 0, 0, headerSize)
+	if err != nil {
+		windows.CloseHandle(windows.Handle(h))
+		return nil, nil, nil, fmt.Errorf("shmring: MapViewOfFile failed: %v", err)
+	}
+	header := bytesAt(addr, headerSize)
+	verr := validate(header)
+	size := headerSize + int(binary.LittleEndian.Uint64(header[offsetSize:]))
+	windows.UnmapViewOfFile(addr)
+	if verr != nil {
+		windows.CloseHandle(windows.Handle(h))
+		return nil, nil, nil, fmt.Errorf("shmring: %s: %v", name, verr)
+	}
+
+	mem, unmap, err := mapView(windows.Handle(h), size)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return mem, nil, unmap, nil
+}
+
+// OpenFile opens the Ring backed by f as the writer. OpenFile is not supported on Windows, where a Ring
+// is opened by the name.
+func OpenFile(f *os.File) (*Ring, error) {
+	return nil, fmt.Errorf("shmring: OpenFile is not supported on Windows")
+}
+
+// mapView maps size bytes of the file mapping h. The returned function unmaps the view and closes h. h is
+// closed on errors.
+func mapView(h windows.Handle, size int) ([]byte, func() error, error) {
+	addr, err := windows.MapViewOfFile(h, fileMapReadWrite, 0, 0, uintptr(size))
+	if err != nil {
+		windows.CloseHandle(h)
+		return nil, nil, fmt.Errorf("shmring: MapViewOfFile failed: %v", err)
+	}
+	return bytesAt(addr, size), func() error {
+		err := windows.UnmapViewOfFile(addr)
+		if cerr := windows.CloseHandle(h); cerr != nil && err == nil {
+			err = cerr
+		}
+		return err
+	}, nil
+}
+
+// bytesAt returns the mapped memory at addr as a byte slice. The memory is outside of the Go heap.
+func bytesAt(addr uintptr, size int) []byte {
+	var b []byte
+	h := (*reflect.SliceHeader)(unsafe.Pointer(&b))
+	h.Data = addr
+	h.Len = size
+	h.Cap = size
+	return b
+}
+
+// remove does nothing, since the mapping is released when all the handles are closed.
+func remove(name string) error {
+	return nil
+}
@@ -0,0 +1,41 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build darwin freebsd netbsd openbsd
+
+package shmring
+
+import (
+	"io/ioutil"
+	"os"
+)
+
+// dir returns the directory of the named rings.
+func dir() string {
+	return os.TempDir()
+}
+
+// anonymous creates a file for an anonymous ring. The file is removed right after it is created, so that
+// it has no name in the file system.
+func anonymous() (*os.File, error) {
+	f, err := ioutil.TempFile("", "shmring")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Remove(f.Name()); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
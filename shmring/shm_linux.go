@@ -0,0 +1,39 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shmring
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// dir returns the directory of the named rings. /dev/shm is backed by memory, while Android doesn't have
+// it.
+func dir() string {
+	if fi, err := os.Stat("/dev/shm"); err == nil && fi.IsDir() {
+		return "/dev/shm"
+	}
+	return os.TempDir()
+}
+
+// anonymous creates a file for an anonymous ring, which has no name in the file system.
+func anonymous() (*os.File, error) {
+	fd, err := unix.MemfdCreate("shmring", unix.MFD_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+	return os.NewFile(uintptr(fd), "memfd:shmring"), nil
+}
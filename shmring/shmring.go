@@ -0,0 +1,394 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package shmring provides a ring buffer of PCM in shared memory, so that another process can play sound
+// through the process owning an Oto Context, e.g. a sandboxed plugin process playing through its host.
+//
+// The host creates the ring with Create, typically by oto's Context.NewIPCPlayer, and the other process
+// opens it by the name with Open and writes PCM with Write. The memory is a named file mapping on Windows,
+// and a file in /dev/shm on Linux or in the temporary directory on the other Unix systems. On Linux, an
+// empty name creates an anonymous memfd that is passed to a child process with File, e.g. as one of
+// exec.Cmd's ExtraFiles, and opened there with OpenFile.
+//
+// The ring has one reader and one writer. The positions are updated with atomic operations on the shared
+// memory, so that neither side waits for the other. shmring doesn't depend on oto, and the writer process
+// doesn't need cgo.
+package shmring
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// ErrClosed is returned by the operations on a Ring after the other side or the Ring itself is closed.
+var ErrClosed = errors.New("shmring: the ring is closed")
+
+// The layout of the shared memory. The integers are little endian, and head and tail are on their own
+// cache lines so that the reader and the writer don't contend.
+const (
+	offsetMagic          = 0
+	offsetVersion        = 4
+	offsetSize           = 8
+	offsetSampleRate     = 16
+	offsetChannelNum     = 20
+	offsetBytesPerSample = 24
+	offsetFlags          = 28
+	offsetHead           = 64
+	offsetTail           = 128
+	headerSize           = 192
+
+	magic   = 0x524f544f // "OTOR"
+	version = 1
+)
+
+// The bits of the flags.
+const (
+	flagReaderClosed = 1 << iota
+	flagWriterOpen
+)
+
+// writeInterval is the interval at which a blocking Write polls the ring for space. There is no wakeup
+// across processes, and the reader consumes the ring once per period of the device anyway.
+const writeInterval = time.Millisecond
+
+// Format is the format of the PCM in a Ring.
+type Format struct {
+	SampleRate     int
+	ChannelNum     int
+	BytesPerSample int
+}
+
+func (f Format) bytesPerFrame() int {
+	return f.ChannelNum * f.BytesPerSample
+}
+
+// Ring is a ring buffer of PCM in shared memory.
+//
+// The side that created the Ring reads it with TryRead, and the side that opened it writes it with Write
+// or TryWrite. Each side can use its Ring from different goroutines, but only one goroutine should read
+// or write at the same time.
+type Ring struct {
+	mem    []byte
+	data   []byte
+	format Format
+	name   string
+	reader bool
+
+	// file is the file backing the memory on Unix, and nil on Windows.
+	file *os.File
+
+	// unmap releases the mapping and the platform resources.
+	unmap func() error
+
+	closed bool
+	m      sync.Mutex
+}
+
+// Create creates a Ring with the name, the format and the size in bytes of the data. size is rounded down
+// to whole frames. Create fails when a ring with the same name exists.
+//
+// The Ring returned by Create is the reader, and the memory is removed when it is closed.
+func Create(name string, format Format, size int) (*Ring, error) {
+	if format.SampleRate <= 0 || format.ChannelNum <= 0 {
+		return nil, fmt.Errorf("shmring: invalid format: %+v", format)
+	}
+	if format.BytesPerSample != 1 && format.BytesPerSample != 2 {
+		return nil, fmt.Errorf("shmring: bytes per sample must be 1 or 2 but %d", format.BytesPerSample)
+	}
+	bpf := format.bytesPerFrame()
+	size = size / bpf * bpf
+	if size <= 0 {
+		return nil, fmt.Errorf("shmring: the size must be at least one frame (%d bytes)", bpf)
+	}
+
+	mem, file, unmap, err := create(name, headerSize+size)
+	if err != nil {
+		return nil, err
+	}
+	// Write the magic at last so that Open doesn't see a half-written header.
+	binary.LittleEndian.PutUint32(mem[offsetVersion:], version)
+	binary.LittleEndian.PutUint64(mem[offsetSize:], uint64(size))
+	binary.LittleEndian.PutUint32(mem[offsetSampleRate:], uint32(format.SampleRate))
+	binary.LittleEndian.PutUint32(mem[offsetChannelNum:], uint32(format.ChannelNum))
+	binary.LittleEndian.PutUint32(mem[offsetBytesPerSample:], uint32(format.BytesPerSample))
+	atomic.StoreUint32(uint32At(mem, offsetMagic), magic)
+
+	return &Ring{
+		mem:    mem,
+		data:   mem[headerSize:],
+		format: format,
+		name:   name,
+		reader: true,
+		file:   file,
+		unmap:  unmap,
+	}, nil
+}
+
+// Open opens the Ring created with the name by another process. The Ring returned by Open is the
+// writer.
+//
+// Opening a ring that already has a writer replaces it, so that a restarted process can continue to
+// play even when the previous one crashed without closing the ring.
+func Open(name string) (*Ring, error) {
+	if name == "" {
+		return nil, fmt.Errorf("shmring: the name must not be empty")
+	}
+	mem, file, unmap, err := open(name)
+	if err != nil {
+		return nil, err
+	}
+	r, err := newWriter(mem, file, unmap)
+	if err != nil {
+		return nil, fmt.Errorf("shmring: %s: %v", name, err)
+	}
+	r.name = name
+	return r, nil
+}
+
+// newWriter creates a writer Ring on the mapped memory, validating the header. newWriter releases the
+// mapping on errors.
+func newWriter(mem []byte, file *os.File, unmap func() error) (*Ring, error) {
+	if err := validate(mem); err != nil {
+		unmap()
+		return nil, err
+	}
+	size := binary.LittleEndian.Uint64(mem[offsetSize:])
+	if size > uint64(len(mem)-headerSize) {
+		unmap()
+		return nil, fmt.Errorf("the size %d exceeds the memory", size)
+	}
+	r := &Ring{
+		mem:  mem,
+		data: mem[headerSize : headerSize+size],
+		format: Format{
+			SampleRate:     int(binary.LittleEndian.Uint32(mem[offsetSampleRate:])),
+			ChannelNum:     int(binary.LittleEndian.Uint32(mem[offsetChannelNum:])),
+			BytesPerSample: int(binary.LittleEndian.Uint32(mem[offsetBytesPerSample:])),
+		},
+		file:  file,
+		unmap: unmap,
+	}
+	if r.flags()&flagReaderClosed != 0 {
+		unmap()
+		return nil, ErrClosed
+	}
+	r.setFlag(flagWriterOpen)
+	return r, nil
+}
+
+// validate checks the header of the mapped memory. The size is checked against the whole mapping by
+// newWriter.
+func validate(mem []byte) error {
+	if len(mem) < headerSize {
+		return fmt.Errorf("the memory is too small: %d bytes", len(mem))
+	}
+	if atomic.LoadUint32(uint32At(mem, offsetMagic)) != magic {
+		return fmt.Errorf("not a ring, or the ring is not ready yet")
+	}
+	if v := binary.LittleEndian.Uint32(mem[offsetVersion:]); v != version {
+		return fmt.Errorf("unsupported version %d", v)
+	}
+	if size := binary.LittleEndian.Uint64(mem[offsetSize:]); size == 0 {
+		return fmt.Errorf("invalid size %d", size)
+	}
+	return nil
+}
+
+// uint32At and uint64At return the pointers to the integers in the shared memory for the atomic
+// operations. The offsets are aligned, and the mapping is aligned to a page.
+func uint32At(mem []byte, offset int) *uint32 {
+	return (*uint32)(unsafe.Pointer(&mem[offset]))
+}
+
+func uint64At(mem []byte, offset int) *uint64 {
+	return (*uint64)(unsafe.Pointer(&mem[offset]))
+}
+
+func (r *Ring) head() *uint64 {
+	return uint64At(r.mem, offsetHead)
+}
+
+func (r *Ring) tail() *uint64 {
+	return uint64At(r.mem, offsetTail)
+}
+
+func (r *Ring) flags() uint32 {
+	return atomic.LoadUint32(uint32At(r.mem, offsetFlags))
+}
+
+func (r *Ring) setFlag(flag uint32) {
+	p := uint32At(r.mem, offsetFlags)
+	for {
+		f := atomic.LoadUint32(p)
+		if atomic.CompareAndSwapUint32(p, f, f|flag) {
+			return
+		}
+	}
+}
+
+func (r *Ring) clearFlag(flag uint32) {
+	p := uint32At(r.mem, offsetFlags)
+	for {
+		f := atomic.LoadUint32(p)
+		if atomic.CompareAndSwapUint32(p, f, f&^flag) {
+			return
+		}
+	}
+}
+
+// Name returns the name of the Ring. The name is empty for an anonymous Ring.
+func (r *Ring) Name() string {
+	return r.name
+}
+
+// Format returns the format of the PCM in the Ring.
+func (r *Ring) Format() Format {
+	return r.format
+}
+
+// Size returns the size of the data of the Ring in bytes.
+func (r *Ring) Size() int {
+	return len(r.data)
+}
+
+// File returns the file backing the Ring, which can be passed to a child process to open with OpenFile.
+// File returns nil on Windows.
+func (r *Ring) File() *os.File {
+	return r.file
+}
+
+// Len returns the number of the bytes written and not read yet.
+func (r *Ring) Len() int {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if r.closed {
+		return 0
+	}
+	return int(atomic.LoadUint64(r.tail()) - atomic.LoadUint64(r.head()))
+}
+
+// Connected reports whether a writer has the Ring open. Connected is false before a writer opens the
+// Ring, after the writer closes it, and after the Ring itself is closed.
+func (r *Ring) Connected() bool {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if r.closed {
+		return false
+	}
+	return r.flags()&flagWriterOpen != 0
+}
+
+// TryRead reads at most len(p) bytes from the Ring without blocking. TryRead returns 0 when the Ring is
+// empty.
+func (r *Ring) TryRead(p []byte) (int, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if r.closed {
+		return 0, ErrClosed
+	}
+	head := atomic.LoadUint64(r.head())
+	n := int(atomic.LoadUint64(r.tail()) - head)
+	if n > len(p) {
+		n = len(p)
+	}
+	r.copyOut(p[:n], head)
+	atomic.StoreUint64(r.head(), head+uint64(n))
+	return n, nil
+}
+
+// TryWrite writes at most len(p) bytes to the Ring without blocking, and returns the number of the bytes
+// written. TryWrite returns 0 when the Ring is full.
+func (r *Ring) TryWrite(p []byte) (int, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	return r.tryWrite(p)
+}
+
+func (r *Ring) tryWrite(p []byte) (int, error) {
+	if r.closed || r.flags()&flagReaderClosed != 0 {
+		return 0, ErrClosed
+	}
+	tail := atomic.LoadUint64(r.tail())
+	n := len(r.data) - int(tail-atomic.LoadUint64(r.head()))
+	if n > len(p) {
+		n = len(p)
+	}
+	r.copyIn(p[:n], tail)
+	atomic.StoreUint64(r.tail(), tail+uint64(n))
+	return n, nil
+}
+
+// Write writes p to the Ring, blocking until the reader consumes enough data. Write returns ErrClosed
+// when the reader or the Ring itself is closed.
+func (r *Ring) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n, err := r.TryWrite(p)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+		if n == 0 {
+			time.Sleep(writeInterval)
+		}
+	}
+	return written, nil
+}
+
+func (r *Ring) copyOut(p []byte, pos uint64) {
+	i := int(pos % uint64(len(r.data)))
+	n := copy(p, r.data[i:])
+	copy(p[n:], r.data)
+}
+
+func (r *Ring) copyIn(p []byte, pos uint64) {
+	i := int(pos % uint64(len(r.data)))
+	n := copy(r.data[i:], p)
+	copy(r.data, p[n:])
+}
+
+// Close closes the Ring, telling the other side. Closing the reader removes the shared memory, and
+// the writer's Write fails with ErrClosed. Close does nothing when the Ring is already closed.
+func (r *Ring) Close() error {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	if r.reader {
+		r.setFlag(flagReaderClosed)
+	} else {
+		r.clearFlag(flagWriterOpen)
+	}
+	err := r.unmap()
+	if r.file != nil {
+		if cerr := r.file.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	if r.reader && r.name != "" {
+		if rerr := remove(r.name); rerr != nil && err == nil {
+			err = rerr
+		}
+	}
+	return err
+}
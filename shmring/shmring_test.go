@@ -0,0 +1,109 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shmring_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/leibnewton/oto/shmring"
+)
+
+func TestReadWrite(t *testing.T) {
+	name := fmt.Sprintf("oto-shmring-test-%d", os.Getpid())
+	format := shmring.Format{SampleRate: 48000, ChannelNum: 2, BytesPerSample: 2}
+	host, err := shmring.Create(name, format, 257)
+	if err != nil {
+		t.Skipf("shared memory is not available: %v", err)
+	}
+	defer host.Close()
+	// The size is rounded down to whole frames.
+	if got, want := host.Size(), 256; got != want {
+		t.Errorf("Size(): got: %d, want: %d", got, want)
+	}
+	if host.Connected() {
+		t.Errorf("Connected() before Open: got: true, want: false")
+	}
+	if _, err := shmring.Create(name, format, 256); err == nil {
+		t.Errorf("Create with an existing name must fail")
+	}
+
+	client, err := shmring.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := client.Format(); got != format {
+		t.Errorf("Format(): got: %+v, want: %+v", got, format)
+	}
+
+	in := make([]byte, 10000)
+	for i := range in {
+		in[i] = byte(i)
+	}
+	go func() {
+		// Write in odd-sized chunks so that the data wraps around at various positions.
+		for i := 0; i < len(in); i += 77 {
+			end := i + 77
+			if end > len(in) {
+				end = len(in)
+			}
+			if _, err := client.Write(in[i:end]); err != nil {
+				panic(err)
+			}
+		}
+		client.Close()
+	}()
+
+	var out []byte
+	buf := make([]byte, 100)
+	for len(out) < len(in) {
+		n, err := host.TryRead(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, buf[:n]...)
+		if n == 0 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if !bytes.Equal(out, in) {
+		t.Errorf("the read data doesn't match with the written data")
+	}
+	for host.Connected() {
+		time.Sleep(time.Millisecond)
+	}
+
+	// A new writer can open the ring, and fails to write after the host closes the ring.
+	client, err = shmring.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if !host.Connected() {
+		t.Errorf("Connected() after a new writer opens the ring: got: false, want: true")
+	}
+	if err := host.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Write(make([]byte, 4)); err != shmring.ErrClosed {
+		t.Errorf("Write after the host is closed: got: %v, want: %v", err, shmring.ErrClosed)
+	}
+	if _, err := shmring.Open(name); err == nil {
+		t.Errorf("Open after the host is closed must fail")
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// Snapshot is the playback state of a Context taken by Context.Snapshot. Context.Restore rebuilds the
+// Players from a Snapshot, e.g. on a new Context after the device is lost.
+type Snapshot struct {
+	// SampleRate, ChannelNum and Format are the format of the Context, which is the format of the
+	// Players' data.
+	SampleRate int
+	ChannelNum int
+	Format     Format
+
+	// Players is the states of the Players in the order of their creation.
+	Players []PlayerState
+}
+
+// PlayerState is the state of a Player in a Snapshot.
+//
+// The effects, the equalizer, the channel matrix, the fade and the position in space are not included,
+// since they are set by the application. Set them again after Context.Restore.
+type PlayerState struct {
+	Volume        float64
+	GainDB        float64
+	Paused        bool
+	Rate          float64
+	Pitch         float64
+	PreservePitch bool
+	Balance       float64
+	Width         float64
+
+	// Position is the position of the first frame of Pending. See Player.Position.
+	Position time.Duration
+
+	// Pending is the data written to the Player that has not been mixed yet.
+	Pending []byte
+}
+
+// Snapshot returns the playback state of the Context: the states of the Players and the data in their
+// buffers. The data already mixed and queued in the device is not included, so the Players restored from
+// the Snapshot skip at most the duration of the device buffer.
+//
+// After the Context is closed, including when the loop feeding the device stops on an error, Snapshot
+// returns the state at the time of closing. Thus, the application can rebuild its sound after, e.g., a
+// driver crash without keeping track of the Players by itself.
+func (c *Context) Snapshot() *Snapshot {
+	c.closeM.Lock()
+	closed, s := c.closed, c.closedSnapshot
+	c.closeM.Unlock()
+	if closed {
+		return s
+	}
+	return c.snapshot()
+}
+
+func (c *Context) snapshot() *Snapshot {
+	s := &Snapshot{
+		SampleRate: c.options.SampleRate,
+		ChannelNum: c.options.ChannelNum,
+		Format:     c.options.Format,
+	}
+	var sources []*playerSource
+	for _, r := range c.mux.Sources() {
+		if p, ok := r.(*playerSource); ok {
+			sources = append(sources, p)
+		}
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		return sources[i].id < sources[j].id
+	})
+
+	bytesPerFrame := int64(c.options.bytesPerFrame())
+	// The loop doesn't read the buffers during Sync, so the pending data and the positions match.
+	c.mux.Sync(func() {
+		for _, p := range sources {
+			s.Players = append(s.Players, PlayerState{
+				Volume:        float64(p.volume32()),
+				GainDB:        loadFloat(&p.gainDB),
+				Paused:        atomic.LoadInt32(&p.paused) != 0,
+				Rate:          loadFloat(&p.rate),
+				Pitch:         loadFloat(&p.pitch),
+				PreservePitch: atomic.LoadInt32(&p.preservePitch) != 0,
+				Balance:       loadFloat(&p.balance),
+				Width:         loadFloat(&p.width),
+				Position:      FramesToDuration(int(atomic.LoadInt64(&p.startFrame)+p.buf.ReadBytes()/bytesPerFrame), p.sampleRate),
+				Pending:       p.buf.Peek(),
+			})
+		}
+	})
+	return s
+}
+
+// loadFloat returns the float32 whose bits are stored in v.
+func loadFloat(v *uint32) float64 {
+	return float64(math.Float32frombits(atomic.LoadUint32(v)))
+}
+
+// Restore creates the Players from the states in s, and returns them in the same order as s.Players.
+// The Players continue from the positions in s with the pending data. The format of the Context must be
+// the same as s.
+//
+// The pending data that doesn't fit in the Player's buffer is dropped, e.g. when the Context has a
+// smaller buffer than the Context where s was taken.
+func (c *Context) Restore(s *Snapshot) ([]*Player, error) {
+	if c.isClosed() {
+		return nil, ErrContextClosed
+	}
+	o := c.options
+	if s.SampleRate != o.SampleRate || s.ChannelNum != o.ChannelNum || s.Format != o.Format {
+		return nil, fmt.Errorf("oto: the snapshot format (%d Hz, %d channels, %v) differs from the Context's (%d Hz, %d channels, %v)",
+			s.SampleRate, s.ChannelNum, s.Format, o.SampleRate, o.ChannelNum, o.Format)
+	}
+
+	players := make([]*Player, 0, len(s.Players))
+	for _, st := range s.Players {
+		p := c.NewPlayer()
+		p.SetVolume(st.Volume)
+		p.SetGainDB(st.GainDB)
+		p.SetRate(st.Rate)
+		p.SetPitch(st.Pitch)
+		p.SetPreservePitch(st.PreservePitch)
+		p.SetBalance(st.Balance)
+		p.SetWidth(st.Width)
+		if st.Paused {
+			p.Pause()
+		}
+		// Round the position, since FramesToDuration rounds it down in the Snapshot.
+		start := (int64(st.Position)*int64(o.SampleRate) + int64(time.Second)/2) / int64(time.Second)
+		atomic.StoreInt64(&p.source.startFrame, start)
+
+		// Write never blocks since the data fits in the empty buffer.
+		pending := st.Pending[:len(st.Pending)/o.bytesPerFrame()*o.bytesPerFrame()]
+		if len(pending) > p.buf.Size() {
+			pending = pending[:p.buf.Size()/o.bytesPerFrame()*o.bytesPerFrame()]
+		}
+		if _, err := p.Write(pending); err != nil {
+			p.Close()
+			for _, p := range players {
+				p.Close()
+			}
+			return nil, err
+		}
+		players = append(players, p)
+	}
+	return players, nil
+}
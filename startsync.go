@@ -0,0 +1,118 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// StartSynced resumes the paused Players at the same frame of the output, e.g. for the stems of a song or
+// the tracks of a multi-track tool, which must stay phase-locked.
+//
+// Create the Players, pause them before writing, write their data, and then call StartSynced. A Player
+// paused before playing doesn't consume any data, so all the Players start from their first frames. The
+// Players must have enough data buffered, since a Player that underflows is padded with silence and falls
+// behind the others.
+//
+// StartSynced returns an error without starting any Player if a Player is not paused, is closed, or
+// belongs to another Context.
+func (c *Context) StartSynced(players ...*Player) error {
+	if err := c.checkStartable("StartSynced", players); err != nil {
+		return err
+	}
+	// The loop doesn't mix during Sync, so all the Players are mixed from the same period.
+	c.mux.Sync(func() {
+		for _, p := range players {
+			atomic.StoreInt32(&p.source.paused, 0)
+		}
+	})
+	c.updateDevicePause(nil)
+	return nil
+}
+
+// StartAt resumes the paused Players so that their first frames are heard at t, e.g. to start the same
+// stream on several machines at once. The start is sample-accurate: the Players start in the middle of a
+// period when t falls there. The time is converted to a frame by Clock, so its precision depends on the
+// device's counter. When t has already passed, the Players start as soon as possible.
+//
+// The requirements for the Players are the same as StartSynced.
+func (c *Context) StartAt(t time.Time, players ...*Player) error {
+	if err := c.checkStartable("StartAt", players); err != nil {
+		return err
+	}
+	clock := c.Clock()
+	start := clock.Frames + int64(t.Sub(clock.Time))*int64(c.options.SampleRate)/int64(time.Second)
+	c.mux.Sync(func() {
+		// The frames before the next period are already mixed.
+		if next := atomic.LoadInt64(&c.driverWriter.stats.framesWritten); start < next {
+			start = next
+		}
+		for _, p := range players {
+			atomic.StoreInt64(&p.source.startAt, start)
+			atomic.StoreInt32(&p.source.scheduled, 1)
+			atomic.StoreInt32(&p.source.paused, 0)
+		}
+	})
+	c.updateDevicePause(nil)
+	return nil
+}
+
+// checkStartable returns an error if any of the Players can't be started by op.
+func (c *Context) checkStartable(op string, players []*Player) error {
+	for _, p := range players {
+		if p.context != c {
+			return fmt.Errorf("oto: the Player belongs to another Context")
+		}
+		if p.isClosed() {
+			return ErrContextClosed
+		}
+		if !p.IsPaused() {
+			return fmt.Errorf("oto: the Player must be paused before %s", op)
+		}
+	}
+	return nil
+}
+
+// readScheduled reads the data for the mux while the Player waits for the start scheduled by StartAt.
+// out is the first mixed frame of buf. Silence is played before the start frame.
+func (s *playerSource) readScheduled(buf []byte, out int64) (int, error) {
+	bytesPerFrame := s.channelNum * s.bytesPerSample
+	// The gain doesn't ramp from silence at the start, so that the first frame is played as is. The frames
+	// before the start are silent, so snapping the gain for them doesn't click either.
+	s.gain = s.targetGain()
+	s.snapGain = true
+	s.fadeOut.reset()
+	offset := atomic.LoadInt64(&s.startAt) - out
+	if offset >= int64(len(buf)/bytesPerFrame) {
+		return 0, nil
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	l := int(offset) * bytesPerFrame
+	silence := byte(0)
+	if s.bytesPerSample == 1 {
+		silence = 128
+	}
+	for i := range buf[:l] {
+		buf[i] = silence
+	}
+	atomic.StoreInt32(&s.scheduled, 0)
+	n, err := s.read(buf[l:])
+	s.played = true
+	return l + n, err
+}
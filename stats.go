@@ -0,0 +1,145 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats represents the statistics of the playback of a Context.
+type Stats struct {
+	// Underruns is the number of times the device ran out of samples. Underruns are detected by the
+	// winmm and ALSA drivers, and the registered drivers implementing driver.UnderrunCounter. Underruns
+	// is always 0 with the other drivers.
+	Underruns int64
+
+	// PlayerUnderruns is the number of times the current Players didn't have enough data for a
+	// period, which was played as silence instead.
+	PlayerUnderruns int64
+
+	// PlayerOverruns is the number of times Write of the current Players had to wait since their
+	// buffers were full.
+	PlayerOverruns int64
+
+	// DeviceRestarts is the number of times the device was reopened, e.g. to grow the buffer by
+	// Options.AdaptiveBuffer.
+	DeviceRestarts int64
+
+	// FramesWritten is the number of frames passed to the driver.
+	FramesWritten int64
+
+	// Jitter is the smoothed deviation of the intervals between writes to the driver from the duration
+	// of the written samples. MaxJitter is the maximum of the deviation. Both are measured only after
+	// the buffer is filled first.
+	Jitter    time.Duration
+	MaxJitter time.Duration
+}
+
+// Stats returns the current statistics of the Context.
+//
+// Stats can be called from any goroutine.
+func (c *Context) Stats() Stats {
+	s := c.driverWriter.stats.snapshot()
+	for _, r := range c.mux.Sources() {
+		if p, ok := r.(*playerSource); ok {
+			s.PlayerUnderruns += p.buf.Underflows()
+			s.PlayerOverruns += p.buf.Overflows()
+		}
+	}
+	return s
+}
+
+// driverStats holds the counters updated by the goroutine feeding the device.
+// The 64bit fields are accessed atomically, and are placed first for the alignment on 32bit
+// platforms.
+type driverStats struct {
+	underruns     int64
+	restarts      int64
+	framesWritten int64
+	jitter        int64
+	maxJitter     int64
+
+	// framesPassed is the number of the frames accepted by the driver. Unlike framesWritten, the data
+	// pending in driverWriter is not counted.
+	framesPassed int64
+
+	// The following fields are used only by the feeding goroutine.
+
+	// underrunsBase is the number of the underruns of the drivers closed so far.
+	underrunsBase int64
+	lastWrite     time.Time
+	bytesWritten  int64
+}
+
+func (s *driverStats) snapshot() Stats {
+	return Stats{
+		Underruns:      atomic.LoadInt64(&s.underruns),
+		DeviceRestarts: atomic.LoadInt64(&s.restarts),
+		FramesWritten:  atomic.LoadInt64(&s.framesWritten),
+		Jitter:         time.Duration(atomic.LoadInt64(&s.jitter)),
+		MaxJitter:      time.Duration(atomic.LoadInt64(&s.maxJitter)),
+	}
+}
+
+// recordWrite records that n bytes were passed to the driver whose buffer has bufferSize bytes.
+func (s *driverStats) recordWrite(n, bytesPerFrame, bytesPerSecond, bufferSize int) {
+	now := time.Now()
+	last := s.lastWrite
+	s.lastWrite = now
+	s.bytesWritten += int64(n)
+	atomic.AddInt64(&s.framesWritten, int64(n/bytesPerFrame))
+
+	// Until the buffer is filled, the writes are not paced by the device.
+	if last.IsZero() || s.bytesWritten <= int64(bufferSize) {
+		return
+	}
+	d := now.Sub(last) - time.Duration(int64(n)*int64(time.Second)/int64(bytesPerSecond))
+	if d < 0 {
+		d = -d
+	}
+	// Smooth the deviation in the same way as the interarrival jitter of RTP (RFC 3550).
+	j := atomic.LoadInt64(&s.jitter)
+	atomic.StoreInt64(&s.jitter, j+(int64(d)-j)/16)
+	if int64(d) > atomic.LoadInt64(&s.maxJitter) {
+		atomic.StoreInt64(&s.maxJitter, int64(d))
+	}
+}
+
+// recordUnderruns records the number of the underruns of the current driver. recordUnderruns reports
+// whether the number has increased.
+func (s *driverStats) recordUnderruns(n int64) bool {
+	old := atomic.LoadInt64(&s.underruns)
+	atomic.StoreInt64(&s.underruns, s.underrunsBase+n)
+	return s.underrunsBase+n > old
+}
+
+// recordSuspend records that the driver whose number of underruns is n was closed to suspend the device.
+func (s *driverStats) recordSuspend(n int64) {
+	s.underrunsBase += n
+	atomic.StoreInt64(&s.underruns, s.underrunsBase)
+	s.bytesWritten = 0
+	s.lastWrite = time.Time{}
+}
+
+// recordRestart records that the driver whose number of underruns is n was closed and reopened.
+func (s *driverStats) recordRestart(n int64) {
+	s.underrunsBase += n
+	atomic.StoreInt64(&s.underruns, s.underrunsBase)
+	atomic.AddInt64(&s.restarts, 1)
+	// The new device buffer is filled first again.
+	s.bytesWritten = 0
+	s.lastWrite = time.Time{}
+}
@@ -0,0 +1,96 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	"math"
+	"sync/atomic"
+
+	"github.com/leibnewton/oto/internal/dsp"
+)
+
+// stereoState is the balance and the width applied to the frames, which ramp to the Player's parameters.
+type stereoState struct {
+	balance dsp.Ramper
+	width   dsp.Ramper
+}
+
+func newStereoState() *stereoState {
+	st := &stereoState{}
+	st.width.Reset(1)
+	return st
+}
+
+// SetBalance sets the balance of the Player's stereo sound. -1 plays only the left channel, 1 plays only
+// the right channel, and 0 plays both as they are, which is the default. Unlike panning, balance
+// attenuates one of the channels and doesn't move the sound of one channel to the other.
+//
+// The balance is clamped to [-1, 1]. SetBalance does nothing for a mono Context.
+func (p *Player) SetBalance(balance float64) {
+	if math.IsNaN(balance) {
+		balance = 0
+	}
+	balance = math.Max(-1, math.Min(1, balance))
+	atomic.StoreUint32(&p.source.balance, math.Float32bits(float32(balance)))
+}
+
+// Balance returns the balance of the Player.
+func (p *Player) Balance() float64 {
+	return float64(math.Float32frombits(atomic.LoadUint32(&p.source.balance)))
+}
+
+// SetWidth sets the stereo width of the Player by scaling the difference between the channels. 0 makes
+// the sound mono, 1 is the original width, which is the default, and a value above 1 widens the sound.
+//
+// A negative width or NaN is treated as 0. SetWidth does nothing for a mono Context.
+func (p *Player) SetWidth(width float64) {
+	if width < 0 || math.IsNaN(width) {
+		width = 0
+	}
+	atomic.StoreUint32(&p.source.width, math.Float32bits(float32(width)))
+}
+
+// Width returns the stereo width of the Player.
+func (p *Player) Width() float64 {
+	return float64(math.Float32frombits(atomic.LoadUint32(&p.source.width)))
+}
+
+// processStereo applies the width and the balance to the stereo frames in buf. The changes ramp like the
+// volume.
+func (s *playerSource) processStereo(buf []float32) {
+	st := s.stereo
+	st.balance.Set(math.Float32frombits(atomic.LoadUint32(&s.balance)), s.rampFrames)
+	st.width.Set(math.Float32frombits(atomic.LoadUint32(&s.width)), s.rampFrames)
+	if !st.balance.Ramping() && !st.width.Ramping() && st.balance.Value() == 0 && st.width.Value() == 1 {
+		return
+	}
+
+	frames := len(buf) / 2
+	for i := 0; i < frames; i++ {
+		b := st.balance.Next()
+		w := st.width.Next()
+
+		l, r := buf[2*i], buf[2*i+1]
+		mid := (l + r) / 2
+		side := (l - r) / 2 * w
+		l, r = mid+side, mid-side
+		if b > 0 {
+			l *= 1 - b
+		} else {
+			r *= 1 + b
+		}
+		buf[2*i], buf[2*i+1] = l, r
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	"time"
+
+	otodriver "github.com/leibnewton/oto/driver"
+)
+
+// suspendedDriver stands in for the device while the device is suspended by Options.SuspendOnSilence.
+// suspendedDriver discards the silence in real time so that the Players keep being consumed.
+type suspendedDriver struct {
+	bytesPerSecond int
+	start          time.Time
+	written        int64
+}
+
+func (s *suspendedDriver) TryWrite(data []byte) (int, error) {
+	if s.start.IsZero() {
+		s.start = time.Now()
+	}
+	s.written += int64(len(data))
+	if d := time.Until(s.start.Add(time.Duration(s.written * int64(time.Second) / int64(s.bytesPerSecond)))); d > 0 {
+		time.Sleep(d)
+	}
+	return len(data), nil
+}
+
+func (s *suspendedDriver) Close() error {
+	return nil
+}
+
+// isSilence reports whether all the samples in buf are silent in the format.
+func isSilence(buf []byte, format Format) bool {
+	var silence byte
+	if format == FormatUnsignedInt8 {
+		silence = 128
+	}
+	for _, b := range buf {
+		if b != silence {
+			return false
+		}
+	}
+	return true
+}
+
+// trackSilence counts the silent bytes passed to the driver. trackSilence must be called with d.m locked.
+func (d *driverWriter) trackSilence(buf []byte) {
+	if d.options.SuspendOnSilence == 0 {
+		return
+	}
+	if isSilence(buf, d.options.Format) {
+		d.silentBytes += int64(len(buf))
+		return
+	}
+	d.silentBytes = 0
+}
+
+// suspendIfSilent closes the device and replaces it with a suspendedDriver when the silence has lasted for
+// Options.SuspendOnSilence.
+func (d *driverWriter) suspendIfSilent() error {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	if d.options.SuspendOnSilence == 0 || d.keepAlive || d.driver == nil {
+		return nil
+	}
+	if _, ok := d.driver.(*suspendedDriver); ok {
+		return nil
+	}
+	if d.silentBytes < int64(d.options.SuspendOnSilence/time.Millisecond)*int64(d.bytesPerSecond)/1000 {
+		return nil
+	}
+
+	var underruns int64
+	if u, ok := d.driver.(otodriver.UnderrunCounter); ok {
+		underruns = u.Underruns()
+	}
+	d.stats.recordSuspend(underruns)
+	// The data queued in the device is silent, and can be dropped.
+	if err := d.driver.Close(); err != nil {
+		return err
+	}
+	d.driver = &suspendedDriver{bytesPerSecond: d.bytesPerSecond}
+	d.lastProgress = time.Time{}
+	logEvent(d.options, EventDeviceSuspended, nil, "suspended the device after silence for %v", d.options.SuspendOnSilence)
+	return nil
+}
+
+// resumeIfSuspended opens the device again if the device is suspended. resumeIfSuspended must be called
+// with d.m locked.
+func (d *driverWriter) resumeIfSuspended() error {
+	if _, ok := d.driver.(*suspendedDriver); !ok {
+		return nil
+	}
+	driver, err := openDriver(d.options)
+	if err != nil {
+		return err
+	}
+	d.driver = driver
+	d.silentBytes = 0
+	logEvent(d.options, EventDeviceResumed, nil, "resumed the device")
+	return d.applySettings()
+}
@@ -0,0 +1,69 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !js
+
+package oto
+
+// #include <mach/mach.h>
+// #include <mach/mach_time.h>
+// #include <mach/thread_policy.h>
+//
+// static kern_return_t oto_setTimeConstraintPolicy(double periodInSeconds) {
+//   mach_timebase_info_data_t info;
+//   mach_timebase_info(&info);
+//   double secondsToAbs = ((double)info.denom / (double)info.numer) * 1000000000.0;
+//
+//   // The thread needs a half of the period at most to compute the samples.
+//   thread_time_constraint_policy_data_t policy;
+//   policy.period = (uint32_t)(periodInSeconds * secondsToAbs);
+//   policy.computation = (uint32_t)(periodInSeconds * secondsToAbs / 4);
+//   policy.constraint = (uint32_t)(periodInSeconds * secondsToAbs / 2);
+//   policy.preemptible = 1;
+//   return thread_policy_set(mach_thread_self(), THREAD_TIME_CONSTRAINT_POLICY,
+//                            (thread_policy_t)&policy, THREAD_TIME_CONSTRAINT_POLICY_COUNT);
+// }
+//
+// static kern_return_t oto_setStandardPolicy() {
+//   thread_standard_policy_data_t policy;
+//   return thread_policy_set(mach_thread_self(), THREAD_STANDARD_POLICY,
+//                            (thread_policy_t)&policy, THREAD_STANDARD_POLICY_COUNT);
+// }
+import "C"
+
+import (
+	"fmt"
+)
+
+// raiseThreadPriority sets the time-constraint policy to the current OS thread when
+// options.RealtimeThread is true.
+//
+// The caller must lock the current goroutine to the OS thread. The returned function reverts the
+// policy.
+func raiseThreadPriority(options *Options) (func(), error) {
+	if !options.RealtimeThread {
+		return func() {}, nil
+	}
+
+	period := options.PeriodDuration
+	if period == 0 {
+		period = options.BufferDuration
+	}
+	if r := C.oto_setTimeConstraintPolicy(C.double(period.Seconds())); r != C.KERN_SUCCESS {
+		return nil, fmt.Errorf("oto: thread_policy_set failed: %d", r)
+	}
+	return func() {
+		C.oto_setStandardPolicy()
+	}, nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !js
+
+package oto
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	schedOther = 0
+	schedFIFO  = 1
+
+	// realtimePriority is the priority for SCHED_FIFO. This is low enough not to compete with
+	// the kernel's and the sound server's threads.
+	realtimePriority = 10
+)
+
+type schedParam struct {
+	priority int32
+}
+
+func schedSetscheduler(tid int, policy int, priority int32) error {
+	p := schedParam{priority: priority}
+	if _, _, e := syscall.RawSyscall(syscall.SYS_SCHED_SETSCHEDULER, uintptr(tid), uintptr(policy), uintptr(unsafe.Pointer(&p))); e != 0 {
+		return e
+	}
+	return nil
+}
+
+// raiseThreadPriority promotes the current OS thread to SCHED_FIFO when options.RealtimeThread is true.
+// This fails with EPERM unless the process has CAP_SYS_NICE or a non-zero RLIMIT_RTPRIO.
+//
+// The caller must lock the current goroutine to the OS thread. The returned function reverts the
+// policy.
+func raiseThreadPriority(options *Options) (func(), error) {
+	if !options.RealtimeThread {
+		return func() {}, nil
+	}
+
+	tid := syscall.Gettid()
+	if err := schedSetscheduler(tid, schedFIFO, realtimePriority); err != nil {
+		return nil, fmt.Errorf("oto: sched_setscheduler failed: %v", err)
+	}
+	return func() {
+		schedSetscheduler(tid, schedOther, 0)
+	}, nil
+}
@@ -12,14 +12,10 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-// +build !js js,wasm
+// +build !windows,!linux,!darwin js
 
 package oto
 
-import (
-	"io"
-)
-
-func pipe() (io.ReadCloser, io.WriteCloser) {
-	return io.Pipe()
+func raiseThreadPriority(options *Options) (func(), error) {
+	return func() {}, nil
 }
@@ -0,0 +1,61 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !js
+
+package oto
+
+import (
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	avrt = windows.NewLazySystemDLL("avrt")
+)
+
+var (
+	procAvSetMmThreadCharacteristicsW   = avrt.NewProc("AvSetMmThreadCharacteristicsW")
+	procAvRevertMmThreadCharacteristics = avrt.NewProc("AvRevertMmThreadCharacteristics")
+)
+
+// raiseThreadPriority registers the current OS thread with MMCSS (Multimedia Class Scheduler Service)
+// as a "Pro Audio" task, so that the scheduler prioritizes the thread feeding the device.
+//
+// This is always done regardless of options.RealtimeThread, since MMCSS is designed for normal
+// applications and doesn't require any privileges.
+//
+// The caller must lock the current goroutine to the OS thread. The returned function reverts the
+// priority.
+func raiseThreadPriority(options *Options) (func(), error) {
+	// avrt.dll is not available before Windows Vista.
+	if err := avrt.Load(); err != nil {
+		return nil, err
+	}
+
+	name, err := windows.UTF16PtrFromString("Pro Audio")
+	if err != nil {
+		return nil, err
+	}
+	var taskIndex uint32
+	h, _, e := procAvSetMmThreadCharacteristicsW.Call(uintptr(unsafe.Pointer(name)), uintptr(unsafe.Pointer(&taskIndex)))
+	if h == 0 {
+		return nil, fmt.Errorf("oto: AvSetMmThreadCharacteristicsW failed: %v", e)
+	}
+	return func() {
+		procAvRevertMmThreadCharacteristics.Call(h)
+	}, nil
+}
@@ -0,0 +1,352 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oto
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrVoiceLimit is returned by VoicePool.Play when all the voices are playing and no voice can be stolen.
+var ErrVoiceLimit = errors.New("oto: all the voices are playing")
+
+// StealPolicy specifies which voice a VoicePool stops to play a new sound when all the voices are playing.
+type StealPolicy int
+
+const (
+	// StealOldest stops the voice that started first.
+	StealOldest StealPolicy = iota
+
+	// StealQuietest stops the voice whose last mixed period is the quietest, considering its volume.
+	StealQuietest
+
+	// StealLowestPriority stops the voice with the lowest priority, and the oldest one among them. A voice
+	// with a higher priority than the new sound is never stopped.
+	StealLowestPriority
+
+	// StealNone doesn't stop any voice, and the new sound is not played.
+	StealNone
+)
+
+func (s StealPolicy) String() string {
+	switch s {
+	case StealOldest:
+		return "oldest"
+	case StealQuietest:
+		return "quietest"
+	case StealLowestPriority:
+		return "lowest priority"
+	case StealNone:
+		return "none"
+	}
+	return fmt.Sprintf("StealPolicy(%d)", int(s))
+}
+
+// VoicePool plays short sounds from memory with bounded polyphony, e.g. for the sound effects of a game
+// firing hundreds of sounds. At most the given number of voices play at the same time. When all the voices
+// are playing, Play stops a voice by the StealPolicy, which fades out over a few milliseconds so that it
+// doesn't click.
+//
+// A voice is lighter than a Player: it has no buffer and no goroutine, and is mixed directly from the data.
+// VoicePool can be used from different goroutines concurrently.
+type VoicePool struct {
+	context   *Context
+	maxVoices int
+	policy    StealPolicy
+
+	// voices is the voices that are playing or fading out, in the order of their start.
+	voices []*Voice
+	closed bool
+
+	m sync.Mutex
+}
+
+// Voice is a sound played by VoicePool.Play.
+type Voice struct {
+	pool     *VoicePool
+	source   *voiceSource
+	priority int
+}
+
+// NewVoicePool creates a VoicePool playing at most maxVoices sounds at the same time.
+func (c *Context) NewVoicePool(maxVoices int, policy StealPolicy) (*VoicePool, error) {
+	if maxVoices <= 0 {
+		return nil, fmt.Errorf("oto: the number of voices must be positive but %d", maxVoices)
+	}
+	if policy < StealOldest || policy > StealNone {
+		return nil, fmt.Errorf("oto: invalid StealPolicy: %v", policy)
+	}
+	return &VoicePool{
+		context:   c,
+		maxVoices: maxVoices,
+		policy:    policy,
+	}, nil
+}
+
+// Play plays data once with the volume and the priority, which is used by StealLowestPriority. data is in
+// the format of the Context, and must be whole frames. data must not be modified while the voice is
+// playing. The volume is a linear gain like Player.SetVolume.
+//
+// When all the voices are playing, Play stops one of them by the StealPolicy. Play returns ErrVoiceLimit
+// when no voice can be stopped.
+func (p *VoicePool) Play(data []byte, volume float64, priority int) (*Voice, error) {
+	c := p.context
+	if bpf := c.options.bytesPerFrame(); len(data)%bpf != 0 {
+		return nil, fmt.Errorf("oto: Play length %d is not a multiple of the frame size %d", len(data), bpf)
+	}
+
+	p.m.Lock()
+	defer p.m.Unlock()
+	if p.closed {
+		return nil, fmt.Errorf("oto: the voice pool is closed")
+	}
+	// Hold the Context's close lock until the voice is added, so that the Context is not closed in between
+	// and the mux is still open at AddSource.
+	c.closeM.Lock()
+	defer c.closeM.Unlock()
+	if c.closed {
+		return nil, ErrContextClosed
+	}
+	p.reap()
+	if p.playing() >= p.maxVoices {
+		v := p.victim(priority)
+		if v == nil {
+			return nil, ErrVoiceLimit
+		}
+		v.source.stop()
+	}
+
+	v := &Voice{
+		pool: p,
+		source: &voiceSource{
+			data:        data,
+			peak:        math.Float32bits(-1),
+			interrupted: &c.interrupted,
+			fadeOut:     newFadeOut(c.options),
+		},
+		priority: priority,
+	}
+	v.SetVolume(volume)
+	p.voices = append(p.voices, v)
+	c.mux.AddSource(v.source)
+	return v, nil
+}
+
+// playing returns the number of the voices that are not stopped. playing must be called with p.m locked.
+func (p *VoicePool) playing() int {
+	n := 0
+	for _, v := range p.voices {
+		if !v.source.isStopped() {
+			n++
+		}
+	}
+	return n
+}
+
+// victim returns the voice to stop by the policy to play a sound with priority, or nil. victim must be
+// called with p.m locked.
+func (p *VoicePool) victim(priority int) *Voice {
+	var victim *Voice
+	for _, v := range p.voices {
+		if v.source.isStopped() {
+			continue
+		}
+		switch p.policy {
+		case StealOldest:
+			return v
+		case StealQuietest:
+			if victim == nil || v.source.loudness() < victim.source.loudness() {
+				victim = v
+			}
+		case StealLowestPriority:
+			if v.priority > priority {
+				continue
+			}
+			if victim == nil || v.priority < victim.priority {
+				victim = v
+			}
+		}
+	}
+	return victim
+}
+
+// reap forgets the voices that have finished. The mux has removed them already, since a voice source is
+// a mux.Finisher. reap must be called with p.m locked.
+func (p *VoicePool) reap() {
+	voices := p.voices[:0]
+	for _, v := range p.voices {
+		if v.source.isDone() {
+			continue
+		}
+		voices = append(voices, v)
+	}
+	for i := len(voices); i < len(p.voices); i++ {
+		p.voices[i] = nil
+	}
+	p.voices = voices
+}
+
+// Playing returns the number of the voices playing.
+func (p *VoicePool) Playing() int {
+	p.m.Lock()
+	defer p.m.Unlock()
+	p.reap()
+	return p.playing()
+}
+
+// Close stops all the voices. The VoicePool is no longer usable after calling Close.
+func (p *VoicePool) Close() error {
+	p.m.Lock()
+	defer p.m.Unlock()
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	for _, v := range p.voices {
+		p.context.mux.RemoveSource(v.source)
+	}
+	p.voices = nil
+	return nil
+}
+
+// SetVolume sets the volume of the voice like Player.SetVolume.
+func (v *Voice) SetVolume(volume float64) {
+	if volume < 0 || math.IsNaN(volume) {
+		volume = 0
+	}
+	atomic.StoreUint32(&v.source.volume, math.Float32bits(float32(volume)))
+}
+
+// Stop stops the voice. The voice fades out over a few milliseconds.
+func (v *Voice) Stop() {
+	v.source.stop()
+}
+
+// IsPlaying reports whether the voice is still playing. IsPlaying is false after the data is played, or
+// after the voice is stopped or stolen.
+func (v *Voice) IsPlaying() bool {
+	return !v.source.isStopped() && !v.source.isDone()
+}
+
+// voiceSource is the source of a Voice for the mux. The fields other than the atomic ones are used only by
+// the Context's loop.
+type voiceSource struct {
+	data []byte
+	pos  int
+
+	// volume is the bits of the float32 gain, and peak is the bits of the float32 peak of the last mixed
+	// period. peak is negative until the voice is mixed.
+	volume uint32
+	peak   uint32
+
+	// stopped is 1 after the voice is stopped, and done is 1 after the voice has finished, including the
+	// fade-out after it is stopped.
+	stopped int32
+	done    int32
+
+	// interrupted points to the Context's interrupted, which pauses the voices too.
+	interrupted *int32
+
+	// gain is the gain for the data of the last Read, and fadeOut plays the data for the gain ramp after
+	// the voice stops.
+	gain    float32
+	fadeOut fadeOut
+}
+
+func (s *voiceSource) Read(buf []byte) (int, error) {
+	if s.isDone() {
+		return 0, io.EOF
+	}
+	stopped := s.isStopped()
+	if stopped || atomic.LoadInt32(s.interrupted) != 0 {
+		s.gain = 0
+		if s.fadeOut.done() {
+			if stopped {
+				atomic.StoreInt32(&s.done, 1)
+				return 0, io.EOF
+			}
+			return 0, nil
+		}
+		// Play the data for the ramp while the mux ramps the gain down to 0 like a paused Player.
+		return s.read(buf[:s.fadeOut.next(len(buf))])
+	}
+	s.gain = math.Float32frombits(atomic.LoadUint32(&s.volume))
+	s.fadeOut.reset()
+	return s.read(buf)
+}
+
+func (s *voiceSource) read(buf []byte) (int, error) {
+	n := copy(buf, s.data[s.pos:])
+	s.pos += n
+	if s.pos == len(s.data) {
+		atomic.StoreInt32(&s.done, 1)
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Gain implements mux.Gainer.
+func (s *voiceSource) Gain() float32 {
+	return s.gain
+}
+
+// Monitor implements mux.Monitor.
+func (s *voiceSource) Monitor(buf []float32) {
+	var peak float32
+	for _, v := range buf {
+		if v < 0 {
+			v = -v
+		}
+		if peak < v {
+			peak = v
+		}
+	}
+	atomic.StoreUint32(&s.peak, math.Float32bits(peak))
+}
+
+// loudness returns the peak of the last mixed period. A voice that has not been mixed yet is regarded as
+// loud as its volume, so that a new voice is not stolen before it is heard.
+func (s *voiceSource) loudness() float32 {
+	if peak := math.Float32frombits(atomic.LoadUint32(&s.peak)); peak >= 0 {
+		return peak
+	}
+	return math.Float32frombits(atomic.LoadUint32(&s.volume))
+}
+
+func (s *voiceSource) stop() {
+	atomic.StoreInt32(&s.stopped, 1)
+}
+
+func (s *voiceSource) isStopped() bool {
+	return atomic.LoadInt32(&s.stopped) != 0
+}
+
+func (s *voiceSource) isDone() bool {
+	return atomic.LoadInt32(&s.done) != 0
+}
+
+// Finished implements mux.Finisher, so that the mux stops mixing the voice as soon as it is done.
+func (s *voiceSource) Finished() bool {
+	return s.isDone()
+}
+
+// Close implements io.Closer. The Context closes its sources when it is closed.
+func (s *voiceSource) Close() error {
+	return nil
+}
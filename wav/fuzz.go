@@ -0,0 +1,51 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build gofuzz
+
+package wav
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// Fuzz is the entry point of go-fuzz. Fuzz parses data as a WAV file, and checks that the format of a
+// parsed file is one that Oto can play:
+//
+//	go-fuzz-build github.com/leibnewton/oto/wav
+//	go-fuzz -bin wav-fuzz.zip
+func Fuzz(data []byte) int {
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		if r != nil {
+			panic("wav: NewReader returns a Reader with an error")
+		}
+		return 0
+	}
+	f := r.Format
+	if f.ChannelNum <= 0 || (f.BytesPerSample != 1 && f.BytesPerSample != 2) {
+		panic(fmt.Sprintf("wav: invalid format: %+v", f))
+	}
+	n, err := io.Copy(ioutil.Discard, r)
+	if err != nil {
+		panic(err)
+	}
+	if n > r.Length {
+		panic(fmt.Sprintf("wav: %d bytes are read beyond the length %d", n, r.Length))
+	}
+	return 1
+}
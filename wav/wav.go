@@ -0,0 +1,161 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package wav offers a minimal parser of RIFF/WAVE files to play them with Oto.
+//
+//	f, _ := os.Open("sound.wav")
+//	r, err := wav.NewReader(f)
+//	if err != nil {
+//		return err
+//	}
+//	c, err := oto.NewContext(-1, r.Format.SampleRate, r.Format.ChannelNum, r.Format.BytesPerSample, 8192)
+//	...
+//	io.Copy(c.NewPlayer(), r)
+//
+// Only linear PCM with 8 or 16 bits per sample is supported, which is what Oto plays.
+package wav
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// Format represents the format of the samples of a WAV file. BytesPerSample is 1 for unsigned 8bit
+// samples and 2 for signed 16bit little-endian samples, like oto.Format.
+type Format struct {
+	SampleRate     int
+	ChannelNum     int
+	BytesPerSample int
+}
+
+// Reader reads the PCM samples of a WAV file. Reader implements io.Reader.
+type Reader struct {
+	// Format is the format of the samples.
+	Format Format
+
+	// Length is the length of the samples in bytes.
+	Length int64
+
+	r io.Reader
+}
+
+const (
+	formatPCM        = 1
+	formatExtensible = 0xfffe
+
+	// maxFormatSize is the size of the fmt chunk of WAVE_FORMAT_EXTENSIBLE, which has all the fields that
+	// are read.
+	maxFormatSize = 40
+)
+
+// NewReader parses the header of the WAV file in r. The returned Reader reads the samples that follow.
+func NewReader(r io.Reader) (*Reader, error) {
+	var riff [12]byte
+	if _, err := io.ReadFull(r, riff[:]); err != nil {
+		return nil, err
+	}
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return nil, errors.New("wav: not a WAV file")
+	}
+
+	var f Format
+	var hasFormat bool
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			if err == io.EOF {
+				return nil, errors.New("wav: no data chunk")
+			}
+			return nil, err
+		}
+		id := string(chunk[0:4])
+		size := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+		switch id {
+		case "fmt ":
+			var err error
+			f, err = readFormat(r, size)
+			if err != nil {
+				return nil, err
+			}
+			hasFormat = true
+			// readFormat reads the whole chunk.
+			size = 0
+		case "data":
+			if !hasFormat {
+				return nil, errors.New("wav: the data chunk comes before the fmt chunk")
+			}
+			return &Reader{
+				Format: f,
+				Length: size,
+				r:      io.LimitReader(r, size),
+			}, nil
+		}
+		// Skip the chunk, including the padding byte of an odd-sized chunk.
+		if _, err := io.CopyN(ioutil.Discard, r, size+size%2); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func readFormat(r io.Reader, size int64) (Format, error) {
+	if size < 16 {
+		return Format{}, fmt.Errorf("wav: too short fmt chunk: %d bytes", size)
+	}
+	// Only the known part is read into memory, so that a broken size doesn't make a huge allocation.
+	n := size
+	if n > maxFormatSize {
+		n = maxFormatSize
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return Format{}, err
+	}
+	if _, err := io.CopyN(ioutil.Discard, r, size-n+size%2); err != nil {
+		return Format{}, err
+	}
+
+	tag := binary.LittleEndian.Uint16(b[0:2])
+	if tag == formatExtensible && size >= 40 {
+		// The first 2 bytes of the sub format GUID are the format tag.
+		tag = binary.LittleEndian.Uint16(b[24:26])
+	}
+	if tag != formatPCM {
+		return Format{}, fmt.Errorf("wav: only linear PCM is supported but the format tag is %#x", tag)
+	}
+
+	f := Format{
+		ChannelNum: int(binary.LittleEndian.Uint16(b[2:4])),
+		SampleRate: int(binary.LittleEndian.Uint32(b[4:8])),
+	}
+	switch bits := binary.LittleEndian.Uint16(b[14:16]); bits {
+	case 8:
+		f.BytesPerSample = 1
+	case 16:
+		f.BytesPerSample = 2
+	default:
+		return Format{}, fmt.Errorf("wav: only 8 or 16 bits per sample are supported but %d", bits)
+	}
+	if f.ChannelNum == 0 {
+		return Format{}, errors.New("wav: the number of channels is 0")
+	}
+	return f, nil
+}
+
+// Read implements io.Reader.
+func (r *Reader) Read(buf []byte) (int, error) {
+	return r.r.Read(buf)
+}
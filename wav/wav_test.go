@@ -0,0 +1,167 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wav_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/leibnewton/oto/wav"
+)
+
+func wavFile(tag uint16, channels, rate, bits int, extra []byte, data []byte) []byte {
+	var b bytes.Buffer
+	b.WriteString("RIFF")
+	binary.Write(&b, binary.LittleEndian, uint32(0))
+	b.WriteString("WAVE")
+
+	// An unknown chunk of an odd size is skipped with its padding byte.
+	b.WriteString("LIST")
+	binary.Write(&b, binary.LittleEndian, uint32(3))
+	b.Write([]byte{1, 2, 3, 0})
+
+	b.WriteString("fmt ")
+	binary.Write(&b, binary.LittleEndian, uint32(16+len(extra)))
+	binary.Write(&b, binary.LittleEndian, tag)
+	binary.Write(&b, binary.LittleEndian, uint16(channels))
+	binary.Write(&b, binary.LittleEndian, uint32(rate))
+	binary.Write(&b, binary.LittleEndian, uint32(rate*channels*bits/8))
+	binary.Write(&b, binary.LittleEndian, uint16(channels*bits/8))
+	binary.Write(&b, binary.LittleEndian, uint16(bits))
+	b.Write(extra)
+
+	b.WriteString("data")
+	binary.Write(&b, binary.LittleEndian, uint32(len(data)))
+	b.Write(data)
+	return b.Bytes()
+}
+
+func TestReader(t *testing.T) {
+	data := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	r, err := wav.NewReader(bytes.NewReader(wavFile(1, 2, 48000, 16, nil, data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := r.Format, (wav.Format{SampleRate: 48000, ChannelNum: 2, BytesPerSample: 2}); got != want {
+		t.Errorf("Format: got: %+v, want: %+v", got, want)
+	}
+	if got, want := r.Length, int64(len(data)); got != want {
+		t.Errorf("Length: got: %d, want: %d", got, want)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("data: got: %v, want: %v", got, data)
+	}
+}
+
+func TestExtensible(t *testing.T) {
+	extra := make([]byte, 24)
+	binary.LittleEndian.PutUint16(extra[0:2], 22)
+	// KSDATAFORMAT_SUBTYPE_PCM starts with 1.
+	binary.LittleEndian.PutUint16(extra[8:10], 1)
+	r, err := wav.NewReader(bytes.NewReader(wavFile(0xfffe, 1, 44100, 8, extra, []byte{128})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := r.Format, (wav.Format{SampleRate: 44100, ChannelNum: 1, BytesPerSample: 1}); got != want {
+		t.Errorf("Format: got: %+v, want: %+v", got, want)
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	cases := [][]byte{
+		[]byte("not a wav file"),
+		// IEEE float
+		wavFile(3, 2, 44100, 32, nil, nil),
+		// 24 bits
+		wavFile(1, 2, 44100, 24, nil, nil),
+	}
+	for _, c := range cases {
+		if _, err := wav.NewReader(bytes.NewReader(c)); err == nil {
+			t.Errorf("NewReader must fail")
+		}
+	}
+}
+
+func TestLargeFormatChunk(t *testing.T) {
+	// The unknown fields of a large fmt chunk are skipped.
+	data := []byte{1, 2, 3, 4}
+	r, err := wav.NewReader(bytes.NewReader(wavFile(1, 1, 8000, 16, make([]byte, 100), data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("data: got: %v, want: %v", got, data)
+	}
+
+	// A broken size must not make a huge allocation.
+	b := wavFile(1, 1, 8000, 16, nil, data)
+	i := bytes.Index(b, []byte("fmt "))
+	binary.LittleEndian.PutUint32(b[i+4:], 0xffffffff)
+	if _, err := wav.NewReader(bytes.NewReader(b)); err == nil {
+		t.Errorf("NewReader must fail")
+	}
+}
+
+func TestWriter(t *testing.T) {
+	f, err := ioutil.TempFile("", "wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	format := wav.Format{SampleRate: 22050, ChannelNum: 1, BytesPerSample: 2}
+	w, err := wav.NewWriter(f, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte{1, 2, 3, 4, 5, 6}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	r, err := wav.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Format != format {
+		t.Errorf("Format: got: %+v, want: %+v", r.Format, format)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("data: got: %v, want: %v", got, data)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2019 The Oto Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wav
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Writer writes PCM samples into a WAV file. Writer implements io.WriteCloser.
+//
+// The sizes in the header are written at Close, so the underlying file must be seekable.
+type Writer struct {
+	w      io.WriteSeeker
+	format Format
+	length int64
+	err    error
+}
+
+const headerSize = 44
+
+// NewWriter creates a Writer, and writes the header of a WAV file with the format. Close must be called
+// after all the samples are written.
+func NewWriter(w io.WriteSeeker, format Format) (*Writer, error) {
+	if format.BytesPerSample != 1 && format.BytesPerSample != 2 {
+		return nil, errors.New("wav: BytesPerSample must be 1 or 2")
+	}
+	wr := &Writer{
+		w:      w,
+		format: format,
+	}
+	if err := wr.writeHeader(); err != nil {
+		return nil, err
+	}
+	return wr, nil
+}
+
+func (w *Writer) writeHeader() error {
+	f := w.format
+	bpf := f.ChannelNum * f.BytesPerSample
+	var h [headerSize]byte
+	copy(h[0:4], "RIFF")
+	binary.LittleEndian.PutUint32(h[4:8], uint32(headerSize-8+w.length))
+	copy(h[8:12], "WAVE")
+	copy(h[12:16], "fmt ")
+	binary.LittleEndian.PutUint32(h[16:20], 16)
+	binary.LittleEndian.PutUint16(h[20:22], formatPCM)
+	binary.LittleEndian.PutUint16(h[22:24], uint16(f.ChannelNum))
+	binary.LittleEndian.PutUint32(h[24:28], uint32(f.SampleRate))
+	binary.LittleEndian.PutUint32(h[28:32], uint32(f.SampleRate*bpf))
+	binary.LittleEndian.PutUint16(h[32:34], uint16(bpf))
+	binary.LittleEndian.PutUint16(h[34:36], uint16(f.BytesPerSample*8))
+	copy(h[36:40], "data")
+	binary.LittleEndian.PutUint32(h[40:44], uint32(w.length))
+	_, err := w.w.Write(h[:])
+	return err
+}
+
+// Write writes PCM samples in the format.
+func (w *Writer) Write(buf []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, err := w.w.Write(buf)
+	w.length += int64(n)
+	if err != nil {
+		w.err = err
+	}
+	return n, err
+}
+
+// Close writes the sizes into the header. Close doesn't close the underlying file.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.length%2 == 1 {
+		// A chunk is padded to an even size.
+		if _, err := w.w.Write([]byte{0}); err != nil {
+			return err
+		}
+	}
+	if _, err := w.w.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+	_, err := w.w.Seek(0, io.SeekEnd)
+	return err
+}